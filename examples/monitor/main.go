@@ -64,8 +64,8 @@ func main() {
 	// 显示被监控的进程
 	fmt.Printf("\nMonitored Processes:\n")
 	monitored := pm.GetMonitoredProcesses()
-	for pid, name := range monitored {
-		fmt.Printf("  PID: %d, Name: %s\n", pid, name)
+	for pid, process := range monitored {
+		fmt.Printf("  PID: %d, Name: %s, First seen: %s\n", pid, process.Name, process.FirstSeen.Format(time.RFC3339))
 	}
 
 	// 监控循环
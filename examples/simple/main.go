@@ -85,8 +85,9 @@ func main() {
 	// Display updated process list
 	fmt.Println("\nUpdated processes:")
 	for _, process := range pm.ListProcesses() {
-		fmt.Printf("  UUID: %s, Name: %s, PID: %d, Status: %s, Restart Count: %d\n",
-			process.UUID, process.Name, process.PID, process.Status(), process.RestartCount)
+		fmt.Printf("  UUID: %s, Name: %s, PID: %d, Status: %s, Restart Count: %d, Last Exit Code: %d, Last Error: %q\n",
+			process.UUID, process.Name, process.PID, process.Status(), process.RestartCount,
+			process.LastExitCode, process.LastError)
 	}
 
 	// Interactive management demo
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+)
+
+// listenFdsStart 第一个继承的文件描述符
+const listenFdsStart = 3
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "child" {
+		runChild()
+		return
+	}
+
+	// 父进程持有监听套接字，重启子进程时端口不会关闭
+	listener, err := net.Listen("tcp", ":8080")
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	file, err := manager.ListenerFile(listener)
+	if err != nil {
+		log.Fatalf("Failed to get listener file: %v", err)
+	}
+	defer file.Close()
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to locate executable: %v", err)
+	}
+
+	uuid, err := pm.StartProcessWithListeners(self, []string{"child"}, true, []*os.File{file})
+	if err != nil {
+		log.Fatalf("Failed to start child: %v", err)
+	}
+
+	fmt.Println("Socket activation demo running on :8080")
+	fmt.Println("The child is restarted every 10 seconds; the port stays open")
+
+	for {
+		time.Sleep(10 * time.Second)
+		uuid, err = pm.RestartProcess(uuid)
+		if err != nil {
+			log.Fatalf("Failed to restart child: %v", err)
+		}
+	}
+}
+
+// runChild 从继承的文件描述符读取监听套接字并提供服务
+func runChild() {
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		log.Fatalf("No inherited listeners (LISTEN_FDS=%q)", os.Getenv("LISTEN_FDS"))
+	}
+
+	file := os.NewFile(uintptr(listenFdsStart), "listener")
+	listener, err := net.FileListener(file)
+	if err != nil {
+		log.Fatalf("Failed to use inherited listener: %v", err)
+	}
+	file.Close()
+
+	pid := os.Getpid()
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Hello from child PID %d\n", pid)
+	})
+
+	log.Fatal(http.Serve(listener, nil))
+}
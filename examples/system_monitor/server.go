@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dreamsxin/process-manager/system"
 	"github.com/dreamsxin/process-manager/types"
@@ -28,8 +30,10 @@ func main() {
 	http.HandleFunc("/api/stats/current", handleCurrentStats)
 	http.HandleFunc("/api/stats/history", handleHistory)
 	http.HandleFunc("/api/stats/chart", handleChartData)
+	http.HandleFunc("/api/stats/series", handleSeries)
 	http.HandleFunc("/api/alerts", handleAlerts)
 	http.HandleFunc("/api/config", handleConfig)
+	http.HandleFunc("/api/schedule", handleSchedule)
 
 	fmt.Println("System Monitor Server running on :8080")
 	fmt.Println("Open http://localhost:8080 in your browser")
@@ -124,6 +128,38 @@ func handleChartData(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleAlerts 返回告警信息
+// handleSeries 返回与前端无关的时间序列，metrics为逗号分隔的指标名
+func handleSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metrics := []string{"cpu", "memory", "disk"}
+	if metricsStr := r.URL.Query().Get("metrics"); metricsStr != "" {
+		metrics = strings.Split(metricsStr, ",")
+	}
+
+	count := 50 // 默认50条
+	if countStr := r.URL.Query().Get("count"); countStr != "" {
+		var err error
+		count, err = strconv.Atoi(countStr)
+		if err != nil {
+			http.Error(w, "Invalid count parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	series, err := systemMonitor.GetSeries(count, metrics)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
 func handleAlerts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -135,6 +171,25 @@ func handleAlerts(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(alerts)
 }
 
+// handleSchedule 返回采集间隔和下一次采集时间，便于前端显示倒计时
+func handleSchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := struct {
+		Interval       time.Duration `json:"interval"`
+		NextCollection time.Time     `json:"next_collection"`
+	}{
+		Interval:       systemMonitor.GetInterval(),
+		NextCollection: systemMonitor.NextCollection(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // handleConfig 处理配置请求
 func handleConfig(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/dreamsxin/process-manager/manager"
 )
@@ -20,6 +21,7 @@ func main() {
 	http.HandleFunc("/process/start", startProcess)
 	http.HandleFunc("/process/stop", stopProcess)
 	http.HandleFunc("/process/restart", restartProcess)
+	http.HandleFunc("/process/output", processOutput)
 
 	fmt.Println("Process Manager API server running on :8080")
 	fmt.Println("Endpoints:")
@@ -27,6 +29,7 @@ func main() {
 	fmt.Println("  POST /process/start - Start a new process")
 	fmt.Println("  POST /process/stop - Stop a process")
 	fmt.Println("  POST /process/restart - Restart a process")
+	fmt.Println("  GET  /process/output?uuid=...&lines=N[&raw=1] - Recent output of a process started with stdio")
 
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
@@ -37,7 +40,7 @@ func listProcesses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	processes := pm.ListProcesses()
+	processes := pm.Snapshot()
 	json.NewEncoder(w).Encode(processes)
 }
 
@@ -51,6 +54,7 @@ func startProcess(w http.ResponseWriter, r *http.Request) {
 		Name    string   `json:"name"`
 		Args    []string `json:"args"`
 		Restart bool     `json:"restart"`
+		Stdio   bool     `json:"stdio"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -58,7 +62,11 @@ func startProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uuid, err := pm.StartProcess(request.Name, request.Args, request.Restart)
+	start := pm.StartProcess
+	if request.Stdio {
+		start = pm.StartProcessWithStdio
+	}
+	uuid, err := start(request.Name, request.Args, request.Restart)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -115,3 +123,34 @@ func restartProcess(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{"new_uuid": newUUID}
 	json.NewEncoder(w).Encode(response)
 }
+
+func processOutput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uuid := r.URL.Query().Get("uuid")
+	lines, _ := strconv.Atoi(r.URL.Query().Get("lines"))
+
+	// Raw output is passed through unchanged, whatever its encoding
+	if r.URL.Query().Get("raw") == "1" {
+		raw, err := pm.ProcessOutputRaw(uuid, lines)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		for _, line := range raw {
+			w.Write(line)
+		}
+		return
+	}
+
+	output, err := pm.ProcessOutput(uuid, lines)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"lines": output})
+}
@@ -2,4 +2,8 @@ module github.com/dreamsxin/process-manager
 
 go 1.24.0
 
-require github.com/google/uuid v1.3.0
+require (
+	github.com/google/uuid v1.3.0
+	go.uber.org/goleak v1.3.0
+	golang.org/x/text v0.32.0
+)
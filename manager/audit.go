@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"context"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// OnProcessAction registers fn to receive an audit record after every
+// start, stop, restart or kill made through the public API, including failed
+// ones; processes stopped by a resource budget are reported as stops. Crash
+// restarts, idle stops and file-watch reloads are not reported. Actions made
+// through the Context variants with a context from WithActor name the actor
+// in the record. fn runs synchronously on the goroutine performing the
+// action and must not block; nil removes the hook.
+func (pm *ProcessManager) OnProcessAction(fn func(types.AuditRecord)) {
+	pm.mu.Lock()
+	pm.auditHook = fn
+	pm.mu.Unlock()
+}
+
+// actorKey is the context key of the actor named by WithActor
+type actorKey struct{}
+
+// WithActor returns a copy of ctx that names actor, e.g. the authenticated
+// user of an API request, as the one performing the actions made with it
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor named by WithActor, or "" if there is none
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// audit stamps the record with the manager's clock and the actor of ctx and
+// passes it to the hook
+func (pm *ProcessManager) audit(ctx context.Context, record types.AuditRecord, err error) {
+	pm.mu.RLock()
+	hook := pm.auditHook
+	pm.mu.RUnlock()
+	if hook == nil {
+		return
+	}
+
+	record.Time = pm.clock.Now()
+	record.Actor = ActorFromContext(ctx)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	hook(record)
+}
+
+// auditStart records a start attempt; uuid is empty when it failed
+func (pm *ProcessManager) auditStart(ctx context.Context, name string, args []string, command, uuid string, err error) {
+	pm.audit(ctx, types.AuditRecord{
+		Action:  types.AuditStart,
+		UUID:    uuid,
+		Name:    name,
+		Args:    append([]string(nil), args...),
+		Command: command,
+	}, err)
+}
+
+// auditProcess records an action on an existing process. processInfo is nil
+// when no process with the UUID was found.
+func (pm *ProcessManager) auditProcess(ctx context.Context, action types.AuditAction, uuid string, processInfo *types.ProcessInfo, newUUID string, err error) {
+	record := types.AuditRecord{Action: action, UUID: uuid, NewUUID: newUUID}
+	if processInfo != nil {
+		pm.mu.RLock()
+		snapshot := processInfo.Snapshot()
+		pm.mu.RUnlock()
+
+		record.Name = snapshot.Name
+		record.Args = snapshot.Args
+		record.Command = snapshot.Command
+		record.Labels = snapshot.Labels
+	}
+	pm.audit(ctx, record, err)
+}
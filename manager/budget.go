@@ -0,0 +1,174 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// SetResourceBudget 设置所有托管进程的资源总预算并启动后台检查，
+// 替换之前的预算。超出预算时按Priority从低到高选择进程(同优先级先选占用高的)，
+// 直到剩余进程的用量回到预算以内，再按Policy处理
+func (pm *ProcessManagerWithMonitor) SetResourceBudget(budget types.ResourceBudget) error {
+	if budget.CPUPercent < 0 {
+		return fmt.Errorf("CPU budget must not be negative")
+	}
+	if budget.CPUPercent == 0 && budget.MemoryBytes == 0 {
+		return fmt.Errorf("budget must limit CPU or memory")
+	}
+	if budget.Interval < 0 {
+		return fmt.Errorf("budget interval must not be negative")
+	}
+	switch budget.Policy {
+	case types.BudgetPolicyLog, types.BudgetPolicyStop, types.BudgetPolicyNice:
+	default:
+		return fmt.Errorf("unknown budget policy %q", budget.Policy)
+	}
+
+	interval := budget.Interval
+	if interval == 0 {
+		interval = pm.monitorManager.GetInterval()
+	}
+
+	pm.ClearResourceBudget()
+
+	stop := make(chan struct{})
+	pm.mu.Lock()
+	pm.budget = &budget
+	pm.budgetStop = stop
+	pm.mu.Unlock()
+
+	pm.loops.Add(1)
+	pm.goTracked(func() { pm.budgetLoop(interval, stop) })
+	return nil
+}
+
+// GetResourceBudget 获取当前的资源预算
+func (pm *ProcessManagerWithMonitor) GetResourceBudget() (types.ResourceBudget, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	if pm.budget == nil {
+		return types.ResourceBudget{}, false
+	}
+	return *pm.budget, true
+}
+
+// ClearResourceBudget 取消资源预算并停止后台检查
+func (pm *ProcessManagerWithMonitor) ClearResourceBudget() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.budgetStop != nil {
+		close(pm.budgetStop)
+		pm.budgetStop = nil
+	}
+	pm.budget = nil
+}
+
+// EnforceBudget 立即检查一次资源预算，返回被处理的进程UUID
+func (pm *ProcessManagerWithMonitor) EnforceBudget() ([]string, error) {
+	budget, exists := pm.GetResourceBudget()
+	if !exists {
+		return nil, fmt.Errorf("no resource budget set")
+	}
+
+	stats, err := pm.monitorManager.GetAllStats()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[int]types.ProcessStats, len(stats))
+	for _, s := range stats {
+		usage[s.PID] = s
+	}
+
+	// 只统计正在运行的托管进程
+	type candidate struct {
+		info  types.ProcessSnapshot
+		stats types.ProcessStats
+	}
+	var candidates []candidate
+	var totalCPU float64
+	var totalMemory uint64
+	for _, info := range pm.Snapshot() {
+		s, monitored := usage[info.PID]
+		if !info.Running || !monitored {
+			continue
+		}
+		candidates = append(candidates, candidate{info: info, stats: s})
+		totalCPU += s.CPUPercent
+		totalMemory += s.MemoryBytes
+	}
+
+	overBudget := func() bool {
+		return (budget.CPUPercent > 0 && totalCPU > budget.CPUPercent) ||
+			(budget.MemoryBytes > 0 && totalMemory > budget.MemoryBytes)
+	}
+	if !overBudget() {
+		return nil, nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].info.Priority != candidates[j].info.Priority {
+			return candidates[i].info.Priority < candidates[j].info.Priority
+		}
+		if candidates[i].stats.MemoryBytes != candidates[j].stats.MemoryBytes {
+			return candidates[i].stats.MemoryBytes > candidates[j].stats.MemoryBytes
+		}
+		return candidates[i].stats.CPUPercent > candidates[j].stats.CPUPercent
+	})
+
+	fmt.Printf("Resource budget exceeded: CPU %.1f%% (budget %.1f%%), memory %d bytes (budget %d bytes)\n",
+		totalCPU, budget.CPUPercent, totalMemory, budget.MemoryBytes)
+
+	var victims []string
+	for _, c := range candidates {
+		if !overBudget() {
+			break
+		}
+		totalCPU -= c.stats.CPUPercent
+		totalMemory -= c.stats.MemoryBytes
+
+		switch budget.Policy {
+		case types.BudgetPolicyStop:
+			if err := pm.StopProcess(c.info.UUID); err != nil {
+				pm.event(types.EventError, c.info.UUID, c.info.Name, "Failed to stop process %s over budget: %v", c.info.Name, err)
+				continue
+			}
+		case types.BudgetPolicyNice:
+			if err := pm.lowerPriorityPlatform(c.info.PID); err != nil {
+				pm.event(types.EventError, c.info.UUID, c.info.Name, "Failed to lower priority of process %s over budget: %v", c.info.Name, err)
+				continue
+			}
+		default:
+			fmt.Printf("Process %s (UUID: %s, priority %d) would be acted on to meet the budget\n",
+				c.info.Name, c.info.UUID, c.info.Priority)
+		}
+		victims = append(victims, c.info.UUID)
+	}
+
+	return victims, nil
+}
+
+// budgetLoop 按间隔检查资源预算，直到stop被关闭
+func (pm *ProcessManagerWithMonitor) budgetLoop(interval time.Duration, stop chan struct{}) {
+	defer pm.loops.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-pm.shutdown:
+			return
+		case <-ticker.C:
+			if _, err := pm.EnforceBudget(); err != nil {
+				fmt.Printf("Failed to enforce resource budget: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// DefaultSensitiveEnvPatterns are the environment keys redacted by default
+var DefaultSensitiveEnvPatterns = []string{"*SECRET*", "*PASSWORD*", "*PASSWD*", "*TOKEN*", "*API_KEY*", "*PRIVATE_KEY*", "*CREDENTIAL*"}
+
+// ErrEnvironUnavailable is returned when the live environment of a process
+// cannot be read on this platform
+var ErrEnvironUnavailable = errors.New("live process environment is not available")
+
+// redactedValue replaces the value of sensitive environment variables
+const redactedValue = "[REDACTED]"
+
+// SetSensitiveEnvPatterns replaces the glob patterns (see path.Match) of
+// environment keys whose values GetProcessEnviron and GetLiveProcessEnviron
+// redact. Keys are matched case-insensitively. No patterns disables redaction.
+func (pm *ProcessManager) SetSensitiveEnvPatterns(patterns ...string) error {
+	upper := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		upper[i] = strings.ToUpper(pattern)
+	}
+
+	pm.mu.Lock()
+	pm.sensitiveEnv = upper
+	pm.mu.Unlock()
+	return nil
+}
+
+// GetProcessEnviron returns the environment a process was started with, in
+// KEY=value form, with sensitive values redacted
+func (pm *ProcessManager) GetProcessEnviron(uuid string) ([]string, error) {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	env := value.(*types.ProcessInfo).Env
+	if env == nil {
+		return nil, fmt.Errorf("environment of process %s is unknown", uuid)
+	}
+	return redactEnv(env, pm.sensitiveEnv), nil
+}
+
+// GetLiveProcessEnviron reads the environment of a running process from the
+// operating system, with sensitive values redacted. Only Linux exposes it
+// (through /proc/<pid>/environ); elsewhere ErrEnvironUnavailable is returned.
+// The live environment reflects the process's start, not later setenv calls.
+func (pm *ProcessManager) GetLiveProcessEnviron(uuid string) ([]string, error) {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	pm.mu.RLock()
+	pid := value.(*types.ProcessInfo).PID
+	running := value.(*types.ProcessInfo).Running
+	patterns := pm.sensitiveEnv
+	pm.mu.RUnlock()
+
+	if !running {
+		return nil, fmt.Errorf("%w: %s", ErrProcessExited, uuid)
+	}
+
+	env, err := readEnvironPlatform(pid)
+	if err != nil {
+		return nil, err
+	}
+	return redactEnv(env, patterns), nil
+}
+
+// redactEnv returns a copy of env with the values of keys matching any of the
+// upper-cased patterns replaced
+func redactEnv(env []string, patterns []string) []string {
+	result := make([]string, len(env))
+	for i, entry := range env {
+		result[i] = entry
+
+		key, _, found := strings.Cut(entry, "=")
+		if !found {
+			continue
+		}
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, strings.ToUpper(key)); matched {
+				result[i] = key + "=" + redactedValue
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+const (
+	// DefaultEventLogSize is how many events RecentEvents keeps by default
+	DefaultEventLogSize = 256
+	// DefaultEventBuffer is the channel buffer of an event subscription
+	DefaultEventBuffer = 64
+	// DefaultEventBatchWindow is how long SubscribeEventBatches collects
+	// events before delivering them
+	DefaultEventBatchWindow = 100 * time.Millisecond
+)
+
+// SetEventLogSize sets how many of the most recent events the manager keeps
+// for RecentEvents, dropping the oldest ones beyond the new size. Zero
+// disables the event log.
+func (pm *ProcessManager) SetEventLogSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("event log size must not be negative")
+	}
+
+	pm.eventsMu.Lock()
+	pm.eventLogSize = size
+	if len(pm.events) > size {
+		pm.events = append([]types.Event(nil), pm.events[len(pm.events)-size:]...)
+	}
+	pm.eventsMu.Unlock()
+	return nil
+}
+
+// RecentEvents returns up to the last n lifecycle events (starts, exits,
+// restarts, reloads, stops, kills, failed health checks and errors), oldest
+// first; n <= 0 returns the whole log. Unlike OnProcessAction it includes
+// events the manager initiates itself, such as crash restarts and idle stops.
+func (pm *ProcessManager) RecentEvents(n int) []types.Event {
+	pm.eventsMu.Lock()
+	defer pm.eventsMu.Unlock()
+
+	if n <= 0 || n > len(pm.events) {
+		n = len(pm.events)
+	}
+	return append([]types.Event(nil), pm.events[len(pm.events)-n:]...)
+}
+
+// SubscribeEvents returns a channel receiving every lifecycle event recorded
+// from now on, in the order RecentEvents lists them, and a function that ends
+// the subscription and closes the channel. buffer <= 0 uses
+// DefaultEventBuffer. Events are never waited for: when the buffer is full
+// the event is dropped for this subscriber, so keep receiving or cancel.
+func (pm *ProcessManager) SubscribeEvents(buffer int) (<-chan types.Event, func()) {
+	events := pm.subscribe(buffer)
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			pm.unsubscribe(events)
+			close(events)
+		})
+	}
+}
+
+// SubscribeEventBatches is like SubscribeEvents but coalesces events: the
+// first event after a delivery opens a window of the given length, and all
+// events recorded until it ends are delivered together as one slice. Events
+// within a batch and across batches keep the order in which they were
+// recorded, and no batch is empty. window <= 0 uses DefaultEventBatchWindow
+// and buffer <= 0 uses DefaultEventBuffer, which bounds the events that can
+// queue up while a batch waits to be received; further events are dropped.
+// The channel is closed when the subscription is cancelled or the manager
+// shuts down, discarding a batch that is still being collected.
+func (pm *ProcessManager) SubscribeEventBatches(window time.Duration, buffer int) (<-chan []types.Event, func()) {
+	if window <= 0 {
+		window = DefaultEventBatchWindow
+	}
+	events := pm.subscribe(buffer)
+	batches := make(chan []types.Event)
+	done := make(chan struct{})
+
+	pm.loops.Add(1)
+	pm.goTracked(func() {
+		defer pm.unsubscribe(events)
+		pm.batchEvents(events, batches, window, done)
+	})
+
+	var once sync.Once
+	return batches, func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// batchEvents delivers the events of a subscription in batches until done is
+// closed or the manager shuts down
+func (pm *ProcessManager) batchEvents(events <-chan types.Event, batches chan<- []types.Event, window time.Duration, done <-chan struct{}) {
+	defer pm.loops.Done()
+	defer close(batches)
+
+	var batch []types.Event
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-pm.shutdown:
+			return
+		case event := <-events:
+			if batch == nil {
+				flush = time.After(window)
+			}
+			batch = append(batch, event)
+		case <-flush:
+			select {
+			case batches <- batch:
+			case <-done:
+				return
+			case <-pm.shutdown:
+				return
+			}
+			batch, flush = nil, nil
+		}
+	}
+}
+
+// subscribe registers a new subscriber channel
+func (pm *ProcessManager) subscribe(buffer int) chan types.Event {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	events := make(chan types.Event, buffer)
+
+	pm.eventsMu.Lock()
+	if pm.subscribers == nil {
+		pm.subscribers = make(map[chan types.Event]struct{})
+	}
+	pm.subscribers[events] = struct{}{}
+	pm.eventsMu.Unlock()
+	return events
+}
+
+// unsubscribe stops delivering events to a subscriber channel
+func (pm *ProcessManager) unsubscribe(events chan types.Event) {
+	pm.eventsMu.Lock()
+	delete(pm.subscribers, events)
+	pm.eventsMu.Unlock()
+}
+
+// event prints a lifecycle message and appends it to the event log
+func (pm *ProcessManager) event(eventType types.EventType, uuid, name, format string, args ...interface{}) {
+	pm.recordEvent(types.Event{
+		Type:    eventType,
+		UUID:    uuid,
+		Name:    name,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// recordEvent stamps the event with the current time, prints its message,
+// passes it to the subscribers and appends it to the event log. Holding
+// eventsMu while delivering keeps subscribers in log order.
+func (pm *ProcessManager) recordEvent(event types.Event) {
+	fmt.Println(event.Message)
+	event.Time = pm.clock.Now()
+
+	pm.eventsMu.Lock()
+	defer pm.eventsMu.Unlock()
+	for events := range pm.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+	if pm.eventLogSize == 0 {
+		return
+	}
+	if len(pm.events) >= pm.eventLogSize {
+		pm.events = pm.events[1:]
+	}
+	pm.events = append(pm.events, event)
+}
+
+// exitReason describes why a run ended, for restart events
+func exitReason(exitCode int, err error) string {
+	if exitCode < 0 && err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("exit code %d", exitCode)
+}
@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// ForgetProcess drops the record of a process the manager cannot get rid of,
+// e.g. one that survives SIGKILL in uninterruptible sleep, so that its
+// monitor no longer holds up Shutdown. The process is killed one last time
+// and auto-restart is disabled, but the record is removed whether or not it
+// exits. This is a last resort: the OS process may keep running, unmanaged
+// and without its stdio drained. A forget event is recorded.
+func (pm *ProcessManager) ForgetProcess(uuid string) error {
+	return pm.ForgetProcessContext(context.Background(), uuid)
+}
+
+// ForgetProcessContext is like ForgetProcess but names the actor of ctx, see
+// WithActor, in the audit record
+func (pm *ProcessManager) ForgetProcessContext(ctx context.Context, uuid string) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		err := fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+		pm.auditProcess(ctx, types.AuditForget, uuid, nil, "", err)
+		return err
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.Restart = false
+	process := processInfo.Process
+	running := processInfo.Running
+	pid := processInfo.PID
+	pm.mu.Unlock()
+
+	outcome := "not running"
+	if running {
+		outcome = "killed"
+		if err := process.Kill(); err != nil {
+			outcome = fmt.Sprintf("kill failed: %v", err)
+		}
+	}
+
+	// The monitor may still be blocked in Wait; it leaves the record alone
+	// once it is no longer tracked
+	pm.releaseMonitor(process)
+	pm.notifyRunEnded(uuid, pid)
+	pm.closeStdio(uuid, process)
+	pm.closeLog(uuid, process)
+	pm.clearPIDFile(processInfo)
+	pm.processes.Delete(uuid)
+
+	pm.auditProcess(ctx, types.AuditForget, uuid, processInfo, "", nil)
+	pm.event(types.EventForget, uuid, processInfo.Name, "Forgot process: %s (UUID: %s, PID: %d), %s",
+		processInfo.Name, uuid, pid, outcome)
+	return nil
+}
+
+// runExit signals the exit of a run to WaitForProcess and WaitForExit
+type runExit struct {
+	done chan struct{} // closed by the monitor once the run's Wait returned
+	err  error         // result of Wait, set before done is closed
+}
+
+// trackMonitor counts the monitor goroutine of a run in pm.wg and registers
+// the exit signal the monitor closes when the run exits
+func (pm *ProcessManager) trackMonitor(process types.Process) {
+	pm.wg.Add(1)
+	pm.monitors.Store(process, struct{}{})
+	pm.exits.Store(process, &runExit{done: make(chan struct{})})
+}
+
+// releaseMonitor stops counting the monitor of a run, once: either when the
+// monitor returns or when ForgetProcess gives up on the run
+func (pm *ProcessManager) releaseMonitor(process types.Process) {
+	if _, tracked := pm.monitors.LoadAndDelete(process); tracked {
+		pm.wg.Done()
+	}
+}
@@ -0,0 +1,291 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// ErrGroupNotFound is returned when no group has the given name
+var ErrGroupNotFound = errors.New("group not found")
+
+// CreateGroup creates an empty process group. Groups bundle processes that
+// are started, stopped and restarted together, e.g. a "staging" stack.
+func (pm *ProcessManager) CreateGroup(name string) error {
+	if name == "" {
+		return fmt.Errorf("group name must not be empty")
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if _, exists := pm.groups[name]; exists {
+		return fmt.Errorf("group %s already exists", name)
+	}
+	pm.groups[name] = nil
+	return nil
+}
+
+// DeleteGroup removes a group; its processes are left untouched
+func (pm *ProcessManager) DeleteGroup(name string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if _, exists := pm.groups[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+	delete(pm.groups, name)
+	return nil
+}
+
+// AddToGroup adds a process to a group. A process may belong to several
+// groups; membership follows the process across restarts.
+func (pm *ProcessManager) AddToGroup(groupName, uuid string) error {
+	if _, exists := pm.processes.Load(uuid); !exists {
+		return fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	members, exists := pm.groups[groupName]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, groupName)
+	}
+	for _, member := range members {
+		if member == uuid {
+			return nil
+		}
+	}
+	pm.groups[groupName] = append(members, uuid)
+	return nil
+}
+
+// RemoveFromGroup removes a process from a group
+func (pm *ProcessManager) RemoveFromGroup(groupName, uuid string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	members, exists := pm.groups[groupName]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, groupName)
+	}
+	for i, member := range members {
+		if member == uuid {
+			pm.groups[groupName] = append(members[:i:i], members[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("process %s is not in group %s", uuid, groupName)
+}
+
+// GroupMembers returns the UUIDs of the processes in a group. Members whose
+// records no longer exist are dropped from the group.
+func (pm *ProcessManager) GroupMembers(name string) ([]string, error) {
+	members, err := pm.groupProcesses(name)
+	if err != nil {
+		return nil, err
+	}
+
+	uuids := make([]string, len(members))
+	for i, processInfo := range members {
+		uuids[i] = processInfo.UUID
+	}
+	return uuids, nil
+}
+
+// groupProcesses returns the records of a group's members, pruning members
+// that were stopped for good or swept
+func (pm *ProcessManager) groupProcesses(name string) ([]*types.ProcessInfo, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	members, exists := pm.groups[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+
+	var live []string
+	var processes []*types.ProcessInfo
+	for _, uuid := range members {
+		if value, exists := pm.processes.Load(uuid); exists {
+			live = append(live, uuid)
+			processes = append(processes, value.(*types.ProcessInfo))
+		}
+	}
+	pm.groups[name] = live
+	return processes, nil
+}
+
+// replaceGroupMember points group memberships at a restarted process
+func (pm *ProcessManager) replaceGroupMember(oldUUID, newUUID string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for _, members := range pm.groups {
+		for i, member := range members {
+			if member == oldUUID {
+				members[i] = newUUID
+			}
+		}
+	}
+}
+
+// groupLevels orders a group's members for stopping: dependents before the
+// processes they depend on. Starting uses the reverse order.
+func (pm *ProcessManager) groupLevels(name string) ([][]*types.ProcessInfo, error) {
+	processes, err := pm.groupProcesses(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return stopLevels(processes), nil
+}
+
+// forEachConcurrently runs fn for every process of a level concurrently, one
+// level after the other, and joins the errors
+func forEachConcurrently(levels [][]*types.ProcessInfo, fn func(*types.ProcessInfo) error) error {
+	var errs []error
+	var mu sync.Mutex
+
+	for _, level := range levels {
+		var wg sync.WaitGroup
+		for _, processInfo := range level {
+			wg.Add(1)
+			go func(processInfo *types.ProcessInfo) {
+				defer wg.Done()
+				if err := fn(processInfo); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s (%s): %w", processInfo.Name, processInfo.UUID, err))
+					mu.Unlock()
+				}
+			}(processInfo)
+		}
+		wg.Wait()
+	}
+	return errors.Join(errs...)
+}
+
+// StopGroup stops the running members of a group, dependents before their
+// dependencies and each level concurrently. The records are kept, so
+// StartGroup can bring the group back with the same UUIDs.
+func (pm *ProcessManager) StopGroup(name string) error {
+	levels, err := pm.groupLevels(name)
+	if err != nil {
+		return err
+	}
+
+	return forEachConcurrently(levels, func(processInfo *types.ProcessInfo) error {
+		pm.mu.Lock()
+		running := processInfo.Running
+		process := processInfo.Process
+		if running {
+			processInfo.Stopped = true
+		}
+		pm.mu.Unlock()
+		if !running {
+			return nil
+		}
+
+		err := process.Kill()
+		if err != nil {
+			err = fmt.Errorf("failed to stop process: %v", err)
+		}
+		pm.clearPIDFile(processInfo)
+		pm.auditProcess(context.Background(), types.AuditStop, processInfo.UUID, processInfo, "", err)
+		return err
+	})
+}
+
+// StartGroup starts the members of a group that are not running, such as
+// those stopped by StopGroup, dependencies before their dependents
+func (pm *ProcessManager) StartGroup(name string) error {
+	levels, err := pm.groupLevels(name)
+	if err != nil {
+		return err
+	}
+	reverseLevels(levels)
+
+	return forEachConcurrently(levels, func(processInfo *types.ProcessInfo) error {
+		pm.mu.RLock()
+		running := processInfo.Running
+		pm.mu.RUnlock()
+		if running {
+			return nil
+		}
+
+		err := pm.reloadProcess(processInfo.UUID, "group start")
+		pm.auditProcess(context.Background(), types.AuditStart, processInfo.UUID, processInfo, "", err)
+		return err
+	})
+}
+
+// RestartGroup restarts every member of a group in place, keeping their
+// UUIDs, dependencies before their dependents
+func (pm *ProcessManager) RestartGroup(name string) error {
+	levels, err := pm.groupLevels(name)
+	if err != nil {
+		return err
+	}
+	reverseLevels(levels)
+
+	return forEachConcurrently(levels, func(processInfo *types.ProcessInfo) error {
+		err := pm.reloadProcess(processInfo.UUID, "group restart")
+		pm.auditProcess(context.Background(), types.AuditRestart, processInfo.UUID, processInfo, processInfo.UUID, err)
+		return err
+	})
+}
+
+// RollingRestartGroup restarts the members of a group in place, at most
+// maxUnavailable at a time. Each batch must pass its readiness checks within
+// readinessTimeout before the next batch is restarted; if it does not, the
+// rollout stops and the error lists the members that failed. Members are
+// taken in start order, dependencies first.
+func (pm *ProcessManager) RollingRestartGroup(groupName string, maxUnavailable int, readinessTimeout time.Duration) error {
+	if maxUnavailable < 1 {
+		return fmt.Errorf("maxUnavailable must be at least 1, got %d", maxUnavailable)
+	}
+
+	levels, err := pm.groupLevels(groupName)
+	if err != nil {
+		return err
+	}
+	reverseLevels(levels)
+
+	var members []*types.ProcessInfo
+	for _, level := range levels {
+		members = append(members, level...)
+	}
+
+	for start := 0; start < len(members); start += maxUnavailable {
+		end := min(start+maxUnavailable, len(members))
+		batch := [][]*types.ProcessInfo{members[start:end]}
+
+		err := forEachConcurrently(batch, func(processInfo *types.ProcessInfo) error {
+			err := pm.reloadProcess(processInfo.UUID, "rolling restart")
+			pm.auditProcess(context.Background(), types.AuditRestart, processInfo.UUID, processInfo, processInfo.UUID, err)
+			if err != nil {
+				return err
+			}
+			return pm.WaitReady(processInfo.UUID, readinessTimeout)
+		})
+		if err != nil {
+			return fmt.Errorf("rolling restart of group %s aborted after %d of %d members: %w",
+				groupName, start, len(members), err)
+		}
+	}
+	return nil
+}
+
+// reverseLevels reverses the order of levels in place
+func reverseLevels(levels [][]*types.ProcessInfo) {
+	for i, j := 0, len(levels)-1; i < j; i, j = i+1, j-1 {
+		levels[i], levels[j] = levels[j], levels[i]
+	}
+}
@@ -0,0 +1,175 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+const (
+	defaultHealthInterval         = 10 * time.Second
+	defaultHealthFailureThreshold = 3
+)
+
+// healthChecker runs the health check of one process
+type healthChecker struct {
+	stop chan struct{}
+}
+
+// SetHealthCheck checks the process every check.Interval while it is running.
+// After check.FailureThreshold consecutive failures an EventUnhealthy is
+// logged and, with RestartOnUnhealthy, the process is restarted in place. A
+// process that exits is left to its exit-based restart policy, so one that
+// exits cleanly without Restart stays down. The check is kept across
+// restarts; calling SetHealthCheck again replaces it.
+func (pm *ProcessManager) SetHealthCheck(uuid string, check types.HealthCheck) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+	if check.Check == nil {
+		return fmt.Errorf("health check function is required")
+	}
+	if check.Interval <= 0 {
+		check.Interval = defaultHealthInterval
+	}
+	if check.FailureThreshold <= 0 {
+		check.FailureThreshold = defaultHealthFailureThreshold
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.Health = &check
+	pm.mu.Unlock()
+
+	pm.startHealthCheck(uuid, check)
+	return nil
+}
+
+// RemoveHealthCheck stops health checking the process
+func (pm *ProcessManager) RemoveHealthCheck(uuid string) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.Health = nil
+	pm.mu.Unlock()
+
+	if previous, loaded := pm.healthChecks.LoadAndDelete(uuid); loaded {
+		close(previous.(*healthChecker).stop)
+	}
+	return nil
+}
+
+// startHealthCheck starts the health check loop, replacing any previous one
+func (pm *ProcessManager) startHealthCheck(uuid string, check types.HealthCheck) {
+	h := &healthChecker{stop: make(chan struct{})}
+	if previous, loaded := pm.healthChecks.Swap(uuid, h); loaded {
+		close(previous.(*healthChecker).stop)
+	}
+
+	pm.loops.Add(1)
+	pm.goTracked(func() { pm.healthLoop(uuid, h, check) })
+}
+
+// healthLoop runs the check until it is replaced or removed, or the process
+// is no longer managed
+func (pm *ProcessManager) healthLoop(uuid string, h *healthChecker, check types.HealthCheck) {
+	defer pm.loops.Done()
+	ticker := time.NewTicker(check.Interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-pm.shutdown:
+			return
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+
+		value, exists := pm.processes.Load(uuid)
+		if !exists {
+			pm.healthChecks.CompareAndDelete(uuid, h)
+			return
+		}
+
+		processInfo := value.(*types.ProcessInfo)
+		pm.mu.RLock()
+		snapshot := processInfo.Snapshot()
+		pm.mu.RUnlock()
+
+		// Exits are handled by the exit-based restart policy
+		if !snapshot.Running {
+			failures = 0
+			continue
+		}
+
+		err := check.Check(snapshot)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if failures++; failures < check.FailureThreshold {
+			continue
+		}
+		failures = 0
+
+		pm.event(types.EventUnhealthy, uuid, snapshot.Name, "Process %s (UUID: %s) is unhealthy after %d failed checks: %v",
+			snapshot.Name, uuid, check.FailureThreshold, err)
+		if check.RestartOnUnhealthy {
+			pm.restartUnhealthy(uuid, snapshot.PID, fmt.Sprintf("health check failed: %v", err))
+		}
+	}
+}
+
+// restartUnhealthy reloads the process unless the unhealthy run already
+// exited, so a health restart never doubles an exit-based restart. It holds
+// off StopAll like an auto-restart and counts towards the restart count used
+// by SetStableDuration. Health restarts share the restart budget with
+// auto-restarts; one the budget does not allow is skipped with a held event,
+// and the next run of failed checks tries again.
+func (pm *ProcessManager) restartUnhealthy(uuid string, pid int, reason string) {
+	pm.restartMu.RLock()
+	defer pm.restartMu.RUnlock()
+
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return
+	}
+	processInfo := value.(*types.ProcessInfo)
+
+	now := pm.clock.Now()
+	pm.mu.Lock()
+	if !processInfo.Running || processInfo.PID != pid {
+		pm.mu.Unlock()
+		return
+	}
+	name := processInfo.Name
+	window := processInfo.Budget.Window
+	allowed, times := takeRestartBudget(processInfo, now)
+	pm.mu.Unlock()
+
+	if !allowed {
+		resume := times[0].Add(window)
+		pm.recordEvent(types.Event{
+			Type:   types.EventHeld,
+			UUID:   uuid,
+			Name:   name,
+			Reason: "restart budget exhausted",
+			Delay:  resume.Sub(now),
+			Message: fmt.Sprintf("Skipped health restart of process %s (UUID: %s) until %v: %d restarts within %v",
+				name, uuid, resume.Format(time.RFC3339), len(times), window),
+		})
+		return
+	}
+
+	if err := pm.reloadProcess(uuid, reason); err != nil {
+		pm.event(types.EventError, uuid, name, "Failed to restart unhealthy process %s (UUID: %s): %v", name, uuid, err)
+	}
+}
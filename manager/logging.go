@@ -0,0 +1,207 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// logRedialInterval is how long forwarding waits before trying to reach an
+// unavailable log destination again; lines in between are dropped
+const logRedialInterval = time.Second
+
+// syslogSeverities maps severity names to RFC 5424 severity codes
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// syslogFacilities maps facility names to RFC 5424 facility codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// logSink writes single lines to a log destination
+type logSink interface {
+	Log(severity int, line string) error
+	Close() error
+}
+
+// outputProcess is implemented by processes whose stdout and stderr can be
+// redirected before they are started
+type outputProcess interface {
+	SetStdout(w io.Writer)
+	SetStderr(w io.Writer)
+}
+
+// StartProcessWithLog starts a new process whose stdout and stderr are
+// forwarded line by line to the host log as configured. Forwarding never
+// blocks the process: while the destination is unreachable lines are dropped
+// and the connection is retried.
+func (pm *ProcessManager) StartProcessWithLog(name string, args []string, restart bool, config types.LogConfig) (string, error) {
+	return pm.StartProcessWithOptions(types.StartOptions{
+		Name:   name,
+		Args:   args,
+		Policy: types.RestartPolicy{Restart: restart},
+		Log:    &config,
+	})
+}
+
+// parseLogConfig validates a log configuration and returns the facility and
+// the stdout and stderr severities
+func parseLogConfig(config types.LogConfig) (facility, stdout, stderr int, err error) {
+	if config.LogTo != types.LogToSyslog {
+		return 0, 0, 0, fmt.Errorf("unsupported log destination %q", config.LogTo)
+	}
+	if (config.Network == "") != (config.Address == "") {
+		return 0, 0, 0, fmt.Errorf("log network and address must be set together")
+	}
+
+	lookup := func(table map[string]int, kind, name, fallback string) (int, error) {
+		if name == "" {
+			name = fallback
+		}
+		code, exists := table[strings.ToLower(name)]
+		if !exists {
+			return 0, fmt.Errorf("unknown syslog %s %q", kind, name)
+		}
+		return code, nil
+	}
+
+	if facility, err = lookup(syslogFacilities, "facility", config.Facility, "user"); err != nil {
+		return 0, 0, 0, err
+	}
+	if stdout, err = lookup(syslogSeverities, "severity", config.StdoutSeverity, "info"); err != nil {
+		return 0, 0, 0, err
+	}
+	if stderr, err = lookup(syslogSeverities, "severity", config.StderrSeverity, "err"); err != nil {
+		return 0, 0, 0, err
+	}
+	return facility, stdout, stderr, nil
+}
+
+// processLog forwards the output of one run of a process to a log sink
+type processLog struct {
+	process types.Process
+	sink    logSink
+	stdout  *lineLogger
+	stderr  *lineLogger
+}
+
+// newProcessLog wires the stdout and stderr of a process that has not been
+// started yet to the configured log. Stdout is shared with the stdio stream
+// when the process also has one.
+func newProcessLog(process types.Process, name string, config types.LogConfig, streams *processStdio) (*processLog, error) {
+	op, ok := process.(outputProcess)
+	if !ok {
+		return nil, fmt.Errorf("process runner does not support log forwarding")
+	}
+
+	facility, stdoutSeverity, stderrSeverity, err := parseLogConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := config.Tag
+	if tag == "" {
+		tag = filepath.Base(name)
+	}
+	sink, err := newLogSink(config, facility, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := &processLog{
+		process: process,
+		sink:    sink,
+		stdout:  &lineLogger{sink: sink, severity: stdoutSeverity},
+		stderr:  &lineLogger{sink: sink, severity: stderrSeverity},
+	}
+
+	var stdout io.Writer = logs.stdout
+	if streams != nil {
+		stdout = io.MultiWriter(streams.stdout, logs.stdout)
+	}
+	op.SetStdout(stdout)
+	op.SetStderr(logs.stderr)
+	return logs, nil
+}
+
+// closeLog flushes and closes the log forwarding of a run once it has exited
+func (pm *ProcessManager) closeLog(uuid string, process types.Process) {
+	value, exists := pm.logs.Load(uuid)
+	if !exists {
+		return
+	}
+
+	logs := value.(*processLog)
+	if logs.process != process {
+		return
+	}
+
+	if pm.logs.CompareAndDelete(uuid, logs) {
+		logs.stdout.Flush()
+		logs.stderr.Flush()
+		logs.sink.Close()
+		pm.openPipes.Add(-1)
+	}
+}
+
+// lineLogger splits output into lines and logs each at a fixed severity
+type lineLogger struct {
+	mu       sync.Mutex
+	sink     logSink
+	severity int
+	partial  []byte
+}
+
+// Write logs every complete line; it always succeeds so the process never
+// sees an error from a log outage
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		l.log(l.partial[:i])
+		l.partial = l.partial[i+1:]
+	}
+	for len(l.partial) >= maxOutputLineLength {
+		l.log(l.partial[:maxOutputLineLength])
+		l.partial = l.partial[maxOutputLineLength:]
+	}
+	return len(p), nil
+}
+
+// Flush logs an unterminated last line
+func (l *lineLogger) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.partial) > 0 {
+		l.log(l.partial)
+		l.partial = nil
+	}
+}
+
+// log sends one line to the sink, dropping it when the sink is unavailable
+func (l *lineLogger) log(line []byte) {
+	text := strings.TrimRight(string(line), "\r")
+	if text == "" {
+		return
+	}
+	l.sink.Log(l.severity, text)
+}
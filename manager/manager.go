@@ -2,30 +2,208 @@ package manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net"
 	"os"
-	"os/exec"
 	"os/signal"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/dreamsxin/process-manager/types"
 	"github.com/dreamsxin/process-manager/util"
+	"golang.org/x/text/encoding"
 )
 
+// DefaultKillTimeout is how long Kill waits for a process to exit after the
+// graceful termination request before forcing it
+const DefaultKillTimeout = 100 * time.Millisecond
+
+// DefaultStopConcurrency is how many processes StopAll stops at once
+const DefaultStopConcurrency = 16
+
+// RestartDelay is how long an auto-restart waits after a process exits
+const RestartDelay = 2 * time.Second
+
+// DefaultRestartJitter is the default fraction of RestartDelay added at
+// random to each auto-restart delay, see SetRestartJitter
+const DefaultRestartJitter = 0.1
+
+// ErrProcessNotFound is returned when no managed process has the given UUID
+var ErrProcessNotFound = errors.New("process not found")
+
+// ErrDuplicateID is returned when a custom IDGenerator produces an id that
+// already belongs to a managed process
+var ErrDuplicateID = errors.New("duplicate process id")
+
+// ErrCommandNotAllowed is returned when a command is not on the allowlist
+// configured with WithAllowedCommands
+var ErrCommandNotAllowed = errors.New("command not allowed")
+
+// ErrNotManaged is returned when a manager created with
+// WithManagedMonitoringOnly is asked to monitor a PID it did not start
+var ErrNotManaged = errors.New("process not managed")
+
+// maxIDAttempts bounds how often the default generator is retried on a clash
+const maxIDAttempts = 3
+
 // ProcessManager manages multiple processes with UUID-based identification
 type ProcessManager struct {
-	processes sync.Map // key: UUID, value: *types.ProcessInfo
-	mu        sync.RWMutex
-	shutdown  chan struct{}
-	wg        sync.WaitGroup
+	processes      sync.Map // key: UUID, value: *types.ProcessInfo
+	runner         ProcessRunner
+	newID          IDGenerator
+	customID       bool
+	startingIDs    sync.Map        // key: UUID, value: struct{}; ids reserved by in-flight starts
+	allowed        map[string]bool // nil allows every command
+	selfCheck      bool            // run SelfCheck at construction
+	managedOnly    bool            // monitoring is restricted to PIDs the manager started
+	sensitiveEnv   []string        // glob patterns of environment keys to redact
+	auditHook      func(types.AuditRecord)
+	observer       runObserver // set by ProcessManagerWithMonitor, nil otherwise
+	eventsMu       sync.Mutex
+	events         []types.Event // most recent lifecycle events, oldest first
+	eventLogSize   int
+	subscribers    map[chan types.Event]struct{} // event subscriptions
+	groups         map[string][]string           // group name -> member UUIDs
+	clock          Clock
+	stableAfter    time.Duration
+	watchers       sync.Map // key: UUID, value: *watcher
+	healthChecks   sync.Map // key: UUID, value: *healthChecker
+	stdio          sync.Map // key: UUID, value: *processStdio
+	logs           sync.Map // key: UUID, value: *processLog
+	mu             sync.RWMutex
+	restartMu      sync.RWMutex // held by auto-restarts (read) and StopAll (write)
+	stopEpoch      atomic.Int64 // incremented by every StopAll
+	killWait       time.Duration
+	stopWorkers    int // processes stopped at once by StopAll
+	restartJitter  float64
+	outputBacklog  int
+	outputEncoding encoding.Encoding // decodes output for ProcessOutput, nil for UTF-8
+	retentionTTL   time.Duration
+	retentionMax   int
+	sweepStop      chan struct{}
+	shutdown       chan struct{}
+	shutdownOnce   sync.Once
+	closeOnce      sync.Once
+	closeErr       error
+	wg             sync.WaitGroup // process monitor goroutines
+	monitors       sync.Map       // key: types.Process, value: struct{}; runs counted in wg
+	exits          sync.Map       // key: types.Process, value: *runExit; signalled when the run exits
+	loops          sync.WaitGroup // background loops that exit on shutdown
+	goroutines     atomic.Int64   // live goroutines started by goTracked
+	openPipes      atomic.Int64   // stdio pipes and log sinks of live runs
+}
+
+// IDGenerator returns the identifier for a newly started process. Ids must
+// be unique among the records the manager holds; StartProcess fails with
+// ErrDuplicateID when a generated id is already in use.
+type IDGenerator func() string
+
+// Option configures a ProcessManager at construction time
+type Option func(*ProcessManager)
+
+// WithIDGenerator replaces the default random UUIDv4 ids with ids from gen,
+// e.g. short sequential ids or ULIDs that are easier to correlate in logs
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(pm *ProcessManager) {
+		if gen != nil {
+			pm.newID = gen
+			pm.customID = true
+		}
+	}
+}
+
+// WithAllowedCommands restricts the executables the manager may start to the
+// given names, compared exactly against the name passed to StartProcess.
+// Shell commands run through the platform shell, so StartShellCommand is only
+// permitted when the shell ("sh" or "cmd") is listed; allowing the shell
+// allows any command.
+func WithAllowedCommands(commands ...string) Option {
+	return func(pm *ProcessManager) {
+		pm.allowed = make(map[string]bool, len(commands))
+		for _, command := range commands {
+			pm.allowed[command] = true
+		}
+	}
+}
+
+// WithManagedMonitoringOnly makes ProcessManagerWithMonitor refuse to monitor
+// PIDs it did not start, so tenants cannot watch other processes on the host.
+// By default any PID may be monitored.
+func WithManagedMonitoringOnly() Option {
+	return func(pm *ProcessManager) {
+		pm.managedOnly = true
+	}
+}
+
+// WithSelfCheck runs SelfCheck when the manager is created and prints a
+// warning for every missing tool. ProcessManagerWithMonitor also checks the
+// tools its monitor needs.
+func WithSelfCheck() Option {
+	return func(pm *ProcessManager) {
+		pm.selfCheck = true
+	}
+}
+
+// Clock supplies the timestamps recorded on process records. Tests can
+// substitute managertest.FakeClock to simulate long uptimes.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+// Now returns the current time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock makes the manager read record timestamps from clock
+func WithClock(clock Clock) Option {
+	return func(pm *ProcessManager) {
+		if clock != nil {
+			pm.clock = clock
+		}
+	}
 }
 
 // NewProcessManager creates a new ProcessManager instance
-func NewProcessManager() *ProcessManager {
+func NewProcessManager(opts ...Option) *ProcessManager {
+	return NewProcessManagerWithRunner(nil, opts...)
+}
+
+// NewProcessManagerWithRunner creates a new ProcessManager that uses the given
+// runner to create processes. A nil runner selects the exec.Cmd backed default.
+func NewProcessManagerWithRunner(runner ProcessRunner, opts ...Option) *ProcessManager {
 	pm := &ProcessManager{
-		shutdown: make(chan struct{}),
+		newID:         util.GenerateUUID,
+		clock:         realClock{},
+		sensitiveEnv:  DefaultSensitiveEnvPatterns,
+		groups:        make(map[string][]string),
+		killWait:      DefaultKillTimeout,
+		stopWorkers:   DefaultStopConcurrency,
+		restartJitter: DefaultRestartJitter,
+		eventLogSize:  DefaultEventLogSize,
+		outputBacklog: DefaultOutputBacklog,
+		shutdown:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(pm)
+	}
+	if runner == nil {
+		runner = execRunner{pm: pm}
+	}
+	pm.runner = runner
+	pm.SetRetention(DefaultRetentionTTL, 0)
+	if pm.selfCheck {
+		warnSelfCheck(pm.SelfCheck())
 	}
 
 	// Setup signal handling for graceful shutdown
@@ -33,149 +211,1120 @@ func NewProcessManager() *ProcessManager {
 	return pm
 }
 
-// StartProcess starts a new process and returns its UUID
+// SelfCheck verifies that the external programs the manager shells out to on
+// this platform are present and working. It returns one error per missing or
+// broken program, so problems surface at startup instead of as failed stops.
+func (pm *ProcessManager) SelfCheck() []error {
+	return util.CheckTools(requiredTools)
+}
+
+// warnSelfCheck prints the problems found by a self-check
+func warnSelfCheck(errs []error) {
+	for _, err := range errs {
+		fmt.Printf("Warning: self-check failed: %v\n", err)
+	}
+}
+
+// SetKillTimeout sets how long stopping a process waits after the graceful
+// termination request (SIGTERM on Unix, CTRL_BREAK on Windows) before it is
+// force killed. A zero timeout forces the kill immediately.
+func (pm *ProcessManager) SetKillTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("kill timeout must not be negative")
+	}
+
+	pm.mu.Lock()
+	pm.killWait = timeout
+	pm.mu.Unlock()
+	return nil
+}
+
+// KillTimeout returns the grace period used before force killing a process
+func (pm *ProcessManager) KillTimeout() time.Duration {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.killWait
+}
+
+// SetRestartJitter sets the fraction of the restart delay added at random to
+// every auto-restart, so that processes crashing together do not all restart
+// at the same moment. With a fraction of 0.5 restarts are spread over
+// [RestartDelay, 1.5*RestartDelay). Zero disables the jitter.
+func (pm *ProcessManager) SetRestartJitter(fraction float64) error {
+	if fraction < 0 || fraction > 1 {
+		return fmt.Errorf("restart jitter must be between 0 and 1")
+	}
+
+	pm.mu.Lock()
+	pm.restartJitter = fraction
+	pm.mu.Unlock()
+	return nil
+}
+
+// RestartJitter returns the restart jitter fraction
+func (pm *ProcessManager) RestartJitter() float64 {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.restartJitter
+}
+
+// restartDelay returns how long to wait before the next auto-restart
+func (pm *ProcessManager) restartDelay() time.Duration {
+	jitter := pm.RestartJitter()
+	return RestartDelay + time.Duration(rand.Float64()*jitter*float64(RestartDelay))
+}
+
+// SetStopConcurrency sets how many processes StopAll and StopAllGraceful stop
+// at once, so that stopping a large fleet does not spawn a kill for every
+// process at the same time
+func (pm *ProcessManager) SetStopConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("stop concurrency must be at least 1")
+	}
+
+	pm.mu.Lock()
+	pm.stopWorkers = n
+	pm.mu.Unlock()
+	return nil
+}
+
+// StopConcurrency returns how many processes are stopped at once
+func (pm *ProcessManager) StopConcurrency() int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.stopWorkers
+}
+
+// SetStableDuration sets how long a run must last to count as stable. When a
+// stable run exits, RestartCount starts again from zero so early crashes do
+// not weigh on a process that has since run well; TotalRestarts keeps the
+// lifetime count. Zero, the default, never resets the count.
+func (pm *ProcessManager) SetStableDuration(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("stable duration must not be negative")
+	}
+
+	pm.mu.Lock()
+	pm.stableAfter = d
+	pm.mu.Unlock()
+	return nil
+}
+
+// StableDuration returns the uptime after which RestartCount is reset
+func (pm *ProcessManager) StableDuration() time.Duration {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.stableAfter
+}
+
+// waitProcessExit polls until the process exits or the timeout elapses and
+// reports whether it exited
+func (pm *ProcessManager) waitProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for pm.isProcessRunning(pid) {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// StartProcess starts a new process and returns its UUID. It is a shorthand
+// for StartProcessWithOptions with Policy.Restart set to restart.
 func (pm *ProcessManager) StartProcess(name string, args []string, restart bool) (string, error) {
-	uuid := util.GenerateUUID()
+	return pm.StartProcessWithOptions(types.StartOptions{
+		Name:   name,
+		Args:   args,
+		Policy: types.RestartPolicy{Restart: restart},
+	})
+}
+
+// StartProcessWithOptions starts a new process configured by opts and returns
+// its UUID. The options are validated before anything is started: the name
+// is required, Env entries must be KEY=value, Dir must be an existing
+// directory, Umask must hold permission bits only, exit code ranges must not
+// be inverted, DependsOn must name managed processes and Log must be a valid
+// log configuration. Env, Dir and Umask only apply to the default exec.Cmd
+// backed runner; Umask is ignored on Windows.
+func (pm *ProcessManager) StartProcessWithOptions(opts types.StartOptions) (string, error) {
+	result, err := pm.StartProcessWithResult(opts)
+	return result.UUID, err
+}
+
+// StartProcessWithResult is like StartProcessWithOptions but also returns the
+// PID and start time of the new process. They are captured as the process
+// starts, so unlike a following GetProcess they cannot race with a quick exit
+// or restart.
+func (pm *ProcessManager) StartProcessWithResult(opts types.StartOptions) (types.StartResult, error) {
+	return pm.StartProcessContext(context.Background(), opts)
+}
+
+// StartProcessContext is like StartProcessWithResult but names the actor of
+// ctx, see WithActor, in the audit record. ctx does not cancel the start.
+func (pm *ProcessManager) StartProcessContext(ctx context.Context, opts types.StartOptions) (types.StartResult, error) {
+	if err := pm.validateStartOptions(opts); err != nil {
+		pm.auditStart(ctx, opts.Name, opts.Args, "", "", err)
+		return types.StartResult{}, err
+	}
+	result, err := pm.startProcess(opts)
+	pm.auditStart(ctx, opts.Name, opts.Args, "", result.UUID, err)
+	return result, err
+}
+
+// StartProcessWithListeners starts a new process that inherits the given
+// listening sockets (systemd-style socket activation). The files are passed
+// to the child starting at fd 3 and LISTEN_FDS is set accordingly. The same
+// files are reused on every restart, so the listening port never closes.
+// The caller keeps ownership of the files and must close them when done.
+func (pm *ProcessManager) StartProcessWithListeners(name string, args []string, restart bool, listeners []*os.File) (string, error) {
+	if len(listeners) == 0 {
+		err := fmt.Errorf("no listeners provided")
+		pm.auditStart(context.Background(), name, args, "", "", err)
+		return "", err
+	}
+	return pm.StartProcessWithOptions(types.StartOptions{
+		Name:      name,
+		Args:      args,
+		Policy:    types.RestartPolicy{Restart: restart},
+		Listeners: listeners,
+	})
+}
+
+// StartProcessWithStdio starts a new process whose stdin and stdout are
+// wired to the manager, so they can be used with ProcessStdin and
+// ProcessStdout. Stderr is left unchanged.
+func (pm *ProcessManager) StartProcessWithStdio(name string, args []string, restart bool) (string, error) {
+	return pm.StartProcessWithOptions(types.StartOptions{
+		Name:   name,
+		Args:   args,
+		Policy: types.RestartPolicy{Restart: restart},
+		Stdio:  true,
+	})
+}
+
+// validateStartOptions rejects options that would fail to start or leave the
+// process misconfigured
+func (pm *ProcessManager) validateStartOptions(opts types.StartOptions) error {
+	if opts.Name == "" {
+		return fmt.Errorf("process name is required")
+	}
+	for _, entry := range opts.Env {
+		if key, _, ok := strings.Cut(entry, "="); !ok || key == "" {
+			return fmt.Errorf("invalid environment entry %q, expected KEY=value", entry)
+		}
+	}
+	if opts.Dir != "" {
+		info, err := os.Stat(opts.Dir)
+		if err != nil {
+			return fmt.Errorf("invalid working directory: %v", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("working directory %s is not a directory", opts.Dir)
+		}
+	}
+	if opts.Umask != nil && *opts.Umask&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid umask %#o, expected permission bits only", uint32(*opts.Umask))
+	}
+	if err := validateExitCodes(opts.Policy.ExitCodes); err != nil {
+		return err
+	}
+	if err := validateRestartBudget(opts.Policy.Budget); err != nil {
+		return err
+	}
+	for _, dependency := range opts.DependsOn {
+		if _, exists := pm.processes.Load(dependency); !exists {
+			return fmt.Errorf("dependency with UUID %s not found", dependency)
+		}
+	}
+	for _, listener := range opts.Listeners {
+		if listener == nil {
+			return fmt.Errorf("listener must not be nil")
+		}
+	}
+	if opts.Log != nil {
+		if _, _, _, err := parseLogConfig(*opts.Log); err != nil {
+			return err
+		}
+	}
+	if err := validateOutputLimit(opts.Output, opts.Stdio); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListenerFile returns a duplicated *os.File for a net.Listener so that it can
+// be handed to StartProcessWithListeners
+func ListenerFile(l net.Listener) (*os.File, error) {
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener type %T does not support file descriptors", l)
+	}
+	return fl.File()
+}
+
+// listenFdsEnv returns the LISTEN_FDS environment entry for n inherited listeners
+func listenFdsEnv(n int) string {
+	return fmt.Sprintf("LISTEN_FDS=%d", n)
+}
+
+// applyEnvDir adds the extra environment and sets the working directory of
+// an exec.Cmd backed process; other runners are left as they are
+func applyEnvDir(process types.Process, env []string, dir string) {
+	ep, ok := process.(*execProcess)
+	if !ok {
+		return
+	}
+	if len(env) > 0 {
+		ep.cmd.Env = append(ep.cmd.Environ(), env...)
+	}
+	ep.cmd.Dir = dir
+}
+
+// applyUmask sets the file mode creation mask of an exec.Cmd backed process
+// on Unix; other runners and a nil umask are left as they are
+func applyUmask(process types.Process, umask *os.FileMode) {
+	if ep, ok := process.(*execProcess); ok && umask != nil {
+		umaskCommand(ep.cmd, *umask)
+	}
+}
 
-	cmd, err := pm.createCommand(name, args)
+// startProcess creates and starts a process with the given configuration
+func (pm *ProcessManager) startProcess(opts types.StartOptions) (types.StartResult, error) {
+	name, args, listeners, logConfig := opts.Name, opts.Args, opts.Listeners, opts.Log
+	if err := pm.checkAllowed(name); err != nil {
+		return types.StartResult{}, err
+	}
+
+	uuid, err := pm.reserveID()
+	if err != nil {
+		return types.StartResult{}, err
+	}
+	defer pm.startingIDs.Delete(uuid)
+
+	process, err := pm.runner.Command(name, args, listeners)
 	if err != nil {
-		return "", fmt.Errorf("failed to create command: %v", err)
+		return types.StartResult{}, fmt.Errorf("failed to create command: %v", err)
+	}
+	applyEnvDir(process, opts.Env, opts.Dir)
+	applyUmask(process, opts.Umask)
+
+	var streams *processStdio
+	if opts.Stdio {
+		if streams, err = pm.newOutputStdio(process, opts.Output, uuid); err != nil {
+			return types.StartResult{}, err
+		}
+	}
+
+	if streams != nil {
+		pm.openPipes.Add(stdioPipes)
+	}
+
+	var logs *processLog
+	if logConfig != nil {
+		if logs, err = newProcessLog(process, name, *logConfig, streams); err != nil {
+			pm.releaseRun(streams, nil)
+			return types.StartResult{}, err
+		}
+		pm.openPipes.Add(1)
+	}
+
+	var labels map[string]string
+	if opts.Labels != nil {
+		labels = make(map[string]string, len(opts.Labels))
+		maps.Copy(labels, opts.Labels)
 	}
 
 	processInfo := &types.ProcessInfo{
 		UUID:         uuid,
-		Cmd:          cmd,
+		Process:      process,
 		Name:         name,
 		Args:         args,
+		ExtraEnv:     append([]string(nil), opts.Env...),
+		Dir:          opts.Dir,
+		Umask:        opts.Umask,
+		Listeners:    listeners,
+		Stdio:        opts.Stdio,
+		Output:       opts.Output,
+		Log:          logConfig,
 		Running:      false,
-		Restart:      restart,
-		StartTime:    time.Now(),
+		Restart:      opts.Policy.Restart,
+		ExitCodes:    copyExitCodes(opts.Policy.ExitCodes),
+		Budget:       opts.Policy.Budget,
+		DependsOn:    append([]string(nil), opts.DependsOn...),
+		Priority:     opts.Priority,
+		Labels:       labels,
+		StartTime:    pm.clock.Now(),
 		RestartCount: 0,
 	}
 
-	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start process: %v", err)
+	if ep, ok := process.(*execProcess); ok {
+		processInfo.Cmd = ep.cmd
+		processInfo.Env = ep.cmd.Environ()
+	}
+
+	if err := process.Start(); err != nil {
+		pm.releaseRun(streams, logs)
+		return types.StartResult{}, fmt.Errorf("failed to start process: %v", err)
 	}
 
 	processInfo.Running = true
-	processInfo.PID = cmd.Process.Pid
+	processInfo.PID = process.Pid()
+	if streams != nil {
+		pm.stdio.Store(uuid, streams)
+	}
+	if logs != nil {
+		pm.logs.Store(uuid, logs)
+	}
+	result := types.StartResult{UUID: uuid, PID: processInfo.PID, StartTime: processInfo.StartTime}
 	pm.processes.Store(uuid, processInfo)
 
 	// Monitor process in background
-	pm.wg.Add(1)
-	go pm.monitorProcess(uuid, processInfo)
+	pm.trackMonitor(process)
+	epoch := pm.stopEpoch.Load()
+	pm.goTracked(func() { pm.monitorProcess(uuid, processInfo, process, epoch) })
 
-	fmt.Printf("Started process: %s (UUID: %s, PID: %d)\n", name, uuid, cmd.Process.Pid)
-	return uuid, nil
+	pm.event(types.EventStart, uuid, name, "Started process: %s (UUID: %s, PID: %d)", name, uuid, processInfo.PID)
+	pm.notifyRunStarted(uuid, result.PID, name)
+	return result, nil
+}
+
+// checkAllowed reports ErrCommandNotAllowed when an allowlist is configured
+// and name is not on it
+func (pm *ProcessManager) checkAllowed(name string) error {
+	if pm.allowed != nil && !pm.allowed[name] {
+		return fmt.Errorf("%w: %s", ErrCommandNotAllowed, name)
+	}
+	return nil
+}
+
+// reserveID generates an id that is neither held by a process record nor by
+// another start in flight. The caller must release it from startingIDs once
+// the record is stored. A clash from the default generator is retried, a
+// clash from a custom generator is reported as ErrDuplicateID.
+func (pm *ProcessManager) reserveID() (string, error) {
+	for attempt := 1; ; attempt++ {
+		uuid := pm.newID()
+		if _, reserved := pm.startingIDs.LoadOrStore(uuid, struct{}{}); !reserved {
+			if _, exists := pm.processes.Load(uuid); !exists {
+				return uuid, nil
+			}
+			pm.startingIDs.Delete(uuid)
+		}
+
+		if pm.customID || attempt >= maxIDAttempts {
+			return "", fmt.Errorf("%w: %s", ErrDuplicateID, uuid)
+		}
+	}
 }
 
+// restartPause is how long RestartProcess waits after stopping a process
+// before starting it again
+const restartPause = 100 * time.Millisecond
+
 // RestartProcess restarts a process by UUID and returns the new UUID
 func (pm *ProcessManager) RestartProcess(uuid string) (string, error) {
+	return pm.RestartProcessContext(context.Background(), uuid)
+}
+
+// RestartProcessContext is like RestartProcess but names the actor of ctx,
+// see WithActor, in the audit record. ctx does not cancel the restart.
+func (pm *ProcessManager) RestartProcessContext(ctx context.Context, uuid string) (string, error) {
+	var processInfo *types.ProcessInfo
+	if value, exists := pm.processes.Load(uuid); exists {
+		processInfo = value.(*types.ProcessInfo)
+	}
+
+	newUUID, err := pm.restartProcess(uuid)
+	pm.auditProcess(ctx, types.AuditRestart, uuid, processInfo, newUUID, err)
+	return newUUID, err
+}
+
+// restartProcess restarts a process without recording an audit entry, for
+// automatic restarts
+func (pm *ProcessManager) restartProcess(uuid string) (string, error) {
 	value, exists := pm.processes.Load(uuid)
 	if !exists {
 		return "", fmt.Errorf("process with UUID %s not found", uuid)
 	}
 
 	processInfo := value.(*types.ProcessInfo)
+	// Mark the record first so the old monitor goroutine does not
+	// auto-restart the run killed below
+	pm.mu.Lock()
+	running := processInfo.Running
+	process := processInfo.Process
+	processInfo.Replaced = true
+	pm.mu.Unlock()
 
 	// Stop the current process if it's running
-	if processInfo.Running {
-		if err := pm.killProcess(processInfo.Cmd); err != nil {
+	if running {
+		if err := process.Kill(); err != nil {
+			pm.mu.Lock()
+			processInfo.Replaced = false
+			pm.mu.Unlock()
 			return "", fmt.Errorf("failed to stop process for restart: %v", err)
 		}
 		// Brief pause to ensure process is fully terminated
-		time.Sleep(100 * time.Millisecond)
+		time.Sleep(restartPause)
 	}
 
 	// Remove old process record
 	pm.processes.Delete(uuid)
 
 	// Start new process with same configuration
-	newUUID, err := pm.StartProcess(processInfo.Name, processInfo.Args, processInfo.Restart)
+	result, err := pm.startProcess(types.StartOptions{
+		Name:      processInfo.Name,
+		Args:      processInfo.Args,
+		Env:       processInfo.ExtraEnv,
+		Dir:       processInfo.Dir,
+		Umask:     processInfo.Umask,
+		Policy:    types.RestartPolicy{Restart: processInfo.Restart},
+		Stdio:     processInfo.Stdio,
+		Output:    processInfo.Output,
+		Log:       processInfo.Log,
+		Listeners: processInfo.Listeners,
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to restart process: %v", err)
 	}
+	newUUID := result.UUID
 
-	// Update restart count in new process info
+	// Update restart statistics in new process info
 	if newValue, exists := pm.processes.Load(newUUID); exists {
 		newProcessInfo := newValue.(*types.ProcessInfo)
+		pm.mu.Lock()
 		newProcessInfo.RestartCount = processInfo.RestartCount + 1
+		newProcessInfo.TotalRestarts = processInfo.TotalRestarts + 1
+		newProcessInfo.LastRestartTime = pm.clock.Now()
+		newProcessInfo.LastExitCode = processInfo.LastExitCode
+		newProcessInfo.LastError = processInfo.LastError
+		newProcessInfo.DependsOn = processInfo.DependsOn
+		newProcessInfo.Priority = processInfo.Priority
+		newProcessInfo.Labels = processInfo.Labels
+		newProcessInfo.Command = processInfo.Command
+		newProcessInfo.PIDFile = processInfo.PIDFile
+		newProcessInfo.Readiness = processInfo.Readiness
+		newProcessInfo.ExitCodes = processInfo.ExitCodes
+		newProcessInfo.Budget = processInfo.Budget
+		newProcessInfo.StatusRegexp = processInfo.StatusRegexp
+		newProcessInfo.RestartTimes = processInfo.RestartTimes
+		newProcessInfo.Health = processInfo.Health
+		health := processInfo.Health
+		pm.mu.Unlock()
+		pm.updatePIDFile(newProcessInfo)
+		if health != nil {
+			pm.startHealthCheck(newUUID, *health)
+		}
 	}
 
-	fmt.Printf("Restarted process: %s (Old UUID: %s, New UUID: %s)\n",
+	// Point dependents, groups and the observer at the new UUID
+	pm.replaceDependency(uuid, newUUID)
+	pm.replaceGroupMember(uuid, newUUID)
+	pm.notifyRunReplaced(uuid, newUUID)
+
+	pm.event(types.EventRestart, newUUID, processInfo.Name, "Restarted process: %s (Old UUID: %s, New UUID: %s)",
 		processInfo.Name, uuid, newUUID)
 	return newUUID, nil
 }
 
 // StopProcess stops a specific process by UUID
 func (pm *ProcessManager) StopProcess(uuid string) error {
+	return pm.StopProcessContext(context.Background(), uuid)
+}
+
+// StopProcessContext is like StopProcess but names the actor of ctx, see
+// WithActor, in the audit record. ctx does not cancel the stop.
+func (pm *ProcessManager) StopProcessContext(ctx context.Context, uuid string) error {
 	value, exists := pm.processes.Load(uuid)
 	if !exists {
-		return fmt.Errorf("process with UUID %s not found", uuid)
+		err := fmt.Errorf("process with UUID %s not found", uuid)
+		pm.auditProcess(ctx, types.AuditStop, uuid, nil, "", err)
+		return err
 	}
 
 	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
 	processInfo.Restart = false // Disable auto-restart
+	running := processInfo.Running
+	pm.mu.Unlock()
 
-	if processInfo.Running {
-		if err := pm.killProcess(processInfo.Cmd); err != nil {
-			// 检查进程是否已经退出
-			if pm.isProcessRunning(processInfo.PID) {
-				return fmt.Errorf("failed to stop process: %v", err)
-			}
-			// 如果进程已经退出，我们认为终止成功
+	if running {
+		if err := processInfo.Process.Kill(); err != nil {
+			err = fmt.Errorf("failed to stop process: %v", err)
+			pm.auditProcess(ctx, types.AuditStop, uuid, processInfo, "", err)
+			return err
 		}
 	}
 
+	pm.clearPIDFile(processInfo)
 	pm.processes.Delete(uuid)
-	fmt.Printf("Stopped process: %s (UUID: %s)\n", processInfo.Name, uuid)
+	pm.auditProcess(ctx, types.AuditStop, uuid, processInfo, "", nil)
+	pm.event(types.EventStop, uuid, processInfo.Name, "Stopped process: %s (UUID: %s)", processInfo.Name, uuid)
+	return nil
+}
+
+// stopIdleProcess stops a process that has been idle for too long. When keep is
+// true the process record is kept so it can be started again on demand with
+// RestartProcess; otherwise it behaves like StopProcess.
+func (pm *ProcessManager) stopIdleProcess(uuid string, keep bool) error {
+	if !keep {
+		return pm.StopProcess(uuid)
+	}
+
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.IdleStopped = true
+	running := processInfo.Running
+	pm.mu.Unlock()
+
+	if running {
+		if err := processInfo.Process.Kill(); err != nil {
+			return fmt.Errorf("failed to stop idle process: %v", err)
+		}
+	}
+
+	pm.event(types.EventStop, uuid, processInfo.Name, "Stopped idle process: %s (UUID: %s)", processInfo.Name, uuid)
+	return nil
+}
+
+// reloadProcess restarts a process in place, keeping its UUID. The reason is
+// recorded on the reload event.
+func (pm *ProcessManager) reloadProcess(uuid, reason string) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+
+	process, err := pm.runner.Command(processInfo.Name, processInfo.Args, processInfo.Listeners)
+	if err != nil {
+		return fmt.Errorf("failed to create command: %v", err)
+	}
+	applyEnvDir(process, processInfo.ExtraEnv, processInfo.Dir)
+	applyUmask(process, processInfo.Umask)
+
+	var streams *processStdio
+	if processInfo.Stdio {
+		if streams, err = pm.newOutputStdio(process, processInfo.Output, uuid); err != nil {
+			return err
+		}
+	}
+
+	if streams != nil {
+		pm.openPipes.Add(stdioPipes)
+	}
+
+	var logs *processLog
+	if processInfo.Log != nil {
+		if logs, err = newProcessLog(process, processInfo.Name, *processInfo.Log, streams); err != nil {
+			pm.releaseRun(streams, nil)
+			return err
+		}
+		pm.openPipes.Add(1)
+	}
+
+	// Swap the run first so the old monitor goroutine leaves the record alone
+	pm.mu.Lock()
+	oldProcess := processInfo.Process
+	oldCmd, oldEnv := processInfo.Cmd, processInfo.Env
+	wasRunning := processInfo.Running
+	processInfo.Process = process
+	processInfo.Cmd = nil
+	if ep, ok := process.(*execProcess); ok {
+		processInfo.Cmd = ep.cmd
+		processInfo.Env = ep.cmd.Environ()
+	}
+	pm.mu.Unlock()
+
+	if wasRunning {
+		if err := oldProcess.Kill(); err != nil {
+			// Keep the old run, it is still the one being monitored
+			pm.mu.Lock()
+			processInfo.Process = oldProcess
+			processInfo.Cmd, processInfo.Env = oldCmd, oldEnv
+			pm.mu.Unlock()
+			pm.releaseRun(streams, logs)
+			return fmt.Errorf("failed to stop process for reload: %v", err)
+		}
+		oldProcess.Wait()
+	}
+
+	if err := process.Start(); err != nil {
+		pm.releaseRun(streams, logs)
+		pm.mu.Lock()
+		processInfo.Running = false
+		processInfo.EndTime = pm.clock.Now()
+		processInfo.LastError = err.Error()
+		pm.mu.Unlock()
+		pm.processes.Delete(uuid)
+		return fmt.Errorf("failed to start process: %v", err)
+	}
+
+	if streams != nil {
+		pm.stdio.Store(uuid, streams)
+	}
+	if logs != nil {
+		pm.logs.Store(uuid, logs)
+	}
+
+	pm.mu.Lock()
+	processInfo.Running = true
+	processInfo.Held = false
+	processInfo.AppStatus = ""
+	processInfo.IdleStopped = false
+	processInfo.Stopped = false
+	processInfo.Terminated = false
+	processInfo.PID = process.Pid()
+	processInfo.StartTime = pm.clock.Now()
+	processInfo.RestartCount++
+	processInfo.TotalRestarts++
+	processInfo.LastRestartTime = processInfo.StartTime
+	pm.mu.Unlock()
+	pm.updatePIDFile(processInfo)
+
+	pm.trackMonitor(process)
+	epoch := pm.stopEpoch.Load()
+	pm.goTracked(func() { pm.monitorProcess(uuid, processInfo, process, epoch) })
+
+	pm.recordEvent(types.Event{
+		Type:    types.EventReload,
+		UUID:    uuid,
+		Name:    processInfo.Name,
+		Reason:  reason,
+		Message: fmt.Sprintf("Reloaded process: %s (UUID: %s, PID: %d) due to %s", processInfo.Name, uuid, processInfo.PID, reason),
+	})
+	pm.notifyRunStarted(uuid, process.Pid(), processInfo.Name)
+	return nil
+}
+
+// SetDependencies records that a process depends on other managed processes.
+// StopAllGraceful stops dependents before the processes they depend on.
+func (pm *ProcessManager) SetDependencies(uuid string, dependsOn []string) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	for _, dependency := range dependsOn {
+		if dependency == uuid {
+			return fmt.Errorf("process %s cannot depend on itself", uuid)
+		}
+		if _, exists := pm.processes.Load(dependency); !exists {
+			return fmt.Errorf("dependency with UUID %s not found", dependency)
+		}
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.DependsOn = append([]string(nil), dependsOn...)
+	pm.mu.Unlock()
 	return nil
 }
 
+// SetExitCodePolicy restricts auto-restart of a process to the exit codes
+// allowed by policy. It only applies while Restart is enabled and is kept
+// across restarts.
+func (pm *ProcessManager) SetExitCodePolicy(uuid string, policy types.ExitCodePolicy) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	if err := validateExitCodes(policy); err != nil {
+		return err
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.ExitCodes = copyExitCodes(policy)
+	pm.mu.Unlock()
+	return nil
+}
+
+// SetRestartPolicy replaces the auto-restart policy of a process, e.g. to
+// enable auto-restart on a process that is already running. The policy is
+// read when the process exits, so it applies to the current run.
+func (pm *ProcessManager) SetRestartPolicy(uuid string, policy types.RestartPolicy) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	if err := validateExitCodes(policy.ExitCodes); err != nil {
+		return err
+	}
+	if err := validateRestartBudget(policy.Budget); err != nil {
+		return err
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.Restart = policy.Restart
+	processInfo.ExitCodes = copyExitCodes(policy.ExitCodes)
+	processInfo.Budget = policy.Budget
+	pm.mu.Unlock()
+	return nil
+}
+
+// GetRestartPolicy returns the auto-restart policy of a process
+func (pm *ProcessManager) GetRestartPolicy(uuid string) (types.RestartPolicy, bool) {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return types.RestartPolicy{}, false
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return types.RestartPolicy{
+		Restart:   processInfo.Restart,
+		ExitCodes: copyExitCodes(processInfo.ExitCodes),
+		Budget:    processInfo.Budget,
+	}, true
+}
+
+// validateExitCodes rejects inverted exit code ranges
+func validateExitCodes(policy types.ExitCodePolicy) error {
+	for _, r := range append(append([]types.ExitCodeRange(nil), policy.Restart...), policy.NoRestart...) {
+		if r.Min > r.Max {
+			return fmt.Errorf("invalid exit code range %d-%d", r.Min, r.Max)
+		}
+	}
+	return nil
+}
+
+// copyExitCodes returns a copy of policy that shares no slices with it
+func copyExitCodes(policy types.ExitCodePolicy) types.ExitCodePolicy {
+	return types.ExitCodePolicy{
+		Restart:   append([]types.ExitCodeRange(nil), policy.Restart...),
+		NoRestart: append([]types.ExitCodeRange(nil), policy.NoRestart...),
+	}
+}
+
+// SetPriority sets the priority of a process. When a resource budget is
+// exceeded, processes with lower priority are acted on first.
+func (pm *ProcessManager) SetPriority(uuid string, priority int) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.Priority = priority
+	pm.mu.Unlock()
+	return nil
+}
+
+// SetLabels replaces the user-defined labels of a process
+func (pm *ProcessManager) SetLabels(uuid string, labels map[string]string) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.Labels = copied
+	pm.mu.Unlock()
+	return nil
+}
+
+// replaceDependency updates dependency references after a process got a new UUID
+func (pm *ProcessManager) replaceDependency(oldUUID, newUUID string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.processes.Range(func(key, value interface{}) bool {
+		processInfo := value.(*types.ProcessInfo)
+		for i, dependency := range processInfo.DependsOn {
+			if dependency == oldUUID {
+				processInfo.DependsOn[i] = newUUID
+			}
+		}
+		return true
+	})
+}
+
+// StopAllGraceful stops all managed processes in reverse dependency order:
+// a process is only stopped once every process depending on it has stopped.
+// Each process is asked to exit gracefully and force-killed if it is still
+// running after timeout. It returns the UUIDs of force-killed processes.
+func (pm *ProcessManager) StopAllGraceful(timeout time.Duration) []string {
+	// No auto-restart may begin once stopping has started
+	pm.restartMu.Lock()
+	defer pm.restartMu.Unlock()
+	pm.stopEpoch.Add(1)
+
+	processes := pm.ListProcesses()
+
+	// Disable auto-restart before stopping anything
+	pm.mu.Lock()
+	for _, processInfo := range processes {
+		processInfo.Restart = false
+	}
+	pm.mu.Unlock()
+
+	var forced []string
+	var forcedMu sync.Mutex
+	workers := make(chan struct{}, pm.StopConcurrency())
+
+	for _, level := range stopLevels(processes) {
+		var wg sync.WaitGroup
+		for _, processInfo := range level {
+			wg.Add(1)
+			workers <- struct{}{}
+			go func(processInfo *types.ProcessInfo) {
+				defer wg.Done()
+				defer func() { <-workers }()
+				action, eventType := types.AuditStop, types.EventStop
+				if pm.stopGracefully(processInfo, timeout) {
+					action, eventType = types.AuditKill, types.EventKill
+					forcedMu.Lock()
+					forced = append(forced, processInfo.UUID)
+					forcedMu.Unlock()
+				}
+				pm.clearPIDFile(processInfo)
+				pm.processes.Delete(processInfo.UUID)
+				pm.auditProcess(context.Background(), action, processInfo.UUID, processInfo, "", nil)
+				pm.event(eventType, processInfo.UUID, processInfo.Name, "Stopped process: %s (UUID: %s)", processInfo.Name, processInfo.UUID)
+			}(processInfo)
+		}
+		wg.Wait()
+	}
+
+	fmt.Println("All processes stopped")
+	return forced
+}
+
+// stopLevels groups processes so that every process appears in a later group
+// than all of its dependents. Processes in a dependency cycle are stopped
+// together in the last group.
+func stopLevels(processes []*types.ProcessInfo) [][]*types.ProcessInfo {
+	remaining := make(map[string]*types.ProcessInfo, len(processes))
+	for _, processInfo := range processes {
+		remaining[processInfo.UUID] = processInfo
+	}
+
+	var levels [][]*types.ProcessInfo
+	for len(remaining) > 0 {
+		// A process still needed by a remaining dependent must wait
+		needed := make(map[string]bool)
+		for _, processInfo := range remaining {
+			for _, dependency := range processInfo.DependsOn {
+				needed[dependency] = true
+			}
+		}
+
+		var level []*types.ProcessInfo
+		for _, processInfo := range processes {
+			if _, ok := remaining[processInfo.UUID]; ok && !needed[processInfo.UUID] {
+				level = append(level, processInfo)
+			}
+		}
+
+		// Dependency cycle, stop everything that is left
+		if len(level) == 0 {
+			for _, processInfo := range processes {
+				if _, ok := remaining[processInfo.UUID]; ok {
+					level = append(level, processInfo)
+				}
+			}
+		}
+
+		for _, processInfo := range level {
+			delete(remaining, processInfo.UUID)
+		}
+		levels = append(levels, level)
+	}
+
+	return levels
+}
+
+// stopGracefully asks a process to exit and waits up to timeout before
+// force-killing it. It reports whether the process had to be force-killed.
+func (pm *ProcessManager) stopGracefully(processInfo *types.ProcessInfo, timeout time.Duration) bool {
+	pm.mu.RLock()
+	running := processInfo.Running
+	pm.mu.RUnlock()
+	if !running {
+		return false
+	}
+
+	done := make(chan struct{})
+	pm.goTracked(func() {
+		processInfo.Process.Wait()
+		close(done)
+	})
+
+	if err := processInfo.Process.Terminate(); err != nil {
+		pm.event(types.EventError, processInfo.UUID, processInfo.Name, "Failed to terminate process %s (UUID: %s): %v", processInfo.Name, processInfo.UUID, err)
+	}
+
+	select {
+	case <-done:
+		return false
+	case <-time.After(timeout):
+	}
+
+	processInfo.Process.Kill()
+	<-done
+	return true
+}
+
 // StopAll stops all managed processes
 func (pm *ProcessManager) StopAll() {
+	// No auto-restart may begin once StopAll has started
+	pm.restartMu.Lock()
+	defer pm.restartMu.Unlock()
+	pm.stopEpoch.Add(1)
+
 	var wg sync.WaitGroup
+	workers := make(chan struct{}, pm.StopConcurrency())
 
 	pm.processes.Range(func(key, value interface{}) bool {
 		wg.Add(1)
+		workers <- struct{}{}
 		go func(uuid string, processInfo *types.ProcessInfo) {
 			defer wg.Done()
+			defer func() { <-workers }()
+			pm.mu.Lock()
 			processInfo.Restart = false
-			if processInfo.Running {
+			running := processInfo.Running
+			pm.mu.Unlock()
+			var err error
+			if running {
 				// 尝试终止进程，但忽略错误
-				pm.killProcess(processInfo.Cmd)
+				err = processInfo.Process.Kill()
 			}
-			fmt.Printf("Stopped process: %s (UUID: %s)\n", processInfo.Name, uuid)
+			pm.clearPIDFile(processInfo)
+			pm.auditProcess(context.Background(), types.AuditKill, uuid, processInfo, "", err)
+			pm.event(types.EventKill, uuid, processInfo.Name, "Stopped process: %s (UUID: %s)", processInfo.Name, uuid)
 		}(key.(string), value.(*types.ProcessInfo))
 		return true
 	})
 
 	wg.Wait()
-	pm.processes = sync.Map{} // Clear the map
+
+	// Clear the map in place; other goroutines may be using it concurrently
+	pm.processes.Range(func(key, value interface{}) bool {
+		pm.processes.Delete(key)
+		return true
+	})
 	fmt.Println("All processes stopped")
 }
 
-// GetProcess retrieves process information by UUID
-func (pm *ProcessManager) GetProcess(uuid string) (*types.ProcessInfo, bool) {
-	value, exists := pm.processes.Load(uuid)
-	if !exists {
-		return nil, false
-	}
-	return value.(*types.ProcessInfo), true
+// GetProcess retrieves a copy of the process record by UUID, including its
+// computed status and uptime. Changing the copy does not affect the manager;
+// use the setters such as SetRestartPolicy or SetLabels instead.
+func (pm *ProcessManager) GetProcess(uuid string) (types.ProcessSnapshot, bool) {
+	return pm.GetSnapshot(uuid)
 }
 
-// ListProcesses returns a list of all managed processes
+// ListProcesses returns a list of all managed processes ordered by start time,
+// then by UUID, so repeated calls return a stable ordering
 func (pm *ProcessManager) ListProcesses() []*types.ProcessInfo {
+	return pm.listProcesses(false)
+}
+
+// listProcesses returns the process records sorted by start time, optionally
+// including terminated records
+func (pm *ProcessManager) listProcesses(includeTerminated bool) []*types.ProcessInfo {
 	var processes []*types.ProcessInfo
 
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
 	pm.processes.Range(func(key, value interface{}) bool {
-		processes = append(processes, value.(*types.ProcessInfo))
+		processInfo := value.(*types.ProcessInfo)
+		if includeTerminated || !processInfo.Terminated {
+			processes = append(processes, processInfo)
+		}
 		return true
 	})
 
+	sort.Slice(processes, func(i, j int) bool {
+		if !processes[i].StartTime.Equal(processes[j].StartTime) {
+			return processes[i].StartTime.Before(processes[j].StartTime)
+		}
+		return processes[i].UUID < processes[j].UUID
+	})
+
 	return processes
 }
 
+// Snapshot returns value copies of all process records, including terminated
+// records kept by the retention policy, captured under the lock so that every
+// record is internally consistent. Unlike ListProcesses, the result does not
+// change as the processes run and is safe to encode.
+func (pm *ProcessManager) Snapshot() []types.ProcessSnapshot {
+	var processes []*types.ProcessInfo
+	pm.processes.Range(func(key, value interface{}) bool {
+		processes = append(processes, value.(*types.ProcessInfo))
+		return true
+	})
+
+	pm.mu.RLock()
+	snapshots := make([]types.ProcessSnapshot, len(processes))
+	for i, processInfo := range processes {
+		snapshots[i] = pm.snapshot(processInfo)
+	}
+	pm.mu.RUnlock()
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].StartTime.Equal(snapshots[j].StartTime) {
+			return snapshots[i].StartTime.Before(snapshots[j].StartTime)
+		}
+		return snapshots[i].UUID < snapshots[j].UUID
+	})
+	return snapshots
+}
+
+// ListSnapshots returns value copies of the records ListProcesses returns,
+// i.e. without terminated records, in the same order
+func (pm *ProcessManager) ListSnapshots() []types.ProcessSnapshot {
+	var snapshots []types.ProcessSnapshot
+	for _, snapshot := range pm.Snapshot() {
+		if !snapshot.Terminated {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots
+}
+
+// GetSnapshot returns a copy of the process record with the given UUID,
+// including terminated records kept by the retention policy
+func (pm *ProcessManager) GetSnapshot(uuid string) (types.ProcessSnapshot, bool) {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return types.ProcessSnapshot{}, false
+	}
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.snapshot(value.(*types.ProcessInfo)), true
+}
+
+// snapshot copies a process record, computing the restart budget with the
+// manager's clock. The caller must hold pm.mu.
+func (pm *ProcessManager) snapshot(processInfo *types.ProcessInfo) types.ProcessSnapshot {
+	snapshot := processInfo.Snapshot()
+	snapshot.RestartBudget = processInfo.RestartBudgetRemaining(pm.clock.Now())
+	return snapshot
+}
+
 // WaitForProcess waits for a specific process to complete with timeout
 func (pm *ProcessManager) WaitForProcess(uuid string, timeout time.Duration) error {
 	value, exists := pm.processes.Load(uuid)
@@ -184,65 +1333,185 @@ func (pm *ProcessManager) WaitForProcess(uuid string, timeout time.Duration) err
 	}
 
 	processInfo := value.(*types.ProcessInfo)
+	pm.mu.RLock()
+	process := processInfo.Process
+	pm.mu.RUnlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	done := make(chan error, 1)
-	go func() {
-		if processInfo.Cmd.Process != nil {
-			_, err := processInfo.Cmd.Process.Wait()
-			done <- err
-		} else {
-			done <- nil
+	// The run's monitor signals the exit; without a signal the run is over
+	// and its error, if any, was recorded on the process
+	value, exists = pm.exits.Load(process)
+	if !exists {
+		pm.mu.RLock()
+		defer pm.mu.RUnlock()
+		if processInfo.LastError != "" {
+			return errors.New(processInfo.LastError)
 		}
-	}()
+		return nil
+	}
+
+	exit := value.(*runExit)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
 	select {
-	case <-ctx.Done():
+	case <-timer.C:
 		return fmt.Errorf("wait timeout for process %s", uuid)
-	case err := <-done:
-		return err
+	case <-exit.done:
+		return exit.err
 	}
 }
 
+// WaitForExit blocks until the process exits and returns its exit code. A
+// non-zero exit code is not an error; the exit code is -1 if the process was
+// terminated by a signal.
+func (pm *ProcessManager) WaitForExit(uuid string) (int, error) {
+	return pm.WaitForExitContext(context.Background(), uuid)
+}
+
+// WaitForExitContext is like WaitForExit but gives up when ctx is done
+func (pm *ProcessManager) WaitForExitContext(ctx context.Context, uuid string) (int, error) {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return -1, fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.RLock()
+	process := processInfo.Process
+	pm.mu.RUnlock()
+
+	// The run's monitor signals the exit; without a signal the run is over
+	if value, ok := pm.exits.Load(process); ok {
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-value.(*runExit).done:
+		}
+	}
+	return process.ExitCode(), nil
+}
+
 // Shutdown gracefully shuts down the process manager and all processes
 func (pm *ProcessManager) Shutdown() {
 	fmt.Println("Shutting down process manager...")
-	close(pm.shutdown)
+	pm.shutdownOnce.Do(func() { close(pm.shutdown) })
 	pm.StopAll()
 	pm.wg.Wait()
 	fmt.Println("Process manager shutdown complete")
 }
 
+// Close shuts the manager down and releases everything it holds: it stops all
+// processes, waits for every background goroutine (signal handling, file
+// watchers, the retention sweep) to exit and closes any log sinks still open.
+// It is safe to call more than once; later calls return the first result.
+func (pm *ProcessManager) Close() error {
+	pm.closeOnce.Do(func() {
+		pm.Shutdown()
+		pm.loops.Wait()
+
+		var errs []error
+		pm.logs.Range(func(key, value interface{}) bool {
+			logs := value.(*processLog)
+			logs.stdout.Flush()
+			logs.stderr.Flush()
+			if err := logs.sink.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close log of process %s: %v", key, err))
+			}
+			if _, loaded := pm.logs.LoadAndDelete(key); loaded {
+				pm.openPipes.Add(-1)
+			}
+			return true
+		})
+		pm.closeErr = errors.Join(errs...)
+	})
+	return pm.closeErr
+}
+
+// goTracked runs fn on a new goroutine that is counted until fn returns, so
+// that goroutines left behind by finished processes show up in MonitorHealth
+func (pm *ProcessManager) goTracked(fn func()) {
+	pm.goroutines.Add(1)
+	go func() {
+		defer pm.goroutines.Add(-1)
+		fn()
+	}()
+}
+
+// releaseRun closes the stdio and log forwarding of a run that never started
+func (pm *ProcessManager) releaseRun(streams *processStdio, logs *processLog) {
+	if streams != nil {
+		streams.close()
+		pm.openPipes.Add(-stdioPipes)
+	}
+	if logs != nil {
+		logs.sink.Close()
+		pm.openPipes.Add(-1)
+	}
+}
+
 // setupSignalHandling configures OS signal handling for graceful shutdown
 func (pm *ProcessManager) setupSignalHandling() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	go func() {
-		<-sigChan
+	pm.loops.Add(1)
+	pm.goTracked(func() {
+		defer pm.loops.Done()
+		defer signal.Stop(sigChan)
+
+		select {
+		case <-sigChan:
+		case <-pm.shutdown:
+			return
+		}
 		fmt.Println("\nReceived shutdown signal")
 		pm.Shutdown()
 		os.Exit(0)
-	}()
+	})
 }
 
-// monitorProcess monitors a process and handles auto-restart if enabled
-func (pm *ProcessManager) monitorProcess(uuid string, processInfo *types.ProcessInfo) {
-	defer pm.wg.Done()
+// monitorProcess monitors a single run of a process and handles auto-restart if enabled
+func (pm *ProcessManager) monitorProcess(uuid string, processInfo *types.ProcessInfo, process types.Process, epoch int64) {
+	defer pm.releaseMonitor(process)
 
-	err := processInfo.Cmd.Wait()
+	err := process.Wait()
+	if value, ok := pm.exits.LoadAndDelete(process); ok {
+		exit := value.(*runExit)
+		exit.err = err
+		close(exit.done)
+	}
+	pm.closeStdio(uuid, process)
+	pm.closeLog(uuid, process)
+	// ForgetProcess gave up on the run, its record is gone
+	if _, tracked := pm.monitors.Load(process); !tracked {
+		return
+	}
+	pm.notifyRunEnded(uuid, process.Pid())
 	if err != nil {
-		fmt.Printf("Process %s (UUID: %s) exited with error: %v\n", processInfo.Name, uuid, err)
+		pm.event(types.EventExit, uuid, processInfo.Name, "Process %s (UUID: %s) exited with error: %v", processInfo.Name, uuid, err)
 	} else {
-		fmt.Printf("Process %s (UUID: %s) exited successfully\n", processInfo.Name, uuid)
+		pm.event(types.EventExit, uuid, processInfo.Name, "Process %s (UUID: %s) exited successfully", processInfo.Name, uuid)
 	}
 
 	pm.mu.Lock()
+	// The run was replaced in place by reloadProcess, nothing more to do
+	if processInfo.Process != process {
+		pm.mu.Unlock()
+		return
+	}
 	processInfo.Running = false
-	processInfo.EndTime = time.Now()
+	processInfo.EndTime = pm.clock.Now()
+	processInfo.LastExitCode = processInfo.Process.ExitCode()
+	if pm.stableAfter > 0 && processInfo.EndTime.Sub(processInfo.StartTime) >= pm.stableAfter {
+		processInfo.RestartCount = 0
+	}
+	if err != nil {
+		processInfo.LastError = err.Error()
+	} else {
+		processInfo.LastError = ""
+	}
 	pm.mu.Unlock()
+	pm.clearPIDFile(processInfo)
 
 	// Check if we should restart
 	select {
@@ -254,31 +1523,81 @@ func (pm *ProcessManager) monitorProcess(uuid string, processInfo *types.Process
 		// Continue with restart logic
 	}
 
-	if processInfo.Restart {
-		processInfo.RestartCount++
-		fmt.Printf("Auto-restarting process: %s (UUID: %s, Restart count: %d)\n",
-			processInfo.Name, uuid, processInfo.RestartCount)
+	pm.mu.RLock()
+	kept := processInfo.IdleStopped || processInfo.Stopped
+	replaced := processInfo.Replaced
+	restart := processInfo.Restart && processInfo.ExitCodes.ShouldRestart(processInfo.LastExitCode)
+	pm.mu.RUnlock()
+
+	// Idle-stopped and group-stopped processes keep their record for a later start
+	if kept {
+		return
+	}
+	// RestartProcess killed the run and replaces the record itself
+	if replaced {
+		return
+	}
+
+	// A StopAll since this run started cancels any auto-restart
+	if restart && pm.stopEpoch.Load() == epoch && pm.waitRestartBudget(uuid, processInfo, process, epoch) {
+		// restartProcess carries the count over to the new record
+		pm.mu.RLock()
+		restartCount := processInfo.RestartCount + 1
+		reason := exitReason(processInfo.LastExitCode, err)
+		pm.mu.RUnlock()
 
-		time.Sleep(2 * time.Second)
+		delay := pm.restartDelay()
+		pm.recordEvent(types.Event{
+			Type:   types.EventRestart,
+			UUID:   uuid,
+			Name:   processInfo.Name,
+			Reason: reason,
+			Delay:  delay,
+			Message: fmt.Sprintf("Auto-restarting process: %s (UUID: %s, Restart count: %d) in %v due to %s",
+				processInfo.Name, uuid, restartCount, delay, reason),
+		})
 
-		// Check if process is still in manager and restart is still enabled
-		if currentValue, exists := pm.processes.Load(uuid); exists {
-			currentInfo := currentValue.(*types.ProcessInfo)
-			if currentInfo.Restart {
-				pm.RestartProcess(uuid)
-				return
-			}
+		select {
+		case <-pm.shutdown:
+		case <-time.After(delay):
+		}
+
+		if pm.tryAutoRestart(uuid, epoch) {
+			return
 		}
 	}
 
-	// Process ended and won't restart, remove from manager
-	pm.processes.Delete(uuid)
+	// Process ended and won't restart
+	pm.retireProcess(uuid, processInfo)
 }
 
-// killProcess is a platform-agnostic method that delegates to platform-specific implementations
-func (pm *ProcessManager) killProcess(cmd *exec.Cmd) error {
-	if cmd.Process == nil {
-		return nil
+// tryAutoRestart restarts the process unless it was stopped, its restart
+// policy was disabled or a StopAll began since the run started. StopAll waits
+// for an auto-restart in progress so it never misses the new process.
+func (pm *ProcessManager) tryAutoRestart(uuid string, epoch int64) bool {
+	pm.restartMu.RLock()
+	defer pm.restartMu.RUnlock()
+
+	if pm.stopEpoch.Load() != epoch {
+		return false
+	}
+
+	// Check if process is still in manager and restart is still enabled
+	currentValue, exists := pm.processes.Load(uuid)
+	if !exists {
+		return false
+	}
+
+	currentInfo := currentValue.(*types.ProcessInfo)
+	pm.mu.RLock()
+	restart := currentInfo.Restart
+	pm.mu.RUnlock()
+	if !restart {
+		return false
+	}
+
+	if _, err := pm.restartProcess(uuid); err != nil {
+		pm.event(types.EventError, uuid, currentInfo.Name, "Failed to auto-restart process %s (UUID: %s): %v", currentInfo.Name, uuid, err)
 	}
-	return pm.killProcessPlatform(cmd)
+	return true
 }
@@ -1,8 +1,12 @@
 package manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"sync"
+	"time"
 
 	"github.com/dreamsxin/process-manager/monitor"
 	"github.com/dreamsxin/process-manager/types"
@@ -12,35 +16,37 @@ import (
 type ProcessManagerWithMonitor struct {
 	*ProcessManager
 	monitorManager *monitor.ProcessMonitorManager
+	budget         *types.ResourceBudget
+	budgetStop     chan struct{}
+	idleConfigs    map[string]types.IdleConfig    // 按UUID保存，进程每次运行时重新设置到监控
+	baselines      map[string]types.UsageBaseline // 按UUID保存，进程每次运行时重新设置到监控
+	pids           map[int]string                 // 托管进程当前运行的PID到UUID
 	mu             sync.RWMutex
 }
 
-// NewProcessManagerWithMonitor 创建带监控功能的进程管理器
-func NewProcessManagerWithMonitor() *ProcessManagerWithMonitor {
+// NewProcessManagerWithMonitor 创建带监控功能的进程管理器，opts与NewProcessManager相同
+func NewProcessManagerWithMonitor(opts ...Option) *ProcessManagerWithMonitor {
 	pm := &ProcessManagerWithMonitor{
-		ProcessManager: NewProcessManager(),
+		ProcessManager: NewProcessManager(opts...),
 		monitorManager: monitor.NewProcessMonitorManager(),
+		idleConfigs:    make(map[string]types.IdleConfig),
+		baselines:      make(map[string]types.UsageBaseline),
+		pids:           make(map[int]string),
 	}
 
-	// 启动监控
-	go pm.monitorManager.Start()
-
-	return pm
-}
+	// 空闲超时时停止进程
+	pm.monitorManager.SetIdleHandler(pm.handleIdle)
+	// 无论以何种方式启动、重启或重载，进程的每次运行都加入监控
+	pm.observer = pm
 
-// StartProcess 启动进程并添加到监控
-func (pm *ProcessManagerWithMonitor) StartProcess(name string, args []string, restart bool) (string, error) {
-	uuid, err := pm.ProcessManager.StartProcess(name, args, restart)
-	if err != nil {
-		return "", err
+	if pm.selfCheck {
+		warnSelfCheck(pm.monitorManager.SelfCheck())
 	}
 
-	// 获取进程信息并添加到监控
-	if processInfo, exists := pm.GetProcess(uuid); exists {
-		pm.monitorManager.AddProcess(processInfo.PID, processInfo.Name)
-	}
+	// 启动监控
+	pm.monitorManager.Start()
 
-	return uuid, nil
+	return pm
 }
 
 // StopProcess 停止进程并从监控移除
@@ -54,9 +60,82 @@ func (pm *ProcessManagerWithMonitor) StopProcess(uuid string) error {
 	return pm.ProcessManager.StopProcess(uuid)
 }
 
+// runStarted 将进程新的一次运行加入监控，并重新设置进程的空闲配置和资源使用基线
+func (pm *ProcessManagerWithMonitor) runStarted(uuid string, pid int, name string) {
+	pm.mu.Lock()
+	pm.pids[pid] = uuid
+	pm.mu.Unlock()
+
+	pm.monitorManager.AddProcess(pid, name)
+	pm.applyRunConfig(uuid, pid)
+}
+
+// runEnded 进程的一次运行结束时将其PID移出监控和PID索引，
+// PID已被本管理器的其他进程复用时保持不变
+func (pm *ProcessManagerWithMonitor) runEnded(uuid string, pid int) {
+	pm.mu.Lock()
+	owned := pm.pids[pid] == uuid
+	if owned {
+		delete(pm.pids, pid)
+	}
+	pm.mu.Unlock()
+
+	if owned {
+		pm.monitorManager.RemoveProcess(pid)
+	}
+}
+
+// runReplaced 重启使进程换用新的UUID时，将空闲配置和资源使用基线转移到新的UUID
+func (pm *ProcessManagerWithMonitor) runReplaced(oldUUID, newUUID string) {
+	pm.mu.Lock()
+	if config, exists := pm.idleConfigs[oldUUID]; exists {
+		pm.idleConfigs[newUUID] = config
+		delete(pm.idleConfigs, oldUUID)
+	}
+	if baseline, exists := pm.baselines[oldUUID]; exists {
+		pm.baselines[newUUID] = baseline
+		delete(pm.baselines, oldUUID)
+	}
+	pm.mu.Unlock()
+
+	if snapshot, exists := pm.GetSnapshot(newUUID); exists && snapshot.Running {
+		pm.applyRunConfig(newUUID, snapshot.PID)
+	}
+}
+
+// applyRunConfig 将按UUID保存的空闲配置和资源使用基线设置到进程当前运行的PID
+func (pm *ProcessManagerWithMonitor) applyRunConfig(uuid string, pid int) {
+	pm.mu.RLock()
+	config, idle := pm.idleConfigs[uuid]
+	baseline, deviation := pm.baselines[uuid]
+	pm.mu.RUnlock()
+
+	if idle {
+		pm.monitorManager.SetIdleConfig(pid, config)
+	}
+	if deviation {
+		pm.monitorManager.SetUsageBaseline(pid, baseline)
+	}
+}
+
+// pruneRunConfig 丢弃已不存在的进程的空闲配置和资源使用基线，调用方需持有pm.mu
+func (pm *ProcessManagerWithMonitor) pruneRunConfig() {
+	for uuid := range pm.idleConfigs {
+		if _, exists := pm.processes.Load(uuid); !exists {
+			delete(pm.idleConfigs, uuid)
+		}
+	}
+	for uuid := range pm.baselines {
+		if _, exists := pm.processes.Load(uuid); !exists {
+			delete(pm.baselines, uuid)
+		}
+	}
+}
+
 // StopAll 停止所有进程并清理监控
 func (pm *ProcessManagerWithMonitor) StopAll() {
-	// 先停止监控
+	// 先停止预算检查和监控
+	pm.ClearResourceBudget()
 	pm.monitorManager.Stop()
 
 	// 然后停止所有进程
@@ -69,50 +148,199 @@ func (pm *ProcessManagerWithMonitor) Shutdown() {
 	pm.ProcessManager.Shutdown()
 }
 
+// Close 停止资源预算检查和监控并等待监控协程退出，然后按ProcessManager.Close
+// 停止所有进程、关闭日志和文件监视并等待后台协程退出。可重复调用
+func (pm *ProcessManagerWithMonitor) Close() error {
+	pm.ClearResourceBudget()
+	monitorErr := pm.monitorManager.Close()
+	return errors.Join(monitorErr, pm.ProcessManager.Close())
+}
+
 // 监控相关方法
 
-// GetProcessStats 获取进程统计信息
+// GetProcessStats 获取进程统计信息，pid属于本管理器正在运行的进程时附带其UUID、标签和重启次数
 func (pm *ProcessManagerWithMonitor) GetProcessStats(pid int) (*types.ProcessStats, error) {
-	return pm.monitorManager.GetProcessStats(pid)
+	stats, err := pm.monitorManager.GetProcessStats(pid)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot, ok := pm.managedSnapshot(pid); ok {
+		annotateStats(stats, snapshot)
+	}
+	return stats, nil
+}
+
+// annotateStats 在统计信息中填入托管进程的UUID、标签和重启次数
+func annotateStats(stats *types.ProcessStats, snapshot types.ProcessSnapshot) {
+	stats.UUID = snapshot.UUID
+	stats.Labels = maps.Clone(snapshot.Labels)
+	stats.RestartCount = snapshot.RestartCount
+}
+
+// annotateManaged 为属于本管理器正在运行的进程的统计信息填入UUID、标签和重启次数
+func (pm *ProcessManagerWithMonitor) annotateManaged(statsList []types.ProcessStats) {
+	for i := range statsList {
+		if snapshot, ok := pm.managedSnapshot(statsList[i].PID); ok {
+			annotateStats(&statsList[i], snapshot)
+		}
+	}
 }
 
-// GetProcessStatsByName 按进程名获取统计信息
+// GetProcessStatsByName 按进程名获取统计信息，本管理器的进程附带其UUID、标签和重启次数
 func (pm *ProcessManagerWithMonitor) GetProcessStatsByName(name string) ([]types.ProcessStats, error) {
-	return pm.monitorManager.GetProcessStatsByName(name)
+	statsList, err := pm.monitorManager.GetProcessStatsByName(name)
+	pm.annotateManaged(statsList)
+	return statsList, err
+}
+
+// GetProcessStatsByNameContext 根据进程名获取统计信息，ctx取消时中止查找并返回ctx.Err()
+func (pm *ProcessManagerWithMonitor) GetProcessStatsByNameContext(ctx context.Context, name string) ([]types.ProcessStats, error) {
+	statsList, err := pm.monitorManager.GetProcessStatsByNameContext(ctx, name)
+	pm.annotateManaged(statsList)
+	return statsList, err
+}
+
+// GetProcessStatsByNameLimited 根据进程名获取排序后的前opts.Limit个进程的统计信息，并返回匹配的进程总数
+func (pm *ProcessManagerWithMonitor) GetProcessStatsByNameLimited(ctx context.Context, name string, opts types.NameQueryOptions) ([]types.ProcessStats, int, error) {
+	statsList, total, err := pm.monitorManager.GetProcessStatsByNameLimited(ctx, name, opts)
+	pm.annotateManaged(statsList)
+	return statsList, total, err
 }
 
-// GetProcessStatsByUUID 按UUID获取进程统计信息
+// GetProcessStatsByUUID 按UUID获取进程统计信息，附带进程的UUID、标签和重启次数
 func (pm *ProcessManagerWithMonitor) GetProcessStatsByUUID(uuid string) (*types.ProcessStats, error) {
-	processInfo, exists := pm.GetProcess(uuid)
+	snapshot, exists := pm.GetSnapshot(uuid)
 	if !exists {
 		return nil, fmt.Errorf("process with UUID %s not found", uuid)
 	}
 
-	return pm.monitorManager.GetProcessStats(processInfo.PID)
+	stats, err := pm.monitorManager.GetProcessStats(snapshot.PID)
+	if err != nil {
+		return nil, err
+	}
+	annotateStats(stats, snapshot)
+	return stats, nil
 }
 
-// GetAllMonitoredStats 获取所有被监控进程的统计信息
+// GetLastSampleByUUID 根据UUID获取进程最近一次采集的样本，尚无样本时返回false
+func (pm *ProcessManagerWithMonitor) GetLastSampleByUUID(uuid string) (types.ProcessStats, bool) {
+	snapshot, exists := pm.GetSnapshot(uuid)
+	if !exists {
+		return types.ProcessStats{}, false
+	}
+	sample, ok := pm.monitorManager.GetLastSample(snapshot.PID)
+	if ok {
+		annotateStats(&sample, snapshot)
+	}
+	return sample, ok
+}
+
+// GetProcessStatsByUUIDs 批量获取多个进程的统计信息，返回成功的结果和每个失败UUID的错误。
+// 最近一个采集间隔内已有样本的进程直接使用该样本，其余进程实时采集
+func (pm *ProcessManagerWithMonitor) GetProcessStatsByUUIDs(uuids []string) (map[string]types.ProcessStats, map[string]error) {
+	results := make(map[string]types.ProcessStats, len(uuids))
+	errs := make(map[string]error)
+
+	// 一次取得所有进程的快照，避免逐个加锁
+	snapshots := make(map[string]types.ProcessSnapshot)
+	for _, snapshot := range pm.Snapshot() {
+		snapshots[snapshot.UUID] = snapshot
+	}
+	maxAge := pm.monitorManager.GetInterval()
+
+	for _, uuid := range uuids {
+		snapshot, exists := snapshots[uuid]
+		switch {
+		case !exists:
+			errs[uuid] = fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+			continue
+		case !snapshot.Running:
+			errs[uuid] = fmt.Errorf("process %s is not running", uuid)
+			continue
+		}
+
+		if sample, ok := pm.monitorManager.GetLastSample(snapshot.PID); ok && time.Since(sample.Timestamp) <= maxAge {
+			annotateStats(&sample, snapshot)
+			results[uuid] = sample
+			continue
+		}
+
+		stats, err := pm.monitorManager.GetProcessStats(snapshot.PID)
+		if err != nil {
+			errs[uuid] = err
+			continue
+		}
+		annotateStats(stats, snapshot)
+		results[uuid] = *stats
+	}
+
+	return results, errs
+}
+
+// detailHistorySize GetProcessDetail返回的历史采样数
+const detailHistorySize = 30
+
+// GetProcessDetail 一次获取进程状态、最近一次采样和最近的历史数据，
+// 供仪表盘的进程详情页使用，避免多次调用之间进程状态发生变化
+func (pm *ProcessManagerWithMonitor) GetProcessDetail(uuid string) (*types.ProcessDetail, error) {
+	snapshot, exists := pm.GetSnapshot(uuid)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	detail := &types.ProcessDetail{Process: snapshot}
+	if !snapshot.Running {
+		if !snapshot.EndTime.IsZero() {
+			detail.Uptime = snapshot.EndTime.Sub(snapshot.StartTime)
+		}
+	} else {
+		detail.Uptime = pm.clock.Now().Sub(snapshot.StartTime)
+		if stats, ok := pm.monitorManager.GetLastSample(snapshot.PID); ok {
+			annotateStats(&stats, snapshot)
+			detail.Stats = &stats
+		}
+		detail.History, _ = pm.monitorManager.GetProcessHistory(snapshot.PID, detailHistorySize)
+		for i := range detail.History {
+			annotateStats(&detail.History[i], snapshot)
+		}
+	}
+	return detail, nil
+}
+
+// GetAllMonitoredStats 获取所有被监控进程的统计信息，本管理器的进程附带其UUID、标签和重启次数
 func (pm *ProcessManagerWithMonitor) GetAllMonitoredStats() ([]types.ProcessStats, error) {
-	return pm.monitorManager.GetAllStats()
+	statsList, err := pm.monitorManager.GetAllStats()
+	pm.annotateManaged(statsList)
+	return statsList, err
 }
 
-// GetProcessHistory 获取进程历史统计
+// GetProcessHistory 获取进程历史统计，pid属于本管理器正在运行的进程时附带其UUID、标签和重启次数
 func (pm *ProcessManagerWithMonitor) GetProcessHistory(pid int, count int) ([]types.ProcessStats, error) {
-	return pm.monitorManager.GetProcessHistory(pid, count)
+	history, err := pm.monitorManager.GetProcessHistory(pid, count)
+	pm.annotateManaged(history)
+	return history, err
 }
 
 // GetProcessHistoryByUUID 按UUID获取进程历史统计
 func (pm *ProcessManagerWithMonitor) GetProcessHistoryByUUID(uuid string, count int) ([]types.ProcessStats, error) {
-	processInfo, exists := pm.GetProcess(uuid)
+	snapshot, exists := pm.GetSnapshot(uuid)
 	if !exists {
 		return nil, fmt.Errorf("process with UUID %s not found", uuid)
 	}
 
-	return pm.monitorManager.GetProcessHistory(processInfo.PID, count)
+	history, err := pm.monitorManager.GetProcessHistory(snapshot.PID, count)
+	for i := range history {
+		annotateStats(&history[i], snapshot)
+	}
+	return history, err
 }
 
-// AddProcessToMonitor 添加进程到监控
+// AddProcessToMonitor 添加进程到监控，使用WithManagedMonitoringOnly创建时
+// 只接受本管理器启动的进程，其他PID返回ErrNotManaged
 func (pm *ProcessManagerWithMonitor) AddProcessToMonitor(pid int, name string) error {
+	if pm.managedOnly && !pm.isManagedPID(pid) {
+		return fmt.Errorf("%w: PID %d", ErrNotManaged, pid)
+	}
 	return pm.monitorManager.AddProcess(pid, name)
 }
 
@@ -131,21 +359,169 @@ func (pm *ProcessManagerWithMonitor) UpdateMonitorConfig(config types.MonitorCon
 	return pm.monitorManager.UpdateConfig(config)
 }
 
+// SelfCheck 检查进程管理器和进程监控器依赖的外部程序是否存在且可用
+func (pm *ProcessManagerWithMonitor) SelfCheck() []error {
+	return append(pm.ProcessManager.SelfCheck(), pm.monitorManager.SelfCheck()...)
+}
+
+// MonitorHealth 获取进程监控器自身的运行指标，以及进程管理器当前持有的协程和管道数，
+// 可用于发现进程退出后未释放的资源
+func (pm *ProcessManagerWithMonitor) MonitorHealth() types.MonitorHealth {
+	health := pm.monitorManager.MonitorHealth()
+	health.Goroutines = pm.goroutines.Load()
+	health.OpenPipes = pm.openPipes.Load()
+	return health
+}
+
 // GetMonitoredProcesses 获取被监控的进程列表
-func (pm *ProcessManagerWithMonitor) GetMonitoredProcesses() map[int]string {
+func (pm *ProcessManagerWithMonitor) GetMonitoredProcesses() map[int]types.MonitoredProcess {
 	return pm.monitorManager.GetMonitoredProcesses()
 }
 
-// MonitorProcessByName 按进程名监控进程
+// MonitorProcessByName 按进程名监控进程，使用WithManagedMonitoringOnly创建时只添加本管理器启动的进程
 func (pm *ProcessManagerWithMonitor) MonitorProcessByName(name string) error {
 	pids, err := pm.monitorManager.GetProcessStatsByName(name)
 	if err != nil {
 		return err
 	}
 
+	added := 0
 	for _, stats := range pids {
+		if pm.managedOnly && !pm.isManagedPID(stats.PID) {
+			continue
+		}
 		pm.monitorManager.AddProcess(stats.PID, stats.Name)
+		added++
+	}
+
+	if added == 0 && len(pids) > 0 {
+		return fmt.Errorf("%w: no managed process named %s", ErrNotManaged, name)
+	}
+	return nil
+}
+
+// GetRawProcessStat 获取进程的原始状态字段，见monitor.ProcessMonitorManager.GetRawProcessStat。
+// 只监控托管进程时，其他PID返回ErrNotManaged
+func (pm *ProcessManagerWithMonitor) GetRawProcessStat(pid int) (map[string]string, error) {
+	if pm.managedOnly && !pm.isManagedPID(pid) {
+		return nil, fmt.Errorf("%w: PID %d", ErrNotManaged, pid)
+	}
+	return pm.monitorManager.GetRawProcessStat(pid)
+}
+
+// isManagedPID 判断pid是否属于本管理器正在运行的进程
+func (pm *ProcessManagerWithMonitor) isManagedPID(pid int) bool {
+	_, ok := pm.managedSnapshot(pid)
+	return ok
+}
+
+// managedSnapshot 通过PID索引返回pid对应的本管理器正在运行的进程的快照
+func (pm *ProcessManagerWithMonitor) managedSnapshot(pid int) (types.ProcessSnapshot, bool) {
+	pm.mu.RLock()
+	uuid, exists := pm.pids[pid]
+	pm.mu.RUnlock()
+	if !exists {
+		return types.ProcessSnapshot{}, false
+	}
+
+	snapshot, exists := pm.GetSnapshot(uuid)
+	if !exists || !snapshot.Running || snapshot.PID != pid {
+		return types.ProcessSnapshot{}, false
+	}
+	return snapshot, true
+}
+
+// SetProcessIdleConfig 设置进程空闲自动停止配置。配置随进程保存，
+// 进程重启、重载或空闲停止后再次启动时继续生效
+func (pm *ProcessManagerWithMonitor) SetProcessIdleConfig(uuid string, config types.IdleConfig) error {
+	processInfo, exists := pm.GetProcess(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	if err := pm.monitorManager.SetIdleConfig(processInfo.PID, config); err != nil {
+		return err
 	}
 
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.pruneRunConfig()
+	pm.idleConfigs[uuid] = config
 	return nil
 }
+
+// GetProcessIdleConfig 获取进程空闲自动停止配置
+func (pm *ProcessManagerWithMonitor) GetProcessIdleConfig(uuid string) (types.IdleConfig, bool) {
+	if _, exists := pm.GetSnapshot(uuid); !exists {
+		return types.IdleConfig{}, false
+	}
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	config, exists := pm.idleConfigs[uuid]
+	return config, exists
+}
+
+// SetProcessUsageBaseline 设置进程的预期资源使用，偏离超过允许范围时产生告警。
+// 基线随进程保存，进程重启或重载后继续生效
+func (pm *ProcessManagerWithMonitor) SetProcessUsageBaseline(uuid string, baseline types.UsageBaseline) error {
+	snapshot, exists := pm.GetSnapshot(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	if err := pm.monitorManager.SetUsageBaseline(snapshot.PID, baseline); err != nil {
+		return err
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.pruneRunConfig()
+	pm.baselines[uuid] = baseline
+	return nil
+}
+
+// GetDeviationAlerts 获取最近的资源使用偏离告警
+func (pm *ProcessManagerWithMonitor) GetDeviationAlerts() []types.DeviationAlert {
+	return pm.monitorManager.GetAlerts()
+}
+
+// handleIdle 处理空闲超时的进程
+func (pm *ProcessManagerWithMonitor) handleIdle(pid int, name string, config types.IdleConfig) {
+	snapshot, ok := pm.managedSnapshot(pid)
+	if !ok {
+		return
+	}
+
+	pm.monitorManager.RemoveProcess(pid)
+	if err := pm.stopIdleProcess(snapshot.UUID, config.KeepDefinition); err != nil {
+		pm.event(types.EventError, snapshot.UUID, name, "Failed to stop idle process %s (PID: %d): %v", name, pid, err)
+	}
+}
+
+// GroupStats 汇总进程组内运行中进程的资源使用，尚未采集到数据的进程只计入Running
+func (pm *ProcessManagerWithMonitor) GroupStats(name string) (*types.GroupStats, error) {
+	uuids, err := pm.GroupMembers(name)
+	if err != nil {
+		return nil, err
+	}
+
+	groupStats := &types.GroupStats{Name: name, Members: len(uuids)}
+	for _, uuid := range uuids {
+		snapshot, exists := pm.GetSnapshot(uuid)
+		if !exists || !snapshot.Running {
+			continue
+		}
+		groupStats.Running++
+
+		stats, err := pm.monitorManager.GetProcessStats(snapshot.PID)
+		if err != nil {
+			continue
+		}
+		annotateStats(stats, snapshot)
+		groupStats.CPUPercent += stats.CPUPercent
+		groupStats.MemoryBytes += stats.MemoryBytes
+		groupStats.Processes = append(groupStats.Processes, *stats)
+	}
+	return groupStats, nil
+}
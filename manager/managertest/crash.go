@@ -0,0 +1,66 @@
+package managertest
+
+import (
+	"fmt"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// Manager is the part of a process manager the crash helpers need; it is
+// implemented by manager.ProcessManager and manager.ProcessManagerWithMonitor
+type Manager interface {
+	GetSnapshot(uuid string) (types.ProcessSnapshot, bool)
+}
+
+// Process returns the fake process with the given PID, or nil
+func (r *FakeRunner) Process(pid int) *FakeProcess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.processes {
+		if p.pid == pid {
+			return p
+		}
+	}
+	return nil
+}
+
+// SetExitSequence makes the next processes started with the given name crash
+// with the given exit codes, one code per process and in order, so a test can
+// drive the exact exit sequence the restart logic sees. A process exits when
+// its Behavior says so, e.g. after RunFor, or when it is stopped. Processes
+// started after the sequence is used up behave normally again.
+func (r *FakeRunner) SetExitSequence(name string, codes ...int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequences[name] = append([]int(nil), codes...)
+}
+
+// CrashOnExit makes the next exit of the fake process, whatever causes it,
+// look like a crash with the given exit code
+func (p *FakeProcess) CrashOnExit(code int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.crash = &code
+}
+
+// SimulateCrash crashes the current run of the managed process with the given
+// UUID with the given exit code, as if the program had died by itself. The
+// manager's monitor then handles the exit like any other crash: exit code
+// policy, restart budget, auto-restart.
+func SimulateCrash(pm Manager, runner *FakeRunner, uuid string, code int) error {
+	snapshot, exists := pm.GetSnapshot(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+	if !snapshot.Running {
+		return fmt.Errorf("process %s is not running", uuid)
+	}
+
+	process := runner.Process(snapshot.PID)
+	if process == nil {
+		return fmt.Errorf("process %s (PID %d) was not started by the fake runner", uuid, snapshot.PID)
+	}
+	process.Crash(code)
+	return nil
+}
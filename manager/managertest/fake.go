@@ -0,0 +1,223 @@
+// Package managertest provides an in-memory process backend for testing code
+// built on the process manager without spawning real binaries.
+package managertest
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// Behavior describes how fake processes with a given name behave
+type Behavior struct {
+	RunFor   time.Duration // exit with ExitCode after this long; 0 runs until killed
+	ExitCode int           // exit code used when RunFor elapses
+	StartErr error         // error returned by Start
+
+	IgnoreTerminate bool // Terminate does not make the process exit
+	IgnoreKill      bool // Kill does not make the process exit, like one stuck in uninterruptible sleep
+}
+
+// FakeRunner is a ProcessRunner that creates in-memory fake processes
+type FakeRunner struct {
+	mu        sync.Mutex
+	nextPID   int
+	behaviors map[string]Behavior
+	processes []*FakeProcess
+	exited    []*FakeProcess
+	sequences map[string][]int // crash codes of the next processes by name
+}
+
+// NewFakeRunner creates a new FakeRunner
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{
+		nextPID:   10000,
+		behaviors: make(map[string]Behavior),
+		sequences: make(map[string][]int),
+	}
+}
+
+// SetBehavior sets the behavior of processes started with the given name
+func (r *FakeRunner) SetBehavior(name string, behavior Behavior) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.behaviors[name] = behavior
+}
+
+// Command creates a fake process
+func (r *FakeRunner) Command(name string, args []string, listeners []*os.File) (types.Process, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextPID++
+	p := &FakeProcess{
+		Name:      name,
+		Args:      args,
+		Listeners: listeners,
+		behavior:  r.behaviors[name],
+		pid:       r.nextPID,
+		exitCode:  -1,
+		done:      make(chan struct{}),
+		runner:    r,
+	}
+	if codes := r.sequences[name]; len(codes) > 0 {
+		code := codes[0]
+		p.crash = &code
+		r.sequences[name] = codes[1:]
+	}
+	r.processes = append(r.processes, p)
+	return p, nil
+}
+
+// Processes returns every fake process created so far, in creation order
+func (r *FakeRunner) Processes() []*FakeProcess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]*FakeProcess, len(r.processes))
+	copy(result, r.processes)
+	return result
+}
+
+// Exited returns the fake processes that have exited, in exit order
+func (r *FakeRunner) Exited() []*FakeProcess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]*FakeProcess, len(r.exited))
+	copy(result, r.exited)
+	return result
+}
+
+// Last returns the most recently created fake process, or nil
+func (r *FakeRunner) Last() *FakeProcess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.processes) == 0 {
+		return nil
+	}
+	return r.processes[len(r.processes)-1]
+}
+
+// FakeProcess is an in-memory process whose lifetime is controlled by its
+// Behavior or explicitly through Exit and Crash
+type FakeProcess struct {
+	Name      string
+	Args      []string
+	Listeners []*os.File
+
+	behavior Behavior
+	pid      int
+	runner   *FakeRunner
+
+	mu       sync.Mutex
+	started  bool
+	exited   bool
+	exitCode int
+	err      error
+	crash    *int // exit code the next exit is reported with as a crash
+	done     chan struct{}
+}
+
+// Start starts the fake process
+func (p *FakeProcess) Start() error {
+	if p.behavior.StartErr != nil {
+		return p.behavior.StartErr
+	}
+
+	p.mu.Lock()
+	p.started = true
+	p.mu.Unlock()
+
+	if p.behavior.RunFor > 0 {
+		time.AfterFunc(p.behavior.RunFor, func() {
+			p.Exit(p.behavior.ExitCode)
+		})
+	}
+	return nil
+}
+
+// Wait blocks until the fake process exits
+func (p *FakeProcess) Wait() error {
+	<-p.done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Terminate asks the fake process to exit, unless its behavior ignores it
+func (p *FakeProcess) Terminate() error {
+	if !p.behavior.IgnoreTerminate {
+		p.finish(-1, fmt.Errorf("signal: terminated"))
+	}
+	return nil
+}
+
+// Kill terminates the fake process as if by a signal, unless its behavior
+// ignores it
+func (p *FakeProcess) Kill() error {
+	if !p.behavior.IgnoreKill {
+		p.finish(-1, fmt.Errorf("signal: killed"))
+	}
+	return nil
+}
+
+// Pid returns the fake process ID
+func (p *FakeProcess) Pid() int {
+	return p.pid
+}
+
+// ExitCode returns the exit code, or -1 if the process has not exited
+func (p *FakeProcess) ExitCode() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exitCode
+}
+
+// Exit makes the fake process exit with the given code
+func (p *FakeProcess) Exit(code int) {
+	var err error
+	if code != 0 {
+		err = fmt.Errorf("exit status %d", code)
+	}
+	p.finish(code, err)
+}
+
+// Crash makes the fake process exit abnormally with the given code
+func (p *FakeProcess) Crash(code int) {
+	p.finish(code, fmt.Errorf("exit status %d (crashed)", code))
+}
+
+// Running reports whether the fake process has started and not yet exited
+func (p *FakeProcess) Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.started && !p.exited
+}
+
+// finish records the exit of the fake process once
+func (p *FakeProcess) finish(code int, err error) {
+	p.mu.Lock()
+	if p.exited {
+		p.mu.Unlock()
+		return
+	}
+	if p.crash != nil {
+		code, err = *p.crash, fmt.Errorf("exit status %d (crashed)", *p.crash)
+	}
+	p.exited = true
+	p.exitCode = code
+	p.err = err
+	p.mu.Unlock()
+
+	p.runner.mu.Lock()
+	p.runner.exited = append(p.runner.exited, p)
+	p.runner.mu.Unlock()
+
+	close(p.done)
+}
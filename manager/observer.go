@@ -0,0 +1,39 @@
+package manager
+
+// runObserver is told about the runs of managed processes, so that
+// ProcessManagerWithMonitor can follow a process whichever way it was started
+// and across restarts and reloads, which change its PID. Methods are called
+// without pm.mu held.
+type runObserver interface {
+	// runStarted is called when a run of the process with the given UUID
+	// started, by any of the Start methods, a restart or a reload
+	runStarted(uuid string, pid int, name string)
+	// runReplaced is called when a restart moved the process to a new
+	// record, after the first run of the new record started
+	runReplaced(oldUUID, newUUID string)
+	// runEnded is called when a run exited, or was given up on by
+	// ForgetProcess, before any auto-restart
+	runEnded(uuid string, pid int)
+}
+
+// notifyRunStarted tells the observer, if any, about a new run
+func (pm *ProcessManager) notifyRunStarted(uuid string, pid int, name string) {
+	if pm.observer != nil {
+		pm.observer.runStarted(uuid, pid, name)
+	}
+}
+
+// notifyRunReplaced tells the observer, if any, that a restart replaced the
+// record of a process
+func (pm *ProcessManager) notifyRunReplaced(oldUUID, newUUID string) {
+	if pm.observer != nil {
+		pm.observer.runReplaced(oldUUID, newUUID)
+	}
+}
+
+// notifyRunEnded tells the observer, if any, that a run is over
+func (pm *ProcessManager) notifyRunEnded(uuid string, pid int) {
+	if pm.observer != nil {
+		pm.observer.runEnded(uuid, pid)
+	}
+}
@@ -0,0 +1,163 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dreamsxin/process-manager/types"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxStatusMatchLength bounds the regular expression work per output line:
+// only the first bytes of a line are matched against a status pattern
+const maxStatusMatchLength = 1024
+
+// SetStatusPattern makes a process started with stdio report its own status:
+// every stdout line is matched against pattern and, on a match, capture group
+// 1 (or the whole match when the pattern has no groups) becomes the AppStatus
+// of the process snapshot, e.g. `^status: (.+)$` for "status: waiting for
+// DB". Only the first 1 KiB of each line is matched, after transcoding it
+// like ProcessOutput. The pattern is kept across restarts while AppStatus
+// starts empty for every run. An empty pattern removes it and clears the
+// status.
+func (pm *ProcessManager) SetStatusPattern(uuid string, pattern string) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid status pattern: %v", err)
+		}
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if !processInfo.Stdio {
+		return fmt.Errorf("process %s was not started with stdio", uuid)
+	}
+	processInfo.StatusRegexp = re
+	if re == nil {
+		processInfo.AppStatus = ""
+	}
+	return nil
+}
+
+// statusMatcher returns the output line hook that updates the AppStatus of
+// the process with the given UUID
+func (pm *ProcessManager) statusMatcher(uuid string) func(line []byte) {
+	return func(line []byte) {
+		value, exists := pm.processes.Load(uuid)
+		if !exists {
+			return
+		}
+
+		processInfo := value.(*types.ProcessInfo)
+		pm.mu.RLock()
+		re := processInfo.StatusRegexp
+		enc := pm.outputEncoding
+		pm.mu.RUnlock()
+		if re == nil {
+			return
+		}
+
+		if len(line) > maxStatusMatchLength {
+			line = line[:maxStatusMatchLength]
+		}
+		match := re.FindStringSubmatch(decodeOutput(line, enc))
+		if match == nil {
+			return
+		}
+		status := match[0]
+		if len(match) > 1 {
+			status = match[1]
+		}
+
+		pm.mu.Lock()
+		if processInfo.StatusRegexp == re {
+			processInfo.AppStatus = status
+		}
+		pm.mu.Unlock()
+	}
+}
+
+// SetOutputEncoding sets the character encoding of process output, e.g.
+// "gbk" or "windows-1252" for programs writing in a Windows code page.
+// ProcessOutput transcodes output from this encoding to UTF-8. The empty
+// string or "utf-8" treats output as UTF-8.
+func (pm *ProcessManager) SetOutputEncoding(name string) error {
+	var enc encoding.Encoding
+	if name != "" {
+		var err error
+		if enc, err = htmlindex.Get(name); err != nil {
+			return fmt.Errorf("unknown output encoding %q", name)
+		}
+		if enc == encoding.Nop || isUTF8(enc) {
+			enc = nil
+		}
+	}
+
+	pm.mu.Lock()
+	pm.outputEncoding = enc
+	pm.mu.Unlock()
+	return nil
+}
+
+// isUTF8 reports whether enc is the UTF-8 encoding
+func isUTF8(enc encoding.Encoding) bool {
+	name, err := htmlindex.Name(enc)
+	return err == nil && name == "utf-8"
+}
+
+// ProcessOutput returns up to the last n buffered lines of stdout of a process
+// started with StartProcessWithStdio, oldest first and without line endings;
+// n <= 0 returns the whole backlog. The lines are transcoded from the
+// encoding set by SetOutputEncoding, and each run of bytes that is not valid
+// in it is replaced with U+FFFD, so the result can always be encoded as
+// JSON. Use ProcessOutputRaw to get the bytes as written.
+func (pm *ProcessManager) ProcessOutput(uuid string, n int) ([]string, error) {
+	raw, err := pm.ProcessOutputRaw(uuid, n)
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.RLock()
+	enc := pm.outputEncoding
+	pm.mu.RUnlock()
+
+	lines := make([]string, len(raw))
+	for i, line := range raw {
+		lines[i] = decodeOutput(line, enc)
+	}
+	return lines, nil
+}
+
+// ProcessOutputRaw is like ProcessOutput but returns the lines as written by
+// the process, including line endings
+func (pm *ProcessManager) ProcessOutputRaw(uuid string, n int) ([][]byte, error) {
+	streams, err := pm.processStdioFor(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return streams.stdout.Lines(n), nil
+}
+
+// decodeOutput converts a line of output to valid UTF-8 without its line ending
+func decodeOutput(line []byte, enc encoding.Encoding) string {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if enc != nil {
+		if decoded, err := enc.NewDecoder().Bytes(line); err == nil {
+			line = decoded
+		}
+	}
+	return strings.ToValidUTF8(string(line), "�")
+}
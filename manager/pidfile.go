@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// SetPIDFile makes the manager keep the PID of a process in the file at path,
+// for external tools such as logrotate or monitoring scripts. The file is
+// written immediately, rewritten with the new PID on every restart and removed
+// when the process exits or is stopped. An empty path removes the file and
+// stops tracking.
+func (pm *ProcessManager) SetPIDFile(uuid string, path string) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	old := processInfo.PIDFile
+	processInfo.PIDFile = path
+	pid := processInfo.PID
+	running := processInfo.Running
+	pm.mu.Unlock()
+
+	if old != "" && old != path {
+		removePIDFile(old, pid)
+	}
+	if path == "" || !running {
+		return nil
+	}
+	return writePIDFile(path, pid)
+}
+
+// updatePIDFile writes the current PID of a process to its PID file, if any
+func (pm *ProcessManager) updatePIDFile(processInfo *types.ProcessInfo) {
+	pm.mu.RLock()
+	path := processInfo.PIDFile
+	pid := processInfo.PID
+	pm.mu.RUnlock()
+
+	if path == "" {
+		return
+	}
+	if err := writePIDFile(path, pid); err != nil {
+		fmt.Printf("Failed to write PID file %s: %v\n", path, err)
+	}
+}
+
+// clearPIDFile removes the PID file of a process if it still holds its PID
+func (pm *ProcessManager) clearPIDFile(processInfo *types.ProcessInfo) {
+	pm.mu.RLock()
+	path := processInfo.PIDFile
+	pid := processInfo.PID
+	pm.mu.RUnlock()
+
+	if path != "" {
+		removePIDFile(path, pid)
+	}
+}
+
+// writePIDFile atomically replaces the file at path with pid
+func writePIDFile(path string, pid int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create PID file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := fmt.Fprintf(tmp, "%d\n", pid); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write PID file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write PID file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write PID file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write PID file: %v", err)
+	}
+	return nil
+}
+
+// removePIDFile removes the file at path unless it has since been rewritten
+// with another PID, e.g. by the restarted process
+func removePIDFile(path string, pid int) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if current, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && current != pid {
+		return
+	}
+	os.Remove(path)
+}
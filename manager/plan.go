@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// PlanRestart reports what RestartProcess would do to a process right now
+// without doing it: whether the current run is stopped first, the stop
+// signals and grace period, an upper bound of the downtime, and whether the
+// process is in restart backoff because its restart budget is used up.
+// RestartProcess always stops the old run before starting the new one under
+// a new UUID; the backoff only delays auto-restarts.
+func (pm *ProcessManager) PlanRestart(uuid string) (types.RestartPlan, error) {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return types.RestartPlan{}, fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	killTimeout := pm.KillTimeout()
+	now := pm.clock.Now()
+	processInfo := value.(*types.ProcessInfo)
+
+	pm.mu.RLock()
+	plan := types.RestartPlan{
+		UUID:             uuid,
+		Name:             processInfo.Name,
+		Running:          processInfo.Running,
+		NewUUID:          true,
+		KillTimeout:      killTimeout,
+		AutoRestart:      processInfo.Restart,
+		AutoRestartDelay: RestartDelay,
+		RestartBudget:    processInfo.RestartBudgetRemaining(now),
+	}
+	if plan.RestartBudget == 0 {
+		plan.Backoff = true
+		plan.BackoffUntil = budgetResetAt(processInfo, now)
+	}
+	pm.mu.RUnlock()
+
+	if plan.Running {
+		plan.ExpectedDowntime = killTimeout + restartPause
+		if _, ok := pm.runner.(execRunner); ok {
+			plan.Signals = append([]string(nil), stopSignals...)
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,206 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dreamsxin/process-manager/system"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// MetricsOptions Prometheus指标输出选项
+//
+// 默认每个进程带uuid标签，重启会产生新的UUID，大量短生命周期进程会导致
+// 时间序列基数快速增长。NameOnly模式去掉uuid标签，把名称和标签相同的进程
+// 聚合为一条序列(数值求和)，适合这类场景。
+//
+// SystemMonitor不为nil时，同时输出该系统监控器的运行指标(monitor="system")。
+type MetricsOptions struct {
+	NameOnly      bool
+	SystemMonitor *system.SystemMonitor
+}
+
+// metricDescs 输出的指标及其帮助信息，按输出顺序排列
+var metricDescs = []struct {
+	name, help, kind string
+}{
+	{"pm_process_up", "Whether the process is running (number of running processes in name-only mode)", "gauge"},
+	{"pm_process_cpu_percent", "CPU usage of the process in percent", "gauge"},
+	{"pm_process_memory_bytes", "Resident memory of the process in bytes", "gauge"},
+	{"pm_process_restarts_total", "Number of times the process has been restarted", "counter"},
+}
+
+// healthDescs 监控器运行指标及其帮助信息，按输出顺序排列
+var healthDescs = []struct {
+	name, help, kind string
+	value            func(h types.MonitorHealth) float64
+}{
+	{"pm_monitor_collections_total", "Number of completed collection cycles", "counter",
+		func(h types.MonitorHealth) float64 { return float64(h.Collections) }},
+	{"pm_monitor_failures_total", "Number of failed collection cycles", "counter",
+		func(h types.MonitorHealth) float64 { return float64(h.Failures) }},
+	{"pm_monitor_skipped_total", "Number of collection cycles missed because a collection overran the interval", "counter",
+		func(h types.MonitorHealth) float64 { return float64(h.Skipped) }},
+	{"pm_monitor_collection_duration_seconds", "Average duration of a collection cycle in seconds", "gauge",
+		func(h types.MonitorHealth) float64 { return h.AverageDuration.Seconds() }},
+	{"pm_monitor_last_collection_duration_seconds", "Duration of the most recent collection cycle in seconds", "gauge",
+		func(h types.MonitorHealth) float64 { return h.LastDuration.Seconds() }},
+	{"pm_monitor_processes", "Number of processes currently monitored", "gauge",
+		func(h types.MonitorHealth) float64 { return float64(h.MonitoredProcesses) }},
+}
+
+// WritePrometheus 以Prometheus文本格式输出所有托管进程的指标。
+// 进程名作为name标签，ProcessInfo.Labels作为附加标签，标签名中的非法字符替换为下划线，
+// 与内置标签(name、uuid)冲突的标签名加label_前缀
+func (pm *ProcessManagerWithMonitor) WritePrometheus(w io.Writer, opts MetricsOptions) error {
+	stats, err := pm.monitorManager.GetAllStats()
+	if err != nil {
+		return err
+	}
+
+	usage := make(map[int]types.ProcessStats, len(stats))
+	for _, s := range stats {
+		usage[s.PID] = s
+	}
+
+	// 按标签集合聚合，key为格式化后的标签
+	values := make(map[string][]float64)
+	for _, info := range pm.ListProcesses() {
+		pm.ProcessManager.mu.RLock()
+		labels := metricLabels(info, opts)
+		running := info.Running
+		restarts := info.TotalRestarts
+		pm.ProcessManager.mu.RUnlock()
+
+		sample := make([]float64, len(metricDescs))
+		sample[3] = float64(restarts)
+		if running {
+			sample[0] = 1
+			if s, exists := usage[info.PID]; exists {
+				sample[1] = s.CPUPercent
+				sample[2] = float64(s.MemoryBytes)
+			}
+		}
+
+		if existing, exists := values[labels]; exists {
+			for i := range existing {
+				existing[i] += sample[i]
+			}
+			continue
+		}
+		values[labels] = sample
+	}
+
+	series := make([]string, 0, len(values))
+	for labels := range values {
+		series = append(series, labels)
+	}
+	sort.Strings(series)
+
+	for i, desc := range metricDescs {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", desc.name, desc.help, desc.name, desc.kind); err != nil {
+			return err
+		}
+		for _, labels := range series {
+			if _, err := fmt.Fprintf(w, "%s{%s} %g\n", desc.name, labels, values[labels][i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeMonitorHealth(w, pm.MonitorHealth(), opts.SystemMonitor)
+}
+
+// writeMonitorHealth 输出进程监控器和(可选的)系统监控器的运行指标
+func writeMonitorHealth(w io.Writer, process types.MonitorHealth, sm *system.SystemMonitor) error {
+	labels := []string{"process"}
+	healths := []types.MonitorHealth{process}
+	if sm != nil {
+		labels = append(labels, "system")
+		healths = append(healths, sm.MonitorHealth())
+	}
+
+	for _, desc := range healthDescs {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", desc.name, desc.help, desc.name, desc.kind); err != nil {
+			return err
+		}
+		for i, health := range healths {
+			if _, err := fmt.Fprintf(w, "%s{monitor=\"%s\"} %g\n", desc.name, labels[i], desc.value(health)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MetricsHandler 返回输出Prometheus指标的HTTP处理器
+func (pm *ProcessManagerWithMonitor) MetricsHandler(opts MetricsOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := pm.WritePrometheus(w, opts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// metricLabels 生成进程的标签字符串，按标签名排序，调用方需持有锁
+func metricLabels(info *types.ProcessInfo, opts MetricsOptions) string {
+	labels := map[string]string{"name": info.Name}
+	if !opts.NameOnly {
+		labels["uuid"] = info.UUID
+	}
+
+	for key, value := range info.Labels {
+		name := sanitizeLabelName(key)
+		if name == "name" || name == "uuid" {
+			name = "label_" + name
+		}
+		labels[name] = value
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(labels[name]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// sanitizeLabelName 将标签名转换为合法的Prometheus标签名([a-zA-Z_][a-zA-Z0-9_]*)，
+// 以__开头的名称为Prometheus保留，改为label_前缀
+func sanitizeLabelName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	sanitized := b.String()
+	if sanitized == "" || strings.HasPrefix(sanitized, "__") {
+		sanitized = "label_" + strings.TrimLeft(sanitized, "_")
+	}
+	return sanitized
+}
+
+// escapeLabelValue 转义标签值中的反斜杠、双引号和换行，并替换非法UTF-8
+func escapeLabelValue(value string) string {
+	value = strings.ToValidUTF8(value, "�")
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,32 @@
+package manager
+
+import "github.com/dreamsxin/process-manager/types"
+
+// ProcessReader is a read-only view of a process manager, for components that
+// may inspect processes but must not start or stop them. Every result is a
+// copy, so callers cannot modify the manager's records through it; this is
+// why ListProcesses, which returns the live records, is not part of it and
+// ListSnapshots takes its place. Resource usage needs a monitor, so the stats
+// queries are in MonitoredProcessReader, which ProcessManagerWithMonitor
+// satisfies.
+type ProcessReader interface {
+	GetProcess(uuid string) (types.ProcessSnapshot, bool)
+	ListSnapshots() []types.ProcessSnapshot
+	Snapshot() []types.ProcessSnapshot
+	GetSnapshot(uuid string) (types.ProcessSnapshot, bool)
+}
+
+// MonitoredProcessReader extends ProcessReader with resource usage queries
+type MonitoredProcessReader interface {
+	ProcessReader
+	GetProcessStatsByUUID(uuid string) (*types.ProcessStats, error)
+	GetProcessStatsByUUIDs(uuids []string) (map[string]types.ProcessStats, map[string]error)
+	GetLastSampleByUUID(uuid string) (types.ProcessStats, bool)
+	GetProcessHistoryByUUID(uuid string, count int) ([]types.ProcessStats, error)
+	MonitorHealth() types.MonitorHealth
+}
+
+var (
+	_ ProcessReader          = (*ProcessManager)(nil)
+	_ MonitoredProcessReader = (*ProcessManagerWithMonitor)(nil)
+)
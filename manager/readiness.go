@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// ErrNotReady is returned when a process does not become ready in time
+var ErrNotReady = errors.New("process not ready")
+
+// readinessInterval is how often WaitReady re-runs a readiness check
+const readinessInterval = 50 * time.Millisecond
+
+// SetReadinessCheck sets the check used to decide when a started process is
+// ready. The check is kept across restarts. A nil check treats a running
+// process as ready.
+func (pm *ProcessManager) SetReadinessCheck(uuid string, check types.ReadinessCheck) error {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	pm.mu.Lock()
+	processInfo.Readiness = check
+	pm.mu.Unlock()
+	return nil
+}
+
+// WaitReady waits up to timeout for a process to be running and pass its
+// readiness check. It returns an error wrapping ErrNotReady on timeout or if
+// the process exits while waiting.
+func (pm *ProcessManager) WaitReady(uuid string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		value, exists := pm.processes.Load(uuid)
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+		}
+
+		processInfo := value.(*types.ProcessInfo)
+		pm.mu.RLock()
+		snapshot := processInfo.Snapshot()
+		check := processInfo.Readiness
+		pm.mu.RUnlock()
+
+		var err error
+		switch {
+		case !snapshot.Running:
+			err = fmt.Errorf("process exited with code %d", snapshot.LastExitCode)
+		case check != nil:
+			err = check(snapshot)
+		}
+		if err == nil {
+			return nil
+		}
+		if !snapshot.Running || !time.Now().Before(deadline) {
+			return fmt.Errorf("%w: %s: %v", ErrNotReady, uuid, err)
+		}
+		time.Sleep(readinessInterval)
+	}
+}
@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// ReconcileLabel is the label that ties a process to the ProcessSpec it was
+// started from
+const ReconcileLabel = "reconcile.id"
+
+// Reconcile brings the managed processes in line with specs. Processes
+// started from a spec that is no longer listed are stopped, new specs are
+// started and processes whose command or arguments changed are restarted;
+// label and restart changes are applied in place. Processes not started by
+// Reconcile are left alone.
+//
+// The result is filled in even when some actions fail; the returned error
+// joins the individual failures.
+func (pm *ProcessManager) Reconcile(specs []types.ProcessSpec) (types.ReconcileResult, error) {
+	result := types.ReconcileResult{Reasons: make(map[string]string)}
+
+	desired := make(map[string]types.ProcessSpec, len(specs))
+	for _, spec := range specs {
+		if spec.ID == "" {
+			return result, errors.New("process spec without an id")
+		}
+		if _, dup := desired[spec.ID]; dup {
+			return result, fmt.Errorf("duplicate process spec id %s", spec.ID)
+		}
+		desired[spec.ID] = spec
+	}
+
+	current := make(map[string]types.ProcessSnapshot)
+	for _, snapshot := range pm.Snapshot() {
+		if id, ok := snapshot.Labels[ReconcileLabel]; ok {
+			current[id] = snapshot
+		}
+	}
+
+	var errs []error
+	fail := func(id string, err error) {
+		result.Failed = append(result.Failed, id)
+		result.Reasons[id] = err.Error()
+		errs = append(errs, fmt.Errorf("%s: %w", id, err))
+	}
+
+	// Stop removed specs first so their resources are free for the rest
+	for _, id := range slices.Sorted(maps.Keys(current)) {
+		if _, ok := desired[id]; ok {
+			continue
+		}
+		if err := pm.StopProcess(current[id].UUID); err != nil {
+			fail(id, err)
+			continue
+		}
+		result.Stopped = append(result.Stopped, id)
+		result.Reasons[id] = "removed from specs"
+	}
+
+	for _, spec := range specs {
+		snapshot, exists := current[spec.ID]
+		switch {
+		case !exists:
+			if err := pm.startSpec(spec); err != nil {
+				fail(spec.ID, err)
+				continue
+			}
+			result.Started = append(result.Started, spec.ID)
+			result.Reasons[spec.ID] = "new spec"
+
+		case snapshot.Name != spec.Name || !slices.Equal(snapshot.Args, spec.Args) || !snapshot.Running:
+			reason := "command changed"
+			if snapshot.Name == spec.Name && slices.Equal(snapshot.Args, spec.Args) {
+				reason = "not running"
+			}
+			if err := pm.StopProcess(snapshot.UUID); err != nil {
+				fail(spec.ID, err)
+				continue
+			}
+			if err := pm.startSpec(spec); err != nil {
+				fail(spec.ID, err)
+				continue
+			}
+			result.Restarted = append(result.Restarted, spec.ID)
+			result.Reasons[spec.ID] = reason
+
+		default:
+			var updated []string
+			labels := specLabels(spec)
+			if !maps.Equal(snapshot.Labels, labels) {
+				pm.SetLabels(snapshot.UUID, labels)
+				updated = append(updated, "labels")
+			}
+			if snapshot.Restart != spec.Restart {
+				if err := pm.SetRestartPolicy(snapshot.UUID, types.RestartPolicy{Restart: spec.Restart}); err != nil {
+					fail(spec.ID, err)
+					continue
+				}
+				updated = append(updated, "restart policy")
+			}
+			result.Unchanged = append(result.Unchanged, spec.ID)
+			result.Reasons[spec.ID] = "up to date"
+			if len(updated) > 0 {
+				result.Reasons[spec.ID] = strings.Join(updated, " and ") + " updated"
+			}
+		}
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// startSpec starts a process from spec and tags it with the spec ID
+func (pm *ProcessManager) startSpec(spec types.ProcessSpec) error {
+	_, err := pm.StartProcessWithOptions(types.StartOptions{
+		Name:   spec.Name,
+		Args:   spec.Args,
+		Policy: types.RestartPolicy{Restart: spec.Restart},
+		Labels: specLabels(spec),
+	})
+	return err
+}
+
+// specLabels returns the labels of spec plus the ReconcileLabel
+func specLabels(spec types.ProcessSpec) map[string]string {
+	labels := make(map[string]string, len(spec.Labels)+1)
+	maps.Copy(labels, spec.Labels)
+	labels[ReconcileLabel] = spec.ID
+	return labels
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// restartBudgetPoll is how often a held process checks whether its restart
+// budget allows a restart again
+const restartBudgetPoll = 100 * time.Millisecond
+
+// validateRestartBudget rejects negative limits and a limit without a window
+func validateRestartBudget(budget types.RestartBudget) error {
+	if budget.Max < 0 || budget.Window < 0 {
+		return fmt.Errorf("restart budget must not be negative")
+	}
+	if budget.Max > 0 && budget.Window == 0 {
+		return fmt.Errorf("restart budget of %d restarts needs a window", budget.Max)
+	}
+	return nil
+}
+
+// budgetResetAt returns when the oldest restart inside the budget window
+// leaves it, freeing a restart. The caller must hold pm.mu.
+func budgetResetAt(processInfo *types.ProcessInfo, now time.Time) time.Time {
+	for _, t := range processInfo.RestartTimes {
+		if now.Sub(t) < processInfo.Budget.Window {
+			return t.Add(processInfo.Budget.Window)
+		}
+	}
+	return time.Time{}
+}
+
+// takeRestartBudget records a restart at now if the restart budget of the
+// process allows one, dropping restarts that left the window. Otherwise it
+// returns false and the restarts still inside the window, oldest first. The
+// caller must hold pm.mu.
+func takeRestartBudget(processInfo *types.ProcessInfo, now time.Time) (bool, []time.Time) {
+	budget := processInfo.Budget
+	if budget.Max <= 0 {
+		processInfo.RestartTimes = nil
+		return true, nil
+	}
+
+	// Keep only the restarts still inside the rolling window
+	times := processInfo.RestartTimes[:0:0]
+	for _, t := range processInfo.RestartTimes {
+		if now.Sub(t) < budget.Window {
+			times = append(times, t)
+		}
+	}
+	if len(times) < budget.Max {
+		processInfo.RestartTimes = append(times, now)
+		return true, nil
+	}
+
+	processInfo.RestartTimes = times
+	return false, times
+}
+
+// waitRestartBudget holds the auto-restart of a process while its restart
+// budget is used up and records the restart once the budget allows it. A held
+// process reports the status "held" and resumes by itself as soon as its
+// oldest restart leaves the window. It returns false when the restart was
+// cancelled meanwhile: the manager shut down, a StopAll began, the process was
+// stopped, reloaded or had Restart disabled.
+func (pm *ProcessManager) waitRestartBudget(uuid string, processInfo *types.ProcessInfo, process types.Process, epoch int64) bool {
+	ticker := time.NewTicker(restartBudgetPoll)
+	defer ticker.Stop()
+	defer func() {
+		pm.mu.Lock()
+		processInfo.Held = false
+		pm.mu.Unlock()
+	}()
+
+	for {
+		now := pm.clock.Now()
+		pm.mu.Lock()
+		if processInfo.Process != process || !processInfo.Restart {
+			pm.mu.Unlock()
+			return false
+		}
+
+		budget := processInfo.Budget
+		allowed, times := takeRestartBudget(processInfo, now)
+		if allowed {
+			pm.mu.Unlock()
+			return true
+		}
+
+		first := !processInfo.Held
+		processInfo.Held = true
+		pm.mu.Unlock()
+
+		if first {
+			resume := times[0].Add(budget.Window)
+			pm.recordEvent(types.Event{
+				Type:   types.EventHeld,
+				UUID:   uuid,
+				Name:   processInfo.Name,
+				Reason: "restart budget exhausted",
+				Delay:  resume.Sub(now),
+				Message: fmt.Sprintf("Holding restart of process %s (UUID: %s) until %v: %d restarts within %v",
+					processInfo.Name, uuid, resume.Format(time.RFC3339), len(times), budget.Window),
+			})
+		}
+
+		select {
+		case <-pm.shutdown:
+			return false
+		case <-ticker.C:
+		}
+		if pm.stopEpoch.Load() != epoch {
+			return false
+		}
+		if _, exists := pm.processes.Load(uuid); !exists {
+			return false
+		}
+	}
+}
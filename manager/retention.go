@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// DefaultRetentionTTL is how long terminated records are kept by default, so
+// that WaitForProcess and WaitForExit can still observe a process that exited
+// before they were called
+const DefaultRetentionTTL = time.Minute
+
+// SetRetention keeps the records of processes that exited and will not be
+// restarted, so that their exit code and error stay queryable. Records are
+// purged once they are older than ttl, and only the newest maxCount are kept
+// when maxCount is positive. Kept records report the status "exited" or
+// "failed" and are returned by GetProcess, ListAllProcesses and Snapshot, but
+// not by ListProcesses. A zero ttl and maxCount removes records on exit.
+// The default is DefaultRetentionTTL with no count limit.
+func (pm *ProcessManager) SetRetention(ttl time.Duration, maxCount int) error {
+	if ttl < 0 {
+		return fmt.Errorf("retention TTL must not be negative")
+	}
+	if maxCount < 0 {
+		return fmt.Errorf("retention count must not be negative")
+	}
+
+	pm.mu.Lock()
+	pm.retentionTTL = ttl
+	pm.retentionMax = maxCount
+	if pm.sweepStop != nil {
+		close(pm.sweepStop)
+		pm.sweepStop = nil
+	}
+	if ttl > 0 {
+		pm.sweepStop = make(chan struct{})
+		pm.loops.Add(1)
+		stop := pm.sweepStop
+		pm.goTracked(func() { pm.sweepLoop(sweepInterval(ttl), stop) })
+	}
+	pm.mu.Unlock()
+
+	pm.sweepTerminated()
+	return nil
+}
+
+// Retention returns the retention TTL and maximum count of terminated records
+func (pm *ProcessManager) Retention() (time.Duration, int) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.retentionTTL, pm.retentionMax
+}
+
+// ListAllProcesses returns all managed processes like ListProcesses, plus the
+// terminated records kept by the retention policy
+func (pm *ProcessManager) ListAllProcesses() []*types.ProcessInfo {
+	return pm.listProcesses(true)
+}
+
+// retireProcess handles a process that exited and will not be restarted:
+// its record is either removed or kept as terminated
+func (pm *ProcessManager) retireProcess(uuid string, processInfo *types.ProcessInfo) {
+	pm.mu.Lock()
+	keep := pm.retentionTTL > 0 || pm.retentionMax > 0
+	limited := pm.retentionMax > 0
+	if keep {
+		processInfo.Terminated = true
+	}
+	pm.mu.Unlock()
+
+	if !keep {
+		pm.processes.Delete(uuid)
+		return
+	}
+
+	// Expired records are left to the sweeper, only the count is enforced here
+	if limited {
+		pm.sweepTerminated()
+	}
+}
+
+// sweepTerminated purges terminated records that are past the TTL or beyond
+// the maximum count
+func (pm *ProcessManager) sweepTerminated() {
+	var terminated []*types.ProcessInfo
+	pm.processes.Range(func(key, value interface{}) bool {
+		terminated = append(terminated, value.(*types.ProcessInfo))
+		return true
+	})
+
+	pm.mu.RLock()
+	ttl, maxCount := pm.retentionTTL, pm.retentionMax
+	disabled := ttl == 0 && maxCount == 0
+	n := 0
+	for _, processInfo := range terminated {
+		if processInfo.Terminated {
+			terminated[n] = processInfo
+			n++
+		}
+	}
+	terminated = terminated[:n]
+
+	// Newest first, so that everything past maxCount is the oldest
+	sort.Slice(terminated, func(i, j int) bool {
+		return terminated[i].EndTime.After(terminated[j].EndTime)
+	})
+
+	var expired []*types.ProcessInfo
+	for i, processInfo := range terminated {
+		if disabled ||
+			(ttl > 0 && time.Since(processInfo.EndTime) > ttl) ||
+			(maxCount > 0 && i >= maxCount) {
+			expired = append(expired, processInfo)
+		}
+	}
+	pm.mu.RUnlock()
+
+	for _, processInfo := range expired {
+		pm.processes.CompareAndDelete(processInfo.UUID, processInfo)
+	}
+}
+
+// sweepLoop purges expired terminated records until stop is closed
+func (pm *ProcessManager) sweepLoop(interval time.Duration, stop chan struct{}) {
+	defer pm.loops.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-pm.shutdown:
+			return
+		case <-ticker.C:
+			pm.sweepTerminated()
+		}
+	}
+}
+
+// sweepInterval checks for expired records a few times per TTL, between
+// 10ms and one minute
+func sweepInterval(ttl time.Duration) time.Duration {
+	interval := ttl / 4
+	if interval < 10*time.Millisecond {
+		return 10 * time.Millisecond
+	}
+	if interval > time.Minute {
+		return time.Minute
+	}
+	return interval
+}
@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// RunOutputLimit is the maximum number of bytes RunProcess keeps from each of
+// stdout and stderr; anything beyond it is discarded
+const RunOutputLimit = 1 << 20
+
+// runWaitDelay bounds how long RunProcess waits for output pipes held open by
+// orphaned grandchildren after the process itself has exited
+const runWaitDelay = time.Second
+
+// RunProcess runs a one-shot command to completion and returns its exit code
+// and captured output. The process is not registered with the manager, so it
+// has no UUID, is never restarted and does not appear in ListProcesses.
+//
+// A non-zero exit is reported through exitCode with a nil error. When ctx is
+// done or the manager shuts down first, the process tree is killed and the
+// error is the context error; output captured until then is still returned.
+// Each stream keeps at most RunOutputLimit bytes.
+func (pm *ProcessManager) RunProcess(ctx context.Context, name string, args []string) (exitCode int, stdout, stderr []byte, err error) {
+	if err := pm.checkAllowed(name); err != nil {
+		return -1, nil, nil, err
+	}
+
+	cmd, err := pm.createCommand(name, args)
+	if err != nil {
+		return -1, nil, nil, fmt.Errorf("failed to create command: %v", err)
+	}
+
+	outBuf := &limitedBuffer{limit: RunOutputLimit}
+	errBuf := &limitedBuffer{limit: RunOutputLimit}
+	cmd.Stdout = outBuf
+	cmd.Stderr = errBuf
+	cmd.WaitDelay = runWaitDelay
+
+	if err := cmd.Start(); err != nil {
+		return -1, nil, nil, fmt.Errorf("failed to start process: %v", err)
+	}
+
+	done := make(chan error, 1)
+	pm.goTracked(func() {
+		done <- cmd.Wait()
+	})
+
+	var canceled error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		canceled = ctx.Err()
+	case <-pm.shutdown:
+		canceled = context.Canceled
+	}
+
+	if canceled != nil {
+		pm.killProcessPlatform(cmd)
+		<-done
+		return -1, outBuf.Bytes(), errBuf.Bytes(), canceled
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return -1, outBuf.Bytes(), errBuf.Bytes(), err
+		}
+		return exitErr.ExitCode(), outBuf.Bytes(), errBuf.Bytes(), nil
+	}
+	return 0, outBuf.Bytes(), errBuf.Bytes(), nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and silently drops
+// the rest, so a chatty process never blocks on a full pipe
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+// Write stores as much of p as fits and always reports success
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// Bytes returns the captured output
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
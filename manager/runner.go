@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// ProcessRunner creates the processes started by a ProcessManager. The default
+// runner is backed by exec.Cmd; tests can provide a fake implementation such as
+// managertest.FakeRunner.
+type ProcessRunner interface {
+	// Command prepares a process that inherits the given listener files
+	Command(name string, args []string, listeners []*os.File) (types.Process, error)
+}
+
+// execRunner is the default exec.Cmd backed ProcessRunner
+type execRunner struct {
+	pm *ProcessManager
+}
+
+// Command creates a platform-specific exec.Cmd backed process
+func (r execRunner) Command(name string, args []string, listeners []*os.File) (types.Process, error) {
+	cmd, err := r.pm.createCommand(name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(listeners) > 0 {
+		// 继承的监听套接字从fd 3开始
+		cmd.ExtraFiles = listeners
+		cmd.Env = append(os.Environ(), listenFdsEnv(len(listeners)))
+	}
+
+	return &execProcess{pm: r.pm, cmd: cmd}, nil
+}
+
+// execProcess adapts an exec.Cmd to the types.Process interface
+type execProcess struct {
+	pm   *ProcessManager
+	cmd  *exec.Cmd
+	once sync.Once
+	err  error
+}
+
+// Start starts the command
+func (p *execProcess) Start() error {
+	return p.cmd.Start()
+}
+
+// Wait waits for the command to exit. It is safe to call more than once.
+func (p *execProcess) Wait() error {
+	p.once.Do(func() {
+		p.err = p.cmd.Wait()
+	})
+	return p.err
+}
+
+// StdinPipe returns a pipe connected to the command's stdin
+func (p *execProcess) StdinPipe() (io.WriteCloser, error) {
+	return p.cmd.StdinPipe()
+}
+
+// SetStdout sends the command's stdout to w
+func (p *execProcess) SetStdout(w io.Writer) {
+	p.cmd.Stdout = w
+}
+
+// SetStderr sends the command's stderr to w
+func (p *execProcess) SetStderr(w io.Writer) {
+	p.cmd.Stderr = w
+}
+
+// Terminate asks the process and its children to exit gracefully
+func (p *execProcess) Terminate() error {
+	if p.cmd.Process == nil {
+		return nil
+	}
+	return p.pm.terminateProcessPlatform(p.cmd)
+}
+
+// Kill terminates the process and its children. A process that has already
+// exited is not an error.
+func (p *execProcess) Kill() error {
+	if p.cmd.Process == nil {
+		return nil
+	}
+
+	if err := p.pm.killProcessPlatform(p.cmd); err != nil {
+		// 如果进程已经退出，我们认为终止成功
+		if p.pm.isProcessRunning(p.cmd.Process.Pid) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pid returns the process ID, or 0 if the process has not started
+func (p *execProcess) Pid() int {
+	if p.cmd.Process == nil {
+		return 0
+	}
+	return p.cmd.Process.Pid
+}
+
+// ExitCode returns the exit code, or -1 if the process has not exited or was
+// terminated by a signal
+func (p *execProcess) ExitCode() int {
+	if p.cmd.ProcessState == nil {
+		return -1
+	}
+	return p.cmd.ProcessState.ExitCode()
+}
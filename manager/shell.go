@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// StartShellCommand starts command through the platform shell (sh -c on
+// Unix, cmd /c on Windows), so pipes, redirections and quoting work as they
+// would in a terminal. The original string is recorded in ProcessInfo.Command
+// and is run again on every restart.
+//
+// The shell interprets the whole string: never build it from untrusted input,
+// as anything it contains (";", "&&", "$(...)", "|") is executed. When an
+// allowlist is configured with WithAllowedCommands the shell itself must be
+// allowed, which in effect permits every command.
+func (pm *ProcessManager) StartShellCommand(command string, restart bool) (string, error) {
+	name, args := shellCommand(command)
+	if strings.TrimSpace(command) == "" {
+		err := fmt.Errorf("empty shell command")
+		pm.auditStart(context.Background(), name, args, command, "", err)
+		return "", err
+	}
+
+	result, err := pm.startProcess(types.StartOptions{
+		Name:   name,
+		Args:   args,
+		Policy: types.RestartPolicy{Restart: restart},
+	})
+	if err != nil {
+		pm.auditStart(context.Background(), name, args, command, "", err)
+		return "", err
+	}
+
+	uuid := result.UUID
+	if value, exists := pm.processes.Load(uuid); exists {
+		pm.mu.Lock()
+		value.(*types.ProcessInfo).Command = command
+		pm.mu.Unlock()
+	}
+	pm.auditStart(context.Background(), name, args, command, uuid, nil)
+	return uuid, nil
+}
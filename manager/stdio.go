@@ -0,0 +1,423 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// DefaultOutputBacklog is the default number of output lines kept per process
+const DefaultOutputBacklog = 1000
+
+// ErrProcessExited is returned when using the stdio of a process that has exited
+var ErrProcessExited = errors.New("process has exited")
+
+// SetOutputBacklog sets how many lines of stdout are kept for processes
+// started afterwards. New subscribers receive these lines first, and a
+// subscriber may fall this far behind before output is dropped for it.
+func (pm *ProcessManager) SetOutputBacklog(lines int) error {
+	if lines < 1 {
+		return fmt.Errorf("output backlog must be at least 1 line")
+	}
+
+	pm.mu.Lock()
+	pm.outputBacklog = lines
+	pm.mu.Unlock()
+	return nil
+}
+
+// OutputBacklog returns the number of output lines kept per process
+func (pm *ProcessManager) OutputBacklog() int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.outputBacklog
+}
+
+// validateOutputLimit rejects negative limits, a byte limit too small for a
+// truncated line and limits without stdio
+func validateOutputLimit(limit types.OutputLimit, stdio bool) error {
+	if limit.Lines < 0 || limit.Bytes < 0 {
+		return fmt.Errorf("output limit must not be negative")
+	}
+	if limit.Bytes > 0 && limit.Bytes < MinOutputBytes {
+		return fmt.Errorf("output byte limit must be at least %d bytes", MinOutputBytes)
+	}
+	if limit != (types.OutputLimit{}) && !stdio {
+		return fmt.Errorf("output limit requires stdio")
+	}
+	return nil
+}
+
+// newOutputStdio wires the stdio of a run of the process with the given UUID,
+// bounding its output by limit
+func (pm *ProcessManager) newOutputStdio(process types.Process, limit types.OutputLimit, uuid string) (*processStdio, error) {
+	lines := limit.Lines
+	if lines == 0 {
+		lines = pm.OutputBacklog()
+	}
+	return newProcessStdio(process, lines, limit.Bytes, pm.statusMatcher(uuid))
+}
+
+// stdioProcess is implemented by processes whose stdin and stdout can be
+// wired to the manager before they are started
+type stdioProcess interface {
+	StdinPipe() (io.WriteCloser, error)
+	SetStdout(w io.Writer)
+}
+
+// stdioPipes is the number of pipes held by a processStdio: stdin and stdout
+const stdioPipes = 2
+
+// processStdio holds the stdio of one run of a process
+type processStdio struct {
+	process types.Process
+	stdin   *processStdin
+	stdout  *outputStream
+}
+
+// newProcessStdio wires the stdio of a process that has not been started yet,
+// keeping the last backlog lines but at most maxBytes bytes of output (no
+// byte limit when maxBytes is 0) and passing every complete line to onLine
+func newProcessStdio(process types.Process, backlog, maxBytes int, onLine func(line []byte)) (*processStdio, error) {
+	sp, ok := process.(stdioProcess)
+	if !ok {
+		return nil, fmt.Errorf("process runner does not support stdio")
+	}
+
+	stdin, err := sp.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %v", err)
+	}
+
+	stdout := newOutputStream(backlog)
+	stdout.maxBytes = maxBytes
+	stdout.onLine = onLine
+	sp.SetStdout(stdout)
+
+	return &processStdio{
+		process: process,
+		stdin:   &processStdin{w: stdin, exited: make(chan struct{})},
+		stdout:  stdout,
+	}, nil
+}
+
+// closeStdio ends the stdio of a run once it has exited. Readers see EOF
+// after the remaining output, writers get ErrProcessExited.
+func (pm *ProcessManager) closeStdio(uuid string, process types.Process) {
+	value, exists := pm.stdio.Load(uuid)
+	if !exists {
+		return
+	}
+
+	streams := value.(*processStdio)
+	if streams.process != process {
+		return
+	}
+
+	if pm.stdio.CompareAndDelete(uuid, streams) {
+		streams.close()
+		pm.openPipes.Add(-stdioPipes)
+	}
+}
+
+// close ends the stdin and stdout of the run
+func (s *processStdio) close() {
+	close(s.stdin.exited)
+	s.stdin.Close()
+	s.stdout.Close()
+}
+
+// processStdioFor returns the stdio of the current run of a process
+func (pm *ProcessManager) processStdioFor(uuid string) (*processStdio, error) {
+	value, exists := pm.processes.Load(uuid)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrProcessNotFound, uuid)
+	}
+
+	processInfo := value.(*types.ProcessInfo)
+	if !processInfo.Stdio {
+		return nil, fmt.Errorf("process %s was not started with stdio", uuid)
+	}
+
+	streams, exists := pm.stdio.Load(uuid)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrProcessExited, uuid)
+	}
+	return streams.(*processStdio), nil
+}
+
+// ProcessStdin returns a writer connected to the stdin of a process started
+// with StartProcessWithStdio. Closing it closes the process's stdin. Writes
+// after the process exits fail with ErrProcessExited.
+func (pm *ProcessManager) ProcessStdin(uuid string) (io.WriteCloser, error) {
+	streams, err := pm.processStdioFor(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return streams.stdin, nil
+}
+
+// ProcessStdout subscribes to the stdout of a process started with
+// StartProcessWithStdio. The reader first returns the buffered backlog (see
+// SetOutputBacklog) and then all subsequent output. Every reader has its own
+// position; a reader that falls more than the backlog behind gets a
+// "[N lines dropped]" line in place of the lost output. Read returns io.EOF
+// once the process has exited and all of its output has been read.
+func (pm *ProcessManager) ProcessStdout(uuid string) (io.ReadCloser, error) {
+	streams, err := pm.processStdioFor(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return streams.stdout.NewReader(), nil
+}
+
+// processStdin guards a process's stdin pipe against use after exit
+type processStdin struct {
+	w      io.WriteCloser
+	exited chan struct{}
+}
+
+// Write writes to the process's stdin
+func (s *processStdin) Write(p []byte) (int, error) {
+	select {
+	case <-s.exited:
+		return 0, ErrProcessExited
+	default:
+	}
+
+	n, err := s.w.Write(p)
+	if err != nil {
+		select {
+		case <-s.exited:
+			return n, ErrProcessExited
+		default:
+		}
+	}
+	return n, err
+}
+
+// Close closes the process's stdin
+func (s *processStdin) Close() error {
+	err := s.w.Close()
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// maxOutputLineLength is the longest line kept in the output buffer; longer
+// output without a newline is split
+const maxOutputLineLength = 64 * 1024
+
+// MinOutputBytes is the smallest byte limit accepted for the output buffer
+const MinOutputBytes = 256
+
+// truncatedMarker ends a line cut short to fit the byte limit of the buffer
+const truncatedMarker = " [truncated]\n"
+
+// outputStream broadcasts a process's output to any number of readers. The
+// last lines are kept in a ring buffer; every reader has its own cursor into
+// it, so a slow reader never blocks the process or other readers. When a
+// reader falls behind by more than the buffer size, the overwritten lines are
+// replaced by a "[N lines dropped]" marker. With a byte limit the oldest lines
+// are also dropped once the buffered lines exceed it, and a line longer than
+// the limit is cut short and ends with a "[truncated]" marker.
+type outputStream struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	lines     [][]byte // ring buffer, line seq is stored at seq % len(lines)
+	start     int64    // sequence number of the oldest buffered line
+	next      int64    // sequence number of the next line
+	size      int      // bytes in the buffered lines
+	maxBytes  int      // limit of size, 0 for none
+	partial   []byte   // output after the last newline
+	truncated bool     // bytes of the partial line were dropped
+	closed    bool
+	onLine    func(line []byte) // called outside mu with every line pushed by Write
+}
+
+// newOutputStream creates an output stream that keeps the last capacity lines
+func newOutputStream(capacity int) *outputStream {
+	s := &outputStream{lines: make([][]byte, capacity)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Write splits output into lines and appends them to the buffer
+func (s *outputStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+
+	pushed := s.next
+	for rest := p; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			s.appendPartial(rest)
+			break
+		}
+		s.appendPartial(rest[:i+1])
+		rest = rest[i+1:]
+		s.push()
+	}
+	for len(s.partial) >= maxOutputLineLength {
+		tail := append([]byte(nil), s.partial[maxOutputLineLength:]...)
+		s.partial = s.partial[:maxOutputLineLength]
+		s.push()
+		s.partial = tail
+	}
+
+	// Lines are never modified once pushed, so they can be read after unlocking
+	var lines [][]byte
+	if s.onLine != nil {
+		for seq := max(pushed, s.first()); seq < s.next; seq++ {
+			lines = append(lines, s.lines[seq%int64(len(s.lines))])
+		}
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	for _, line := range lines {
+		s.onLine(line)
+	}
+	return len(p), nil
+}
+
+// appendPartial adds output to the partial line, dropping what does not fit
+// the byte limit, called with mu held
+func (s *outputStream) appendPartial(p []byte) {
+	if s.maxBytes > 0 && len(s.partial)+len(p) > s.maxBytes {
+		keep := max(s.maxBytes-len(s.partial), 0)
+		s.partial = append(s.partial, p[:keep]...)
+		s.truncated = true
+		return
+	}
+	s.partial = append(s.partial, p...)
+}
+
+// push moves the partial line into the ring buffer, dropping the oldest lines
+// beyond the line or byte limit, called with mu held
+func (s *outputStream) push() {
+	line := s.partial
+	if s.truncated {
+		line = append(line[:min(len(line), s.maxBytes-len(truncatedMarker))], truncatedMarker...)
+	}
+	if s.next-s.start == int64(len(s.lines)) {
+		s.drop()
+	}
+	s.lines[s.next%int64(len(s.lines))] = line
+	s.size += len(line)
+	s.next++
+	for s.maxBytes > 0 && s.size > s.maxBytes && s.start < s.next-1 {
+		s.drop()
+	}
+	s.partial = nil
+	s.truncated = false
+}
+
+// drop removes the oldest buffered line, called with mu held
+func (s *outputStream) drop() {
+	i := s.start % int64(len(s.lines))
+	s.size -= len(s.lines[i])
+	s.lines[i] = nil
+	s.start++
+}
+
+// first returns the sequence number of the oldest buffered line
+func (s *outputStream) first() int64 {
+	return s.start
+}
+
+// Close marks the end of the output, keeping an unterminated last line
+func (s *outputStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.partial) > 0 || s.truncated {
+		s.push()
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	return nil
+}
+
+// Lines returns copies of up to the last n buffered lines, all of them when
+// n <= 0. An unterminated last line is included.
+func (s *outputStream) Lines(n int) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lines [][]byte
+	for seq := s.first(); seq < s.next; seq++ {
+		lines = append(lines, append([]byte(nil), s.lines[seq%int64(len(s.lines))]...))
+	}
+	if len(s.partial) > 0 {
+		lines = append(lines, append([]byte(nil), s.partial...))
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// NewReader returns a reader that starts with the buffered lines
+func (s *outputStream) NewReader() *outputReader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &outputReader{stream: s, cursor: s.first()}
+}
+
+// outputReader is one subscriber of an outputStream
+type outputReader struct {
+	stream *outputStream
+	cursor int64  // sequence number of the next line to read
+	buf    []byte // rest of the line being read
+	closed bool
+}
+
+// Read blocks until output is available, the process exits or the reader is closed
+func (r *outputReader) Read(p []byte) (int, error) {
+	s := r.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(r.buf) == 0 {
+		switch first := s.first(); {
+		case r.closed:
+			return 0, os.ErrClosed
+		case r.cursor < first:
+			r.buf = []byte(fmt.Sprintf("[%d lines dropped]\n", first-r.cursor))
+			r.cursor = first
+		case r.cursor < s.next:
+			r.buf = s.lines[r.cursor%int64(len(s.lines))]
+			r.cursor++
+		case s.closed:
+			return 0, io.EOF
+		default:
+			s.cond.Wait()
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close stops reading and wakes up a pending Read
+func (r *outputReader) Close() error {
+	s := r.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.closed = true
+	s.cond.Broadcast()
+	return nil
+}
@@ -3,11 +3,27 @@
 package manager
 
 import (
+	"fmt"
+	"log/syslog"
+	"os"
 	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
 )
 
+// requiredTools are the external programs the manager needs; Unix uses
+// system calls only
+var requiredTools []util.Tool
+
+// stopSignals is the stop sequence of killProcessPlatform, for PlanRestart
+var stopSignals = []string{"SIGTERM", "SIGKILL"}
+
 // createCommand creates a Unix-specific command
 func (pm *ProcessManager) createCommand(name string, args []string) (*exec.Cmd, error) {
 	cmd := exec.Command(name, args...)
@@ -17,6 +33,37 @@ func (pm *ProcessManager) createCommand(name string, args []string) (*exec.Cmd,
 	return cmd, nil
 }
 
+// umaskCommand makes cmd set the file mode creation mask before running its
+// program: it starts sh, which sets the umask and execs the program in its
+// own place, so the PID stays the same
+func umaskCommand(cmd *exec.Cmd, umask os.FileMode) {
+	if cmd.Err != nil {
+		return
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		cmd.Err = fmt.Errorf("sh is required to set the umask: %v", err)
+		return
+	}
+	script := fmt.Sprintf(`umask %04o && exec "$0" "$@"`, uint32(umask))
+	cmd.Args = append([]string{"sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = sh
+}
+
+// shellCommand returns the argv that runs command through sh
+func shellCommand(command string) (string, []string) {
+	return "sh", []string{"-c", command}
+}
+
+// terminateProcessPlatform sends SIGTERM to the process group on Unix systems
+func (pm *ProcessManager) terminateProcessPlatform(cmd *exec.Cmd) error {
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	if err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
 // killProcessPlatform terminates a process and its children on Unix systems
 func (pm *ProcessManager) killProcessPlatform(cmd *exec.Cmd) error {
 	if cmd.Process == nil {
@@ -32,11 +79,8 @@ func (pm *ProcessManager) killProcessPlatform(cmd *exec.Cmd) error {
 		}
 	}
 
-	// Wait a bit for graceful shutdown
-	time.Sleep(100 * time.Millisecond)
-
-	// Check if process is still running
-	if pm.isProcessRunning(cmd.Process.Pid) {
+	// Wait for graceful shutdown, then force kill if still running
+	if !pm.waitProcessExit(cmd.Process.Pid, pm.KillTimeout()) {
 		// Force kill with SIGKILL
 		err = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 		if err != nil && err != syscall.ESRCH {
@@ -47,9 +91,125 @@ func (pm *ProcessManager) killProcessPlatform(cmd *exec.Cmd) error {
 	return nil
 }
 
-// isProcessRunning 检查进程是否仍在运行
+// isProcessRunning 检查进程是否仍在运行。信号0对已退出但未被回收的僵尸进程
+// 同样成功，因此还需检查/proc中的进程状态
 func (pm *ProcessManager) isProcessRunning(pid int) bool {
 	// Send signal 0 to check if process exists
-	err := syscall.Kill(pid, 0)
-	return err == nil
+	if err := syscall.Kill(pid, 0); err != nil {
+		return false
+	}
+	return !util.IsZombie(pid)
+}
+
+// lowerPriorityPlatform 将进程调度优先级降到最低(nice 19)
+func (pm *ProcessManager) lowerPriorityPlatform(pid int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, 19)
+}
+
+// readEnvironPlatform reads /proc/<pid>/environ, which only Linux provides
+func readEnvironPlatform(pid int) ([]string, error) {
+	if runtime.GOOS != "linux" {
+		return nil, ErrEnvironUnavailable
+	}
+
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment of process %d: %v", pid, err)
+	}
+
+	var env []string
+	for _, entry := range strings.Split(string(data), "\x00") {
+		if entry != "" {
+			env = append(env, entry)
+		}
+	}
+	return env, nil
+}
+
+// syslogSink writes lines to syslog, redialing after a failure
+type syslogSink struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	priority syslog.Priority
+	tag      string
+	w        *syslog.Writer
+	lastDial time.Time
+}
+
+// newLogSink connects to the syslog destination. An unreachable destination
+// is not an error; the connection is retried when lines are logged.
+func newLogSink(config types.LogConfig, facility int, tag string) (logSink, error) {
+	s := &syslogSink{
+		network:  config.Network,
+		address:  config.Address,
+		priority: syslog.Priority(facility << 3),
+		tag:      tag,
+	}
+	s.dial()
+	return s, nil
+}
+
+// dial connects to syslog, called with mu held
+func (s *syslogSink) dial() error {
+	s.lastDial = time.Now()
+	w, err := syslog.Dial(s.network, s.address, s.priority|syslog.LOG_INFO, s.tag)
+	if err != nil {
+		return err
+	}
+	s.w = w
+	return nil
+}
+
+// Log writes one line at the given severity
+func (s *syslogSink) Log(severity int, line string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.w == nil {
+		if time.Since(s.lastDial) < logRedialInterval {
+			return fmt.Errorf("syslog unavailable")
+		}
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch syslog.Priority(severity) {
+	case syslog.LOG_EMERG:
+		err = s.w.Emerg(line)
+	case syslog.LOG_ALERT:
+		err = s.w.Alert(line)
+	case syslog.LOG_CRIT:
+		err = s.w.Crit(line)
+	case syslog.LOG_ERR:
+		err = s.w.Err(line)
+	case syslog.LOG_WARNING:
+		err = s.w.Warning(line)
+	case syslog.LOG_NOTICE:
+		err = s.w.Notice(line)
+	case syslog.LOG_DEBUG:
+		err = s.w.Debug(line)
+	default:
+		err = s.w.Info(line)
+	}
+	if err != nil {
+		s.w.Close()
+		s.w = nil
+	}
+	return err
+}
+
+// Close closes the syslog connection
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	s.w = nil
+	return err
 }
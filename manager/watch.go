@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+const (
+	defaultWatchInterval = 500 * time.Millisecond
+	defaultWatchDebounce = 300 * time.Millisecond
+)
+
+// fileState is the part of a file's metadata used to detect changes
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// watcher polls a set of paths and reloads a process when they change
+type watcher struct {
+	config types.WatchConfig
+	stop   chan struct{}
+}
+
+// WatchProcess restarts the process in place, keeping its UUID, whenever one
+// of the watched paths changes. Rapid changes are debounced and a path that is
+// temporarily missing (e.g. during an atomic rename) does not trigger a reload
+// until it reappears. Calling it again replaces the previous watch.
+func (pm *ProcessManager) WatchProcess(uuid string, config types.WatchConfig) error {
+	if _, exists := pm.processes.Load(uuid); !exists {
+		return fmt.Errorf("process with UUID %s not found", uuid)
+	}
+	if len(config.Paths) == 0 {
+		return fmt.Errorf("no paths to watch")
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultWatchInterval
+	}
+	if config.Debounce <= 0 {
+		config.Debounce = defaultWatchDebounce
+	}
+
+	w := &watcher{
+		config: config,
+		stop:   make(chan struct{}),
+	}
+	if previous, loaded := pm.watchers.Swap(uuid, w); loaded {
+		close(previous.(*watcher).stop)
+	}
+
+	pm.loops.Add(1)
+	pm.goTracked(func() { pm.watchLoop(uuid, w) })
+	return nil
+}
+
+// UnwatchProcess stops watching files for the process
+func (pm *ProcessManager) UnwatchProcess(uuid string) error {
+	previous, loaded := pm.watchers.LoadAndDelete(uuid)
+	if !loaded {
+		return fmt.Errorf("process with UUID %s is not being watched", uuid)
+	}
+	close(previous.(*watcher).stop)
+	return nil
+}
+
+// IsWatched reports whether file watching is enabled for the process
+func (pm *ProcessManager) IsWatched(uuid string) bool {
+	_, exists := pm.watchers.Load(uuid)
+	return exists
+}
+
+// watchLoop polls the watched paths until the watch is stopped or the process
+// is no longer managed
+func (pm *ProcessManager) watchLoop(uuid string, w *watcher) {
+	defer pm.loops.Done()
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	last := statPaths(w.config.Paths)
+	var changedAt time.Time
+
+	for {
+		select {
+		case <-pm.shutdown:
+			return
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if _, exists := pm.processes.Load(uuid); !exists {
+			pm.watchers.CompareAndDelete(uuid, w)
+			return
+		}
+
+		current := statPaths(w.config.Paths)
+		if !sameStates(last, current) {
+			last = current
+			changedAt = time.Now()
+			continue
+		}
+
+		// Wait until the files have settled and all of them exist again
+		if changedAt.IsZero() || time.Since(changedAt) < w.config.Debounce || !allExist(current) {
+			continue
+		}
+		changedAt = time.Time{}
+
+		fmt.Printf("Watched files changed, reloading process (UUID: %s)\n", uuid)
+		if err := pm.reloadProcess(uuid, "file change"); err != nil {
+			pm.event(types.EventError, uuid, "", "Failed to reload process (UUID: %s): %v", uuid, err)
+		}
+	}
+}
+
+// statPaths returns the current state of every path
+func statPaths(paths []string) []fileState {
+	states := make([]fileState, len(paths))
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		states[i] = fileState{
+			exists:  true,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+	}
+	return states
+}
+
+// sameStates reports whether two snapshots are identical
+func sameStates(a, b []fileState) bool {
+	for i := range a {
+		if a[i].exists != b[i].exists || a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// allExist reports whether every path in the snapshot exists
+func allExist(states []fileState) bool {
+	for _, state := range states {
+		if !state.exists {
+			return false
+		}
+	}
+	return true
+}
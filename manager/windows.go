@@ -4,23 +4,77 @@ package manager
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"sync"
 	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
 )
 
 const (
 	CREATE_NEW_PROCESS_GROUP = 0x00000200
 )
 
+// requiredTools are the external programs used to stop processes on Windows
+var requiredTools = []util.Tool{
+	{Name: "taskkill", Args: []string{"/?"}, Purpose: "stopping process trees"},
+	{Name: "wmic", Args: []string{"os", "get", "Caption", "/value"}, Purpose: "the force-kill fallback"},
+}
+
+// stopSignals is the stop sequence of killProcessPlatform, for PlanRestart
+var stopSignals = []string{"CTRL_BREAK", "taskkill /F"}
+
 // createCommand creates a Windows-specific command
 func (pm *ProcessManager) createCommand(name string, args []string) (*exec.Cmd, error) {
 	cmd := exec.Command(name, args...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		CreationFlags: CREATE_NEW_PROCESS_GROUP,
 	}
+
+	// cmd.exe不遵循Go的参数转义规则，shell命令按原样传给/c
+	if name == "cmd" && len(args) == 2 && args[0] == "/c" {
+		cmd.SysProcAttr.CmdLine = "cmd /c " + args[1]
+	}
 	return cmd, nil
 }
 
+// umaskCommand does nothing, Windows has no umask
+func umaskCommand(cmd *exec.Cmd, umask os.FileMode) {}
+
+// shellCommand returns the argv that runs command through cmd.exe
+func shellCommand(command string) (string, []string) {
+	return "cmd", []string{"/c", command}
+}
+
+var procGenerateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// sendCtrlBreak 向以CREATE_NEW_PROCESS_GROUP创建的进程组发送CTRL_BREAK_EVENT
+func sendCtrlBreak(pid int) error {
+	const CTRL_BREAK_EVENT = 1
+
+	r, _, err := procGenerateConsoleCtrlEvent.Call(CTRL_BREAK_EVENT, uintptr(pid))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// terminateProcessPlatform asks a process tree to close on Windows
+func (pm *ProcessManager) terminateProcessPlatform(cmd *exec.Cmd) error {
+	// 控制台程序优先使用CTRL_BREAK
+	if err := sendCtrlBreak(cmd.Process.Pid); err == nil {
+		return nil
+	}
+
+	// 不带/F的taskkill会向GUI程序发送WM_CLOSE
+	killCmd := exec.Command("taskkill", "/T", "/PID", fmt.Sprintf("%d", cmd.Process.Pid))
+	return killCmd.Run()
+}
+
 // killProcessPlatform terminates a process and its children on Windows
 func (pm *ProcessManager) killProcessPlatform(cmd *exec.Cmd) error {
 	if cmd.Process == nil {
@@ -29,6 +83,13 @@ func (pm *ProcessManager) killProcessPlatform(cmd *exec.Cmd) error {
 
 	pid := cmd.Process.Pid
 
+	// 先请求进程正常退出，超时后再强制终止
+	if err := pm.terminateProcessPlatform(cmd); err == nil {
+		if pm.waitProcessExit(pid, pm.KillTimeout()) {
+			return nil
+		}
+	}
+
 	// 方法1: 使用taskkill (最可靠的方法)
 	killCmd := exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", pid))
 	if err := killCmd.Run(); err == nil {
@@ -102,3 +163,126 @@ func (pm *ProcessManager) isProcessRunning(pid int) bool {
 
 	return exitCode == STILL_ACTIVE
 }
+
+var procSetPriorityClass = syscall.NewLazyDLL("kernel32.dll").NewProc("SetPriorityClass")
+
+// lowerPriorityPlatform 将进程优先级类设置为IDLE_PRIORITY_CLASS
+func (pm *ProcessManager) lowerPriorityPlatform(pid int) error {
+	const (
+		PROCESS_SET_INFORMATION = 0x0200
+		IDLE_PRIORITY_CLASS     = 0x00000040
+	)
+
+	handle, err := syscall.OpenProcess(PROCESS_SET_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return fmt.Errorf("failed to open process %d: %v", pid, err)
+	}
+	defer syscall.CloseHandle(handle)
+
+	r, _, err := procSetPriorityClass.Call(uintptr(handle), IDLE_PRIORITY_CLASS)
+	if r == 0 {
+		return fmt.Errorf("failed to set priority of process %d: %v", pid, err)
+	}
+	return nil
+}
+
+// readEnvironPlatform Windows不提供读取其他进程环境变量的接口
+func readEnvironPlatform(pid int) ([]string, error) {
+	return nil, ErrEnvironUnavailable
+}
+
+var (
+	procRegisterEventSourceW  = syscall.NewLazyDLL("advapi32.dll").NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = syscall.NewLazyDLL("advapi32.dll").NewProc("DeregisterEventSource")
+	procReportEventW          = syscall.NewLazyDLL("advapi32.dll").NewProc("ReportEventW")
+)
+
+// eventLogSink 将输出写入Windows事件日志，注册失败时稍后重试
+type eventLogSink struct {
+	mu       sync.Mutex
+	source   string
+	handle   uintptr
+	lastOpen time.Time
+}
+
+// newLogSink registers the event source. Remote syslog is not available on
+// Windows.
+func newLogSink(config types.LogConfig, facility int, tag string) (logSink, error) {
+	if config.Network != "" {
+		return nil, fmt.Errorf("remote syslog is not supported on Windows")
+	}
+
+	s := &eventLogSink{source: tag}
+	s.open()
+	return s, nil
+}
+
+// open registers the event source, called with mu held
+func (s *eventLogSink) open() error {
+	s.lastOpen = time.Now()
+	source, err := syscall.UTF16PtrFromString(s.source)
+	if err != nil {
+		return err
+	}
+
+	h, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(source)))
+	if h == 0 {
+		return err
+	}
+	s.handle = h
+	return nil
+}
+
+// Log reports one line as an event, mapping syslog severities to event types
+func (s *eventLogSink) Log(severity int, line string) error {
+	const (
+		EVENTLOG_ERROR_TYPE       = 0x0001
+		EVENTLOG_WARNING_TYPE     = 0x0002
+		EVENTLOG_INFORMATION_TYPE = 0x0004
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.handle == 0 {
+		if time.Since(s.lastOpen) < logRedialInterval {
+			return fmt.Errorf("event log unavailable")
+		}
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	eventType := EVENTLOG_INFORMATION_TYPE
+	switch {
+	case severity <= syslogSeverities["err"]:
+		eventType = EVENTLOG_ERROR_TYPE
+	case severity == syslogSeverities["warning"]:
+		eventType = EVENTLOG_WARNING_TYPE
+	}
+
+	message, err := syscall.UTF16PtrFromString(line)
+	if err != nil {
+		return err
+	}
+	strs := []*uint16{message}
+	r, _, err := procReportEventW.Call(s.handle, uintptr(eventType), 0, 1, 0, 1, 0, uintptr(unsafe.Pointer(&strs[0])), 0)
+	if r == 0 {
+		procDeregisterEventSource.Call(s.handle)
+		s.handle = 0
+		return err
+	}
+	return nil
+}
+
+// Close deregisters the event source
+func (s *eventLogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.handle != 0 {
+		procDeregisterEventSource.Call(s.handle)
+		s.handle = 0
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build darwin
+
+package monitor
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// kinfoProcSize sizeof(struct kinfo_proc)，amd64和arm64相同
+const kinfoProcSize = 648
+
+// processCreateTime 通过sysctl(CTL_KERN, KERN_PROC, KERN_PROC_PID)读取kinfo_proc，
+// 创建时间为kp_proc.p_starttime，位于结构体开头的struct timeval
+func processCreateTime(pid int) (time.Time, error) {
+	mib := [4]int32{1 /* CTL_KERN */, 14 /* KERN_PROC */, 1 /* KERN_PROC_PID */, int32(pid)}
+	var buf [kinfoProcSize]byte
+	size := uintptr(len(buf))
+
+	_, _, errno := syscall.Syscall6(syscall.SYS___SYSCTL,
+		uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0, 0)
+	if errno != 0 {
+		if errno == syscall.EPERM {
+			return time.Time{}, fmt.Errorf("%w: process %d: %v", ErrPermission, pid, errno)
+		}
+		return time.Time{}, fmt.Errorf("sysctl kern.proc.pid.%d: %v", pid, errno)
+	}
+	// 进程不存在时sysctl成功但不返回数据
+	if size == 0 {
+		return time.Time{}, fmt.Errorf("%w: process %d does not exist", ErrProcessGone, pid)
+	}
+	if size < 16 {
+		return time.Time{}, fmt.Errorf("%w: short kinfo_proc for PID %d", ErrParse, pid)
+	}
+
+	sec := *(*int64)(unsafe.Pointer(&buf[0]))
+	usec := *(*int32)(unsafe.Pointer(&buf[8]))
+	return time.Unix(sec, int64(usec)*int64(time.Microsecond)), nil
+}
@@ -0,0 +1,30 @@
+//go:build !windows && !darwin
+
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// processCreateTime 由/proc/<pid>/stat的starttime字段计算进程创建时间
+func processCreateTime(pid int) (time.Time, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return time.Time{}, classifyReadError(pid, err)
+	}
+
+	// 进程名可能包含空格和括号，以最后一个右括号为界
+	content := string(data)
+	lastParen := strings.LastIndex(content, ")")
+	if lastParen == -1 {
+		return time.Time{}, fmt.Errorf("%w: invalid stat format for PID %d", ErrParse, pid)
+	}
+	rest := strings.Fields(content[lastParen+1:])
+	if len(rest) < 20 {
+		return time.Time{}, fmt.Errorf("%w: invalid stat format for PID %d", ErrParse, pid)
+	}
+	return getProcessStartTime(pid, rest[19])
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// processQueryLimitedInformation PROCESS_QUERY_LIMITED_INFORMATION访问权限
+const processQueryLimitedInformation = 0x1000
+
+// processCreateTime 通过GetProcessTimes获取进程创建时间
+func processCreateTime(pid int) (time.Time, error) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		switch {
+		case errors.Is(err, syscall.ERROR_ACCESS_DENIED):
+			return time.Time{}, fmt.Errorf("%w: process %d: %v", ErrPermission, pid, err)
+		case errors.Is(err, syscall.Errno(87)): // ERROR_INVALID_PARAMETER，进程不存在
+			return time.Time{}, fmt.Errorf("%w: process %d does not exist", ErrProcessGone, pid)
+		}
+		return time.Time{}, fmt.Errorf("failed to open process %d: %v", pid, err)
+	}
+	defer syscall.CloseHandle(handle)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get times of process %d: %v", pid, err)
+	}
+	return time.Unix(0, creation.Nanoseconds()), nil
+}
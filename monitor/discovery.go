@@ -0,0 +1,160 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// WatchByPattern 按进程名正则自动发现并监控进程。每个采集周期刷新一次：
+// 新出现的匹配进程自动加入监控，已退出的自动发现进程被移除。
+// 需要采集器实现ProcessLister接口
+func (m *ProcessMonitorManager) WatchByPattern(pattern string) error {
+	if _, ok := m.collector.(ProcessLister); !ok {
+		return fmt.Errorf("collector does not support process listing")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+
+	m.mu.Lock()
+	for _, existing := range m.watchPatterns {
+		if existing.String() == pattern {
+			m.mu.Unlock()
+			return fmt.Errorf("pattern %q is already being watched", pattern)
+		}
+	}
+	m.watchPatterns = append(m.watchPatterns, re)
+	m.mu.Unlock()
+
+	// 立即刷新一次，无需等待下一个采集周期
+	m.refreshDiscovered()
+	return nil
+}
+
+// UnwatchPattern 取消按名称模式的自动发现，已发现的进程在下一个周期内
+// 若不再匹配其它模式则被移除
+func (m *ProcessMonitorManager) UnwatchPattern(pattern string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.watchPatterns {
+		if existing.String() == pattern {
+			m.watchPatterns = append(m.watchPatterns[:i], m.watchPatterns[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("pattern %q is not being watched", pattern)
+}
+
+// ExcludeByPattern 添加排除模式，名称匹配的进程不会被自动发现。
+// 不影响通过AddProcess手动添加的进程
+func (m *ProcessMonitorManager) ExcludeByPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+
+	m.mu.Lock()
+	for _, existing := range m.excludePatterns {
+		if existing.String() == pattern {
+			m.mu.Unlock()
+			return nil
+		}
+	}
+	m.excludePatterns = append(m.excludePatterns, re)
+	m.mu.Unlock()
+
+	m.refreshDiscovered()
+	return nil
+}
+
+// GetWatchPatterns 获取当前的自动发现模式和排除模式
+func (m *ProcessMonitorManager) GetWatchPatterns() (watch []string, exclude []string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, re := range m.watchPatterns {
+		watch = append(watch, re.String())
+	}
+	for _, re := range m.excludePatterns {
+		exclude = append(exclude, re.String())
+	}
+	return watch, exclude
+}
+
+// refreshDiscovered 根据名称模式刷新自动发现的进程集合
+func (m *ProcessMonitorManager) refreshDiscovered() {
+	lister, ok := m.collector.(ProcessLister)
+	if !ok {
+		return
+	}
+
+	m.mu.RLock()
+	active := len(m.watchPatterns) > 0 || len(m.discovered) > 0
+	m.mu.RUnlock()
+	if !active {
+		return
+	}
+
+	processes, err := lister.ListProcesses()
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 移除已退出或不再匹配的自动发现进程
+	for pid := range m.discovered {
+		name, exists := processes[pid]
+		if exists && m.matchesPatterns(name) {
+			continue
+		}
+		delete(m.discovered, pid)
+		delete(m.monitoredProcesses, pid)
+		delete(m.statsHistory, pid)
+		delete(m.seen, pid)
+		delete(m.idleConfigs, pid)
+		delete(m.baselines, pid)
+		delete(m.idleSince, pid)
+		delete(m.errorCounts, pid)
+	}
+
+	// 加入新出现的匹配进程，已手动添加的进程保持不变
+	now := m.clock.Now()
+	for pid, name := range processes {
+		if _, exists := m.monitoredProcesses[pid]; exists {
+			if seen, exists := m.seen[pid]; exists {
+				seen.last = now
+				m.seen[pid] = seen
+			}
+			continue
+		}
+		if !m.matchesPatterns(name) {
+			continue
+		}
+		m.monitoredProcesses[pid] = name
+		m.statsHistory[pid] = make([]types.ProcessStats, 0, m.config.HistorySize)
+		m.discovered[pid] = true
+		m.seen[pid] = seenTimes{first: now, last: now}
+	}
+}
+
+// matchesPatterns 判断进程名是否匹配自动发现模式且不在排除列表中，调用方需持有锁
+func (m *ProcessMonitorManager) matchesPatterns(name string) bool {
+	for _, re := range m.excludePatterns {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	for _, re := range m.watchPatterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,40 +1,115 @@
 package monitor
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
 )
 
+// maxConsecutiveErrors 连续采集失败多少次后停止监控该进程
+const maxConsecutiveErrors = 3
+
+// seenTimes 进程加入监控和最近一次确认存活的时间
+type seenTimes struct {
+	first time.Time
+	last  time.Time
+}
+
+// DefaultCollectTimeout 采集单个进程统计信息的默认超时时间
+const DefaultCollectTimeout = 5 * time.Second
+
+// BaselineTimeout AddProcess采集基准样本的超时时间，不超过采集超时。基准采集在调用方
+// 协程中进行，超时后不阻塞调用方，由监控循环的下一次采集建立基准
+const BaselineTimeout = 500 * time.Millisecond
+
+// maxAlerts 保留的偏离告警条数
+const maxAlerts = 100
+
 // ProcessMonitorManager 进程监控管理器
 type ProcessMonitorManager struct {
+	collector          StatsCollector
+	collectTimeout     time.Duration
+	clock              Clock
 	monitoredProcesses map[int]string // pid -> name
 	statsHistory       map[int][]types.ProcessStats
 	config             types.MonitorConfig
+	idleConfigs        map[int]types.IdleConfig
+	idleSince          map[int]time.Time
+	idleHandler        func(pid int, name string, config types.IdleConfig)
+	baselines          map[int]types.UsageBaseline
+	deviationHandler   func(alert types.DeviationAlert)
+	alerts             []types.DeviationAlert // 最近的偏离告警，最多maxAlerts条
+	watchPatterns      []*regexp.Regexp
+	excludePatterns    []*regexp.Regexp
+	discovered         map[int]bool      // 通过名称模式自动加入的进程
+	seen               map[int]seenTimes // 首次和最近一次出现的时间
+	errorCounts        map[int]int       // 连续采集失败次数
+	nameSnapshot       map[int]string    // 按名称查找使用的进程列表快照
+	nameTaken          time.Time
+	nameTTL            time.Duration
+	nameMu             sync.Mutex // 保护名称查找快照，扫描期间不持有mu
+	health             types.MonitorHealth
 	running            bool
+	startedAt          time.Time // 最近一次启动的时间
+	firstSampled       bool      // 启动后是否已完成第一轮采集
+	nextCollection     time.Time
 	stopChan           chan struct{}
+	stopOnce           sync.Once
+	wg                 sync.WaitGroup // 监控循环协程
+	resetChan          chan struct{}
 	mu                 sync.RWMutex
 }
 
 // NewProcessMonitorManager 创建新的进程监控管理器
 func NewProcessMonitorManager() *ProcessMonitorManager {
+	return NewProcessMonitorManagerWithCollector(nil)
+}
+
+// NewProcessMonitorManagerWithCollector 使用自定义采集器创建进程监控管理器，
+// collector为nil时使用平台默认实现
+func NewProcessMonitorManagerWithCollector(collector StatsCollector) *ProcessMonitorManager {
+	if collector == nil {
+		collector = newPlatformCollector()
+	}
+
 	return &ProcessMonitorManager{
+		collector:          collector,
+		collectTimeout:     DefaultCollectTimeout,
+		clock:              realClock{},
 		monitoredProcesses: make(map[int]string),
 		statsHistory:       make(map[int][]types.ProcessStats),
+		idleConfigs:        make(map[int]types.IdleConfig),
+		idleSince:          make(map[int]time.Time),
+		baselines:          make(map[int]types.UsageBaseline),
+		discovered:         make(map[int]bool),
+		seen:               make(map[int]seenTimes),
+		errorCounts:        make(map[int]int),
+		nameTTL:            DefaultNameCacheTTL,
 		config: types.MonitorConfig{
 			Enabled:     true,
 			Interval:    2 * time.Second,
 			HistorySize: 60, // 保留最近60个样本
 		},
-		stopChan: make(chan struct{}),
+		stopChan:  make(chan struct{}),
+		resetChan: make(chan struct{}, 1),
 	}
 }
 
 // Start 启动监控
 func (m *ProcessMonitorManager) Start() error {
+	return m.StartContext(context.Background())
+}
+
+// StartContext 启动监控，ctx取消时自动停止
+func (m *ProcessMonitorManager) StartContext(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -42,8 +117,14 @@ func (m *ProcessMonitorManager) Start() error {
 		return fmt.Errorf("monitor is already running")
 	}
 
+	// 每次启动使用新的停止通道，支持停止后再次启动
+	m.stopChan = make(chan struct{})
+	m.stopOnce = sync.Once{}
 	m.running = true
-	go m.monitoringLoop()
+	m.startedAt = m.clock.Now()
+	m.firstSampled = false
+	m.wg.Add(1)
+	go m.monitoringLoop(ctx, m.stopChan)
 	return nil
 }
 
@@ -56,22 +137,138 @@ func (m *ProcessMonitorManager) Stop() error {
 		return fmt.Errorf("monitor is not running")
 	}
 
-	close(m.stopChan)
+	m.stopLocked()
+	return nil
+}
+
+// stopLocked 关闭当前的停止通道，调用方需持有m.mu且监控正在运行
+func (m *ProcessMonitorManager) stopLocked() {
+	m.stopOnce.Do(func() {
+		close(m.stopChan)
+	})
 	m.running = false
+	m.nextCollection = time.Time{}
+}
+
+// stopRun 仅当stopChan仍属于当前这次运行时停止监控，
+// 已停止后再次启动的监控不受早先ctx取消的影响
+func (m *ProcessMonitorManager) stopRun(stopChan chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running && m.stopChan == stopChan {
+		m.stopLocked()
+	}
+}
+
+// Close 停止监控并等待监控协程退出，未运行时直接返回，可重复调用
+func (m *ProcessMonitorManager) Close() error {
+	m.mu.Lock()
+	if m.running {
+		m.stopLocked()
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
 	return nil
 }
 
-// AddProcess 添加进程到监控列表
-func (m *ProcessMonitorManager) AddProcess(pid int, name string) error {
+// SetClock 设置采集抖动和首个样本耗时等计时指标使用的时钟，需在Start前调用
+func (m *ProcessMonitorManager) SetClock(clock Clock) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.clock = clock
+}
+
+// SetCollectTimeout 设置采集单个进程统计信息的超时时间，超时的采集返回ErrTimeout，
+// 避免挂起的/proc读取阻塞整个采集循环
+func (m *ProcessMonitorManager) SetCollectTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("collect timeout must be positive")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.collectTimeout = timeout
+	return nil
+}
+
+// GetCollectTimeout 获取采集单个进程统计信息的超时时间
+func (m *ProcessMonitorManager) GetCollectTimeout() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.collectTimeout
+}
+
+// GetInterval 获取当前采集间隔
+func (m *ProcessMonitorManager) GetInterval() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.config.Interval
+}
+
+// NextCollection 获取下一次采集的时间，未运行时返回零值
+func (m *ProcessMonitorManager) NextCollection() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.nextCollection
+}
+
+// GetRawProcessStat 获取进程的原始状态字段，供需要ProcessStats之外字段的场景使用。
+// 主要面向Linux：返回/proc/<pid>/stat(按proc(5)的小写字段名，如minflt、majflt、
+// priority、nice)和/proc/<pid>/status(保留原名，如voluntary_ctxt_switches、
+// nonvoluntary_ctxt_switches)的全部字段；Windows上尽力返回Win32_Process的属性。
+// 值为未解析的原始文本，字段集合随内核和平台而不同
+func (m *ProcessMonitorManager) GetRawProcessStat(pid int) (map[string]string, error) {
+	return getRawProcessStat(pid)
+}
+
+// SelfCheck 检查当前平台采集所依赖的外部程序是否存在且可用，
+// 每个缺失或无法运行的程序返回一个错误
+func (m *ProcessMonitorManager) SelfCheck() []error {
+	return util.CheckTools(requiredTools)
+}
+
+// MonitorHealth 获取监控器自身的运行指标
+func (m *ProcessMonitorManager) MonitorHealth() types.MonitorHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	health := m.health
+	health.MonitoredProcesses = len(m.monitoredProcesses)
+	return health
+}
 
+// AddProcess 添加进程到监控列表，并立即采集一次作为基准样本，
+// 使历史数据不为空且下一次采集即可得到实际的CPU使用率。基准采集在调用方协程中进行，
+// 最多阻塞BaselineTimeout，超时时进程仍被监控；进程已经退出时从监控列表移除，
+// 并返回可用errors.Is判断为ErrProcessGone的错误
+func (m *ProcessMonitorManager) AddProcess(pid int, name string) error {
+	m.mu.Lock()
 	if _, exists := m.monitoredProcesses[pid]; exists {
+		m.mu.Unlock()
 		return fmt.Errorf("process %d is already being monitored", pid)
 	}
 
 	m.monitoredProcesses[pid] = name
 	m.statsHistory[pid] = make([]types.ProcessStats, 0, m.config.HistorySize)
+	now := m.clock.Now()
+	m.seen[pid] = seenTimes{first: now, last: now}
+	config := m.config
+	clock := m.clock
+	timeout := min(m.collectTimeout, BaselineTimeout)
+	m.mu.Unlock()
+
+	start := clock.Now()
+	if err := m.collectProcess(pid, name, config, timeout); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	// 基准采集超时时没有样本，首个样本耗时留给监控循环之后的采集
+	if len(m.statsHistory[pid]) > 0 {
+		m.health.AddToFirstSample = clock.Now().Sub(start)
+	}
+	m.mu.Unlock()
 	return nil
 }
 
@@ -86,12 +283,97 @@ func (m *ProcessMonitorManager) RemoveProcess(pid int) error {
 
 	delete(m.monitoredProcesses, pid)
 	delete(m.statsHistory, pid)
+	delete(m.seen, pid)
+	delete(m.idleConfigs, pid)
+	delete(m.idleSince, pid)
+	delete(m.baselines, pid)
+	delete(m.discovered, pid)
+	delete(m.errorCounts, pid)
 	return nil
 }
 
+// SetIdleConfig 设置进程空闲自动停止配置
+func (m *ProcessMonitorManager) SetIdleConfig(pid int, config types.IdleConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.monitoredProcesses[pid]; !exists {
+		return fmt.Errorf("process %d is not being monitored", pid)
+	}
+	if config.Duration <= 0 {
+		return fmt.Errorf("idle duration must be positive")
+	}
+	if config.CPUThreshold < 0 {
+		return fmt.Errorf("idle CPU threshold must not be negative")
+	}
+
+	m.idleConfigs[pid] = config
+	delete(m.idleSince, pid)
+	return nil
+}
+
+// GetIdleConfig 获取进程空闲自动停止配置
+func (m *ProcessMonitorManager) GetIdleConfig(pid int) (types.IdleConfig, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	config, exists := m.idleConfigs[pid]
+	return config, exists
+}
+
+// SetIdleHandler 设置进程空闲超时时的回调
+func (m *ProcessMonitorManager) SetIdleHandler(handler func(pid int, name string, config types.IdleConfig)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idleHandler = handler
+}
+
+// SetUsageBaseline 设置进程的预期资源使用，采集到的CPU或内存偏离预期超过
+// Deviation百分比时产生告警，即使未超过绝对阈值也能发现异常
+func (m *ProcessMonitorManager) SetUsageBaseline(pid int, baseline types.UsageBaseline) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.monitoredProcesses[pid]; !exists {
+		return fmt.Errorf("process %d is not being monitored", pid)
+	}
+	if baseline.Deviation <= 0 {
+		return fmt.Errorf("baseline deviation must be positive")
+	}
+	if baseline.CPUPercent < 0 {
+		return fmt.Errorf("baseline CPU percent must not be negative")
+	}
+
+	m.baselines[pid] = baseline
+	return nil
+}
+
+// GetUsageBaseline 获取进程的预期资源使用
+func (m *ProcessMonitorManager) GetUsageBaseline(pid int) (types.UsageBaseline, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	baseline, exists := m.baselines[pid]
+	return baseline, exists
+}
+
+// SetDeviationHandler 设置资源使用偏离预期时的回调
+func (m *ProcessMonitorManager) SetDeviationHandler(handler func(alert types.DeviationAlert)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deviationHandler = handler
+}
+
+// GetAlerts 获取最近的偏离告警
+func (m *ProcessMonitorManager) GetAlerts() []types.DeviationAlert {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]types.DeviationAlert(nil), m.alerts...)
+}
+
 // GetProcessStats 获取进程统计信息
 func (m *ProcessMonitorManager) GetProcessStats(pid int) (*types.ProcessStats, error) {
-	stats, err := getProcessStats(pid)
+	stats, err := m.processStats(pid)
 	if err != nil {
 		return nil, err
 	}
@@ -106,16 +388,112 @@ func (m *ProcessMonitorManager) GetProcessStats(pid int) (*types.ProcessStats, e
 	return stats, nil
 }
 
+// processStats 通过采集器获取进程统计信息，开启DetailedMemory时补充PSS/USS
+func (m *ProcessMonitorManager) processStats(pid int) (*types.ProcessStats, error) {
+	return m.processStatsWithin(pid, m.GetCollectTimeout())
+}
+
+// processStatsWithin 与processStats相同，每次读取最多等待timeout
+func (m *ProcessMonitorManager) processStatsWithin(pid int, timeout time.Duration) (*types.ProcessStats, error) {
+	m.mu.RLock()
+	detailed := m.config.DetailedMemory
+	m.mu.RUnlock()
+
+	var stats *types.ProcessStats
+	err := withTimeout(timeout, func() (err error) {
+		stats, err = m.collector.ProcessStats(pid)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrTimeout) {
+			return nil, fmt.Errorf("%w: reading stats of process %d took longer than %v", ErrTimeout, pid, timeout)
+		}
+		return nil, err
+	}
+
+	if !detailed {
+		return stats, nil
+	}
+
+	// 无法读取时回退到RSS
+	stats.MemoryPSS = stats.MemoryBytes
+	stats.MemoryUSS = stats.MemoryBytes
+	if collector, ok := m.collector.(MemoryDetailCollector); ok {
+		var pss, uss uint64
+		err := withTimeout(timeout, func() (err error) {
+			pss, uss, err = collector.ProcessMemoryDetail(pid)
+			return err
+		})
+		if err == nil {
+			stats.MemoryPSS = pss
+			stats.MemoryUSS = uss
+		}
+	}
+
+	return stats, nil
+}
+
+// withTimeout 在独立协程中执行fn，超过timeout未返回时返回ErrTimeout。
+// 阻塞的系统调用无法取消，该协程在fn返回后才退出，调用方超时后不得再读取fn写入的结果
+func withTimeout(timeout time.Duration, fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ErrTimeout
+	}
+}
+
 // GetProcessStatsByName 按进程名获取统计信息
 func (m *ProcessMonitorManager) GetProcessStatsByName(name string) ([]types.ProcessStats, error) {
-	pids, names, err := getPIDsByName(name)
+	return m.GetProcessStatsByNameContext(context.Background(), name)
+}
+
+// GetProcessStatsByNameContext 按进程名获取统计信息，ctx取消时中止查找
+// (Unix中止/proc遍历，Windows结束tasklist子进程)并返回ctx.Err()。
+// 进程列表快照在SetNameCacheTTL设置的有效期内复用。
+func (m *ProcessMonitorManager) GetProcessStatsByNameContext(ctx context.Context, name string) ([]types.ProcessStats, error) {
+	statsList, _, err := m.GetProcessStatsByNameLimited(ctx, name, types.NameQueryOptions{})
+	return statsList, err
+}
+
+// GetProcessStatsByNameLimited 按进程名获取最多opts.Limit个进程的统计信息，并返回名称匹配的进程总数。
+// 按PID排序时依次采集，取得Limit个结果后即停止；按CPU或内存排序时需采集全部匹配进程后再截取
+func (m *ProcessMonitorManager) GetProcessStatsByNameLimited(ctx context.Context, name string, opts types.NameQueryOptions) ([]types.ProcessStats, int, error) {
+	var less func(a, b types.ProcessStats) bool
+	switch opts.SortBy {
+	case types.SortByPID:
+	case types.SortByCPU:
+		less = func(a, b types.ProcessStats) bool { return a.CPUPercent > b.CPUPercent }
+	case types.SortByMemory:
+		less = func(a, b types.ProcessStats) bool { return a.MemoryBytes > b.MemoryBytes }
+	default:
+		return nil, 0, fmt.Errorf("unknown sort key %q", opts.SortBy)
+	}
+
+	pids, names, err := m.lookupPIDs(ctx, name)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	var statsList []types.ProcessStats
 	for i, pid := range pids {
-		stats, err := getProcessStats(pid)
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		// 按PID排序时后面的进程不会进入结果
+		if less == nil && opts.Limit > 0 && len(statsList) >= opts.Limit {
+			break
+		}
+		stats, err := m.processStats(pid)
 		if err != nil {
 			continue // 忽略错误的进程
 		}
@@ -123,17 +501,29 @@ func (m *ProcessMonitorManager) GetProcessStatsByName(name string) ([]types.Proc
 		statsList = append(statsList, *stats)
 	}
 
-	return statsList, nil
+	if less != nil {
+		sort.SliceStable(statsList, func(i, j int) bool {
+			return less(statsList[i], statsList[j])
+		})
+	}
+	if opts.Limit > 0 && len(statsList) > opts.Limit {
+		statsList = statsList[:opts.Limit]
+	}
+	return statsList, len(pids), nil
 }
 
 // GetAllStats 获取所有被监控进程的统计信息
 func (m *ProcessMonitorManager) GetAllStats() ([]types.ProcessStats, error) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	processes := make(map[int]string, len(m.monitoredProcesses))
+	for pid, name := range m.monitoredProcesses {
+		processes[pid] = name
+	}
+	m.mu.RUnlock()
 
 	var statsList []types.ProcessStats
-	for pid, name := range m.monitoredProcesses {
-		stats, err := getProcessStats(pid)
+	for pid, name := range processes {
+		stats, err := m.processStats(pid)
 		if err != nil {
 			continue // 进程可能已经退出
 		}
@@ -149,6 +539,35 @@ func (m *ProcessMonitorManager) GetAllStats() ([]types.ProcessStats, error) {
 	return statsList, nil
 }
 
+// TopByCPU 按CPU使用率降序返回前n个被监控进程，n<=0时返回全部
+func (m *ProcessMonitorManager) TopByCPU(n int) []types.ProcessStats {
+	return m.top(n, func(a, b types.ProcessStats) bool {
+		return a.CPUPercent > b.CPUPercent
+	})
+}
+
+// TopByMemory 按内存使用量降序返回前n个被监控进程，n<=0时返回全部
+func (m *ProcessMonitorManager) TopByMemory(n int) []types.ProcessStats {
+	return m.top(n, func(a, b types.ProcessStats) bool {
+		return a.MemoryBytes > b.MemoryBytes
+	})
+}
+
+// top 按给定顺序排序被监控进程并截取前n个，使用率相同时按PID升序
+func (m *ProcessMonitorManager) top(n int, less func(a, b types.ProcessStats) bool) []types.ProcessStats {
+	statsList, _ := m.GetAllStats()
+
+	// GetAllStats已按PID排序，稳定排序保证相同使用率时按PID排列
+	sort.SliceStable(statsList, func(i, j int) bool {
+		return less(statsList[i], statsList[j])
+	})
+
+	if n > 0 && n < len(statsList) {
+		statsList = statsList[:n]
+	}
+	return statsList
+}
+
 // GetProcessHistory 获取进程历史统计
 func (m *ProcessMonitorManager) GetProcessHistory(pid int, count int) ([]types.ProcessStats, error) {
 	m.mu.RLock()
@@ -163,9 +582,76 @@ func (m *ProcessMonitorManager) GetProcessHistory(pid int, count int) ([]types.P
 		count = len(history)
 	}
 
-	// 返回最新的数据
+	// 返回最新数据的副本，避免调用方与采集协程共享底层数组
 	start := len(history) - count
-	return history[start:], nil
+	return append([]types.ProcessStats(nil), history[start:]...), nil
+}
+
+// GetLastSample 获取进程最近一次采集的样本，不触发实时采集；尚无样本时返回false
+func (m *ProcessMonitorManager) GetLastSample(pid int) (types.ProcessStats, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := m.statsHistory[pid]
+	if len(history) == 0 {
+		return types.ProcessStats{}, false
+	}
+	return history[len(history)-1], true
+}
+
+// ClearHistory 清空所有进程的历史数据并清除CPU基准值，被监控的进程保持不变，
+// 下一次采集重新建立基准
+func (m *ProcessMonitorManager) ClearHistory() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for pid := range m.statsHistory {
+		m.statsHistory[pid] = make([]types.ProcessStats, 0, m.config.HistorySize)
+	}
+	if resetter, ok := m.collector.(BaselineResetter); ok {
+		resetter.ResetBaselines()
+	}
+}
+
+// GetProcessStatsHistory 获取按采集间隔对齐到墙上时钟的历史数据，返回最近count个时间段。
+//
+// 每个时间段从interval的整数倍开始(time.Truncate)，最后一个时间段包含当前时间。
+// 时间段内有多个采样时取最新的一个；没有采样(监控暂停、采集失败等)时Stats为nil，
+// 图表据此显示断档而不是跨过停机时间连线。当前时间段尚未采集时也为nil。
+func (m *ProcessMonitorManager) GetProcessStatsHistory(pid int, count int) ([]types.HistoryPoint, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+
+	m.mu.RLock()
+	history, exists := m.statsHistory[pid]
+	if !exists {
+		m.mu.RUnlock()
+		return nil, fmt.Errorf("no history found for process %d", pid)
+	}
+	samples := make([]types.ProcessStats, len(history))
+	copy(samples, history)
+	interval := m.config.Interval
+	m.mu.RUnlock()
+
+	end := time.Now().Truncate(interval)
+	start := end.Add(-time.Duration(count-1) * interval)
+
+	points := make([]types.HistoryPoint, count)
+	for i := range points {
+		points[i].Time = start.Add(time.Duration(i) * interval)
+	}
+
+	// 历史按时间顺序排列，后面的采样覆盖同一时间段内较早的采样
+	for i := range samples {
+		slot := samples[i].Timestamp.Truncate(interval)
+		if slot.Before(start) || slot.After(end) {
+			continue
+		}
+		points[int(slot.Sub(start)/interval)].Stats = &samples[i]
+	}
+
+	return points, nil
 }
 
 // GetConfig 获取监控配置
@@ -186,71 +672,302 @@ func (m *ProcessMonitorManager) UpdateConfig(config types.MonitorConfig) error {
 	if config.HistorySize < 1 {
 		return fmt.Errorf("history size must be at least 1")
 	}
+	if config.MaxAge < 0 {
+		return fmt.Errorf("max age must not be negative")
+	}
+	if config.RetentionDays != 0 {
+		return fmt.Errorf("retention days is not supported by the process monitor")
+	}
+	if config.AlertThresholds.CPU != 0 || config.AlertThresholds.Memory != 0 || config.AlertThresholds.Disk != 0 {
+		return fmt.Errorf("alert thresholds are not supported by the process monitor")
+	}
+	if config.CPUAverageSamples < 0 {
+		return fmt.Errorf("CPU average samples must not be negative")
+	}
+	if config.DeadBand != 0 || config.MaxGap != 0 {
+		return fmt.Errorf("dead band sampling is not supported by the process monitor")
+	}
+	if config.CPUEMAAlpha != 0 {
+		return fmt.Errorf("CPU EMA smoothing is not supported by the process monitor")
+	}
 
+	intervalChanged := config.Interval != m.config.Interval
 	m.config = config
+
+	// 通知监控循环按新的间隔重置定时器
+	if intervalChanged {
+		select {
+		case m.resetChan <- struct{}{}:
+		default:
+		}
+	}
+
+	// 如果历史数据超过新的限制，进行裁剪
+	now := time.Now()
+	for pid, history := range m.statsHistory {
+		m.statsHistory[pid] = trimHistory(history, config, now)
+	}
 	return nil
 }
 
-// GetMonitoredProcesses 获取被监控的进程列表
-func (m *ProcessMonitorManager) GetMonitoredProcesses() map[int]string {
+// GetMonitoredProcesses 获取被监控的进程列表及其首次和最近一次出现的时间，
+// 自动发现模式下可据此发现频繁启停的进程
+func (m *ProcessMonitorManager) GetMonitoredProcesses() map[int]types.MonitoredProcess {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	result := make(map[int]string)
+	result := make(map[int]types.MonitoredProcess, len(m.monitoredProcesses))
 	for pid, name := range m.monitoredProcesses {
-		result[pid] = name
+		seen := m.seen[pid]
+		result[pid] = types.MonitoredProcess{
+			PID:        pid,
+			Name:       name,
+			Discovered: m.discovered[pid],
+			FirstSeen:  seen.first,
+			LastSeen:   seen.last,
+		}
 	}
 	return result
 }
 
 // monitoringLoop 监控循环
-func (m *ProcessMonitorManager) monitoringLoop() {
-	ticker := time.NewTicker(m.config.Interval)
+func (m *ProcessMonitorManager) monitoringLoop(ctx context.Context, stopChan chan struct{}) {
+	defer m.wg.Done()
+	m.mu.Lock()
+	interval := m.config.Interval
+	clock := m.clock
+	m.nextCollection = clock.Now().Add(interval)
+	m.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-m.stopChan:
+		case <-stopChan:
+			return
+		case <-ctx.Done():
+			m.stopRun(stopChan)
 			return
+		case <-m.resetChan:
+			m.mu.Lock()
+			interval = m.config.Interval
+			ticker.Reset(interval)
+			m.nextCollection = clock.Now().Add(interval)
+			m.mu.Unlock()
 		case <-ticker.C:
+			m.mu.Lock()
+			now := clock.Now()
+			jitter := now.Sub(m.nextCollection)
+			m.nextCollection = now.Add(interval)
+			m.mu.Unlock()
+
+			start := time.Now()
 			m.collectStats()
+			elapsed := time.Since(start)
+
+			m.mu.Lock()
+			m.health.Record(elapsed, interval, false)
+			m.health.RecordJitter(jitter)
+			if !m.firstSampled {
+				m.firstSampled = true
+				m.health.TimeToFirstSample = clock.Now().Sub(m.startedAt)
+			}
+			m.mu.Unlock()
 		}
 	}
 }
 
 // collectStats 收集所有被监控进程的统计信息
 func (m *ProcessMonitorManager) collectStats() {
+	m.refreshDiscovered()
+
 	m.mu.RLock()
 	processes := make(map[int]string)
 	for pid, name := range m.monitoredProcesses {
 		processes[pid] = name
 	}
 	config := m.config
+	timeout := m.collectTimeout
 	m.mu.RUnlock()
 
 	for pid, name := range processes {
-		stats, err := getProcessStats(pid)
-		if err != nil {
-			// 进程可能已经退出，从监控列表中移除
-			m.mu.Lock()
-			delete(m.monitoredProcesses, pid)
-			delete(m.statsHistory, pid)
-			m.mu.Unlock()
-			continue
+		m.collectProcess(pid, name, config, timeout)
+	}
+}
+
+// collectProcess 采集单个进程的统计信息并写入历史，每次读取最多等待timeout，
+// 进程因此被移出监控列表时返回原因
+func (m *ProcessMonitorManager) collectProcess(pid int, name string, config types.MonitorConfig, timeout time.Duration) error {
+	stats, err := m.processStatsWithin(pid, timeout)
+	if err != nil {
+		// 权限、解析等临时错误保留历史并跳过本次采集，
+		// 连续失败达到上限时才视为无法监控
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, exists := m.monitoredProcesses[pid]; !exists {
+			return nil
+		}
+		m.errorCounts[pid]++
+		if !errors.Is(err, ErrProcessGone) && m.errorCounts[pid] < maxConsecutiveErrors {
+			return nil
 		}
 
-		stats.Name = name
-		stats.Timestamp = time.Now()
+		// 进程已经退出，从监控列表中移除
+		delete(m.errorCounts, pid)
+		delete(m.monitoredProcesses, pid)
+		delete(m.statsHistory, pid)
+		delete(m.seen, pid)
+		delete(m.idleConfigs, pid)
+		delete(m.baselines, pid)
+		delete(m.idleSince, pid)
+		delete(m.discovered, pid)
+		return fmt.Errorf("process %d removed from monitoring: %w", pid, err)
+	}
 
-		m.mu.Lock()
-		history := m.statsHistory[pid]
-		history = append(history, *stats)
+	stats.Name = name
+	stats.Timestamp = time.Now()
+
+	m.mu.Lock()
+	// 采集期间进程可能已被移除
+	if _, exists := m.monitoredProcesses[pid]; !exists {
+		m.mu.Unlock()
+		return nil
+	}
+	delete(m.errorCounts, pid)
+	if seen, exists := m.seen[pid]; exists {
+		seen.last = m.clock.Now()
+		m.seen[pid] = seen
+	}
+	stats.CPUPercentAvg = cpuAverage(m.statsHistory[pid], stats.CPUPercent, config.CPUAverageSamples)
+	history := append(m.statsHistory[pid], *stats)
+
+	// 保持历史记录不超过配置的大小和保留时间
+	m.statsHistory[pid] = trimHistory(history, config, stats.Timestamp)
+	m.mu.Unlock()
+
+	m.checkIdle(pid, name, stats)
+	m.checkDeviation(pid, name, stats)
+	return nil
+}
+
+// trimHistory 按配置裁剪按时间排列的历史：最多保留HistorySize个样本，
+// 并丢弃在now之前超过MaxAge的样本
+func trimHistory(history []types.ProcessStats, config types.MonitorConfig, now time.Time) []types.ProcessStats {
+	if len(history) > config.HistorySize {
+		history = history[len(history)-config.HistorySize:]
+	}
+	if config.MaxAge <= 0 {
+		return history
+	}
+
+	cutoff := now.Add(-config.MaxAge)
+	first := sort.Search(len(history), func(i int) bool {
+		return history[i].Timestamp.After(cutoff)
+	})
+	return history[first:]
+}
 
-		// 保持历史记录不超过配置的大小
-		if len(history) > config.HistorySize {
-			history = history[len(history)-config.HistorySize:]
+// cpuAverage 计算当前CPU使用率与最近samples-1个历史样本的平均值，
+// 历史不足时按已有样本计算
+func cpuAverage(history []types.ProcessStats, current float64, samples int) float64 {
+	if samples > len(history)+1 {
+		samples = len(history) + 1
+	}
+	if samples <= 1 {
+		return current
+	}
+
+	sum := current
+	for _, stats := range history[len(history)-samples+1:] {
+		sum += stats.CPUPercent
+	}
+	return sum / float64(samples)
+}
+
+// checkDeviation 检查进程资源使用是否偏离预期，偏离时记录告警并调用回调
+func (m *ProcessMonitorManager) checkDeviation(pid int, name string, stats *types.ProcessStats) {
+	m.mu.Lock()
+	baseline, exists := m.baselines[pid]
+	if !exists {
+		m.mu.Unlock()
+		return
+	}
+
+	var alerts []types.DeviationAlert
+	check := func(metric string, expected, actual float64, format func(float64) string) {
+		if expected <= 0 {
+			return
+		}
+		deviation := math.Abs(actual-expected) / expected * 100
+		if deviation <= baseline.Deviation {
+			return
+		}
+		alerts = append(alerts, types.DeviationAlert{
+			PID:       pid,
+			Name:      name,
+			Metric:    metric,
+			Expected:  expected,
+			Actual:    actual,
+			Deviation: deviation,
+			Timestamp: stats.Timestamp,
+			Message: fmt.Sprintf("[%s] %s (PID %d) %s usage deviates %.0f%% from baseline: expected %s, actual %s",
+				stats.Timestamp.Format("2006-01-02 15:04:05"), name, pid, metric, deviation, format(expected), format(actual)),
+		})
+	}
+	percent := func(v float64) string { return fmt.Sprintf("%.2f%%", v) }
+	bytes := func(v float64) string { return fmt.Sprintf("%.0f bytes", v) }
+	check("cpu", baseline.CPUPercent, stats.CPUPercent, percent)
+	check("memory", float64(baseline.MemoryBytes), float64(stats.MemoryBytes), bytes)
+
+	m.alerts = append(m.alerts, alerts...)
+	if len(m.alerts) > maxAlerts {
+		m.alerts = m.alerts[len(m.alerts)-maxAlerts:]
+	}
+	handler := m.deviationHandler
+	m.mu.Unlock()
+
+	if handler != nil {
+		for _, alert := range alerts {
+			handler(alert)
 		}
-		m.statsHistory[pid] = history
+	}
+}
+
+// checkIdle 检查进程是否空闲超时，超时则调用空闲回调
+func (m *ProcessMonitorManager) checkIdle(pid int, name string, stats *types.ProcessStats) {
+	m.mu.Lock()
+	config, exists := m.idleConfigs[pid]
+	if !exists {
 		m.mu.Unlock()
+		return
+	}
+
+	if stats.CPUPercent >= config.CPUThreshold {
+		delete(m.idleSince, pid)
+		m.mu.Unlock()
+		return
+	}
+
+	since, idle := m.idleSince[pid]
+	if !idle {
+		m.idleSince[pid] = stats.Timestamp
+		m.mu.Unlock()
+		return
+	}
+
+	if stats.Timestamp.Sub(since) < config.Duration {
+		m.mu.Unlock()
+		return
+	}
+
+	// 空闲超时，停止跟踪该进程的空闲状态，避免重复触发
+	delete(m.idleConfigs, pid)
+	delete(m.idleSince, pid)
+	handler := m.idleHandler
+	m.mu.Unlock()
+
+	if handler != nil {
+		handler(pid, name, config)
 	}
 }
@@ -1,9 +1,128 @@
 package monitor
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/dreamsxin/process-manager/types"
 )
 
+// 平台采集函数返回的错误分类，可使用errors.Is判断
+var (
+	// ErrProcessGone 进程已退出或不存在
+	ErrProcessGone = errors.New("process gone")
+
+	// ErrPermission 无权限读取进程信息
+	ErrPermission = errors.New("permission denied")
+
+	// ErrParse 进程信息格式无法解析
+	ErrParse = errors.New("parse error")
+
+	// ErrTimeout 读取进程信息超时，如/proc所在文件系统挂起
+	ErrTimeout = errors.New("timeout")
+)
+
+// Clock 提供采集计时指标使用的当前时间，测试中可替换为可手动推进的时钟
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock 系统时钟
+type realClock struct{}
+
+// Now 返回当前时间
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// StatsCollector 进程统计信息采集器接口
+type StatsCollector interface {
+	// 获取指定进程的统计信息
+	ProcessStats(pid int) (*types.ProcessStats, error)
+}
+
+// cpuUsage 用于CPU使用率计算
+type cpuUsage struct {
+	lastTime  time.Time
+	lastUTime uint64
+	lastSTime uint64
+}
+
+// cpuBaselines 按PID保存计算CPU使用率增量的上一次采样，由各采集器分别持有，
+// 清除一个监控器的基准值不影响其他监控器
+type cpuBaselines struct {
+	mu    sync.Mutex // 采集在withTimeout的协程中并发进行
+	usage map[int]*cpuUsage
+}
+
+// reset 清除所有进程的CPU基准值
+func (b *cpuBaselines) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.usage = make(map[int]*cpuUsage)
+}
+
+// platformCollector 基于平台实现(/proc或wmic)的默认采集器
+type platformCollector struct {
+	cpu *cpuBaselines
+}
+
+// newPlatformCollector 创建持有独立CPU基准值的平台采集器
+func newPlatformCollector() platformCollector {
+	return platformCollector{cpu: &cpuBaselines{usage: make(map[int]*cpuUsage)}}
+}
+
+// ProcessStats 获取进程统计信息
+func (c platformCollector) ProcessStats(pid int) (*types.ProcessStats, error) {
+	return getProcessStats(pid, c.cpu)
+}
+
+// ProcessMemoryDetail 获取进程PSS/USS
+func (platformCollector) ProcessMemoryDetail(pid int) (uint64, uint64, error) {
+	return getProcessMemoryDetail(pid)
+}
+
+// ListProcesses 列出系统中所有进程
+func (platformCollector) ListProcesses() (map[int]string, error) {
+	return listProcesses()
+}
+
+// ResetBaselines 清除CPU使用率的增量基准值
+func (c platformCollector) ResetBaselines() {
+	c.cpu.reset()
+}
+
+// GetProcessCreateTime 获取进程的创建时间：Linux由/proc/<pid>/stat的启动时间
+// 和系统启动时间计算，Windows调用GetProcessTimes，macOS通过sysctl读取kinfo_proc。
+// 进程不存在时返回ErrProcessGone
+func GetProcessCreateTime(pid int) (time.Time, error) {
+	if pid <= 0 {
+		return time.Time{}, fmt.Errorf("%w: invalid PID %d", ErrProcessGone, pid)
+	}
+	return processCreateTime(pid)
+}
+
+// MemoryDetailCollector 可选接口，支持获取PSS/USS的采集器实现该接口
+type MemoryDetailCollector interface {
+	// 获取进程的PSS和USS(字节)
+	ProcessMemoryDetail(pid int) (pss uint64, uss uint64, err error)
+}
+
+// ProcessLister 可选接口，支持按名称自动发现进程的采集器实现该接口
+type ProcessLister interface {
+	// 列出系统中所有进程(pid -> 进程名)
+	ListProcesses() (map[int]string, error)
+}
+
+// BaselineResetter 可选接口，按增量计算CPU使用率的采集器实现该接口，
+// 清除基准值后下一次采集重新建立基准
+type BaselineResetter interface {
+	// 清除所有进程的CPU基准值
+	ResetBaselines()
+}
+
 // Monitor 监控器接口
 type Monitor interface {
 	// 启动监控
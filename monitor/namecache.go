@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultNameCacheTTL 按名称查找时进程列表快照的默认有效期，与默认采集间隔相同
+const DefaultNameCacheTTL = 2 * time.Second
+
+// SetNameCacheTTL 设置按名称查找时进程列表快照的有效期，有效期内的多次查找
+// 共用一次进程列表扫描；ttl为0时每次查找都重新扫描
+func (m *ProcessMonitorManager) SetNameCacheTTL(ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("name cache TTL must not be negative")
+	}
+
+	m.nameMu.Lock()
+	defer m.nameMu.Unlock()
+	m.nameTTL = ttl
+	m.nameSnapshot = nil
+	return nil
+}
+
+// lookupPIDs 根据进程名查找PID，按PID排序。快照在有效期内时直接使用；
+// 快照中没有该名称时重新扫描，以免遗漏有效期内新启动的进程。
+// 快照中已退出的进程由调用方在采集统计信息时跳过。
+func (m *ProcessMonitorManager) lookupPIDs(ctx context.Context, name string) ([]int, []string, error) {
+	m.nameMu.Lock()
+	defer m.nameMu.Unlock()
+
+	fresh := m.nameSnapshot != nil && time.Since(m.nameTaken) < m.nameTTL
+	if fresh {
+		if pids, names := matchName(m.nameSnapshot, name); len(pids) > 0 {
+			return pids, names, nil
+		}
+	}
+
+	processes, err := listProcessesContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	m.health.NameScans++
+	m.mu.Unlock()
+
+	m.nameSnapshot = processes
+	m.nameTaken = time.Now()
+	pids, names := matchName(processes, name)
+	return pids, names, nil
+}
+
+// matchName 返回快照中名称与name匹配的PID和实际进程名，按PID排序
+func matchName(processes map[int]string, name string) ([]int, []string) {
+	var pids []int
+	for pid, processName := range processes {
+		if processNameMatches(processName, name) {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+
+	names := make([]string, len(pids))
+	for i, pid := range pids {
+		names[i] = processes[pid]
+	}
+	return pids, names
+}
@@ -4,20 +4,28 @@ package monitor
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
 )
 
-// getProcessStats 获取Unix进程统计信息
-func getProcessStats(pid int) (*types.ProcessStats, error) {
+// requiredTools 进程监控器依赖的外部程序，Unix上直接读取/proc
+var requiredTools []util.Tool
+
+// getProcessStats 获取Unix进程统计信息，CPU使用率按baselines中的上一次采样增量计算
+func getProcessStats(pid int, baselines *cpuBaselines) (*types.ProcessStats, error) {
 	// 检查进程是否存在
 	if !isProcessRunning(pid) {
-		return nil, fmt.Errorf("process %d does not exist", pid)
+		return nil, fmt.Errorf("%w: process %d does not exist", ErrProcessGone, pid)
 	}
 
 	// 获取进程状态信息
@@ -33,7 +41,7 @@ func getProcessStats(pid int) (*types.ProcessStats, error) {
 	}
 
 	// 获取进程CPU使用率
-	cpuPercent, err := getProcessCPUPercent(pid)
+	cpuPercent, err := getProcessCPUPercent(pid, baselines)
 	if err != nil {
 		cpuPercent = 0
 	}
@@ -72,21 +80,12 @@ type processMemoryInfo struct {
 	vsize uint64 // 虚拟内存大小
 }
 
-// cpuUsage 用于CPU使用率计算
-type cpuUsage struct {
-	lastTime  time.Time
-	lastUTime uint64
-	lastSTime uint64
-}
-
-var cpuUsageMap = make(map[int]*cpuUsage)
-
 // getProcessStat 从/proc文件系统读取进程状态
 func getProcessStat(pid int) (*processStat, error) {
 	statFile := fmt.Sprintf("/proc/%d/stat", pid)
 	data, err := os.ReadFile(statFile)
 	if err != nil {
-		return nil, err
+		return nil, classifyReadError(pid, err)
 	}
 
 	// 解析stat文件内容
@@ -95,14 +94,14 @@ func getProcessStat(pid int) (*processStat, error) {
 	firstParen := strings.IndexRune(content, '(')
 	lastParen := strings.LastIndex(content, ")")
 	if firstParen == -1 || lastParen == -1 {
-		return nil, fmt.Errorf("invalid stat format for PID %d", pid)
+		return nil, fmt.Errorf("%w: invalid stat format for PID %d", ErrParse, pid)
 	}
 
 	name := content[firstParen+1 : lastParen]
 	rest := strings.Fields(content[lastParen+2:])
 
 	if len(rest) < 20 {
-		return nil, fmt.Errorf("invalid stat format for PID %d", pid)
+		return nil, fmt.Errorf("%w: invalid stat format for PID %d", ErrParse, pid)
 	}
 
 	// 解析字段
@@ -128,25 +127,95 @@ func getProcessStat(pid int) (*processStat, error) {
 	}, nil
 }
 
+// statFieldNames /proc/<pid>/stat各字段的名称，与proc(5)一致
+var statFieldNames = []string{
+	"pid", "comm", "state", "ppid", "pgrp", "session", "tty_nr", "tpgid", "flags",
+	"minflt", "cminflt", "majflt", "cmajflt", "utime", "stime", "cutime", "cstime",
+	"priority", "nice", "num_threads", "itrealvalue", "starttime", "vsize", "rss",
+	"rsslim", "startcode", "endcode", "startstack", "kstkesp", "kstkeip", "signal",
+	"blocked", "sigignore", "sigcatch", "wchan", "nswap", "cnswap", "exit_signal",
+	"processor", "rt_priority", "policy", "delayacct_blkio_ticks", "guest_time",
+	"cguest_time", "start_data", "end_data", "start_brk", "arg_start", "arg_end",
+	"env_start", "env_end", "exit_code",
+}
+
+// getRawProcessStat 读取/proc/<pid>/stat和/proc/<pid>/status的全部字段。
+// stat字段使用proc(5)中的小写名称(如minflt、nice)，status字段保留文件中的
+// 名称(如voluntary_ctxt_switches、VmRSS)，值为原始文本
+func getRawProcessStat(pid int) (map[string]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, classifyReadError(pid, err)
+	}
+
+	// 进程名可能包含空格和括号，以最后一个右括号为界
+	content := strings.TrimSpace(string(data))
+	firstParen := strings.IndexRune(content, '(')
+	lastParen := strings.LastIndex(content, ")")
+	if firstParen == -1 || lastParen < firstParen {
+		return nil, fmt.Errorf("%w: invalid stat format for PID %d", ErrParse, pid)
+	}
+
+	values := append([]string{strings.TrimSpace(content[:firstParen]), content[firstParen+1 : lastParen]},
+		strings.Fields(content[lastParen+1:])...)
+	fields := make(map[string]string, len(values)+64)
+	for i, value := range values {
+		if i >= len(statFieldNames) {
+			break
+		}
+		fields[statFieldNames[i]] = value
+	}
+
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, classifyReadError(pid, err)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+
+	return fields, nil
+}
+
+// classifyReadError 将读取/proc文件的错误归类为ErrProcessGone或ErrPermission
+func classifyReadError(pid int, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ESRCH):
+		return fmt.Errorf("%w: process %d: %v", ErrProcessGone, pid, err)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: process %d: %v", ErrPermission, pid, err)
+	default:
+		return err
+	}
+}
+
 // getProcessMemoryInfo 获取进程内存信息
 func getProcessMemoryInfo(pid int) (*processMemoryInfo, error) {
 	statmFile := fmt.Sprintf("/proc/%d/statm", pid)
 	data, err := os.ReadFile(statmFile)
 	if err != nil {
-		return nil, err
+		return nil, classifyReadError(pid, err)
 	}
 
 	fields := strings.Fields(string(data))
 	if len(fields) < 2 {
-		return nil, fmt.Errorf("invalid statm format for PID %d", pid)
+		return nil, fmt.Errorf("%w: invalid statm format for PID %d", ErrParse, pid)
 	}
 
 	// 获取页面大小
 	pageSize := uint64(os.Getpagesize())
 
 	// 解析字段
-	vsize, _ := strconv.ParseUint(fields[0], 10, 64)
-	rss, _ := strconv.ParseUint(fields[1], 10, 64)
+	vsize, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid statm size for PID %d: %v", ErrParse, pid, err)
+	}
+	rss, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid statm rss for PID %d: %v", ErrParse, pid, err)
+	}
 
 	// 转换为字节
 	vsize *= pageSize
@@ -158,8 +227,48 @@ func getProcessMemoryInfo(pid int) (*processMemoryInfo, error) {
 	}, nil
 }
 
+// getProcessMemoryDetail 从smaps_rollup(旧内核回退到smaps)读取PSS和USS
+func getProcessMemoryDetail(pid int) (uint64, uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/smaps_rollup", pid))
+	if err != nil {
+		data, err = os.ReadFile(fmt.Sprintf("/proc/%d/smaps", pid))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var pss, uss uint64
+	var found bool
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "Pss:", "Private_Clean:", "Private_Dirty:":
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			if fields[0] == "Pss:" {
+				pss += kb * 1024
+				found = true
+			} else {
+				uss += kb * 1024
+			}
+		}
+	}
+
+	if !found {
+		return 0, 0, fmt.Errorf("no PSS data for PID %d", pid)
+	}
+	return pss, uss, nil
+}
+
 // getProcessCPUPercent 计算进程CPU使用率
-func getProcessCPUPercent(pid int) (float64, error) {
+func getProcessCPUPercent(pid int, baselines *cpuBaselines) (float64, error) {
 	stat, err := getProcessStat(pid)
 	if err != nil {
 		return 0, err
@@ -168,11 +277,14 @@ func getProcessCPUPercent(pid int) (float64, error) {
 	now := time.Now()
 	totalTime := stat.utime + stat.stime
 
+	baselines.mu.Lock()
+	defer baselines.mu.Unlock()
+
 	// 检查是否有上一次的记录
-	usage, exists := cpuUsageMap[pid]
+	usage, exists := baselines.usage[pid]
 	if !exists {
 		// 第一次采样，创建记录
-		cpuUsageMap[pid] = &cpuUsage{
+		baselines.usage[pid] = &cpuUsage{
 			lastTime:  now,
 			lastUTime: stat.utime,
 			lastSTime: stat.stime,
@@ -277,18 +389,23 @@ func getSystemUptime() (float64, error) {
 	return uptime, nil
 }
 
-// getPIDsByName 根据进程名获取PID列表
-func getPIDsByName(name string) ([]int, []string, error) {
-	var pids []int
-	var names []string
+// listProcesses 列出系统中所有进程的PID和进程名
+func listProcesses() (map[int]string, error) {
+	return listProcessesContext(context.Background())
+}
 
-	// 遍历/proc目录
+// listProcessesContext 列出系统中所有进程，ctx取消时中止/proc遍历并返回ctx.Err()
+func listProcessesContext(ctx context.Context) (map[int]string, error) {
 	entries, err := os.ReadDir("/proc")
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
+	processes := make(map[int]string)
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if !entry.IsDir() {
 			continue
 		}
@@ -298,19 +415,19 @@ func getPIDsByName(name string) ([]int, []string, error) {
 			continue
 		}
 
-		// 读取进程状态
 		stat, err := getProcessStat(pid)
 		if err != nil {
 			continue
 		}
-
-		if stat.name == name {
-			pids = append(pids, pid)
-			names = append(names, stat.name)
-		}
+		processes[pid] = stat.name
 	}
 
-	return pids, names, nil
+	return processes, nil
+}
+
+// processNameMatches 判断进程名是否与查找的名称相同
+func processNameMatches(processName, name string) bool {
+	return processName == name
 }
 
 // getMemoryPercent 获取内存使用百分比
@@ -342,13 +459,21 @@ func getMemoryPercent(rss uint64) (float64, error) {
 		return 0, fmt.Errorf("failed to get total memory")
 	}
 
+	// 在容器中运行时按cgroup内存限制计算
+	if limits, err := util.ReadCgroupLimits(util.DefaultCgroupRoot); err == nil &&
+		limits.MemoryLimit > 0 && limits.MemoryLimit < totalMemory {
+		totalMemory = limits.MemoryLimit
+	}
+
 	return (float64(rss) / float64(totalMemory)) * 100, nil
 }
 
-// isProcessRunning 检查进程是否在运行
+// isProcessRunning 检查进程是否在运行，僵尸进程视为已退出
 func isProcessRunning(pid int) bool {
-	_, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
-	return err == nil
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err != nil {
+		return false
+	}
+	return !util.IsZombie(pid)
 }
 
 // getProcessName 获取进程名
@@ -3,6 +3,8 @@
 package monitor
 
 import (
+	"context"
+	"encoding/csv"
 	"fmt"
 	"os/exec"
 	"runtime"
@@ -11,19 +13,16 @@ import (
 	"time"
 
 	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
 )
 
-// cpuUsage 用于CPU使用率计算
-type cpuUsage struct {
-	lastTime  time.Time
-	lastUTime uint64
-	lastSTime uint64
+// requiredTools 进程监控器依赖的外部程序
+var requiredTools = []util.Tool{
+	{Name: "wmic", Args: []string{"os", "get", "Caption", "/value"}, Purpose: "process CPU, memory and name lookups"},
 }
 
-var cpuUsageMap = make(map[int]*cpuUsage)
-
-// getProcessStats 获取Windows进程统计信息
-func getProcessStats(pid int) (*types.ProcessStats, error) {
+// getProcessStats 获取Windows进程统计信息，CPU使用率直接由性能计数器得到，不使用基准值
+func getProcessStats(pid int, _ *cpuBaselines) (*types.ProcessStats, error) {
 	// 使用wmic获取进程信息
 	name, err := getProcessName(pid)
 	if err != nil {
@@ -43,17 +42,28 @@ func getProcessStats(pid int) (*types.ProcessStats, error) {
 		memoryPercent = 0
 	}
 
+	// 获取创建时间，无权限打开进程时以当前时间代替
+	createTime, err := processCreateTime(pid)
+	if err != nil {
+		createTime = time.Now()
+	}
+
 	return &types.ProcessStats{
 		PID:           pid,
 		Name:          name,
 		CPUPercent:    cpuPercent,
 		MemoryPercent: memoryPercent,
 		MemoryBytes:   memoryBytes,
-		CreateTime:    time.Now(), // Windows上获取精确创建时间较复杂
+		CreateTime:    createTime,
 		Timestamp:     time.Now(),
 	}, nil
 }
 
+// getProcessMemoryDetail Windows上不支持PSS/USS
+func getProcessMemoryDetail(pid int) (uint64, uint64, error) {
+	return 0, 0, fmt.Errorf("PSS/USS is not supported on Windows")
+}
+
 // getProcessCPUPercent 获取进程CPU使用率
 func getProcessCPUPercent(pid int) (float64, error) {
 	// 使用wmic获取进程CPU时间
@@ -94,7 +104,7 @@ func getProcessMemoryInfo(pid int) (uint64, float64, error) {
 			memStr := strings.TrimSpace(strings.TrimPrefix(line, "WorkingSetSize="))
 			memoryBytes, err = strconv.ParseUint(memStr, 10, 64)
 			if err != nil {
-				return 0, 0, err
+				return 0, 0, fmt.Errorf("%w: invalid working set size for PID %d: %v", ErrParse, pid, err)
 			}
 			break
 		}
@@ -110,6 +120,27 @@ func getProcessMemoryInfo(pid int) (uint64, float64, error) {
 	return memoryBytes, memoryPercent, nil
 }
 
+// getRawProcessStat 尽力而为地通过wmic读取Win32_Process的全部属性，
+// 键为属性名(如PageFaults、Priority、ThreadCount)，值为原始文本
+func getRawProcessStat(pid int) (map[string]string, error) {
+	cmd := exec.Command("wmic", "process", "where", fmt.Sprintf("ProcessId=%d", pid), "get", "/format:list")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			fields[key] = value
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: process %d does not exist", ErrProcessGone, pid)
+	}
+	return fields, nil
+}
+
 // getProcessName 获取进程名
 func getProcessName(pid int) (string, error) {
 	// 使用wmic获取进程名
@@ -126,43 +157,48 @@ func getProcessName(pid int) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("process name not found for PID %d", pid)
+	return "", fmt.Errorf("%w: process name not found for PID %d", ErrProcessGone, pid)
+}
+
+// listProcesses 使用tasklist列出系统中所有进程的PID和进程名
+func listProcesses() (map[int]string, error) {
+	return listProcessesContext(context.Background())
 }
 
-// getPIDsByName 根据进程名获取PID列表
-func getPIDsByName(name string) ([]int, []string, error) {
-	// 使用wmic根据进程名获取PID
-	cmd := exec.Command("wmic", "process", "where", fmt.Sprintf("Name='%s'", name), "get", "ProcessId,Name", "/format:value")
+// listProcessesContext 列出系统中所有进程，ctx取消时结束tasklist子进程并返回ctx.Err()
+func listProcessesContext(ctx context.Context) (map[int]string, error) {
+	cmd := exec.CommandContext(ctx, "tasklist", "/FO", "CSV", "/NH")
 	output, err := cmd.Output()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	var pids []int
-	var names []string
-
-	lines := strings.Split(string(output), "\n")
-	var currentPID int
-	var currentName string
+	records, err := csv.NewReader(strings.NewReader(string(output))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "ProcessId=") {
-			pidStr := strings.TrimSpace(strings.TrimPrefix(line, "ProcessId="))
-			currentPID, _ = strconv.Atoi(pidStr)
-		} else if strings.HasPrefix(line, "Name=") {
-			currentName = strings.TrimSpace(strings.TrimPrefix(line, "Name="))
-
-			// 当收集到完整的进程信息时，添加到结果
-			if currentPID > 0 && currentName != "" {
-				pids = append(pids, currentPID)
-				names = append(names, currentName)
-				currentPID = 0
-				currentName = ""
-			}
+	processes := make(map[int]string)
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
 		}
+		pid, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			continue
+		}
+		processes[pid] = record[0]
 	}
 
-	return pids, names, nil
+	return processes, nil
+}
+
+// processNameMatches 判断进程名是否与查找的名称相同，Windows进程名不区分大小写
+func processNameMatches(processName, name string) bool {
+	return strings.EqualFold(processName, name)
 }
 
 // getTotalMemory 获取系统总内存
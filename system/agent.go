@@ -0,0 +1,346 @@
+package system
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// 代理协议：每帧为4字节大端长度前缀加一个JSON编码的types.SystemStats
+const (
+	maxFrameSize        = 1 << 20
+	agentSendBuffer     = 16 // 每个连接缓冲的样本数，慢连接超出时丢弃新样本
+	defaultRetryDelay   = 2 * time.Second
+	defaultHostsHistory = 1000
+)
+
+// writeFrame 写入一帧样本
+func writeFrame(w io.Writer, stats types.SystemStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame 读取一帧样本
+func readFrame(r io.Reader) (types.SystemStats, error) {
+	var stats types.SystemStats
+
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return stats, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return stats, fmt.Errorf("frame of %d bytes exceeds limit", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return stats, err
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return stats, fmt.Errorf("invalid frame: %v", err)
+	}
+	return stats, nil
+}
+
+// Agent 通过TCP向采集端(Collector)推送SystemMonitor的样本
+type Agent struct {
+	monitor  *SystemMonitor
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]chan types.SystemStats
+	remove   func()
+	closed   bool
+}
+
+// NewAgent 创建推送monitor样本的代理，监控器需另行启动
+func NewAgent(monitor *SystemMonitor) *Agent {
+	return &Agent{
+		monitor: monitor,
+		conns:   make(map[net.Conn]chan types.SystemStats),
+	}
+}
+
+// Serve 在listener上接受采集端连接直到Close。每个连接先收到最新的一个样本，
+// 之后实时收到新样本
+func (a *Agent) Serve(listener net.Listener) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return fmt.Errorf("agent is closed")
+	}
+	if a.listener != nil {
+		a.mu.Unlock()
+		return fmt.Errorf("agent is already serving")
+	}
+	a.listener = listener
+	a.remove = a.monitor.OnSample(a.broadcast)
+	a.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			a.mu.Lock()
+			closed := a.closed
+			a.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		a.serveConn(conn)
+	}
+}
+
+// serveConn 为一个采集端连接启动发送协程
+func (a *Agent) serveConn(conn net.Conn) {
+	samples := make(chan types.SystemStats, agentSendBuffer)
+	if latest := a.monitor.GetHistory(1); len(latest) == 1 {
+		samples <- latest[0]
+	}
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		conn.Close()
+		return
+	}
+	a.conns[conn] = samples
+	a.mu.Unlock()
+
+	go func() {
+		defer a.dropConn(conn)
+		for stats := range samples {
+			if err := writeFrame(conn, stats); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// broadcast 将新样本发给所有连接，不阻塞采集协程
+func (a *Agent) broadcast(stats types.SystemStats) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, samples := range a.conns {
+		select {
+		case samples <- stats:
+		default:
+		}
+	}
+}
+
+// dropConn 关闭连接并停止向其发送
+func (a *Agent) dropConn(conn net.Conn) {
+	a.mu.Lock()
+	if samples, ok := a.conns[conn]; ok {
+		delete(a.conns, conn)
+		close(samples)
+	}
+	a.mu.Unlock()
+	conn.Close()
+}
+
+// Close 停止接受连接并断开所有采集端
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	listener := a.listener
+	remove := a.remove
+	conns := make([]net.Conn, 0, len(a.conns))
+	for conn := range a.conns {
+		conns = append(conns, conn)
+	}
+	a.mu.Unlock()
+
+	if remove != nil {
+		remove()
+	}
+	for _, conn := range conns {
+		a.dropConn(conn)
+	}
+	if listener != nil {
+		return listener.Close()
+	}
+	return nil
+}
+
+// Collector 连接多个代理，按主机汇总它们推送的样本
+type Collector struct {
+	addrs       []string
+	retryDelay  time.Duration
+	historySize int
+	mu          sync.RWMutex
+	hosts       map[string][]types.SystemStats
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewCollector 创建连接到addrs上各代理的采集端
+func NewCollector(addrs ...string) *Collector {
+	return &Collector{
+		addrs:       append([]string(nil), addrs...),
+		retryDelay:  defaultRetryDelay,
+		historySize: defaultHostsHistory,
+		hosts:       make(map[string][]types.SystemStats),
+	}
+}
+
+// SetRetryDelay 设置连接断开后重连的间隔，需在Start前调用
+func (c *Collector) SetRetryDelay(delay time.Duration) error {
+	if delay <= 0 {
+		return fmt.Errorf("retry delay must be positive")
+	}
+	c.retryDelay = delay
+	return nil
+}
+
+// Start 开始接收样本，连接断开时按重连间隔重试，直到Stop或ctx取消
+func (c *Collector) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		return fmt.Errorf("collector is already running")
+	}
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	for _, addr := range c.addrs {
+		c.wg.Add(1)
+		go c.run(ctx, addr)
+	}
+	return nil
+}
+
+// Stop 断开所有代理并等待接收协程退出
+func (c *Collector) Stop() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.cancel = nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	c.wg.Wait()
+}
+
+// run 维持到一个代理的连接
+func (c *Collector) run(ctx context.Context, addr string) {
+	defer c.wg.Done()
+
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			err = c.receive(ctx, addr, conn)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			fmt.Printf("Error receiving from agent %s: %v\n", addr, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.retryDelay):
+		}
+	}
+}
+
+// receive 读取一个连接上的样本直到连接断开
+func (c *Collector) receive(ctx context.Context, addr string, conn net.Conn) error {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	for {
+		stats, err := readFrame(conn)
+		if err != nil {
+			return err
+		}
+		c.add(addr, stats)
+	}
+}
+
+// add 记录一个样本，未带主机标识的样本以代理地址作为主机；
+// 重连后重复推送的旧样本被忽略
+func (c *Collector) add(addr string, stats types.SystemStats) {
+	if stats.Host == "" {
+		stats.Host = addr
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := c.hosts[stats.Host]
+	if n := len(history); n > 0 && !stats.Timestamp.After(history[n-1].Timestamp) {
+		return
+	}
+	history = append(history, stats)
+	if len(history) > c.historySize {
+		history = history[1:]
+	}
+	c.hosts[stats.Host] = history
+}
+
+// Hosts 获取已收到样本的主机，按名称排序
+func (c *Collector) Hosts() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	hosts := make([]string, 0, len(c.hosts))
+	for host := range c.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Latest 获取每台主机的最新样本
+func (c *Collector) Latest() map[string]types.SystemStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	latest := make(map[string]types.SystemStats, len(c.hosts))
+	for host, history := range c.hosts {
+		latest[host] = history[len(history)-1]
+	}
+	return latest
+}
+
+// GetHistory 获取一台主机最近count个样本，count<=0时返回全部
+func (c *Collector) GetHistory(host string, count int) []types.SystemStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	history := c.hosts[host]
+	if count <= 0 || count > len(history) {
+		count = len(history)
+	}
+	return append([]types.SystemStats(nil), history[len(history)-count:]...)
+}
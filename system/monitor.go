@@ -1,25 +1,47 @@
 package system
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
 )
 
+// compactionInterval 运行时执行数据保留策略的间隔
+const compactionInterval = time.Hour
+
+// defaultMaxGap 启用DeadBand且未设置MaxGap时两个样本的最大间隔
+const defaultMaxGap = 10 * time.Minute
+
 // SystemMonitor 系统监控器
 type SystemMonitor struct {
-	history  []types.SystemStats
-	config   types.MonitorConfig
-	running  bool
-	stopChan chan struct{}
-	mu       sync.RWMutex
-	dataFile string
-	alerts   []string
+	history        []types.SystemStats
+	config         types.MonitorConfig
+	running        bool
+	stopChan       chan struct{}
+	stopOnce       sync.Once
+	resetChan      chan struct{}
+	nextCollection time.Time
+	startedAt      time.Time // 最近一次启动的时间
+	firstSampled   bool      // 启动后是否已完成第一轮采集
+	mu             sync.RWMutex
+	dataFile       string
+	pruned         bool // 上次保存后保留策略丢弃过样本，Compact据此决定是否保存
+	alerts         []string
+	health         types.MonitorHealth
+	lastStats      *types.SystemStats // 最近一次采集的样本(含死区内未记录的)，用于递推EMA
+	cpu            cpuBaseline
+	host           string
+	sampleHandlers map[int]func(stats types.SystemStats)
+	nextHandlerID  int
+	diskExcludes   []string // GetDiskUsages排除的文件系统类型
 }
 
 // NewSystemMonitor 创建新的系统监控器
@@ -32,11 +54,14 @@ func NewSystemMonitor(dataDir string) *SystemMonitor {
 	os.MkdirAll(dataDir, 0755)
 
 	monitor := &SystemMonitor{
-		history:  make([]types.SystemStats, 0),
-		stopChan: make(chan struct{}),
-		dataFile: filepath.Join(dataDir, "system_stats.json"),
-		alerts:   make([]string, 0),
+		history:      make([]types.SystemStats, 0),
+		stopChan:     make(chan struct{}),
+		resetChan:    make(chan struct{}, 1),
+		dataFile:     filepath.Join(dataDir, "system_stats.json"),
+		alerts:       make([]string, 0),
+		diskExcludes: append([]string(nil), util.DefaultExcludedFSTypes...),
 	}
+	monitor.host, _ = os.Hostname()
 
 	// 默认配置
 	monitor.config.Enabled = true
@@ -55,6 +80,11 @@ func NewSystemMonitor(dataDir string) *SystemMonitor {
 
 // Start 启动系统监控
 func (sm *SystemMonitor) Start() error {
+	return sm.StartContext(context.Background())
+}
+
+// StartContext 启动系统监控，ctx取消时自动停止
+func (sm *SystemMonitor) StartContext(ctx context.Context) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -62,8 +92,16 @@ func (sm *SystemMonitor) Start() error {
 		return fmt.Errorf("system monitor is already running")
 	}
 
+	// 重新获取CPU基准值
+	sm.resetCPUBaseline()
+
+	// 每次启动使用新的停止通道，支持停止后再次启动
+	sm.stopChan = make(chan struct{})
+	sm.stopOnce = sync.Once{}
 	sm.running = true
-	go sm.monitoringLoop()
+	sm.startedAt = time.Now()
+	sm.firstSampled = false
+	go sm.monitoringLoop(ctx, sm.stopChan)
 
 	return nil
 }
@@ -77,18 +115,123 @@ func (sm *SystemMonitor) Stop() error {
 		return fmt.Errorf("system monitor is not running")
 	}
 
-	close(sm.stopChan)
+	sm.stopLocked()
+	return nil
+}
+
+// stopLocked 关闭当前的停止通道并保存数据，调用方需持有sm.mu且监控正在运行
+func (sm *SystemMonitor) stopLocked() {
+	sm.stopOnce.Do(func() {
+		close(sm.stopChan)
+	})
 	sm.running = false
+	sm.nextCollection = time.Time{}
 
 	// 保存数据
 	sm.saveHistory()
+}
 
-	return nil
+// stopRun 仅当stopChan仍属于当前这次运行时停止监控，
+// 已停止后再次启动的监控不受早先ctx取消的影响
+func (sm *SystemMonitor) stopRun(stopChan chan struct{}) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.running && sm.stopChan == stopChan {
+		sm.stopLocked()
+	}
+}
+
+// GetInterval 获取当前采集间隔
+func (sm *SystemMonitor) GetInterval() time.Duration {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.config.Interval
+}
+
+// NextCollection 获取下一次采集的时间，未运行时返回零值
+func (sm *SystemMonitor) NextCollection() time.Time {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.nextCollection
+}
+
+// MonitorHealth 获取监控器自身的运行指标
+func (sm *SystemMonitor) MonitorHealth() types.MonitorHealth {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.health
+}
+
+// SelfCheck 检查当前平台采集所依赖的外部程序是否存在且可用，
+// 每个缺失或无法运行的程序返回一个错误
+func (sm *SystemMonitor) SelfCheck() []error {
+	return util.CheckTools(requiredTools)
 }
 
 // GetCurrentStats 获取当前系统统计
 func (sm *SystemMonitor) GetCurrentStats() (*types.SystemStats, error) {
-	return sm.collectStats()
+	stats, err := sm.collectStats()
+	if err != nil {
+		return nil, err
+	}
+	stats.Host = sm.Host()
+	return stats, nil
+}
+
+// Host 获取写入样本的主机标识，默认为主机名
+func (sm *SystemMonitor) Host() string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.host
+}
+
+// SetHost 设置写入样本的主机标识，用于汇总多台主机的采样
+func (sm *SystemMonitor) SetHost(host string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.host = host
+}
+
+// OnSample 注册新样本写入历史后的回调，返回取消注册的函数。
+// 回调在采集协程中、锁外依次调用，不应阻塞
+func (sm *SystemMonitor) OnSample(handler func(stats types.SystemStats)) (remove func()) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.sampleHandlers == nil {
+		sm.sampleHandlers = make(map[int]func(stats types.SystemStats))
+	}
+	id := sm.nextHandlerID
+	sm.nextHandlerID++
+	sm.sampleHandlers[id] = handler
+
+	return func() {
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		delete(sm.sampleHandlers, id)
+	}
+}
+
+// SetDiskExcludedFSTypes 设置GetDiskUsages排除的文件系统类型，
+// 默认为util.DefaultExcludedFSTypes中的伪文件系统，传入空列表时统计所有挂载点
+func (sm *SystemMonitor) SetDiskExcludedFSTypes(fstypes []string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.diskExcludes = append([]string(nil), fstypes...)
+}
+
+// DiskExcludedFSTypes 获取GetDiskUsages排除的文件系统类型
+func (sm *SystemMonitor) DiskExcludedFSTypes() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return append([]string(nil), sm.diskExcludes...)
+}
+
+// GetDiskUsages 获取各挂载点的磁盘使用情况。Linux上从/proc/mounts读取挂载点并按文件系统类型
+// 排除伪文件系统，同一设备的多个挂载只统计一次；其他Unix平台只返回根分区，Windows返回C盘
+func (sm *SystemMonitor) GetDiskUsages() ([]types.DiskUsage, error) {
+	return sm.diskUsages(sm.DiskExcludedFSTypes())
 }
 
 // GetHistory 获取历史数据
@@ -108,99 +251,105 @@ func (sm *SystemMonitor) GetHistory(count int) []types.SystemStats {
 	return result
 }
 
-// GetChartData 获取图表数据
-func (sm *SystemMonitor) GetChartData(count int, metric string) (*types.ChartData, error) {
+// GetHistoryPage 从最新的样本往前分页获取历史数据，跳过最新的offset个样本后返回
+// 至多limit个，按时间顺序排列，同时返回历史样本总数。offset为负时按0处理，
+// offset超出总数或limit<=0时返回空页
+func (sm *SystemMonitor) GetHistoryPage(offset, limit int) ([]types.SystemStats, int) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	total := len(sm.history)
+	offset = max(offset, 0)
+	if limit <= 0 || offset >= total {
+		return []types.SystemStats{}, total
+	}
+
+	end := total - offset
+	start := max(end-limit, 0)
+	page := make([]types.SystemStats, end-start)
+	copy(page, sm.history[start:end])
+	return page, total
+}
+
+// GetSystemStatsRate 由最近两个历史样本计算累计计数器的每秒速率，
+// 计数器回退(如主机重启)时对应速率取0。样本不足两个时返回错误
+func (sm *SystemMonitor) GetSystemStatsRate() (types.SystemRates, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	n := len(sm.history)
+	if n < 2 {
+		return types.SystemRates{}, fmt.Errorf("need at least 2 samples, have %d", n)
+	}
+	return sm.history[n-1].RatesSince(sm.history[n-2]), nil
+}
+
+// GetSeries 获取与前端库无关的时间序列数据。
+// 支持的指标：cpu、cpu_ema、memory、disk、load1、load5、load15、load_per_cpu、temperature
+func (sm *SystemMonitor) GetSeries(count int, metrics []string) ([]types.Series, error) {
+	for _, metric := range metrics {
+		if _, exists := seriesExtractors[metric]; !exists {
+			return nil, fmt.Errorf("unknown metric: %s", metric)
+		}
+	}
+
 	history := sm.GetHistory(count)
 	if len(history) == 0 {
 		return nil, fmt.Errorf("no data available")
 	}
 
+	series := make([]types.Series, len(metrics))
+	for i, metric := range metrics {
+		extract := seriesExtractors[metric]
+		points := make([]types.Point, len(history))
+		for j, stat := range history {
+			points[j] = types.Point{T: stat.Timestamp, V: extract(stat)}
+		}
+		series[i] = types.Series{Name: metric, Points: points}
+	}
+
+	return series, nil
+}
+
+// GetChartData 获取Chart.js格式的图表数据，基于GetSeries生成
+func (sm *SystemMonitor) GetChartData(count int, metric string) (*types.ChartData, error) {
+	styles, exists := chartStyles[metric]
+	if !exists {
+		return nil, fmt.Errorf("unknown metric: %s", metric)
+	}
+
+	metrics := make([]string, len(styles))
+	for i, style := range styles {
+		metrics[i] = style.series
+	}
+
+	series, err := sm.GetSeries(count, metrics)
+	if err != nil {
+		return nil, err
+	}
+
 	chartData := &types.ChartData{
-		Labels:   make([]string, len(history)),
-		Datasets: make([]types.Dataset, 0),
+		Labels:   make([]string, len(series[0].Points)),
+		Datasets: make([]types.Dataset, len(series)),
 	}
 
 	// 准备时间标签
-	for i, stat := range history {
-		chartData.Labels[i] = stat.Timestamp.Format("15:04:05")
+	for i, point := range series[0].Points {
+		chartData.Labels[i] = point.T.Format("15:04:05")
 	}
 
-	// 根据指标类型准备数据
-	switch metric {
-	case "cpu":
-		chartData.Datasets = append(chartData.Datasets, types.Dataset{
-			Label:           "CPU Usage (%)",
-			Data:            extractCPUData(history),
-			BorderColor:     "rgb(75, 192, 192)",
-			BackgroundColor: "rgba(75, 192, 192, 0.2)",
-			Fill:            true,
-		})
-	case "memory":
-		chartData.Datasets = append(chartData.Datasets, types.Dataset{
-			Label:           "Memory Usage (%)",
-			Data:            extractMemoryData(history),
-			BorderColor:     "rgb(255, 99, 132)",
-			BackgroundColor: "rgba(255, 99, 132, 0.2)",
-			Fill:            true,
-		})
-	case "disk":
-		chartData.Datasets = append(chartData.Datasets, types.Dataset{
-			Label:           "Disk Usage (%)",
-			Data:            extractDiskData(history),
-			BorderColor:     "rgb(153, 102, 255)",
-			BackgroundColor: "rgba(153, 102, 255, 0.2)",
-			Fill:            true,
-		})
-	case "load":
-		chartData.Datasets = []types.Dataset{
-			{
-				Label:           "Load 1min",
-				Data:            extractLoad1Data(history),
-				BorderColor:     "rgb(255, 159, 64)",
-				BackgroundColor: "rgba(255, 159, 64, 0.2)",
-				Fill:            false,
-			},
-			{
-				Label:           "Load 5min",
-				Data:            extractLoad5Data(history),
-				BorderColor:     "rgb(54, 162, 235)",
-				BackgroundColor: "rgba(54, 162, 235, 0.2)",
-				Fill:            false,
-			},
-			{
-				Label:           "Load 15min",
-				Data:            extractLoad15Data(history),
-				BorderColor:     "rgb(201, 203, 207)",
-				BackgroundColor: "rgba(201, 203, 207, 0.2)",
-				Fill:            false,
-			},
+	for i, style := range styles {
+		data := make([]float64, len(series[i].Points))
+		for j, point := range series[i].Points {
+			data[j] = point.V
 		}
-	case "all":
-		chartData.Datasets = []types.Dataset{
-			{
-				Label:           "CPU (%)",
-				Data:            extractCPUData(history),
-				BorderColor:     "rgb(75, 192, 192)",
-				BackgroundColor: "rgba(75, 192, 192, 0.2)",
-				Fill:            false,
-			},
-			{
-				Label:           "Memory (%)",
-				Data:            extractMemoryData(history),
-				BorderColor:     "rgb(255, 99, 132)",
-				BackgroundColor: "rgba(255, 99, 132, 0.2)",
-				Fill:            false,
-			},
-			{
-				Label:           "Disk (%)",
-				Data:            extractDiskData(history),
-				BorderColor:     "rgb(153, 102, 255)",
-				BackgroundColor: "rgba(153, 102, 255, 0.2)",
-				Fill:            false,
-			},
+		chartData.Datasets[i] = types.Dataset{
+			Label:           style.label,
+			Data:            data,
+			BorderColor:     style.borderColor,
+			BackgroundColor: style.backgroundColor,
+			Fill:            style.fill,
 		}
-	default:
-		return nil, fmt.Errorf("unknown metric: %s", metric)
 	}
 
 	return chartData, nil
@@ -235,52 +384,247 @@ func (sm *SystemMonitor) UpdateConfig(config types.MonitorConfig) error {
 	if config.HistorySize < 10 {
 		return fmt.Errorf("history size must be at least 10")
 	}
+	if config.RetentionDays < 0 || config.MaxAge < 0 {
+		return fmt.Errorf("retention days and max age must not be negative")
+	}
+	if config.DetailedMemory {
+		return fmt.Errorf("detailed memory is not supported by the system monitor")
+	}
+	if config.CPUAverageSamples < 0 {
+		return fmt.Errorf("CPU average samples must not be negative")
+	}
+	if config.DeadBand < 0 || config.MaxGap < 0 {
+		return fmt.Errorf("dead band and max gap must not be negative")
+	}
+	if config.CPUEMAAlpha < 0 || config.CPUEMAAlpha > 1 {
+		return fmt.Errorf("CPU EMA alpha must be between 0 and 1")
+	}
+	if config.AlertThresholds.CPU < 0 || config.AlertThresholds.CPU > 100 {
+		return fmt.Errorf("CPU alert threshold must be between 0 and 100")
+	}
+	if config.AlertThresholds.Memory < 0 || config.AlertThresholds.Memory > 100 {
+		return fmt.Errorf("memory alert threshold must be between 0 and 100")
+	}
+	if config.AlertThresholds.Disk < 0 || config.AlertThresholds.Disk > 100 {
+		return fmt.Errorf("disk alert threshold must be between 0 and 100")
+	}
 
+	intervalChanged := config.Interval != sm.config.Interval
 	sm.config = config
 
+	// 通知监控循环按新的间隔重置定时器
+	if intervalChanged {
+		select {
+		case sm.resetChan <- struct{}{}:
+		default:
+		}
+	}
+
 	// 如果历史数据超过新的限制，进行裁剪
-	if len(sm.history) > sm.config.HistorySize {
-		sm.history = sm.history[len(sm.history)-sm.config.HistorySize:]
+	sm.applyRetentionPolicy()
+
+	return nil
+}
+
+// SetAlertThreshold 只更新一项告警阈值，metric为"cpu"、"memory"或"disk"，
+// 在锁内完成读改写，不会覆盖其他并发更新的配置字段
+func (sm *SystemMonitor) SetAlertThreshold(metric string, value float64) error {
+	if value < 0 || value > 100 {
+		return fmt.Errorf("%s alert threshold must be between 0 and 100", metric)
 	}
 
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	switch metric {
+	case "cpu":
+		sm.config.AlertThresholds.CPU = value
+	case "memory":
+		sm.config.AlertThresholds.Memory = value
+	case "disk":
+		sm.config.AlertThresholds.Disk = value
+	default:
+		return fmt.Errorf("unknown alert metric %q", metric)
+	}
 	return nil
 }
 
+// ClearHistory 清空内存中的历史数据和告警并重新获取CPU基准值，
+// removeFile为true时同时删除持久化的历史文件
+func (sm *SystemMonitor) ClearHistory(removeFile bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.history = nil
+	sm.alerts = nil
+	sm.lastStats = nil
+	sm.resetCPUBaseline()
+
+	if removeFile {
+		if err := os.Remove(sm.dataFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove history file: %v", err)
+		}
+	}
+	return nil
+}
+
+// Compact 按保留策略清理过期数据，自上次保存后丢弃过样本时保存
+func (sm *SystemMonitor) Compact() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.applyRetentionPolicy()
+	if sm.pruned {
+		sm.saveHistory()
+	}
+}
+
 // monitoringLoop 监控循环
-func (sm *SystemMonitor) monitoringLoop() {
-	ticker := time.NewTicker(sm.config.Interval)
+func (sm *SystemMonitor) monitoringLoop(ctx context.Context, stopChan chan struct{}) {
+	sm.mu.Lock()
+	interval := sm.config.Interval
+	sm.nextCollection = time.Now().Add(interval)
+	sm.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	// 启动后立即采集一次，历史数据不必等待一个完整间隔，这一轮没有计划时间，抖动为0
+	sm.collect(interval, 0)
+
+	compactionTicker := time.NewTicker(compactionInterval)
+	defer compactionTicker.Stop()
+
 	for {
 		select {
-		case <-sm.stopChan:
+		case <-stopChan:
+			return
+		case <-ctx.Done():
+			sm.stopRun(stopChan)
 			return
+		case <-compactionTicker.C:
+			sm.Compact()
+		case <-sm.resetChan:
+			sm.mu.Lock()
+			interval = sm.config.Interval
+			ticker.Reset(interval)
+			sm.nextCollection = time.Now().Add(interval)
+			sm.mu.Unlock()
 		case <-ticker.C:
-			stats, err := sm.collectStats()
-			if err != nil {
-				fmt.Printf("Error collecting system stats: %v\n", err)
-				continue
-			}
-
 			sm.mu.Lock()
-			sm.history = append(sm.history, *stats)
+			now := time.Now()
+			jitter := now.Sub(sm.nextCollection)
+			sm.nextCollection = now.Add(interval)
+			sm.mu.Unlock()
+
+			sm.collect(interval, jitter)
+		}
+	}
+}
 
-			// 保持历史记录不超过配置的大小
-			if len(sm.history) > sm.config.HistorySize {
-				sm.history = sm.history[1:]
-			}
+// collect 采集一次系统统计，写入历史并检查告警，jitter为实际采集时间与计划时间之差
+func (sm *SystemMonitor) collect(interval, jitter time.Duration) {
+	start := time.Now()
+	stats, err := sm.collectStats()
+	elapsed := time.Since(start)
 
-			// 检查告警
-			sm.checkAlerts(stats)
+	sm.mu.Lock()
+	sm.health.Record(elapsed, interval, err != nil)
+	sm.health.RecordJitter(jitter)
+	if !sm.firstSampled {
+		sm.firstSampled = true
+		sm.health.TimeToFirstSample = time.Since(sm.startedAt)
+	}
+	if err != nil {
+		sm.mu.Unlock()
+		fmt.Printf("Error collecting system stats: %v\n", err)
+		return
+	}
 
-			// 定期保存数据
-			if len(sm.history)%10 == 0 {
-				sm.saveHistory()
-			}
+	if !sm.record(stats) {
+		sm.mu.Unlock()
+		return
+	}
 
-			sm.mu.Unlock()
-		}
+	handlers := make([]func(stats types.SystemStats), 0, len(sm.sampleHandlers))
+	for _, handler := range sm.sampleHandlers {
+		handlers = append(handlers, handler)
+	}
+	sm.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(*stats)
+	}
+}
+
+// record 将新样本写入历史并检查告警，样本在死区内未记录时返回false，调用方需持有锁
+func (sm *SystemMonitor) record(stats *types.SystemStats) bool {
+	stats.Host = sm.host
+	stats.CPUPercentAvg = cpuAverage(sm.history, stats.CPUPercent, sm.config.CPUAverageSamples)
+
+	// 增量递推EMA，重启后从最后一条历史样本接续
+	prev := sm.lastStats
+	if prev == nil && len(sm.history) > 0 {
+		prev = &sm.history[len(sm.history)-1]
+	}
+	stats.ApplyCPUEMA(prev, sm.config.CPUEMAAlpha)
+	sm.lastStats = stats
+
+	// 指标变化在死区内时只检查告警，不记录样本
+	if sm.withinDeadBand(stats) {
+		sm.checkAlerts(stats)
+		return false
+	}
+
+	sm.history = append(sm.history, *stats)
+
+	// 保持历史记录不超过配置的大小和保留时间
+	sm.applyRetentionPolicy()
+
+	// 检查告警
+	sm.checkAlerts(stats)
+
+	// 定期保存数据
+	if len(sm.history)%10 == 0 {
+		sm.saveHistory()
 	}
+	return true
+}
+
+// withinDeadBand 判断启用DeadBand时新样本是否可以省略：指标变化不超过DeadBand，
+// 且距上一个记录的样本未超过MaxGap
+func (sm *SystemMonitor) withinDeadBand(stats *types.SystemStats) bool {
+	if sm.config.DeadBand <= 0 || len(sm.history) == 0 {
+		return false
+	}
+
+	maxGap := sm.config.MaxGap
+	if maxGap <= 0 {
+		maxGap = defaultMaxGap
+	}
+
+	last := sm.history[len(sm.history)-1]
+	if stats.Timestamp.Sub(last.Timestamp) >= maxGap {
+		return false
+	}
+	return !stats.ChangedFrom(last, sm.config.DeadBand)
+}
+
+// cpuAverage 计算当前CPU使用率与最近samples-1个历史样本的平均值，
+// 历史不足时按已有样本计算
+func cpuAverage(history []types.SystemStats, current float64, samples int) float64 {
+	if samples > len(history)+1 {
+		samples = len(history) + 1
+	}
+	if samples <= 1 {
+		return current
+	}
+
+	sum := current
+	for _, stats := range history[len(history)-samples+1:] {
+		sum += stats.CPUPercent
+	}
+	return sum / float64(samples)
 }
 
 // checkAlerts 检查告警条件
@@ -324,6 +668,16 @@ func (sm *SystemMonitor) loadHistory() {
 		return
 	}
 
+	if err := migrateHistory(&history); err != nil {
+		// 保留无法识别的文件，避免被后续保存覆盖
+		backup := fmt.Sprintf("%s.v%d.bak", sm.dataFile, history.Version)
+		if renameErr := os.Rename(sm.dataFile, backup); renameErr != nil {
+			fmt.Printf("Error backing up history: %v\n", renameErr)
+		}
+		fmt.Printf("Error loading history: %v (file moved to %s)\n", err, backup)
+		return
+	}
+
 	sm.history = history.Stats
 
 	// 应用保留策略
@@ -333,7 +687,8 @@ func (sm *SystemMonitor) loadHistory() {
 // saveHistory 保存历史数据
 func (sm *SystemMonitor) saveHistory() {
 	history := types.SystemStatsHistory{
-		Stats: sm.history,
+		Version: types.SchemaVersion,
+		Stats:   sm.history,
 	}
 
 	data, err := json.MarshalIndent(history, "", "  ")
@@ -344,72 +699,103 @@ func (sm *SystemMonitor) saveHistory() {
 
 	if err := os.WriteFile(sm.dataFile, data, 0644); err != nil {
 		fmt.Printf("Error saving history: %v\n", err)
+		return
 	}
+	sm.pruned = false
 }
 
-// applyRetentionPolicy 应用数据保留策略
-func (sm *SystemMonitor) applyRetentionPolicy() {
-	if sm.config.RetentionDays <= 0 {
-		return
+// migrateHistory 将历史数据升级到当前格式版本
+func migrateHistory(history *types.SystemStatsHistory) error {
+	switch {
+	case history.Version > types.SchemaVersion:
+		return fmt.Errorf("unsupported history version %d (current version is %d)", history.Version, types.SchemaVersion)
+	case history.Version < 0:
+		return fmt.Errorf("invalid history version %d", history.Version)
 	}
 
-	cutoffTime := time.Now().AddDate(0, 0, -sm.config.RetentionDays)
-	var filtered []types.SystemStats
-
-	for _, stat := range sm.history {
-		if stat.Timestamp.After(cutoffTime) {
-			filtered = append(filtered, stat)
-		}
+	// 版本0(无版本号)与版本1的数据格式相同，只需补上版本号
+	if history.Version == 0 {
+		history.Version = 1
 	}
 
-	sm.history = filtered
+	return nil
 }
 
-// 数据提取辅助函数
-func extractCPUData(history []types.SystemStats) []float64 {
-	result := make([]float64, len(history))
-	for i, stat := range history {
-		result[i] = stat.CPUPercent
-	}
-	return result
-}
+// applyRetentionPolicy 应用数据保留策略：最多保留HistorySize个样本，并丢弃早于
+// MaxAge和RetentionDays中较短者的样本
+func (sm *SystemMonitor) applyRetentionPolicy() {
+	before := len(sm.history)
+	defer func() { sm.pruned = sm.pruned || len(sm.history) != before }()
 
-func extractMemoryData(history []types.SystemStats) []float64 {
-	result := make([]float64, len(history))
-	for i, stat := range history {
-		result[i] = stat.MemoryPercent
+	if size := sm.config.HistorySize; size > 0 && len(sm.history) > size {
+		sm.history = sm.history[len(sm.history)-size:]
 	}
-	return result
-}
 
-func extractDiskData(history []types.SystemStats) []float64 {
-	result := make([]float64, len(history))
-	for i, stat := range history {
-		result[i] = stat.DiskPercent
+	maxAge := sm.config.MaxAge
+	if days := time.Duration(sm.config.RetentionDays) * 24 * time.Hour; days > 0 && (maxAge <= 0 || days < maxAge) {
+		maxAge = days
 	}
-	return result
+	if maxAge <= 0 {
+		return
+	}
+
+	// 历史按时间顺序排列
+	cutoffTime := time.Now().Add(-maxAge)
+	first := sort.Search(len(sm.history), func(i int) bool {
+		return sm.history[i].Timestamp.After(cutoffTime)
+	})
+	sm.history = sm.history[first:]
 }
 
-func extractLoad1Data(history []types.SystemStats) []float64 {
-	result := make([]float64, len(history))
-	for i, stat := range history {
-		result[i] = stat.Load1
-	}
-	return result
+// 数据提取辅助函数
+
+// seriesExtractors 各时间序列指标的取值函数
+var seriesExtractors = map[string]func(types.SystemStats) float64{
+	"cpu":          func(s types.SystemStats) float64 { return s.CPUPercent },
+	"cpu_ema":      func(s types.SystemStats) float64 { return s.CPUPercentEMA },
+	"memory":       func(s types.SystemStats) float64 { return s.MemoryPercent },
+	"disk":         func(s types.SystemStats) float64 { return s.DiskPercent },
+	"load1":        func(s types.SystemStats) float64 { return s.Load1 },
+	"load5":        func(s types.SystemStats) float64 { return s.Load5 },
+	"load15":       func(s types.SystemStats) float64 { return s.Load15 },
+	"load_per_cpu": func(s types.SystemStats) float64 { return s.LoadPerCPU },
+	"temperature":  func(s types.SystemStats) float64 { return s.Temperature },
 }
 
-func extractLoad5Data(history []types.SystemStats) []float64 {
-	result := make([]float64, len(history))
-	for i, stat := range history {
-		result[i] = stat.Load5
-	}
-	return result
+// chartStyle 图表数据集对应的时间序列和Chart.js样式
+type chartStyle struct {
+	series          string
+	label           string
+	borderColor     string
+	backgroundColor string
+	fill            bool
 }
 
-func extractLoad15Data(history []types.SystemStats) []float64 {
-	result := make([]float64, len(history))
-	for i, stat := range history {
-		result[i] = stat.Load15
-	}
-	return result
+// chartStyles 图表指标到数据集的映射
+var chartStyles = map[string][]chartStyle{
+	"cpu": {
+		{"cpu", "CPU Usage (%)", "rgb(75, 192, 192)", "rgba(75, 192, 192, 0.2)", true},
+	},
+	"cpu_ema": {
+		{"cpu_ema", "CPU Usage EMA (%)", "rgb(75, 192, 192)", "rgba(75, 192, 192, 0.2)", true},
+	},
+	"memory": {
+		{"memory", "Memory Usage (%)", "rgb(255, 99, 132)", "rgba(255, 99, 132, 0.2)", true},
+	},
+	"disk": {
+		{"disk", "Disk Usage (%)", "rgb(153, 102, 255)", "rgba(153, 102, 255, 0.2)", true},
+	},
+	"load": {
+		{"load1", "Load 1min", "rgb(255, 159, 64)", "rgba(255, 159, 64, 0.2)", false},
+		{"load5", "Load 5min", "rgb(54, 162, 235)", "rgba(54, 162, 235, 0.2)", false},
+		{"load15", "Load 15min", "rgb(201, 203, 207)", "rgba(201, 203, 207, 0.2)", false},
+	},
+	"temperature": {
+		{"temperature", "CPU Temperature (°C)", "rgb(255, 205, 86)", "rgba(255, 205, 86, 0.2)", true},
+	},
+	"all": {
+		{"cpu", "CPU (%)", "rgb(75, 192, 192)", "rgba(75, 192, 192, 0.2)", false},
+		{"memory", "Memory (%)", "rgb(255, 99, 132)", "rgba(255, 99, 132, 0.2)", false},
+		{"disk", "Disk (%)", "rgb(153, 102, 255)", "rgba(153, 102, 255, 0.2)", false},
+	},
 }
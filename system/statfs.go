@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+
+package system
+
+import "syscall"
+
+// statfsUsage 通过statfs按文件系统实际块大小计算path所在分区的已用和总字节数
+func statfsUsage(path string) (used, total uint64, err error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, 0, err
+	}
+
+	blockSize := uint64(fs.Bsize)
+	total = uint64(fs.Blocks) * blockSize
+	used = (uint64(fs.Blocks) - uint64(fs.Bfree)) * blockSize
+	return used, total, nil
+}
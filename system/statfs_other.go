@@ -0,0 +1,10 @@
+//go:build !windows && !linux && !darwin && !freebsd
+
+package system
+
+import "fmt"
+
+// statfsUsage 当前平台不支持statfs，由调用方回退到df
+func statfsUsage(path string) (used, total uint64, err error) {
+	return 0, 0, fmt.Errorf("statfs is not supported on this platform")
+}
@@ -7,11 +7,15 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
 )
 
 // collectStats 收集Unix系统统计信息
@@ -27,6 +31,11 @@ func (sm *SystemMonitor) collectStats() (*types.SystemStats, error) {
 	}
 	stats.CPUPercent = cpuPercent
 
+	// 容器CPU限制
+	if limits, err := util.ReadCgroupLimits(util.DefaultCgroupRoot); err == nil {
+		stats.CPULimit = limits.CPULimit
+	}
+
 	// 获取内存使用率
 	memoryPercent, memoryUsed, memoryTotal, err := sm.getMemoryUsage()
 	if err != nil {
@@ -61,10 +70,35 @@ func (sm *SystemMonitor) collectStats() (*types.SystemStats, error) {
 		stats.Load5 = load5
 		stats.Load15 = load15
 	}
+	stats.NumCPU = runtime.NumCPU()
+	stats.NormalizeLoad()
+
+	// 获取CPU温度，虚拟机和容器中通常不可用，忽略错误
+	if temperature, err := sm.getTemperature(); err == nil {
+		stats.Temperature = temperature
+	}
+
+	// 累计计数器仅Linux提供，读取失败时保持为0
+	if net, err := util.ReadNetDev(util.DefaultNetDevPath); err == nil {
+		stats.NetRxBytes = net.RxBytes
+		stats.NetTxBytes = net.TxBytes
+	}
+	if disk, err := util.ReadDiskstats(util.DefaultDiskstatsPath); err == nil {
+		stats.DiskReads = disk.Reads
+		stats.DiskWrites = disk.Writes
+	}
+	if ctxt, err := util.ReadContextSwitches(util.DefaultProcStatPath); err == nil {
+		stats.CtxSwitches = ctxt
+	}
 
 	return stats, nil
 }
 
+// requiredTools 系统监控器依赖的外部程序
+var requiredTools = []util.Tool{
+	{Name: "df", Args: []string{"-k", "-P", "/"}, Purpose: "disk usage"},
+}
+
 // getCPUPercent 获取CPU使用率
 func (sm *SystemMonitor) getCPUPercent() (float64, error) {
 	// 读取/proc/stat获取CPU信息
@@ -74,6 +108,9 @@ func (sm *SystemMonitor) getCPUPercent() (float64, error) {
 	}
 	defer file.Close()
 
+	sm.cpu.mu.Lock()
+	defer sm.cpu.mu.Unlock()
+
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -97,19 +134,19 @@ func (sm *SystemMonitor) getCPUPercent() (float64, error) {
 			idleTotal := idle + iowait
 
 			// 如果是第一次调用，保存基准值
-			if lastCPUTotal == 0 {
-				lastCPUTotal = total
-				lastCPUIdle = idleTotal
+			if sm.cpu.total == 0 {
+				sm.cpu.total = total
+				sm.cpu.idle = idleTotal
 				return 0, nil
 			}
 
 			// 计算CPU使用率
-			totalDiff := total - lastCPUTotal
-			idleDiff := idleTotal - lastCPUIdle
+			totalDiff := total - sm.cpu.total
+			idleDiff := idleTotal - sm.cpu.idle
 
 			// 更新上次的值
-			lastCPUTotal = total
-			lastCPUIdle = idleTotal
+			sm.cpu.total = total
+			sm.cpu.idle = idleTotal
 
 			if totalDiff == 0 {
 				return 0, nil
@@ -123,75 +160,118 @@ func (sm *SystemMonitor) getCPUPercent() (float64, error) {
 	return 0, fmt.Errorf("cpu line not found in /proc/stat")
 }
 
+// resetCPUBaseline 重新获取CPU基准值，避免重启后的第一个样本跨越停止期间
+func (sm *SystemMonitor) resetCPUBaseline() {
+	sm.cpu.mu.Lock()
+	sm.cpu.total = 0
+	sm.cpu.idle = 0
+	sm.cpu.mu.Unlock()
+	sm.getCPUPercent()
+}
+
 // getMemoryUsage 获取内存使用情况
 func (sm *SystemMonitor) getMemoryUsage() (float64, uint64, uint64, error) {
-	file, err := os.Open("/proc/meminfo")
+	info, err := util.ReadMeminfo(util.DefaultMeminfoPath)
 	if err != nil {
-		return 0, 0, 0, err
+		return 0, 0, 0, fmt.Errorf("failed to get memory information: %v", err)
 	}
-	defer file.Close()
 
-	var memTotal, memAvailable uint64
-	scanner := bufio.NewScanner(file)
+	memTotal := info.Total
+	memUsed := memTotal - info.Available
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
-		}
+	// 在容器中运行时按cgroup内存限制计算
+	if limits, err := util.ReadCgroupLimits(util.DefaultCgroupRoot); err == nil &&
+		limits.MemoryLimit > 0 && limits.MemoryLimit < memTotal {
+		memTotal = limits.MemoryLimit
+		memUsed = limits.MemoryUsage
+	}
+
+	memoryPercent := (float64(memUsed) / float64(memTotal)) * 100
 
-		switch fields[0] {
-		case "MemTotal:":
-			memTotal, _ = strconv.ParseUint(fields[1], 10, 64)
-			memTotal *= 1024 // 转换为字节
-		case "MemAvailable:":
-			memAvailable, _ = strconv.ParseUint(fields[1], 10, 64)
-			memAvailable *= 1024 // 转换为字节
+	return memoryPercent, memUsed, memTotal, nil
+}
+
+// getDiskUsage 获取根分区磁盘使用情况，优先使用statfs，失败时回退到df
+func (sm *SystemMonitor) getDiskUsage() (float64, uint64, uint64, error) {
+	usedBytes, totalBytes, err := statfsUsage("/")
+	if err != nil || totalBytes == 0 {
+		if usedBytes, totalBytes, err = dfUsage("/"); err != nil {
+			return 0, 0, 0, err
 		}
 	}
 
-	if memTotal == 0 {
-		return 0, 0, 0, fmt.Errorf("failed to get memory information")
+	diskPercent := (float64(usedBytes) / float64(totalBytes)) * 100
+
+	return diskPercent, usedBytes, totalBytes, nil
+}
+
+// diskUsages 获取/proc/mounts中未被排除的各挂载点的使用情况，没有/proc/mounts时只统计根分区
+func (sm *SystemMonitor) diskUsages(exclude []string) ([]types.DiskUsage, error) {
+	mounts, err := util.ReadMounts(util.DefaultMountsPath, exclude)
+	if err != nil {
+		mounts = []util.Mount{{MountPoint: "/"}}
 	}
 
-	memUsed := memTotal - memAvailable
-	memoryPercent := (float64(memUsed) / float64(memTotal)) * 100
+	var usages []types.DiskUsage
+	seen := make(map[string]bool)
+	for _, mount := range mounts {
+		// bind mount等同一设备的多个挂载点只统计第一个
+		if mount.Device != "" && seen[mount.Device] {
+			continue
+		}
 
-	return memoryPercent, memUsed, memTotal, nil
+		used, total, err := statfsUsage(mount.MountPoint)
+		if err != nil {
+			used, total, err = dfUsage(mount.MountPoint)
+		}
+		if err != nil || total == 0 {
+			continue
+		}
+
+		seen[mount.Device] = true
+		usages = append(usages, types.DiskUsage{
+			MountPoint: mount.MountPoint,
+			Device:     mount.Device,
+			FSType:     mount.FSType,
+			Used:       used,
+			Total:      total,
+			Percent:    float64(used) / float64(total) * 100,
+		})
+	}
+
+	if len(usages) == 0 {
+		return nil, fmt.Errorf("failed to get disk usage of any mount")
+	}
+	return usages, nil
 }
 
-// getDiskUsage 获取磁盘使用情况
-func (sm *SystemMonitor) getDiskUsage() (float64, uint64, uint64, error) {
-	// 使用df命令获取根分区使用情况
-	cmd := exec.Command("df", "/")
+// dfUsage 使用df命令获取path所在分区的已用和总字节数。
+// -k -P使各平台统一按POSIX格式输出1KB块，而不是512字节块或带单位的数值
+func dfUsage(path string) (used, total uint64, err error) {
+	cmd := exec.Command("df", "-k", "-P", path)
 	output, err := cmd.Output()
 	if err != nil {
-		return 0, 0, 0, err
+		return 0, 0, err
 	}
 
 	lines := strings.Split(string(output), "\n")
 	if len(lines) < 2 {
-		return 0, 0, 0, fmt.Errorf("invalid df output")
+		return 0, 0, fmt.Errorf("invalid df output")
 	}
 
 	// 解析第二行（数据行）
 	fields := strings.Fields(lines[1])
 	if len(fields) < 5 {
-		return 0, 0, 0, fmt.Errorf("invalid df data format")
+		return 0, 0, fmt.Errorf("invalid df data format")
 	}
 
-	totalBlocks, _ := strconv.ParseUint(fields[1], 10, 64)
+	totalBlocks, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil || totalBlocks == 0 {
+		return 0, 0, fmt.Errorf("invalid df total %q", fields[1])
+	}
 	usedBlocks, _ := strconv.ParseUint(fields[2], 10, 64)
-	// availableBlocks, _ := strconv.ParseUint(fields[3], 10, 64)
-
-	// 转换为字节（假设块大小为1KB）
-	totalBytes := totalBlocks * 1024
-	usedBytes := usedBlocks * 1024
 
-	diskPercent := (float64(usedBytes) / float64(totalBytes)) * 100
-
-	return diskPercent, usedBytes, totalBytes, nil
+	return usedBlocks * 1024, totalBlocks * 1024, nil
 }
 
 // getLoadAverage 获取系统负载
@@ -213,8 +293,43 @@ func (sm *SystemMonitor) getLoadAverage() (float64, float64, float64, error) {
 	return load1, load5, load15, nil
 }
 
-// 添加这些全局变量用于CPU计算
-var (
-	lastCPUTotal uint64
-	lastCPUIdle  uint64
-)
+// getTemperature 读取所有thermal zone中的最高温度
+func (sm *SystemMonitor) getTemperature() (float64, error) {
+	zones, err := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
+	if err != nil {
+		return 0, err
+	}
+
+	var maxTemp float64
+	var found bool
+	for _, zone := range zones {
+		data, err := os.ReadFile(zone)
+		if err != nil {
+			continue
+		}
+
+		// 单位为毫摄氏度
+		milli, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil || milli <= 0 {
+			continue
+		}
+
+		temp := float64(milli) / 1000
+		if !found || temp > maxTemp {
+			maxTemp = temp
+			found = true
+		}
+	}
+
+	if !found {
+		return 0, fmt.Errorf("no thermal data available")
+	}
+	return maxTemp, nil
+}
+
+// cpuBaseline 上一次读取的/proc/stat CPU时间，每个监控器独立维护
+type cpuBaseline struct {
+	mu    sync.Mutex
+	total uint64
+	idle  uint64
+}
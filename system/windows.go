@@ -5,6 +5,7 @@ package system
 import (
 	"fmt"
 	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -12,8 +13,15 @@ import (
 	"unsafe"
 
 	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
 )
 
+// requiredTools 系统监控器依赖的外部程序
+var requiredTools = []util.Tool{
+	{Name: "wmic", Args: []string{"os", "get", "Caption", "/value"}, Purpose: "CPU, memory, disk and temperature stats"},
+	{Name: "powershell", Args: []string{"-NoProfile", "-Command", "exit 0"}, Purpose: "the CPU usage fallback"},
+}
+
 // 定义Windows内存状态结构体
 type memoryStatusEx struct {
 	Length               uint32
@@ -62,10 +70,20 @@ func (sm *SystemMonitor) collectStats() (*types.SystemStats, error) {
 		stats.DiskTotal = diskTotal
 	}
 
-	// Windows没有直接的负载平均值，可以跳过或使用其他指标
-	stats.Load1 = 0
+	// Windows没有负载平均值，用正在运行和排队等待CPU的线程数近似Load1，
+	// 与Unix负载的含义一致；Load5和Load15无法近似，保持为0
+	stats.NumCPU = runtime.NumCPU()
+	if queue, err := sm.getProcessorQueueLength(); err == nil {
+		stats.Load1 = cpuPercent/100*float64(stats.NumCPU) + queue
+	}
 	stats.Load5 = 0
 	stats.Load15 = 0
+	stats.NormalizeLoad()
+
+	// 获取CPU温度，虚拟机和容器中通常不可用，忽略错误
+	if temperature, err := sm.getTemperature(); err == nil {
+		stats.Temperature = temperature
+	}
 
 	return stats, nil
 }
@@ -97,6 +115,22 @@ func (sm *SystemMonitor) getCPUPercent() (float64, error) {
 	return 0, fmt.Errorf("failed to parse CPU usage")
 }
 
+// getProcessorQueueLength 获取等待CPU的线程数
+func (sm *SystemMonitor) getProcessorQueueLength() (float64, error) {
+	cmd := exec.Command("wmic", "path", "Win32_PerfFormattedData_PerfOS_System", "get", "ProcessorQueueLength", "/value")
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "ProcessorQueueLength=") {
+			return strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(line, "ProcessorQueueLength=")), 64)
+		}
+	}
+	return 0, fmt.Errorf("failed to parse processor queue length")
+}
+
 // getCPUPercentFallback 备用的CPU使用率获取方法
 func (sm *SystemMonitor) getCPUPercentFallback() (float64, error) {
 	// 使用PowerShell获取CPU使用率
@@ -116,6 +150,46 @@ func (sm *SystemMonitor) getCPUPercentFallback() (float64, error) {
 	return cpuValue, nil
 }
 
+// getTemperature 通过WMI读取ACPI温区中的最高温度
+func (sm *SystemMonitor) getTemperature() (float64, error) {
+	cmd := exec.Command("wmic", "/namespace:\\\\root\\wmi", "PATH", "MSAcpi_ThermalZoneTemperature", "get", "CurrentTemperature", "/value")
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+
+	var maxTemp float64
+	var found bool
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.HasPrefix(line, "CurrentTemperature=") {
+			continue
+		}
+
+		// 单位为0.1开尔文
+		value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(line, "CurrentTemperature=")), 64)
+		if err != nil || value <= 0 {
+			continue
+		}
+
+		temp := value/10 - 273.15
+		if !found || temp > maxTemp {
+			maxTemp = temp
+			found = true
+		}
+	}
+
+	if !found {
+		return 0, fmt.Errorf("no thermal data available")
+	}
+	return maxTemp, nil
+}
+
+// cpuBaseline Windows上的CPU使用率是瞬时值，无需基准
+type cpuBaseline struct{}
+
+// resetCPUBaseline Windows上的CPU使用率是瞬时值，无需基准
+func (sm *SystemMonitor) resetCPUBaseline() {}
+
 // getMemoryUsage 获取内存使用情况
 func (sm *SystemMonitor) getMemoryUsage() (float64, uint64, uint64, error) {
 	// 使用wmic命令获取内存信息（更兼容的方法）
@@ -194,6 +268,15 @@ func (sm *SystemMonitor) getMemoryUsageEx() (float64, uint64, uint64, error) {
 	return memoryPercent, usedMemory, totalMemory, nil
 }
 
+// diskUsages 获取C盘的使用情况，Windows上不按文件系统类型过滤
+func (sm *SystemMonitor) diskUsages(exclude []string) ([]types.DiskUsage, error) {
+	percent, used, total, err := sm.getDiskUsage()
+	if err != nil {
+		return nil, err
+	}
+	return []types.DiskUsage{{MountPoint: "C:", Used: used, Total: total, Percent: percent}}, nil
+}
+
 // getDiskUsage 获取磁盘使用情况
 func (sm *SystemMonitor) getDiskUsage() (float64, uint64, uint64, error) {
 	// 使用wmic获取C盘使用情况
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/system"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+func TestAgentCollector(t *testing.T) {
+	var addrs []string
+	for _, host := range []string{"alpha", "beta"} {
+		sm := system.NewSystemMonitor(t.TempDir())
+		sm.SetHost(host)
+		config := sm.GetConfig()
+		config.Interval = time.Second
+		if err := sm.UpdateConfig(config); err != nil {
+			t.Fatalf("Failed to update config: %v", err)
+		}
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		agent := system.NewAgent(sm)
+		go agent.Serve(listener)
+		defer agent.Close()
+
+		if err := sm.Start(); err != nil {
+			t.Fatalf("Failed to start monitor: %v", err)
+		}
+		defer sm.Stop()
+		addrs = append(addrs, listener.Addr().String())
+	}
+
+	collector := system.NewCollector(addrs...)
+	if err := collector.SetRetryDelay(100 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to set retry delay: %v", err)
+	}
+	if err := collector.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start collector: %v", err)
+	}
+	defer collector.Stop()
+
+	// Each agent streams samples as they are collected
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(collector.GetHistory("alpha", 0)) >= 2 && len(collector.GetHistory("beta", 0)) >= 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if hosts := collector.Hosts(); len(hosts) != 2 || hosts[0] != "alpha" || hosts[1] != "beta" {
+		t.Fatalf("Expected samples from alpha and beta, got %v", hosts)
+	}
+	for host, stats := range collector.Latest() {
+		if stats.Host != host || stats.Timestamp.IsZero() {
+			t.Errorf("Unexpected latest sample for %s: %+v", host, stats)
+		}
+		history := collector.GetHistory(host, 0)
+		if len(history) < 2 {
+			t.Errorf("Expected streamed samples from %s, got %d", host, len(history))
+		}
+		for i := 1; i < len(history); i++ {
+			if !history[i].Timestamp.After(history[i-1].Timestamp) {
+				t.Errorf("Expected increasing timestamps from %s, got %v then %v", host, history[i-1].Timestamp, history[i].Timestamp)
+			}
+		}
+	}
+}
+
+func TestSystemMonitorOnSample(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+	sm.SetHost("node-1")
+
+	samples := make(chan string, 10)
+	remove := sm.OnSample(func(stats types.SystemStats) { samples <- stats.Host })
+
+	if err := sm.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer sm.Stop()
+
+	select {
+	case host := <-samples:
+		if host != "node-1" {
+			t.Errorf("Expected host node-1, got %q", host)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a sample")
+	}
+	remove()
+
+	if current, err := sm.GetCurrentStats(); err != nil || current.Host != "node-1" {
+		t.Errorf("Expected current stats for node-1, got %+v, %v", current, err)
+	}
+}
@@ -0,0 +1,324 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+func TestAuditRecords(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner, manager.WithAllowedCommands("worker"))
+	defer pm.Shutdown()
+
+	var mu sync.Mutex
+	var records []types.AuditRecord
+	pm.OnProcessAction(func(record types.AuditRecord) {
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
+	})
+
+	uuid, err := pm.StartProcess("worker", []string{"-v"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.SetLabels(uuid, map[string]string{"team": "core"}); err != nil {
+		t.Fatalf("Failed to set labels: %v", err)
+	}
+	if _, err := pm.StartProcess("denied", nil, false); err == nil {
+		t.Fatal("Expected start of a command off the allowlist to fail")
+	}
+	newUUID, err := pm.RestartProcess(uuid)
+	if err != nil {
+		t.Fatalf("Failed to restart process: %v", err)
+	}
+	if err := pm.StopProcess(newUUID); err != nil {
+		t.Fatalf("Failed to stop process: %v", err)
+	}
+	if _, err := pm.StartProcess("worker", nil, false); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	pm.StopAll()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []struct {
+		action types.AuditAction
+		name   string
+		failed bool
+	}{
+		{types.AuditStart, "worker", false},
+		{types.AuditStart, "denied", true},
+		{types.AuditRestart, "worker", false},
+		{types.AuditStop, "worker", false},
+		{types.AuditStart, "worker", false},
+		{types.AuditKill, "worker", false},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d audit records, got %d: %+v", len(want), len(records), records)
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Action != w.action || r.Name != w.name || (r.Error != "") != w.failed || r.Time.IsZero() {
+			t.Errorf("Record %d: expected %s of %s (failed %v), got %+v", i, w.action, w.name, w.failed, r)
+		}
+	}
+
+	if records[0].UUID != uuid || len(records[0].Args) != 1 || records[0].Args[0] != "-v" {
+		t.Errorf("Unexpected start record: %+v", records[0])
+	}
+	if records[1].UUID != "" {
+		t.Errorf("Expected no UUID for a failed start, got %q", records[1].UUID)
+	}
+	if records[2].UUID != uuid || records[2].NewUUID != newUUID || records[2].Labels["team"] != "core" {
+		t.Errorf("Unexpected restart record: %+v", records[2])
+	}
+	if records[3].UUID != newUUID || records[3].Labels["team"] != "core" {
+		t.Errorf("Unexpected stop record: %+v", records[3])
+	}
+}
+
+func TestAuditActorAndClock(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := managertest.NewFakeClock(now)
+	pm := manager.NewProcessManagerWithRunner(runner, manager.WithClock(clock))
+	defer pm.Shutdown()
+
+	var mu sync.Mutex
+	var records []types.AuditRecord
+	pm.OnProcessAction(func(record types.AuditRecord) {
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
+	})
+
+	ctx := manager.WithActor(context.Background(), "alice")
+	if actor := manager.ActorFromContext(ctx); actor != "alice" {
+		t.Errorf("Expected actor alice, got %q", actor)
+	}
+	result, err := pm.StartProcessContext(ctx, types.StartOptions{Name: "worker"})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	newUUID, err := pm.RestartProcessContext(ctx, result.UUID)
+	if err != nil {
+		t.Fatalf("Failed to restart process: %v", err)
+	}
+	if err := pm.StopProcessContext(context.Background(), newUUID); err != nil {
+		t.Fatalf("Failed to stop process: %v", err)
+	}
+	if err := pm.ForgetProcessContext(ctx, "missing"); err == nil {
+		t.Error("Expected forgetting an unknown process to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []struct {
+		action types.AuditAction
+		actor  string
+	}{
+		{types.AuditStart, "alice"},
+		{types.AuditRestart, "alice"},
+		{types.AuditStop, ""},
+		{types.AuditForget, "alice"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d audit records, got %d: %+v", len(want), len(records), records)
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Action != w.action || r.Actor != w.actor || !r.Time.Equal(now) {
+			t.Errorf("Record %d: expected %s by %q at %v, got %+v", i, w.action, w.actor, now, r)
+		}
+	}
+}
+
+func TestRecentEvents(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("worker", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	newUUID, err := pm.RestartProcess(uuid)
+	if err != nil {
+		t.Fatalf("Failed to restart process: %v", err)
+	}
+	if err := pm.StopProcess(newUUID); err != nil {
+		t.Fatalf("Failed to stop process: %v", err)
+	}
+	crashed, err := pm.StartProcess("crasher", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	runner.Last().Crash(3)
+
+	hasEvent := func(eventType types.EventType, uuid string) bool {
+		for _, event := range pm.RecentEvents(0) {
+			if event.Type == eventType && event.UUID == uuid {
+				return true
+			}
+		}
+		return false
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !hasEvent(types.EventExit, crashed) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, want := range []struct {
+		eventType types.EventType
+		uuid      string
+	}{
+		{types.EventStart, uuid},
+		{types.EventRestart, newUUID},
+		{types.EventStop, newUUID},
+		{types.EventStart, crashed},
+		{types.EventExit, crashed},
+	} {
+		if !hasEvent(want.eventType, want.uuid) {
+			t.Errorf("Expected a %s event for %s, got %+v", want.eventType, want.uuid, pm.RecentEvents(0))
+		}
+	}
+
+	events := pm.RecentEvents(0)
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Errorf("Expected events oldest first, got %+v", events)
+			break
+		}
+	}
+	if last := pm.RecentEvents(1); len(last) != 1 || last[0] != events[len(events)-1] {
+		t.Errorf("Expected RecentEvents(1) to return the newest event, got %+v", last)
+	}
+
+	if err := pm.SetEventLogSize(-1); err == nil {
+		t.Error("Expected a negative event log size to be rejected")
+	}
+	if err := pm.SetEventLogSize(2); err != nil {
+		t.Fatalf("Failed to set event log size: %v", err)
+	}
+	if trimmed := pm.RecentEvents(0); len(trimmed) != 2 || trimmed[1] != events[len(events)-1] {
+		t.Errorf("Expected the 2 newest events to be kept, got %+v", trimmed)
+	}
+}
+
+func TestRestartEventReasonAndDelay(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+	if err := pm.SetRestartJitter(0); err != nil {
+		t.Fatalf("Failed to disable jitter: %v", err)
+	}
+
+	crashing, err := pm.StartProcess("crasher", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	runner.Last().Crash(1)
+
+	unhealthy, err := pm.StartProcess("server", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	err = pm.SetHealthCheck(unhealthy, types.HealthCheck{
+		Check:              func(types.ProcessSnapshot) error { return errors.New("no response") },
+		Interval:           20 * time.Millisecond,
+		FailureThreshold:   1,
+		RestartOnUnhealthy: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set health check: %v", err)
+	}
+
+	find := func(eventType types.EventType, uuid string) (types.Event, bool) {
+		for _, event := range pm.RecentEvents(0) {
+			if event.Type == eventType && event.UUID == uuid {
+				return event, true
+			}
+		}
+		return types.Event{}, false
+	}
+
+	var restart, reload types.Event
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		var restarted, reloaded bool
+		restart, restarted = find(types.EventRestart, crashing)
+		reload, reloaded = find(types.EventReload, unhealthy)
+		if restarted && reloaded {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if restart.Reason != "exit code 1" || restart.Delay != manager.RestartDelay {
+		t.Errorf("Expected a restart in %v due to exit code 1, got %+v", manager.RestartDelay, restart)
+	}
+	if reload.Reason != "health check failed: no response" {
+		t.Errorf("Expected a reload due to the failed health check, got %+v", reload)
+	}
+}
+
+func TestSubscribeEventBatches(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	batches, cancel := pm.SubscribeEventBatches(200*time.Millisecond, 0)
+	defer cancel()
+
+	const count = 20
+	started := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		uuid, err := pm.StartProcess(fmt.Sprintf("worker-%d", i), nil, false)
+		if err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		started = append(started, uuid)
+	}
+
+	var received []types.Event
+	deliveries := 0
+	timeout := time.After(2 * time.Second)
+	for len(received) < count {
+		select {
+		case batch := <-batches:
+			if len(batch) == 0 {
+				t.Fatal("Expected no empty batches")
+			}
+			deliveries++
+			received = append(received, batch...)
+		case <-timeout:
+			t.Fatalf("Timed out after receiving %d of %d events", len(received), count)
+		}
+	}
+
+	if deliveries >= count {
+		t.Errorf("Expected the %d start events to be coalesced, got %d deliveries", count, deliveries)
+	}
+	for i, event := range received {
+		if event.Type != types.EventStart || event.UUID != started[i] {
+			t.Errorf("Event %d: expected start of %s, got %s of %s", i, started[i], event.Type, event.UUID)
+		}
+	}
+
+	cancel()
+	if _, ok := <-batches; ok {
+		t.Error("Expected the batch channel to be closed after cancel")
+	}
+}
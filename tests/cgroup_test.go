@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dreamsxin/process-manager/util"
+)
+
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+}
+
+func TestCgroupV2Limits(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"memory.max":         "536870912",
+		"memory.current":     "134217728",
+		"cpu.max":            "150000 100000",
+	})
+
+	limits, err := util.ReadCgroupLimits(root)
+	if err != nil {
+		t.Fatalf("Failed to read limits: %v", err)
+	}
+	if limits.MemoryLimit != 536870912 || limits.MemoryUsage != 134217728 {
+		t.Errorf("Unexpected memory limits: %+v", limits)
+	}
+	if limits.CPULimit != 1.5 {
+		t.Errorf("Expected CPU limit 1.5, got %.2f", limits.CPULimit)
+	}
+}
+
+func TestCgroupV2Unlimited(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"memory.max":         "max",
+		"cpu.max":            "max 100000",
+	})
+
+	limits, err := util.ReadCgroupLimits(root)
+	if err != nil {
+		t.Fatalf("Failed to read limits: %v", err)
+	}
+	if limits.MemoryLimit != 0 || limits.CPULimit != 0 {
+		t.Errorf("Expected no limits, got %+v", limits)
+	}
+}
+
+func TestCgroupV1Limits(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"memory/memory.limit_in_bytes": "268435456",
+		"memory/memory.usage_in_bytes": "67108864",
+		"cpu/cpu.cfs_quota_us":         "200000",
+		"cpu/cpu.cfs_period_us":        "100000",
+	})
+
+	limits, err := util.ReadCgroupLimits(root)
+	if err != nil {
+		t.Fatalf("Failed to read limits: %v", err)
+	}
+	if limits.MemoryLimit != 268435456 || limits.MemoryUsage != 67108864 {
+		t.Errorf("Unexpected memory limits: %+v", limits)
+	}
+	if limits.CPULimit != 2 {
+		t.Errorf("Expected CPU limit 2, got %.2f", limits.CPULimit)
+	}
+
+	// The kernel reports an unlimited v1 memory cgroup as a huge value
+	writeCgroupFiles(t, root, map[string]string{
+		"memory/memory.limit_in_bytes": "9223372036854771712",
+		"cpu/cpu.cfs_quota_us":         "-1",
+	})
+	limits, err = util.ReadCgroupLimits(root)
+	if err != nil {
+		t.Fatalf("Failed to read limits: %v", err)
+	}
+	if limits.MemoryLimit != 0 || limits.CPULimit != 0 {
+		t.Errorf("Expected no limits, got %+v", limits)
+	}
+}
+
+func TestCgroupMissing(t *testing.T) {
+	if _, err := util.ReadCgroupLimits(t.TempDir()); err == nil {
+		t.Error("Expected an error without a cgroup filesystem")
+	}
+}
+
+func TestReadMeminfoWithoutMemAvailable(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFiles(t, dir, map[string]string{
+		// 3.10 kernels have no MemAvailable line
+		"old": "MemTotal:        1000000 kB\nMemFree:          200000 kB\nBuffers:           50000 kB\nCached:           250000 kB\nSwapCached:            0 kB",
+		"new": "MemTotal:        1000000 kB\nMemFree:          200000 kB\nMemAvailable:     600000 kB\nBuffers:           50000 kB\nCached:           250000 kB",
+	})
+
+	info, err := util.ReadMeminfo(filepath.Join(dir, "old"))
+	if err != nil {
+		t.Fatalf("Failed to read meminfo: %v", err)
+	}
+	if info.Total != 1000000*1024 || info.Available != 500000*1024 {
+		t.Errorf("Expected available memory from MemFree + Buffers + Cached, got %+v", info)
+	}
+
+	info, err = util.ReadMeminfo(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatalf("Failed to read meminfo: %v", err)
+	}
+	if info.Available != 600000*1024 {
+		t.Errorf("Expected MemAvailable to be used when present, got %+v", info)
+	}
+
+	if _, err := util.ReadMeminfo(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing meminfo file")
+	}
+}
+
+func TestReadMountsExcludesPseudoFilesystems(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFiles(t, dir, map[string]string{
+		"mounts": "/dev/sda1 / ext4 rw,relatime 0 0\n" +
+			"proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0\n" +
+			"tmpfs /run tmpfs rw,nosuid,nodev,mode=755 0 0\n" +
+			"overlay /var/lib/docker/overlay2/merged overlay rw,relatime 0 0\n" +
+			"/dev/sdb1 /mnt/backup\\040disk xfs rw,relatime 0 0",
+	})
+	path := filepath.Join(dir, "mounts")
+
+	mounts, err := util.ReadMounts(path, util.DefaultExcludedFSTypes)
+	if err != nil {
+		t.Fatalf("Failed to read mounts: %v", err)
+	}
+	want := []util.Mount{
+		{Device: "/dev/sda1", MountPoint: "/", FSType: "ext4"},
+		{Device: "/dev/sdb1", MountPoint: "/mnt/backup disk", FSType: "xfs"},
+	}
+	if len(mounts) != len(want) {
+		t.Fatalf("Expected %d real filesystems, got %+v", len(want), mounts)
+	}
+	for i := range want {
+		if mounts[i] != want[i] {
+			t.Errorf("Expected mount %+v, got %+v", want[i], mounts[i])
+		}
+	}
+
+	// 自定义排除列表
+	mounts, err = util.ReadMounts(path, []string{"xfs"})
+	if err != nil {
+		t.Fatalf("Failed to read mounts: %v", err)
+	}
+	if len(mounts) != 4 {
+		t.Errorf("Expected only xfs to be excluded, got %+v", mounts)
+	}
+}
+
+func TestReadKernelCounters(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFiles(t, dir, map[string]string{
+		"net_dev": "Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo: 9999 10 0 0 0 0 0 0 9999 10 0 0 0 0 0 0\n" +
+			"  eth0: 1000 10 0 0 0 0 0 0 400 4 0 0 0 0 0 0\n" +
+			"  eth1: 2000 20 0 0 0 0 0 0 600 6 0 0 0 0 0 0\n",
+		"diskstats": "   7       0 loop0 50 0 0 0 50 0 0 0 0 0 0\n" +
+			"   8       0 sda 100 0 0 0 200 0 0 0 0 0 0\n" +
+			"   8       1 sda1 90 0 0 0 190 0 0 0 0 0 0\n" +
+			" 259       0 nvme0n1 30 0 0 0 40 0 0 0 0 0 0\n" +
+			" 259       1 nvme0n1p1 30 0 0 0 40 0 0 0 0 0 0\n",
+		"stat": "cpu  1 2 3 4\nctxt 123456\nbtime 1\n",
+	})
+
+	net, err := util.ReadNetDev(filepath.Join(dir, "net_dev"))
+	if err != nil || net.RxBytes != 3000 || net.TxBytes != 1000 {
+		t.Errorf("Expected 3000/1000 bytes without loopback, got %+v, %v", net, err)
+	}
+	disk, err := util.ReadDiskstats(filepath.Join(dir, "diskstats"))
+	if err != nil || disk.Reads != 130 || disk.Writes != 240 {
+		t.Errorf("Expected 130 reads and 240 writes of whole disks, got %+v, %v", disk, err)
+	}
+	ctxt, err := util.ReadContextSwitches(filepath.Join(dir, "stat"))
+	if err != nil || ctxt != 123456 {
+		t.Errorf("Expected 123456 context switches, got %d, %v", ctxt, err)
+	}
+}
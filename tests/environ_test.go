@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// envValue returns the value of key in env and whether it is present
+func envValue(env []string, key string) (string, bool) {
+	for _, entry := range env {
+		if value, found := strings.CutPrefix(entry, key+"="); found {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func TestGetProcessEnvironRedacts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("environ test uses sleep")
+	}
+
+	t.Setenv("APP_DB_PASSWORD", "hunter2")
+	t.Setenv("app_secret_key", "s3cr3t")
+	t.Setenv("APP_REGION", "eu-west-1")
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("sleep", []string{"30"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	env, err := pm.GetProcessEnviron(uuid)
+	if err != nil {
+		t.Fatalf("Failed to get environment: %v", err)
+	}
+	for key, want := range map[string]string{
+		"APP_DB_PASSWORD": "[REDACTED]",
+		"app_secret_key":  "[REDACTED]",
+		"APP_REGION":      "eu-west-1",
+	} {
+		if got, _ := envValue(env, key); got != want {
+			t.Errorf("Expected %s=%s, got %q", key, want, got)
+		}
+	}
+
+	live, err := pm.GetLiveProcessEnviron(uuid)
+	if runtime.GOOS != "linux" {
+		if !errors.Is(err, manager.ErrEnvironUnavailable) {
+			t.Errorf("Expected ErrEnvironUnavailable, got %v", err)
+		}
+	} else if err != nil {
+		t.Errorf("Failed to read live environment: %v", err)
+	} else if got, _ := envValue(live, "APP_DB_PASSWORD"); got != "[REDACTED]" {
+		t.Errorf("Expected live environment to be redacted, got %q", got)
+	}
+
+	// Custom patterns replace the defaults
+	if err := pm.SetSensitiveEnvPatterns("*REGION"); err != nil {
+		t.Fatalf("Failed to set patterns: %v", err)
+	}
+	env, _ = pm.GetProcessEnviron(uuid)
+	if got, _ := envValue(env, "APP_REGION"); got != "[REDACTED]" {
+		t.Errorf("Expected APP_REGION to be redacted, got %q", got)
+	}
+	if got, _ := envValue(env, "APP_DB_PASSWORD"); got != "hunter2" {
+		t.Errorf("Expected APP_DB_PASSWORD to be visible, got %q", got)
+	}
+
+	if err := pm.SetSensitiveEnvPatterns("[bad"); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	if _, err := pm.GetProcessEnviron("missing"); !errors.Is(err, manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound, got %v", err)
+	}
+}
+
+func TestStartProcessWithOptionsEnvAndDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("environ test uses sleep")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	dir := t.TempDir()
+	uuid, err := pm.StartProcessWithOptions(types.StartOptions{
+		Name: "sleep",
+		Args: []string{"30"},
+		Env:  []string{"APP_MODE=options", "PATH=" + os.Getenv("PATH")},
+		Dir:  dir,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	// The environment and directory are reapplied on restart
+	for _, id := range []string{uuid, ""} {
+		if id == "" {
+			if id, err = pm.RestartProcess(uuid); err != nil {
+				t.Fatalf("Failed to restart process: %v", err)
+			}
+		}
+
+		env, err := pm.GetProcessEnviron(id)
+		if err != nil {
+			t.Fatalf("Failed to get environment: %v", err)
+		}
+		if got, _ := envValue(env, "APP_MODE"); got != "options" {
+			t.Errorf("Expected APP_MODE=options, got %q", got)
+		}
+
+		if runtime.GOOS != "linux" {
+			continue
+		}
+		snapshot, _ := pm.GetSnapshot(id)
+		cwd, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", snapshot.PID))
+		if err != nil {
+			t.Fatalf("Failed to read working directory: %v", err)
+		}
+		if want, _ := filepath.EvalSymlinks(dir); cwd != want {
+			t.Errorf("Expected working directory %s, got %s", want, cwd)
+		}
+	}
+}
+
+func TestStartProcessWithUmask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no umask")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	invalid := os.FileMode(0o1022)
+	if _, err := pm.StartProcessWithOptions(types.StartOptions{Name: "sleep", Umask: &invalid}); err == nil {
+		t.Error("Expected a umask with non-permission bits to be rejected")
+	}
+
+	// Each run creates a file named after its PID, the umask is reapplied on restart
+	dir := t.TempDir()
+	umask := os.FileMode(0o077)
+	uuid, err := pm.StartProcessWithOptions(types.StartOptions{
+		Name:  "sh",
+		Args:  []string{"-c", `touch "run-$$" && exec sleep 30`},
+		Dir:   dir,
+		Umask: &umask,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	waitFiles := func(n int) []os.DirEntry {
+		t.Helper()
+		var files []os.DirEntry
+		deadline := time.Now().Add(5 * time.Second)
+		for len(files) < n && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+			files, _ = os.ReadDir(dir)
+		}
+		if len(files) != n {
+			t.Fatalf("Expected %d files, got %d", n, len(files))
+		}
+		return files
+	}
+	waitFiles(1)
+	if _, err := pm.RestartProcess(uuid); err != nil {
+		t.Fatalf("Failed to restart process: %v", err)
+	}
+
+	files := waitFiles(2)
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", file.Name(), err)
+		}
+		if mode := info.Mode().Perm(); mode != 0o600 {
+			t.Errorf("Expected %s to be created with mode 0600, got %#o", file.Name(), mode)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// waitForRunning waits until every process reports the given running state;
+// a removed process counts as not running
+func waitForRunning(t *testing.T, pm *manager.ProcessManager, running bool, uuids ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		done := true
+		for _, uuid := range uuids {
+			if snapshot, exists := pm.GetSnapshot(uuid); (exists && snapshot.Running) != running {
+				done = false
+			}
+		}
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Processes %v did not reach running=%v", uuids, running)
+}
+
+func TestGroupLifecycle(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	db, _ := pm.StartProcess("db", nil, true)
+	web, _ := pm.StartProcess("web", nil, true)
+	other, _ := pm.StartProcess("other", nil, true)
+	if err := pm.SetDependencies(web, []string{db}); err != nil {
+		t.Fatalf("Failed to set dependencies: %v", err)
+	}
+
+	if err := pm.CreateGroup("staging"); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	for _, uuid := range []string{db, web} {
+		if err := pm.AddToGroup("staging", uuid); err != nil {
+			t.Fatalf("Failed to add process to group: %v", err)
+		}
+	}
+
+	if err := pm.StopGroup("staging"); err != nil {
+		t.Fatalf("Failed to stop group: %v", err)
+	}
+	waitForRunning(t, pm, false, db, web)
+
+	exited := runner.Exited()
+	if len(exited) != 2 || exited[0].Name != "web" || exited[1].Name != "db" {
+		t.Fatalf("Expected web to stop before db, got %v", exited)
+	}
+	if snapshot, _ := pm.GetSnapshot(other); !snapshot.Running {
+		t.Error("Expected the process outside the group to keep running")
+	}
+
+	// Stopped members are not auto-restarted
+	time.Sleep(50 * time.Millisecond)
+	if len(runner.Processes()) != 3 {
+		t.Fatalf("Expected no restarts after StopGroup, got %d processes", len(runner.Processes()))
+	}
+
+	if err := pm.StartGroup("staging"); err != nil {
+		t.Fatalf("Failed to start group: %v", err)
+	}
+	waitForRunning(t, pm, true, db, web)
+	started := runner.Processes()[3:]
+	if len(started) != 2 || started[0].Name != "db" || started[1].Name != "web" {
+		t.Fatalf("Expected db to start before web, got %v", started)
+	}
+
+	before, _ := pm.GetSnapshot(web)
+	if err := pm.RestartGroup("staging"); err != nil {
+		t.Fatalf("Failed to restart group: %v", err)
+	}
+	waitForRunning(t, pm, true, db, web)
+	after, _ := pm.GetSnapshot(web)
+	if after.PID == before.PID {
+		t.Error("Expected RestartGroup to start a new process")
+	}
+
+	members, err := pm.GroupMembers("staging")
+	if err != nil || len(members) != 2 || members[0] != db || members[1] != web {
+		t.Errorf("Expected members to keep their UUIDs, got %v (%v)", members, err)
+	}
+}
+
+func TestGroupFollowsRestartedMember(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, _ := pm.StartProcess("worker", nil, true)
+	pm.CreateGroup("workers")
+	pm.AddToGroup("workers", uuid)
+
+	restarted := crashAndWaitRestart(t, pm, runner, uuid)
+
+	members, err := pm.GroupMembers("workers")
+	if err != nil || len(members) != 1 || members[0] != restarted.UUID {
+		t.Errorf("Expected group to track the restarted process %s, got %v (%v)", restarted.UUID, members, err)
+	}
+}
+
+func TestGroupErrors(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	if err := pm.CreateGroup(""); err == nil {
+		t.Error("Expected error for empty group name")
+	}
+	if err := pm.CreateGroup("staging"); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if err := pm.CreateGroup("staging"); err == nil {
+		t.Error("Expected error for duplicate group")
+	}
+	if err := pm.AddToGroup("staging", "missing"); !errors.Is(err, manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound, got %v", err)
+	}
+
+	uuid, _ := pm.StartProcess("worker", nil, true)
+	if err := pm.AddToGroup("missing", uuid); !errors.Is(err, manager.ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+	if err := pm.StopGroup("missing"); !errors.Is(err, manager.ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+
+	pm.AddToGroup("staging", uuid)
+	if err := pm.RemoveFromGroup("staging", uuid); err != nil {
+		t.Errorf("Failed to remove process from group: %v", err)
+	}
+	if err := pm.DeleteGroup("staging"); err != nil {
+		t.Errorf("Failed to delete group: %v", err)
+	}
+	if _, err := pm.GroupMembers("staging"); !errors.Is(err, manager.ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound after delete, got %v", err)
+	}
+}
+
+func TestRollingRestartGroup(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	pm.CreateGroup("workers")
+	var uuids []string
+	var pids []int
+	for i := 0; i < 5; i++ {
+		uuid, err := pm.StartProcess("worker", []string{fmt.Sprint(i)}, true)
+		if err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		pm.AddToGroup("workers", uuid)
+		snapshot, _ := pm.GetSnapshot(uuid)
+		uuids = append(uuids, uuid)
+		pids = append(pids, snapshot.PID)
+	}
+
+	if err := pm.RollingRestartGroup("workers", 2, time.Second); err != nil {
+		t.Fatalf("Rolling restart failed: %v", err)
+	}
+	for i, uuid := range uuids {
+		snapshot, _ := pm.GetSnapshot(uuid)
+		if !snapshot.Running || snapshot.PID == pids[i] {
+			t.Errorf("Expected worker %d to be restarted and running", i)
+		}
+		pids[i] = snapshot.PID
+	}
+
+	// The third worker never becomes ready, so the last batch is left alone
+	pm.SetReadinessCheck(uuids[2], func(types.ProcessSnapshot) error {
+		return errors.New("warming up")
+	})
+
+	err := pm.RollingRestartGroup("workers", 2, 100*time.Millisecond)
+	if !errors.Is(err, manager.ErrNotReady) {
+		t.Fatalf("Expected ErrNotReady, got %v", err)
+	}
+	for i, uuid := range uuids {
+		snapshot, _ := pm.GetSnapshot(uuid)
+		if restarted := snapshot.PID != pids[i]; restarted != (i < 4) {
+			t.Errorf("Worker %d: expected restarted=%v, got %v", i, i < 4, restarted)
+		}
+	}
+
+	if err := pm.RollingRestartGroup("workers", 0, time.Second); err == nil {
+		t.Error("Expected error for maxUnavailable 0")
+	}
+}
+
+func TestGroupStats(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	pm.CreateGroup("sleepers")
+	for i := 0; i < 2; i++ {
+		uuid, err := pm.StartProcess("sleep", []string{"10"}, false)
+		if err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		pm.AddToGroup("sleepers", uuid)
+	}
+
+	stats, err := pm.GroupStats("sleepers")
+	if err != nil {
+		t.Fatalf("Failed to get group stats: %v", err)
+	}
+	if stats.Members != 2 || stats.Running != 2 {
+		t.Errorf("Expected 2 running members, got %d of %d", stats.Running, stats.Members)
+	}
+	var memory uint64
+	for _, processStats := range stats.Processes {
+		memory += processStats.MemoryBytes
+	}
+	if stats.MemoryBytes != memory {
+		t.Errorf("Expected memory total %d, got %d", memory, stats.MemoryBytes)
+	}
+}
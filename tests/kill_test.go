@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/monitor"
+	"github.com/dreamsxin/process-manager/types"
+	"github.com/dreamsxin/process-manager/util"
+)
+
+// buildTrapSignal compiles the signal trapping helper into a temp directory
+func buildTrapSignal(t *testing.T) string {
+	t.Helper()
+
+	bin := filepath.Join(t.TempDir(), "trapsignal")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	out, err := exec.Command("go", "build", "-o", bin, "./testdata/trapsignal").CombinedOutput()
+	if err != nil {
+		t.Skipf("Cannot build helper: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// waitForFile waits until path exists or the timeout elapses
+func waitForFile(path string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+func TestKillTimeoutAllowsCleanup(t *testing.T) {
+	bin := buildTrapSignal(t)
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	done := filepath.Join(dir, "done")
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	if pm.KillTimeout() != manager.DefaultKillTimeout {
+		t.Errorf("Expected default kill timeout %v, got %v", manager.DefaultKillTimeout, pm.KillTimeout())
+	}
+	if err := pm.SetKillTimeout(-time.Second); err == nil {
+		t.Error("Expected error for negative kill timeout")
+	}
+	if err := pm.SetKillTimeout(3 * time.Second); err != nil {
+		t.Fatalf("Failed to set kill timeout: %v", err)
+	}
+
+	uuid, err := pm.StartProcess(bin, []string{"-ready", ready, "-done", done, "-cleanup", "300ms"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if !waitForFile(ready, 5*time.Second) {
+		t.Fatal("Helper process did not become ready")
+	}
+
+	if err := pm.StopProcess(uuid); err != nil {
+		t.Fatalf("Failed to stop process: %v", err)
+	}
+
+	// 清理在超时之前完成，进程应已正常退出
+	if _, err := os.Stat(done); err != nil {
+		t.Error("Expected process to finish cleanup before being killed")
+	}
+}
+
+func TestKillTimeoutForcesKill(t *testing.T) {
+	bin := buildTrapSignal(t)
+	ready := filepath.Join(t.TempDir(), "ready")
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+	pm.SetKillTimeout(300 * time.Millisecond)
+
+	uuid, err := pm.StartProcess(bin, []string{"-ready", ready, "-ignore"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if !waitForFile(ready, 5*time.Second) {
+		t.Fatal("Helper process did not become ready")
+	}
+
+	var process types.Process
+	for _, info := range pm.ListProcesses() {
+		if info.UUID == uuid {
+			process = info.Process
+		}
+	}
+
+	start := time.Now()
+	if err := pm.StopProcess(uuid); err != nil {
+		t.Fatalf("Failed to stop process: %v", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		process.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process ignoring the termination request was not force killed")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("Expected force kill to wait for the kill timeout, took %v", elapsed)
+	}
+}
+
+func TestZombieReportedNotRunning(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("zombie detection reads /proc")
+	}
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	pid := cmd.Process.Pid
+	defer cmd.Wait()
+
+	// Force-kill the child without reaping it, leaving a zombie behind
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatalf("Failed to kill process: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !util.IsZombie(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Process %d did not become a zombie", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := monitor.NewProcessMonitorManager().GetProcessStats(pid); !errors.Is(err, monitor.ErrProcessGone) {
+		t.Errorf("Expected a zombie to be reported as gone, got %v", err)
+	}
+	if util.IsZombie(os.Getpid()) {
+		t.Error("Expected a live process not to be reported as a zombie")
+	}
+}
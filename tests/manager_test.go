@@ -1,11 +1,21 @@
 package tests
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+	"github.com/dreamsxin/process-manager/types"
 )
 
 func TestProcessManagerLifecycle(t *testing.T) {
@@ -76,11 +86,15 @@ func TestProcessRestart(t *testing.T) {
 		t.Fatalf("Failed to start process: %v", err)
 	}
 
-	// Wait for process to complete and restart
-	time.Sleep(3 * time.Second)
+	// Wait for process to complete and restart, allowing for the restart jitter
+	processes := pm.ListProcesses()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && len(processes) == 1 && processes[0].UUID == uuid {
+		time.Sleep(100 * time.Millisecond)
+		processes = pm.ListProcesses()
+	}
 
 	// Process should still be in the list due to auto-restart
-	processes := pm.ListProcesses()
 	if len(processes) != 1 {
 		t.Errorf("Expected 1 process after auto-restart, got %d", len(processes))
 	}
@@ -177,3 +191,1393 @@ func TestStopAll(t *testing.T) {
 		t.Errorf("Expected 0 processes after StopAll, got %d", len(processes))
 	}
 }
+
+func TestStopAllBoundedConcurrency(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	if pm.StopConcurrency() != manager.DefaultStopConcurrency {
+		t.Errorf("Expected default stop concurrency %d, got %d", manager.DefaultStopConcurrency, pm.StopConcurrency())
+	}
+	if err := pm.SetStopConcurrency(0); err == nil {
+		t.Error("Expected an error for zero stop concurrency")
+	}
+	if err := pm.SetStopConcurrency(3); err != nil {
+		t.Fatalf("Failed to set stop concurrency: %v", err)
+	}
+
+	const count = 50
+	for i := 0; i < count; i++ {
+		if _, err := pm.StartProcess("worker", nil, true); err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+	}
+
+	// The audit hook runs inside each stop, so it sees the stop fan-out
+	var active, peak atomic.Int32
+	pm.OnProcessAction(func(record types.AuditRecord) {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		active.Add(-1)
+	})
+
+	pm.StopAll()
+
+	if peak.Load() > 3 {
+		t.Errorf("Expected at most 3 concurrent stops, got %d", peak.Load())
+	}
+	if exited := runner.Exited(); len(exited) != count {
+		t.Errorf("Expected %d exited processes, got %d", count, len(exited))
+	}
+	if processes := pm.ListProcesses(); len(processes) != 0 {
+		t.Errorf("Expected 0 processes after StopAll, got %d", len(processes))
+	}
+}
+
+func TestListProcessesStableOrder(t *testing.T) {
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	var testCommand string
+	var testArgs []string
+
+	if runtime.GOOS == "windows" {
+		testCommand = "cmd"
+		testArgs = []string{"/c", "timeout", "10"}
+	} else {
+		testCommand = "sleep"
+		testArgs = []string{"10"}
+	}
+
+	var uuids []string
+	for i := 0; i < 5; i++ {
+		uuid, err := pm.StartProcess(testCommand, testArgs, false)
+		if err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		uuids = append(uuids, uuid)
+	}
+
+	// Processes are listed in start order on every call
+	for i := 0; i < 10; i++ {
+		processes := pm.ListProcesses()
+		if len(processes) != len(uuids) {
+			t.Fatalf("Expected %d processes, got %d", len(uuids), len(processes))
+		}
+		for j, process := range processes {
+			if process.UUID != uuids[j] {
+				t.Fatalf("Expected process %d to be %s, got %s", j, uuids[j], process.UUID)
+			}
+		}
+	}
+}
+
+func TestFakeRunnerCrashRestart(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("worker", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	// Simulate a crash and let the manager auto-restart the process
+	runner.Last().Crash(3)
+	time.Sleep(2500 * time.Millisecond)
+
+	processes := pm.ListProcesses()
+	if len(processes) != 1 {
+		t.Fatalf("Expected 1 process after auto-restart, got %d", len(processes))
+	}
+
+	process := processes[0]
+	if process.UUID == uuid {
+		t.Error("Expected new UUID after restart")
+	}
+	if process.LastExitCode != 3 {
+		t.Errorf("Expected last exit code 3, got %d", process.LastExitCode)
+	}
+	if len(runner.Processes()) != 2 || !runner.Last().Running() {
+		t.Error("Expected a second running fake process")
+	}
+}
+
+func TestManualRestartSkipsAutoRestart(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("worker", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	newUUID, err := pm.RestartProcess(uuid)
+	if err != nil {
+		t.Fatalf("Failed to restart process: %v", err)
+	}
+
+	// The monitor of the killed run must not schedule an auto-restart
+	time.Sleep(200 * time.Millisecond)
+	for _, event := range pm.RecentEvents(0) {
+		if event.Type == types.EventRestart && event.UUID == uuid {
+			t.Errorf("Expected no auto-restart of the replaced record, got %+v", event)
+		}
+	}
+	if processes := pm.ListProcesses(); len(processes) != 1 || processes[0].UUID != newUUID {
+		t.Errorf("Expected only the restarted process, got %d records", len(processes))
+	}
+	if len(runner.Processes()) != 2 {
+		t.Errorf("Expected exactly one new run, got %d runs", len(runner.Processes()))
+	}
+}
+
+// crashAndWaitRestart crashes the running fake process and waits for the
+// manager to replace the record, returning the new snapshot
+func crashAndWaitRestart(t *testing.T, pm *manager.ProcessManager, runner *managertest.FakeRunner, uuid string) types.ProcessSnapshot {
+	t.Helper()
+
+	runner.Last().Crash(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if snapshots := pm.ListProcesses(); len(snapshots) == 1 && snapshots[0].UUID != uuid {
+			if snapshot, exists := findSnapshot(pm, snapshots[0].UUID); exists {
+				return snapshot
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for auto-restart")
+	return types.ProcessSnapshot{}
+}
+
+func TestRestartCountResetsAfterStableRun(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	clock := managertest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pm := manager.NewProcessManagerWithRunner(runner, manager.WithClock(clock))
+	defer pm.Shutdown()
+
+	if err := pm.SetStableDuration(time.Hour); err != nil {
+		t.Fatalf("Failed to set stable duration: %v", err)
+	}
+	if err := pm.SetStableDuration(-time.Second); err == nil {
+		t.Error("Expected an error for a negative stable duration")
+	}
+
+	uuid, err := pm.StartProcess("worker", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	// A crash right after launch counts
+	snapshot := crashAndWaitRestart(t, pm, runner, uuid)
+	if snapshot.RestartCount != 1 || snapshot.TotalRestarts != 1 {
+		t.Fatalf("Expected 1 restart after an early crash, got %d (total %d)", snapshot.RestartCount, snapshot.TotalRestarts)
+	}
+
+	// A crash after a stable run starts counting again, the total keeps growing
+	clock.Advance(2 * time.Hour)
+	snapshot = crashAndWaitRestart(t, pm, runner, snapshot.UUID)
+	if snapshot.RestartCount != 1 || snapshot.TotalRestarts != 2 {
+		t.Errorf("Expected the count to reset after a stable run, got %d (total %d)", snapshot.RestartCount, snapshot.TotalRestarts)
+	}
+}
+
+func TestCustomIDGenerator(t *testing.T) {
+	next := 0
+	sequential := func() string {
+		next++
+		return fmt.Sprintf("job-%d", next)
+	}
+
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner, manager.WithIDGenerator(sequential))
+	defer pm.Shutdown()
+
+	for _, want := range []string{"job-1", "job-2"} {
+		id, err := pm.StartProcess("worker", nil, false)
+		if err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		if id != want {
+			t.Errorf("Expected id %s, got %s", want, id)
+		}
+	}
+
+	// A generator that repeats an id makes StartProcess fail
+	fixed := manager.NewProcessManagerWithRunner(runner, manager.WithIDGenerator(func() string { return "fixed" }))
+	defer fixed.Shutdown()
+
+	if _, err := fixed.StartProcess("worker", nil, false); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if _, err := fixed.StartProcess("worker", nil, false); err == nil {
+		t.Error("Expected an error for a duplicate id")
+	}
+	if snapshot, exists := findSnapshot(fixed, "fixed"); !exists || !snapshot.Running {
+		t.Error("Expected the first process to keep running")
+	}
+}
+
+func TestDuplicateIDKeepsFirstProcess(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner, manager.WithIDGenerator(func() string { return "dup" }))
+	defer pm.Shutdown()
+
+	if _, err := pm.StartProcess("first", nil, false); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	first := runner.Last()
+
+	_, err := pm.StartProcess("second", nil, false)
+	if !errors.Is(err, manager.ErrDuplicateID) {
+		t.Fatalf("Expected ErrDuplicateID, got %v", err)
+	}
+	if len(runner.Processes()) != 1 {
+		t.Errorf("Expected no process to be created for a duplicate id, got %d", len(runner.Processes()))
+	}
+
+	// The first record is still owned by its monitor goroutine, which
+	// observes the exit
+	first.Crash(5)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	code, err := pm.WaitForExitContext(ctx, "dup")
+	if err != nil || code != 5 {
+		t.Errorf("Expected exit code 5 from the first process, got %d (%v)", code, err)
+	}
+	if snapshot, _ := findSnapshot(pm, "dup"); snapshot.Name != "first" {
+		t.Errorf("Expected the record to belong to the first process, got %q", snapshot.Name)
+	}
+}
+
+func TestWaitForExit(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	runner.SetBehavior("ok", managertest.Behavior{RunFor: 100 * time.Millisecond, ExitCode: 0})
+	runner.SetBehavior("fail", managertest.Behavior{RunFor: 100 * time.Millisecond, ExitCode: 2})
+
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	for name, expected := range map[string]int{"ok": 0, "fail": 2} {
+		uuid, err := pm.StartProcess(name, nil, false)
+		if err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+
+		code, err := pm.WaitForExit(uuid)
+		if err != nil {
+			t.Fatalf("WaitForExit failed for %s: %v", name, err)
+		}
+		if code != expected {
+			t.Errorf("Expected exit code %d for %s, got %d", expected, name, code)
+		}
+	}
+
+	if _, err := pm.WaitForExit("missing"); !errors.Is(err, manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound, got %v", err)
+	}
+}
+
+func TestWaitForExitContext(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("forever", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := pm.WaitForExitContext(ctx, uuid); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+
+	// Abandoned waits leave no goroutine blocked on the process behind
+	before := runtime.NumGoroutine()
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	for i := 0; i < 50; i++ {
+		pm.WaitForExitContext(canceled, uuid)
+	}
+	if after := runtime.NumGoroutine(); after-before >= 50 {
+		t.Errorf("Expected abandoned waits not to leak goroutines, went from %d to %d", before, after)
+	}
+
+	// Waiting after the run exited returns its exit code at once; retain
+	// the record so it outlives the run
+	if err := pm.SetRetention(time.Minute, 0); err != nil {
+		t.Fatalf("Failed to set retention: %v", err)
+	}
+	runner.Last().Crash(3)
+	if code, err := pm.WaitForExit(uuid); err != nil || code != 3 {
+		t.Errorf("Expected exit code 3, got %d (%v)", code, err)
+	}
+	if code, err := pm.WaitForExitContext(canceled, uuid); err != nil || code != 3 {
+		t.Errorf("Expected exit code 3 once exited, got %d (%v)", code, err)
+	}
+}
+
+func TestWaitForProcess(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	if err := pm.SetRetention(time.Minute, 0); err != nil {
+		t.Fatalf("Failed to set retention: %v", err)
+	}
+	uuid, err := pm.StartProcess("forever", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	// Timed out waits leave no goroutine blocked on the process behind
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		if err := pm.WaitForProcess(uuid, time.Millisecond); err == nil {
+			t.Fatal("Expected the wait to time out")
+		}
+	}
+	if after := runtime.NumGoroutine(); after-before >= 50 {
+		t.Errorf("Expected timed out waits not to leak goroutines, went from %d to %d", before, after)
+	}
+
+	// Waiters see the error of the run, before and after it exited
+	done := make(chan error, 1)
+	go func() { done <- pm.WaitForProcess(uuid, 2*time.Second) }()
+	time.Sleep(50 * time.Millisecond)
+	runner.Last().Crash(3)
+	if err := <-done; err == nil {
+		t.Error("Expected the wait to report the crash")
+	}
+	if err := pm.WaitForProcess(uuid, time.Second); err == nil {
+		t.Error("Expected a wait after the exit to report the crash")
+	}
+}
+
+func TestStopAllGracefulOrder(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	runner.SetBehavior("stubborn", managertest.Behavior{IgnoreTerminate: true})
+
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	db, _ := pm.StartProcess("db", nil, true)
+	cache, _ := pm.StartProcess("cache", nil, true)
+	web, _ := pm.StartProcess("web", nil, true)
+	worker, _ := pm.StartProcess("stubborn", nil, true)
+
+	// web and worker depend on db and cache; cache depends on db
+	if err := pm.SetDependencies(cache, []string{db}); err != nil {
+		t.Fatalf("Failed to set dependencies: %v", err)
+	}
+	if err := pm.SetDependencies(web, []string{db, cache}); err != nil {
+		t.Fatalf("Failed to set dependencies: %v", err)
+	}
+	if err := pm.SetDependencies(worker, []string{db, cache}); err != nil {
+		t.Fatalf("Failed to set dependencies: %v", err)
+	}
+
+	forced := pm.StopAllGraceful(200 * time.Millisecond)
+	if len(forced) != 1 || forced[0] != worker {
+		t.Errorf("Expected only the stubborn worker to be force-killed, got %v", forced)
+	}
+
+	exited := runner.Exited()
+	if len(exited) != 4 {
+		t.Fatalf("Expected 4 exited processes, got %d", len(exited))
+	}
+	if exited[2].Name != "cache" || exited[3].Name != "db" {
+		t.Errorf("Expected cache then db to stop last, got %s then %s", exited[2].Name, exited[3].Name)
+	}
+
+	if processes := pm.ListProcesses(); len(processes) != 0 {
+		t.Errorf("Expected 0 processes after graceful stop, got %d", len(processes))
+	}
+}
+
+func TestStopAllCancelsPendingRestarts(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	runner.SetBehavior("flaky", managertest.Behavior{RunFor: 20 * time.Millisecond, ExitCode: 1})
+
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	for i := 0; i < 5; i++ {
+		if _, err := pm.StartProcess("flaky", nil, true); err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+	}
+
+	// Let the processes exit so their auto-restarts are pending
+	time.Sleep(100 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pm.StopAll()
+		}()
+	}
+	wg.Wait()
+
+	// Wait past the auto-restart delay
+	time.Sleep(2500 * time.Millisecond)
+
+	if processes := pm.ListProcesses(); len(processes) != 0 {
+		t.Errorf("Expected 0 processes after StopAll, got %d", len(processes))
+	}
+	if runs := len(runner.Processes()); runs != 5 {
+		t.Errorf("Expected no restarts after StopAll, got %d runs", runs)
+	}
+}
+
+func TestStopAllConcurrentWithList(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Keep listing while processes are started and stopped
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				pm.ListProcesses()
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		if _, err := pm.StartProcess("worker", nil, true); err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		pm.StopAll()
+	}
+
+	close(done)
+	wg.Wait()
+
+	if processes := pm.ListProcesses(); len(processes) != 0 {
+		t.Errorf("Expected 0 processes after StopAll, got %d", len(processes))
+	}
+}
+
+func TestSnapshotDuringChurn(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	runner.SetBehavior("short", managertest.Behavior{RunFor: 5 * time.Millisecond, ExitCode: 1})
+	runner.SetBehavior("long", managertest.Behavior{RunFor: time.Hour})
+
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Churn: processes exit on their own, get stopped and get relabelled
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				pm.StartProcess("short", nil, false)
+				uuid, err := pm.StartProcess("long", []string{"arg"}, false)
+				if err != nil {
+					continue
+				}
+				pm.SetLabels(uuid, map[string]string{"service": "churn"})
+				pm.SetPriority(uuid, 1)
+				pm.StopProcess(uuid)
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		snapshots := pm.Snapshot()
+		if _, err := json.Marshal(snapshots); err != nil {
+			t.Fatalf("Failed to encode snapshot: %v", err)
+		}
+		for i, snapshot := range snapshots {
+			if snapshot.Running && snapshot.Status != "running" {
+				t.Errorf("Torn snapshot: running with status %s", snapshot.Status)
+			}
+			if i > 0 && snapshot.StartTime.Before(snapshots[i-1].StartTime) {
+				t.Error("Expected snapshots sorted by start time")
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// A snapshot is a copy, not a view of the live record
+	uuid, _ := pm.StartProcess("long", []string{"a"}, false)
+	pm.SetLabels(uuid, map[string]string{"service": "api"})
+	var snapshot types.ProcessSnapshot
+	for _, s := range pm.Snapshot() {
+		if s.UUID == uuid {
+			snapshot = s
+		}
+	}
+	pm.SetLabels(uuid, map[string]string{"service": "changed"})
+	pm.StopProcess(uuid)
+	if snapshot.Labels["service"] != "api" || !snapshot.Running || snapshot.Args[0] != "a" {
+		t.Errorf("Expected snapshot to be unaffected by later changes, got %+v", snapshot)
+	}
+}
+
+// findSnapshot returns the snapshot of one process
+func findSnapshot(pm *manager.ProcessManager, uuid string) (types.ProcessSnapshot, bool) {
+	for _, snapshot := range pm.Snapshot() {
+		if snapshot.UUID == uuid {
+			return snapshot, true
+		}
+	}
+	return types.ProcessSnapshot{}, false
+}
+
+func TestTerminatedRecordRetention(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	runner.SetBehavior("ok", managertest.Behavior{RunFor: 10 * time.Millisecond, ExitCode: 0})
+	runner.SetBehavior("fail", managertest.Behavior{RunFor: 10 * time.Millisecond, ExitCode: 3})
+
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	if err := pm.SetRetention(-time.Second, 0); err == nil {
+		t.Error("Expected error for negative TTL")
+	}
+	if err := pm.SetRetention(500*time.Millisecond, 0); err != nil {
+		t.Fatalf("Failed to set retention: %v", err)
+	}
+
+	okUUID, _ := pm.StartProcess("ok", nil, false)
+	failUUID, _ := pm.StartProcess("fail", nil, false)
+	pm.WaitForExit(okUUID)
+	pm.WaitForExit(failUUID)
+	time.Sleep(50 * time.Millisecond)
+
+	process, exists := findSnapshot(pm, okUUID)
+	if !exists {
+		t.Fatal("Expected finished process to be kept")
+	}
+	if process.Status != "exited" {
+		t.Errorf("Expected status exited, got %s", process.Status)
+	}
+	process, exists = findSnapshot(pm, failUUID)
+	if !exists {
+		t.Fatal("Expected failed process to be kept")
+	}
+	if process.Status != "failed" || process.LastExitCode != 3 {
+		t.Errorf("Expected failed with code 3, got %s with code %d", process.Status, process.LastExitCode)
+	}
+
+	if n := len(pm.ListProcesses()); n != 0 {
+		t.Errorf("Expected ListProcesses to skip terminated records, got %d", n)
+	}
+	if n := len(pm.ListAllProcesses()); n != 2 {
+		t.Errorf("Expected ListAllProcesses to include terminated records, got %d", n)
+	}
+	if n := len(pm.Snapshot()); n != 2 {
+		t.Errorf("Expected Snapshot to include terminated records, got %d", n)
+	}
+
+	// Purged by the sweeper once the TTL has passed
+	time.Sleep(time.Second)
+	if _, exists := pm.GetProcess(okUUID); exists {
+		t.Error("Expected record to be purged after the TTL")
+	}
+	if n := len(pm.ListAllProcesses()); n != 0 {
+		t.Errorf("Expected all terminated records purged, got %d", n)
+	}
+}
+
+func TestTerminatedRecordMaxCount(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	runner.SetBehavior("job", managertest.Behavior{RunFor: 10 * time.Millisecond})
+
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+	pm.SetRetention(time.Hour, 2)
+
+	var uuids []string
+	for i := 0; i < 4; i++ {
+		uuid, _ := pm.StartProcess("job", nil, false)
+		pm.WaitForExit(uuid)
+		time.Sleep(30 * time.Millisecond)
+		uuids = append(uuids, uuid)
+	}
+
+	all := pm.ListAllProcesses()
+	if len(all) != 2 {
+		t.Fatalf("Expected 2 kept records, got %d", len(all))
+	}
+	for _, uuid := range uuids[2:] {
+		if _, exists := pm.GetProcess(uuid); !exists {
+			t.Errorf("Expected newest record %s to be kept", uuid)
+		}
+	}
+}
+
+func TestWaitAfterQuickExit(t *testing.T) {
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	exitCommand := func(code string) (string, []string) {
+		if runtime.GOOS == "windows" {
+			return "cmd", []string{"/c", "exit", code}
+		}
+		return "sh", []string{"-c", "exit " + code}
+	}
+
+	name, args := exitCommand("0")
+	okUUID, err := pm.StartProcess(name, args, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	name, args = exitCommand("4")
+	failUUID, err := pm.StartProcess(name, args, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	// Both processes have exited before anyone waits on them
+	time.Sleep(500 * time.Millisecond)
+
+	if err := pm.WaitForProcess(okUUID, time.Second); err != nil {
+		t.Errorf("Expected WaitForProcess to succeed after exit, got %v", err)
+	}
+	if code, err := pm.WaitForExit(okUUID); err != nil || code != 0 {
+		t.Errorf("Expected exit code 0, got %d (%v)", code, err)
+	}
+	if code, err := pm.WaitForExit(failUUID); err != nil || code != 4 {
+		t.Errorf("Expected exit code 4, got %d (%v)", code, err)
+	}
+}
+
+func TestExitCodePolicy(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("worker", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	// Restart on a clean exit or a 40-49 code, never on 42
+	policy := types.ExitCodePolicy{
+		Restart:   []types.ExitCodeRange{{Min: 0, Max: 0}, {Min: 40, Max: 49}},
+		NoRestart: []types.ExitCodeRange{{Min: 42, Max: 42}},
+	}
+	if err := pm.SetExitCodePolicy(uuid, types.ExitCodePolicy{Restart: []types.ExitCodeRange{{Min: 2, Max: 1}}}); err == nil {
+		t.Error("Expected an error for an inverted range")
+	}
+	if err := pm.SetExitCodePolicy(uuid, policy); err != nil {
+		t.Fatalf("Failed to set exit code policy: %v", err)
+	}
+
+	// A code inside the restart set restarts the process and keeps the policy
+	runner.Last().Crash(0)
+	restarted := waitForNewProcess(t, pm, uuid)
+
+	// Codes outside the restart set, or in the forbidden set, do not
+	for _, code := range []int{1, 42} {
+		runner.Last().Crash(code)
+		waitForRunning(t, pm, false, restarted)
+		time.Sleep(100 * time.Millisecond)
+		if snapshots := pm.ListProcesses(); len(snapshots) != 0 {
+			t.Errorf("Expected exit code %d not to restart, got %d processes", code, len(snapshots))
+		}
+
+		uuid, _ = pm.StartProcess("worker", nil, true)
+		pm.SetExitCodePolicy(uuid, policy)
+		restarted = uuid
+	}
+
+	runner.Last().Crash(45)
+	waitForNewProcess(t, pm, uuid)
+}
+
+func TestSetRestartPolicy(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("worker", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	if err := pm.SetRestartPolicy("missing", types.RestartPolicy{Restart: true}); err == nil {
+		t.Error("Expected an error for an unknown process")
+	}
+
+	// Promote the running process to auto-restart
+	if err := pm.SetRestartPolicy(uuid, types.RestartPolicy{Restart: true}); err != nil {
+		t.Fatalf("Failed to set restart policy: %v", err)
+	}
+	runner.Last().Crash(1)
+	restarted := waitForNewProcess(t, pm, uuid)
+
+	policy, ok := pm.GetRestartPolicy(restarted)
+	if !ok || !policy.Restart {
+		t.Errorf("Expected the restarted process to keep the policy, got %+v", policy)
+	}
+
+	// Demote it again mid-run
+	if err := pm.SetRestartPolicy(restarted, types.RestartPolicy{Restart: false}); err != nil {
+		t.Fatalf("Failed to set restart policy: %v", err)
+	}
+	runner.Last().Crash(1)
+	waitForRunning(t, pm, false, restarted)
+	time.Sleep(100 * time.Millisecond)
+	if snapshots := pm.ListProcesses(); len(snapshots) != 0 {
+		t.Errorf("Expected no restart after disabling the policy, got %d processes", len(snapshots))
+	}
+}
+
+func TestRestartJitter(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	if pm.RestartJitter() != manager.DefaultRestartJitter {
+		t.Errorf("Expected default jitter %v, got %v", manager.DefaultRestartJitter, pm.RestartJitter())
+	}
+	for _, fraction := range []float64{-0.1, 1.5} {
+		if err := pm.SetRestartJitter(fraction); err == nil {
+			t.Errorf("Expected jitter %v to be rejected", fraction)
+		}
+	}
+	if err := pm.SetRestartJitter(1); err != nil {
+		t.Fatalf("Failed to set restart jitter: %v", err)
+	}
+
+	const count = 10
+	for i := 0; i < count; i++ {
+		if _, err := pm.StartProcess(fmt.Sprintf("worker-%d", i), nil, true); err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+	}
+
+	// Crash everything at once, as a shared dependency failure would
+	crashed := time.Now()
+	for _, process := range runner.Processes() {
+		process.Crash(1)
+	}
+
+	deadline := crashed.Add(3 * manager.RestartDelay)
+	var restarts []time.Time
+	for time.Now().Before(deadline) {
+		restarts = restarts[:0]
+		for _, snapshot := range pm.Snapshot() {
+			if snapshot.TotalRestarts > 0 {
+				restarts = append(restarts, snapshot.StartTime)
+			}
+		}
+		if len(restarts) == count {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(restarts) != count {
+		t.Fatalf("Expected %d restarts, got %d", count, len(restarts))
+	}
+
+	first, last := restarts[0], restarts[0]
+	for _, restart := range restarts {
+		if restart.Sub(crashed) < manager.RestartDelay {
+			t.Errorf("Expected no restart before the base delay, got one after %v", restart.Sub(crashed))
+		}
+		if restart.Before(first) {
+			first = restart
+		}
+		if restart.After(last) {
+			last = restart
+		}
+	}
+	if spread := last.Sub(first); spread < manager.RestartDelay/4 {
+		t.Errorf("Expected restarts to spread over the jitter window, got %v", spread)
+	}
+}
+
+// waitForNewProcess waits for the only process to be replaced by a restart
+func waitForNewProcess(t *testing.T, pm *manager.ProcessManager, uuid string) string {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if snapshots := pm.ListProcesses(); len(snapshots) == 1 && snapshots[0].UUID != uuid && snapshots[0].Running {
+			return snapshots[0].UUID
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for auto-restart")
+	return ""
+}
+
+func TestRestartOnUnhealthy(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("server", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	first, _ := pm.GetSnapshot(uuid)
+
+	var healthy atomic.Bool
+	err = pm.SetHealthCheck(uuid, types.HealthCheck{
+		Check: func(types.ProcessSnapshot) error {
+			if healthy.Load() {
+				return nil
+			}
+			return errors.New("not responding")
+		},
+		Interval:           20 * time.Millisecond,
+		FailureThreshold:   2,
+		RestartOnUnhealthy: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set health check: %v", err)
+	}
+
+	// The process stays alive but fails its checks until it is restarted
+	deadline := time.Now().Add(2 * time.Second)
+	var snapshot types.ProcessSnapshot
+	for time.Now().Before(deadline) {
+		if snapshot, _ = pm.GetSnapshot(uuid); snapshot.PID != first.PID && snapshot.Running {
+			healthy.Store(true)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if snapshot.PID == first.PID || !snapshot.Running {
+		t.Fatalf("Expected the unhealthy process to be restarted in place, got %+v", snapshot)
+	}
+	if snapshot.TotalRestarts < 1 {
+		t.Errorf("Expected the health restart to be counted, got %d restarts", snapshot.TotalRestarts)
+	}
+
+	var unhealthy bool
+	for _, event := range pm.RecentEvents(0) {
+		if event.Type == types.EventUnhealthy && event.UUID == uuid {
+			unhealthy = true
+		}
+	}
+	if !unhealthy {
+		t.Errorf("Expected an unhealthy event, got %+v", pm.RecentEvents(0))
+	}
+
+	// A clean exit is left to the exit-based policy, which keeps it down
+	healthy.Store(false)
+	runner.Last().Exit(0)
+	time.Sleep(150 * time.Millisecond)
+	if snapshot, exists := pm.GetSnapshot(uuid); exists && snapshot.Running {
+		t.Errorf("Expected the exited process to stay down, got %+v", snapshot)
+	}
+
+	if err := pm.SetHealthCheck("missing", types.HealthCheck{Check: func(types.ProcessSnapshot) error { return nil }}); !errors.Is(err, manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound, got %v", err)
+	}
+}
+
+func TestUnhealthyRestartHonoursBudget(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcessWithOptions(types.StartOptions{
+		Name:   "server",
+		Policy: types.RestartPolicy{Budget: types.RestartBudget{Max: 1, Window: time.Hour}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	first, _ := pm.GetSnapshot(uuid)
+
+	err = pm.SetHealthCheck(uuid, types.HealthCheck{
+		Check:              func(types.ProcessSnapshot) error { return errors.New("not responding") },
+		Interval:           20 * time.Millisecond,
+		FailureThreshold:   2,
+		RestartOnUnhealthy: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set health check: %v", err)
+	}
+
+	// The first health restart uses up the budget, later ones are skipped
+	held := func() bool {
+		for _, event := range pm.RecentEvents(0) {
+			if event.Type == types.EventHeld && event.UUID == uuid {
+				return true
+			}
+		}
+		return false
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && !held() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !held() {
+		t.Fatalf("Expected a held event for the skipped health restart, got %+v", pm.RecentEvents(0))
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	snapshot, _ := pm.GetSnapshot(uuid)
+	if snapshot.PID == first.PID || !snapshot.Running {
+		t.Errorf("Expected the first health restart to go through, got %+v", snapshot)
+	}
+	if snapshot.TotalRestarts != 1 {
+		t.Errorf("Expected exactly 1 health restart within the budget, got %d", snapshot.TotalRestarts)
+	}
+	if len(runner.Processes()) != 2 {
+		t.Errorf("Expected 2 runs, got %d", len(runner.Processes()))
+	}
+}
+
+func TestGetProcessReturnsCopy(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("worker", []string{"-v"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.SetLabels(uuid, map[string]string{"team": "core"}); err != nil {
+		t.Fatalf("Failed to set labels: %v", err)
+	}
+
+	process, exists := pm.GetProcess(uuid)
+	if !exists {
+		t.Fatal("Process not found by UUID")
+	}
+	if process.Status != "running" || !process.Running {
+		t.Errorf("Expected a running process with its computed status, got %+v", process)
+	}
+
+	process.Restart = true
+	process.Running = false
+	process.Args[0] = "-q"
+	process.Labels["team"] = "other"
+
+	again, _ := pm.GetProcess(uuid)
+	if again.Restart || !again.Running || again.Args[0] != "-v" || again.Labels["team"] != "core" {
+		t.Errorf("Expected changes to the copy not to affect the manager, got %+v", again)
+	}
+
+	// Mutations go through the manager's setters
+	if err := pm.SetRestartPolicy(uuid, types.RestartPolicy{Restart: true}); err != nil {
+		t.Fatalf("Failed to set restart policy: %v", err)
+	}
+	if again, _ := pm.GetProcess(uuid); !again.Restart {
+		t.Error("Expected SetRestartPolicy to enable restart")
+	}
+}
+
+func TestStartProcessWithOptions(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	dependency, err := pm.StartProcess("db", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start dependency: %v", err)
+	}
+
+	labels := map[string]string{"team": "core"}
+	policy := types.RestartPolicy{
+		Restart:   true,
+		ExitCodes: types.ExitCodePolicy{NoRestart: []types.ExitCodeRange{{Min: 2, Max: 2}}},
+	}
+	uuid, err := pm.StartProcessWithOptions(types.StartOptions{
+		Name:      "api",
+		Args:      []string{"--port", "8080"},
+		Policy:    policy,
+		Labels:    labels,
+		Priority:  5,
+		DependsOn: []string{dependency},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	labels["team"] = "changed"
+
+	snapshot, _ := pm.GetSnapshot(uuid)
+	if snapshot.Name != "api" || len(snapshot.Args) != 2 || !snapshot.Restart {
+		t.Errorf("Expected the name, args and restart flag from the options, got %+v", snapshot)
+	}
+	if snapshot.Labels["team"] != "core" {
+		t.Errorf("Expected the labels to be copied, got %v", snapshot.Labels)
+	}
+	if snapshot.Priority != 5 {
+		t.Errorf("Expected priority 5, got %d", snapshot.Priority)
+	}
+	if len(snapshot.DependsOn) != 1 || snapshot.DependsOn[0] != dependency {
+		t.Errorf("Expected to depend on %s, got %v", dependency, snapshot.DependsOn)
+	}
+	if got, _ := pm.GetRestartPolicy(uuid); got.ExitCodes.ShouldRestart(2) || !got.ExitCodes.ShouldRestart(1) {
+		t.Errorf("Expected the exit code policy from the options, got %+v", got)
+	}
+
+	// Exit code 2 is excluded from restarts by the policy
+	runner.Last().Exit(2)
+	time.Sleep(200 * time.Millisecond)
+	if snapshot, _ := pm.GetSnapshot(uuid); snapshot.Running {
+		t.Error("Expected the process not to be restarted after exit code 2")
+	}
+}
+
+func TestStartProcessWithOptionsValidation(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	for name, opts := range map[string]types.StartOptions{
+		"missing name":       {},
+		"malformed env":      {Name: "worker", Env: []string{"NOEQUALS"}},
+		"empty env key":      {Name: "worker", Env: []string{"=value"}},
+		"missing dir":        {Name: "worker", Dir: filepath.Join(t.TempDir(), "missing")},
+		"dir is a file":      {Name: "worker", Dir: file},
+		"inverted exit code": {Name: "worker", Policy: types.RestartPolicy{ExitCodes: types.ExitCodePolicy{Restart: []types.ExitCodeRange{{Min: 5, Max: 1}}}}},
+		"unknown dependency": {Name: "worker", DependsOn: []string{"missing"}},
+		"nil listener":       {Name: "worker", Listeners: []*os.File{nil}},
+		"invalid log config": {Name: "worker", Log: &types.LogConfig{LogTo: "nowhere"}},
+	} {
+		if _, err := pm.StartProcessWithOptions(opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if processes := runner.Processes(); len(processes) != 0 {
+		t.Errorf("Expected no process to be created for invalid options, got %d", len(processes))
+	}
+}
+
+func TestRestartBudgetHoldsAndResumes(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	clock := managertest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pm := manager.NewProcessManagerWithRunner(runner, manager.WithClock(clock))
+	defer pm.Shutdown()
+	if err := pm.SetRestartJitter(0); err != nil {
+		t.Fatalf("Failed to disable jitter: %v", err)
+	}
+
+	budget := types.RestartBudget{Max: 1, Window: time.Hour}
+	if _, err := pm.StartProcessWithOptions(types.StartOptions{
+		Name:   "worker",
+		Policy: types.RestartPolicy{Restart: true, Budget: types.RestartBudget{Max: 1}},
+	}); err == nil {
+		t.Error("Expected a budget without a window to be rejected")
+	}
+	uuid, err := pm.StartProcessWithOptions(types.StartOptions{
+		Name:   "worker",
+		Policy: types.RestartPolicy{Restart: true, Budget: budget},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if process, _ := pm.GetProcess(uuid); process.RestartBudget != 1 {
+		t.Errorf("Expected 1 restart left, got %d", process.RestartBudget)
+	}
+
+	waitFor := func(what string, cond func(types.ProcessSnapshot) bool) types.ProcessSnapshot {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if snapshots := pm.Snapshot(); len(snapshots) == 1 && cond(snapshots[0]) {
+				return snapshots[0]
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("Timed out waiting for the process to be %s", what)
+		return types.ProcessSnapshot{}
+	}
+
+	// The first crash uses up the budget
+	runner.Last().Crash(1)
+	restarted := waitFor("restarted", func(s types.ProcessSnapshot) bool { return s.UUID != uuid && s.Running })
+	if restarted.RestartBudget != 0 {
+		t.Errorf("Expected no restarts left, got %d", restarted.RestartBudget)
+	}
+
+	// The second crash within the hour is held down
+	runner.Last().Crash(1)
+	waitFor("held", func(s types.ProcessSnapshot) bool { return s.Status == "held" })
+	clock.Advance(59 * time.Minute)
+	time.Sleep(300 * time.Millisecond)
+	if held := waitFor("held", func(s types.ProcessSnapshot) bool { return true }); held.Status != "held" {
+		t.Errorf("Expected the process to stay held inside the window, got %s", held.Status)
+	}
+
+	// Crossing the window boundary resumes it
+	clock.Advance(time.Minute)
+	resumed := waitFor("resumed", func(s types.ProcessSnapshot) bool { return s.UUID != restarted.UUID && s.Running })
+	if resumed.RestartBudget != 0 || resumed.TotalRestarts != 2 {
+		t.Errorf("Expected the second restart to use the renewed budget, got %+v", resumed)
+	}
+
+	var held bool
+	for _, event := range pm.RecentEvents(0) {
+		held = held || event.Type == types.EventHeld
+	}
+	if !held {
+		t.Error("Expected a held event")
+	}
+}
+
+func TestPlanRestart(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	clock := managertest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pm := manager.NewProcessManagerWithRunner(runner, manager.WithClock(clock))
+	defer pm.Shutdown()
+	if err := pm.SetRestartJitter(0); err != nil {
+		t.Fatalf("Failed to disable jitter: %v", err)
+	}
+	if err := pm.SetKillTimeout(3 * time.Second); err != nil {
+		t.Fatalf("Failed to set kill timeout: %v", err)
+	}
+
+	if _, err := pm.PlanRestart("missing"); !errors.Is(err, manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound, got %v", err)
+	}
+
+	uuid, err := pm.StartProcessWithOptions(types.StartOptions{
+		Name:   "worker",
+		Policy: types.RestartPolicy{Restart: true, Budget: types.RestartBudget{Max: 1, Window: time.Hour}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	plan, err := pm.PlanRestart(uuid)
+	if err != nil {
+		t.Fatalf("Failed to plan restart: %v", err)
+	}
+	if !plan.Running || plan.Overlap || !plan.NewUUID {
+		t.Errorf("Expected a stop-then-start restart under a new UUID, got %+v", plan)
+	}
+	if plan.KillTimeout != 3*time.Second || plan.ExpectedDowntime < plan.KillTimeout {
+		t.Errorf("Expected the downtime to cover the 3s kill timeout, got %+v", plan)
+	}
+	if len(plan.Signals) != 0 {
+		t.Errorf("Expected no signals for a custom runner, got %v", plan.Signals)
+	}
+	if !plan.AutoRestart || plan.RestartBudget != 1 || plan.Backoff {
+		t.Errorf("Expected one restart left and no backoff, got %+v", plan)
+	}
+
+	// Planning has no side effects
+	if process := runner.Last(); !process.Running() || len(runner.Processes()) != 1 {
+		t.Error("Expected planning not to touch the process")
+	}
+
+	// A crash uses up the budget, so the next auto-restart would be held
+	runner.Last().Crash(1)
+	var restarted string
+	deadline := time.Now().Add(5 * time.Second)
+	for restarted == "" && time.Now().Before(deadline) {
+		if snapshots := pm.Snapshot(); len(snapshots) == 1 && snapshots[0].UUID != uuid && snapshots[0].Running {
+			restarted = snapshots[0].UUID
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if restarted == "" {
+		t.Fatal("Timed out waiting for the restart")
+	}
+
+	clock.Advance(10 * time.Minute)
+	plan, err = pm.PlanRestart(restarted)
+	if err != nil {
+		t.Fatalf("Failed to plan restart: %v", err)
+	}
+	if plan.RestartBudget != 0 || !plan.Backoff {
+		t.Errorf("Expected the used-up budget to put the process in backoff, got %+v", plan)
+	}
+	if want := clock.Now().Add(50 * time.Minute); !plan.BackoffUntil.Equal(want) {
+		t.Errorf("Expected the backoff to end at %v, got %v", want, plan.BackoffUntil)
+	}
+}
+
+func TestForgetStuckProcess(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	runner.SetBehavior("stuck", managertest.Behavior{IgnoreTerminate: true, IgnoreKill: true})
+	pm := manager.NewProcessManagerWithRunner(runner)
+
+	if err := pm.ForgetProcess("missing"); !errors.Is(err, manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound, got %v", err)
+	}
+
+	uuid, err := pm.StartProcess("stuck", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.ForgetProcess(uuid); err != nil {
+		t.Fatalf("Failed to forget process: %v", err)
+	}
+	if _, exists := pm.GetProcess(uuid); exists {
+		t.Error("Expected the record to be gone")
+	}
+	if !runner.Last().Running() {
+		t.Error("Expected the stuck process to survive the final kill")
+	}
+
+	var forgotten bool
+	for _, event := range pm.RecentEvents(0) {
+		forgotten = forgotten || (event.Type == types.EventForget && event.UUID == uuid)
+	}
+	if !forgotten {
+		t.Error("Expected a forget event")
+	}
+
+	// The monitor still blocked in Wait no longer holds up Shutdown
+	done := make(chan struct{})
+	go func() {
+		pm.Shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown waited for the forgotten process")
+	}
+
+	// A late exit is not restarted and does not bring the record back
+	runner.Last().Exit(1)
+	time.Sleep(100 * time.Millisecond)
+	if len(runner.Processes()) != 1 || len(pm.ListProcesses()) != 0 {
+		t.Error("Expected the late exit of a forgotten process to be ignored")
+	}
+}
+
+func TestSimulateCrashDrivesExitSequence(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+	if err := pm.SetRestartJitter(0); err != nil {
+		t.Fatalf("Failed to disable jitter: %v", err)
+	}
+
+	if err := managertest.SimulateCrash(pm, runner, "missing", 1); err == nil {
+		t.Error("Expected an error for an unknown process")
+	}
+
+	// A stop is reported as a crash once CrashOnExit is set
+	uuid, err := pm.StartProcess("worker", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	runner.Last().CrashOnExit(9)
+	runner.Last().Kill()
+	if code, _ := pm.WaitForExit(uuid); code != 9 {
+		t.Errorf("Expected the kill to be reported as a crash with code 9, got %d", code)
+	}
+
+	// Crash with 3, which restarts, then with 4, which the policy forbids
+	runner.SetBehavior("worker", managertest.Behavior{RunFor: 50 * time.Millisecond})
+	runner.SetExitSequence("worker", 3, 4)
+	uuid, err = pm.StartProcessWithOptions(types.StartOptions{
+		Name: "worker",
+		Policy: types.RestartPolicy{
+			Restart:   true,
+			ExitCodes: types.ExitCodePolicy{NoRestart: []types.ExitCodeRange{{Min: 4, Max: 4}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(runner.Exited()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	var codes []int
+	for _, process := range runner.Exited() {
+		codes = append(codes, process.ExitCode())
+	}
+	if fmt.Sprint(codes) != "[9 3 4]" {
+		t.Errorf("Expected the exit sequence [9 3 4], got %v", codes)
+	}
+	if processes := pm.ListProcesses(); len(runner.Processes()) != 3 || len(processes) != 0 {
+		t.Errorf("Expected no restart after exit code 4, got %d records", len(processes))
+	}
+
+	// SimulateCrash crashes the current run of a managed process
+	uuid, err = pm.StartProcess("server", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := managertest.SimulateCrash(pm, runner, uuid, 7); err != nil {
+		t.Fatalf("Failed to simulate crash: %v", err)
+	}
+	restarted := waitForNewProcess(t, pm, uuid)
+	if snapshot, _ := pm.GetSnapshot(restarted); snapshot.LastExitCode != 7 {
+		t.Errorf("Expected last exit code 7, got %d", snapshot.LastExitCode)
+	}
+}
+
+func TestStartProcessWithResult(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	if result, err := pm.StartProcessWithResult(types.StartOptions{}); err == nil || result != (types.StartResult{}) {
+		t.Errorf("Expected an empty result and an error for invalid options, got %+v, %v", result, err)
+	}
+
+	result, err := pm.StartProcessWithResult(types.StartOptions{Name: "worker"})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	process, exists := pm.GetProcess(result.UUID)
+	if !exists {
+		t.Fatal("Expected the returned UUID to be managed")
+	}
+	if result.PID == 0 || result.PID != process.PID || result.PID != runner.Last().Pid() {
+		t.Errorf("Expected PID %d, got %d", process.PID, result.PID)
+	}
+	if !result.StartTime.Equal(process.StartTime) {
+		t.Errorf("Expected start time %v, got %v", process.StartTime, result.StartTime)
+	}
+
+	// The result outlives a run that exits before GetProcess could be called
+	runner.SetBehavior("flash", managertest.Behavior{RunFor: time.Millisecond})
+	result, err = pm.StartProcessWithResult(types.StartOptions{Name: "flash"})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if result.PID != runner.Last().Pid() || result.StartTime.IsZero() {
+		t.Errorf("Expected the PID and start time of the quick run, got %+v", result)
+	}
+}
@@ -0,0 +1,1855 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+	"github.com/dreamsxin/process-manager/monitor"
+	"github.com/dreamsxin/process-manager/types"
+	"go.uber.org/goleak"
+)
+
+func TestIdleProcessAutoStop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("idle detection test relies on /proc based CPU sampling")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	// Start a sleeping process that never uses CPU
+	uuid, err := pm.StartProcess("sleep", []string{"30"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	err = pm.SetProcessIdleConfig(uuid, types.IdleConfig{
+		CPUThreshold:   5,
+		Duration:       time.Second,
+		KeepDefinition: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set idle config: %v", err)
+	}
+
+	// Wait for at least two collections so the idle duration elapses
+	time.Sleep(6 * time.Second)
+
+	process, exists := pm.GetProcess(uuid)
+	if !exists {
+		t.Fatal("Expected idle process definition to be kept")
+	}
+	if process.Running {
+		t.Error("Expected idle process to be stopped")
+	}
+	if process.Status != "idle" {
+		t.Errorf("Expected status idle, got %s", process.Status)
+	}
+
+	// The definition can be started again on demand
+	newUUID, err := pm.RestartProcess(uuid)
+	if err != nil {
+		t.Fatalf("Failed to restart idle process: %v", err)
+	}
+	if process, exists := pm.GetProcess(newUUID); !exists || !process.Running {
+		t.Error("Expected restarted process to be running")
+	}
+
+	// The idle config follows the process to its new UUID and PID, so an
+	// idle restarted process is stopped again
+	if config, exists := pm.GetProcessIdleConfig(newUUID); !exists || config.Duration != time.Second {
+		t.Errorf("Expected the idle config to carry over to the restarted process, got %+v", config)
+	}
+	time.Sleep(6 * time.Second)
+
+	process, exists = pm.GetProcess(newUUID)
+	if !exists {
+		t.Fatal("Expected the restarted idle process definition to be kept")
+	}
+	if process.Running || process.Status != "idle" {
+		t.Errorf("Expected the restarted process to be stopped as idle again, got %s", process.Status)
+	}
+}
+
+func TestProcessMonitorConfigValidation(t *testing.T) {
+	m := monitor.NewProcessMonitorManager()
+
+	config := m.GetConfig()
+	config.HistorySize = 5
+	if err := m.UpdateConfig(config); err != nil {
+		t.Errorf("Expected history size 5 to be accepted, got %v", err)
+	}
+
+	config = m.GetConfig()
+	config.RetentionDays = 7
+	if err := m.UpdateConfig(config); err == nil {
+		t.Error("Expected RetentionDays to be rejected by the process monitor")
+	}
+
+	config = m.GetConfig()
+	config.AlertThresholds.CPU = 80
+	if err := m.UpdateConfig(config); err == nil {
+		t.Error("Expected alert thresholds to be rejected by the process monitor")
+	}
+}
+
+// fakeCollector returns canned stats without touching real processes
+type fakeCollector struct {
+	mu    sync.Mutex
+	stats map[int]types.ProcessStats
+	errs  map[int]error // injected errors take precedence over stats
+}
+
+func (c *fakeCollector) ProcessStats(pid int) (*types.ProcessStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err, exists := c.errs[pid]; exists {
+		return nil, err
+	}
+
+	stats, exists := c.stats[pid]
+	if !exists {
+		return nil, fmt.Errorf("%w: process %d does not exist", monitor.ErrProcessGone, pid)
+	}
+	stats.PID = pid
+	stats.Timestamp = time.Now()
+	return &stats, nil
+}
+
+func (c *fakeCollector) ListProcesses() (map[int]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	processes := make(map[int]string)
+	for pid, stats := range c.stats {
+		processes[pid] = stats.Name
+	}
+	return processes, nil
+}
+
+// clockedCollector advances a fake clock by step on every collection
+type clockedCollector struct {
+	*fakeCollector
+	clock *managertest.FakeClock
+	step  time.Duration
+}
+
+func (c *clockedCollector) ProcessStats(pid int) (*types.ProcessStats, error) {
+	c.clock.Advance(c.step)
+	return c.fakeCollector.ProcessStats(pid)
+}
+
+func TestProcessMonitorWithFakeCollector(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{
+			100: {CPUPercent: 12.5, MemoryBytes: 1024},
+		},
+	}
+
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.AddProcess(100, "fake")
+	m.AddProcess(200, "gone")
+
+	stats, err := m.GetProcessStats(100)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Name != "fake" || stats.CPUPercent != 12.5 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+
+	// Wait for one collection cycle after the baseline taken by AddProcess
+	time.Sleep(m.GetConfig().Interval + 500*time.Millisecond)
+
+	history, err := m.GetProcessHistory(100, 10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 2 || history[1].MemoryBytes != 1024 {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+
+	// A process the collector cannot see is dropped from monitoring
+	if _, exists := m.GetMonitoredProcesses()[200]; exists {
+		t.Error("Expected missing process to be removed from monitoring")
+	}
+}
+
+func TestProcessMonitorNextCollection(t *testing.T) {
+	m := monitor.NewProcessMonitorManagerWithCollector(&fakeCollector{})
+
+	if !m.NextCollection().IsZero() {
+		t.Error("Expected zero next collection before start")
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	next := m.NextCollection()
+	if until := time.Until(next); until <= 0 || until > m.GetInterval() {
+		t.Errorf("Expected next collection within one interval, got %v", until)
+	}
+
+	// Changing the interval reschedules the next collection
+	config := m.GetConfig()
+	config.Interval = 5 * time.Second
+	if err := m.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if until := time.Until(m.NextCollection()); until <= 4*time.Second || until > 5*time.Second {
+		t.Errorf("Expected next collection about 5s away, got %v", until)
+	}
+}
+
+func TestProcessMonitorHealth(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{
+			100: {CPUPercent: 1},
+		},
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.AddProcess(100, "fake")
+
+	config := m.GetConfig()
+	config.Interval = time.Second
+	if err := m.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	if health := m.MonitorHealth(); health.Collections != 0 || health.MonitoredProcesses != 1 {
+		t.Errorf("Unexpected health before start: %+v", health)
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+	time.Sleep(3500 * time.Millisecond)
+
+	health := m.MonitorHealth()
+	if health.Collections < 3 {
+		t.Errorf("Expected at least 3 collections, got %d", health.Collections)
+	}
+	if health.LastCollection.IsZero() || health.TotalDuration < health.LastDuration {
+		t.Errorf("Unexpected durations: %+v", health)
+	}
+	if health.Skipped != 0 || health.Failures != 0 {
+		t.Errorf("Expected no skipped or failed collections, got %+v", health)
+	}
+
+	// A collection that overruns the interval counts the ticks it missed
+	var h types.MonitorHealth
+	h.Record(100*time.Millisecond, time.Second, false)
+	h.Record(2500*time.Millisecond, time.Second, true)
+	if h.Collections != 2 || h.Failures != 1 || h.Skipped != 2 {
+		t.Errorf("Unexpected counters: %+v", h)
+	}
+	if h.AverageDuration != 1300*time.Millisecond || h.LastDuration != 2500*time.Millisecond {
+		t.Errorf("Unexpected durations: %+v", h)
+	}
+}
+
+func TestProcessMonitorStartContext(t *testing.T) {
+	m := monitor.NewProcessMonitorManagerWithCollector(&fakeCollector{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := m.StartContext(ctx); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if m.NextCollection().IsZero() {
+		t.Fatal("Expected monitor to be running")
+	}
+
+	// Cancelling the context stops the monitor
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	if !m.NextCollection().IsZero() {
+		t.Error("Expected monitor to stop after context cancel")
+	}
+
+	// A later Stop must not panic
+	if err := m.Stop(); err == nil {
+		t.Error("Expected Stop after cancel to report not running")
+	}
+}
+
+func TestProcessMonitorStaleContextKeepsRestartedMonitor(t *testing.T) {
+	m := monitor.NewProcessMonitorManagerWithCollector(&fakeCollector{})
+	defer m.Close()
+
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := m.StartContext(ctx); err != nil {
+			t.Fatalf("Failed to start monitor: %v", err)
+		}
+		if err := m.Stop(); err != nil {
+			t.Fatalf("Failed to stop monitor: %v", err)
+		}
+
+		// The context of the stopped run is cancelled after the restart
+		if err := m.Start(); err != nil {
+			t.Fatalf("Failed to restart monitor: %v", err)
+		}
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+
+		if m.NextCollection().IsZero() {
+			t.Fatalf("Iteration %d: expected the restarted monitor to keep running", i)
+		}
+		if err := m.Stop(); err != nil {
+			t.Fatalf("Failed to stop monitor: %v", err)
+		}
+	}
+}
+
+func TestProcessMonitorStopStart(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{100: {CPUPercent: 1}},
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.AddProcess(100, "fake")
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	if err := m.Stop(); err != nil {
+		t.Fatalf("Failed to stop monitor: %v", err)
+	}
+
+	// Stopping twice reports an error instead of panicking
+	if err := m.Stop(); err == nil {
+		t.Error("Expected second Stop to fail")
+	}
+
+	// The monitor can be started again and keeps collecting
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to restart monitor: %v", err)
+	}
+	defer m.Stop()
+
+	time.Sleep(m.GetInterval() + 500*time.Millisecond)
+
+	history, err := m.GetProcessHistory(100, 10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) == 0 {
+		t.Error("Expected samples after restarting the monitor")
+	}
+}
+
+func TestGetLastSample(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{100: {CPUPercent: 1}},
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	if _, ok := m.GetLastSample(100); ok {
+		t.Error("Expected no sample before the process is added")
+	}
+	m.AddProcess(100, "fake")
+
+	config := m.GetConfig()
+	config.Interval = time.Second
+	if err := m.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+
+	time.Sleep(m.GetInterval() + 500*time.Millisecond)
+	collector.mu.Lock()
+	collector.stats[100] = types.ProcessStats{CPUPercent: 7}
+	collector.mu.Unlock()
+	time.Sleep(m.GetInterval())
+
+	sample, ok := m.GetLastSample(100)
+	if !ok {
+		t.Fatal("Expected a sample after a few collections")
+	}
+	if sample.CPUPercent != 7 {
+		t.Errorf("Expected the latest sample with CPU 7, got %v", sample.CPUPercent)
+	}
+
+	history, _ := m.GetProcessHistory(100, 1)
+	if len(history) != 1 || !history[0].Timestamp.Equal(sample.Timestamp) {
+		t.Error("Expected GetLastSample to match the newest history entry")
+	}
+	if _, ok := m.GetLastSample(200); ok {
+		t.Error("Expected no sample for an unmonitored process")
+	}
+}
+
+func TestAddProcessCollectsBaseline(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{100: {CPUPercent: 3, MemoryBytes: 1024}},
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+
+	// The monitor is not even started; the sample comes from AddProcess itself
+	if err := m.AddProcess(100, "fake"); err != nil {
+		t.Fatalf("Failed to add process: %v", err)
+	}
+
+	history, err := m.GetProcessHistory(100, 10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 1 || history[0].MemoryBytes != 1024 || history[0].Name != "fake" {
+		t.Errorf("Expected a baseline sample right after AddProcess, got %+v", history)
+	}
+
+	// A PID that is already gone is dropped again and reported
+	if err := m.AddProcess(999, "gone"); !errors.Is(err, monitor.ErrProcessGone) {
+		t.Errorf("Expected ErrProcessGone for an exited process, got %v", err)
+	}
+	if _, exists := m.GetMonitoredProcesses()[999]; exists {
+		t.Error("Expected the exited process not to be monitored")
+	}
+}
+
+func TestCPUAverageSmoothsSpike(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{100: {CPUPercent: 10}},
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+
+	config := m.GetConfig()
+	config.Interval = time.Second
+	config.CPUAverageSamples = -1
+	if err := m.UpdateConfig(config); err == nil {
+		t.Error("Expected negative CPU average samples to be rejected")
+	}
+	config.CPUAverageSamples = 3
+	if err := m.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	// Baseline at 10%, then a single spike to 100%
+	m.AddProcess(100, "fake")
+	collector.mu.Lock()
+	collector.stats[100] = types.ProcessStats{CPUPercent: 100}
+	collector.mu.Unlock()
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+	time.Sleep(m.GetInterval() + 500*time.Millisecond)
+
+	history, err := m.GetProcessHistory(100, 10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 samples, got %d", len(history))
+	}
+	if history[0].CPUPercentAvg != 10 {
+		t.Errorf("Expected the first average to equal the sample, got %v", history[0].CPUPercentAvg)
+	}
+	if history[1].CPUPercent != 100 || history[1].CPUPercentAvg != 55 {
+		t.Errorf("Expected the spike to be averaged to 55, got %v (instant %v)", history[1].CPUPercentAvg, history[1].CPUPercent)
+	}
+}
+
+func TestProcessMonitorClearHistory(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{100: {CPUPercent: 5}},
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.UpdateConfig(types.MonitorConfig{Enabled: true, Interval: time.Second, HistorySize: 10})
+	m.AddProcess(100, "fake")
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+	time.Sleep(1500 * time.Millisecond)
+
+	if history, _ := m.GetProcessHistory(100, 10); len(history) != 2 {
+		t.Fatalf("Expected 2 samples before clearing, got %d", len(history))
+	}
+
+	m.ClearHistory()
+	if history, _ := m.GetProcessHistory(100, 10); len(history) != 0 {
+		t.Errorf("Expected empty history after clear, got %d samples", len(history))
+	}
+	if _, exists := m.GetMonitoredProcesses()[100]; !exists {
+		t.Fatal("Expected the process to stay monitored after clearing history")
+	}
+
+	time.Sleep(time.Second)
+	if _, ok := m.GetLastSample(100); !ok {
+		t.Error("Expected sampling to continue after clearing history")
+	}
+}
+
+func TestUsageBaselineDeviation(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{100: {CPUPercent: 10, MemoryBytes: 100 << 20}},
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+
+	var mu sync.Mutex
+	var handled []types.DeviationAlert
+	m.SetDeviationHandler(func(alert types.DeviationAlert) {
+		mu.Lock()
+		handled = append(handled, alert)
+		mu.Unlock()
+	})
+
+	if err := m.SetUsageBaseline(100, types.UsageBaseline{MemoryBytes: 100 << 20, Deviation: 50}); err == nil {
+		t.Error("Expected error for an unmonitored process")
+	}
+
+	// The baseline sample matches expectations
+	m.AddProcess(100, "fake")
+	if err := m.SetUsageBaseline(100, types.UsageBaseline{MemoryBytes: 100 << 20}); err == nil {
+		t.Error("Expected error for a zero deviation")
+	}
+	baseline := types.UsageBaseline{CPUPercent: 10, MemoryBytes: 100 << 20, Deviation: 50}
+	if err := m.SetUsageBaseline(100, baseline); err != nil {
+		t.Fatalf("Failed to set baseline: %v", err)
+	}
+
+	// Memory triples while staying far below any absolute threshold
+	collector.mu.Lock()
+	collector.stats[100] = types.ProcessStats{CPUPercent: 12, MemoryBytes: 300 << 20}
+	collector.mu.Unlock()
+
+	config := m.GetConfig()
+	config.Interval = time.Second
+	m.UpdateConfig(config)
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+	time.Sleep(1500 * time.Millisecond)
+
+	alerts := m.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("Expected 1 deviation alert, got %+v", alerts)
+	}
+	alert := alerts[0]
+	if alert.Metric != "memory" || alert.Expected != 100<<20 || alert.Actual != 300<<20 || alert.Deviation != 200 {
+		t.Errorf("Unexpected alert: %+v", alert)
+	}
+	if !strings.Contains(alert.Message, "expected") || !strings.Contains(alert.Message, "actual") {
+		t.Errorf("Expected the message to include expected and actual usage, got %q", alert.Message)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 1 {
+		t.Errorf("Expected the handler to see 1 alert, got %d", len(handled))
+	}
+}
+
+func TestTopByUsage(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{
+			1: {CPUPercent: 10, MemoryBytes: 300},
+			2: {CPUPercent: 50, MemoryBytes: 100},
+			3: {CPUPercent: 30, MemoryBytes: 200},
+			4: {CPUPercent: 50, MemoryBytes: 50},
+		},
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	for pid := 1; pid <= 4; pid++ {
+		m.AddProcess(pid, fmt.Sprintf("proc-%d", pid))
+	}
+
+	// Ties are ordered by PID
+	top := m.TopByCPU(3)
+	expected := []int{2, 4, 3}
+	if len(top) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(top))
+	}
+	for i, pid := range expected {
+		if top[i].PID != pid {
+			t.Errorf("TopByCPU[%d]: expected PID %d, got %d", i, pid, top[i].PID)
+		}
+		if top[i].Timestamp.IsZero() {
+			t.Errorf("TopByCPU[%d]: expected sample timestamp", i)
+		}
+	}
+
+	top = m.TopByMemory(0)
+	expected = []int{1, 3, 2, 4}
+	if len(top) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(top))
+	}
+	for i, pid := range expected {
+		if top[i].PID != pid {
+			t.Errorf("TopByMemory[%d]: expected PID %d, got %d", i, pid, top[i].PID)
+		}
+	}
+}
+
+func TestDetailedMemory(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("PSS/USS is only available on Linux")
+	}
+
+	// sleep is dynamically linked, so part of its RSS is shared
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	m := monitor.NewProcessMonitorManager()
+	m.AddProcess(cmd.Process.Pid, "sleep")
+
+	stats, err := m.GetProcessStats(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.MemoryPSS != 0 || stats.MemoryUSS != 0 {
+		t.Error("Expected PSS/USS to be empty unless enabled")
+	}
+
+	config := m.GetConfig()
+	config.DetailedMemory = true
+	if err := m.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	stats, err = m.GetProcessStats(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.MemoryPSS == 0 || stats.MemoryUSS == 0 {
+		t.Fatalf("Expected PSS and USS, got %+v", stats)
+	}
+	if stats.MemoryUSS > stats.MemoryPSS || stats.MemoryPSS > stats.MemoryBytes {
+		t.Errorf("Expected USS <= PSS <= RSS, got USS=%d PSS=%d RSS=%d",
+			stats.MemoryUSS, stats.MemoryPSS, stats.MemoryBytes)
+	}
+}
+
+func TestProcessMonitorWatchByPattern(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{
+			100: {Name: "worker-1"},
+			101: {Name: "worker-2"},
+			102: {Name: "worker-debug"},
+			103: {Name: "nginx"},
+		},
+	}
+
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.UpdateConfig(types.MonitorConfig{Enabled: true, Interval: time.Second, HistorySize: 10})
+
+	if err := m.WatchByPattern("[invalid"); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+	if err := m.ExcludeByPattern("debug$"); err != nil {
+		t.Fatalf("Failed to add exclude pattern: %v", err)
+	}
+	if err := m.WatchByPattern("^worker-"); err != nil {
+		t.Fatalf("Failed to watch pattern: %v", err)
+	}
+	if err := m.WatchByPattern("^worker-"); err == nil {
+		t.Error("Expected error for duplicate pattern")
+	}
+
+	// 手动添加的进程不受自动发现影响
+	collector.mu.Lock()
+	collector.stats[200] = types.ProcessStats{Name: "manual"}
+	collector.mu.Unlock()
+	m.AddProcess(200, "manual")
+
+	assertMonitored := func(expected ...int) {
+		t.Helper()
+		monitored := m.GetMonitoredProcesses()
+		if len(monitored) != len(expected) {
+			t.Fatalf("Expected %d monitored processes, got %v", len(expected), monitored)
+		}
+		for _, pid := range expected {
+			if _, exists := monitored[pid]; !exists {
+				t.Fatalf("Expected PID %d to be monitored, got %v", pid, monitored)
+			}
+		}
+	}
+
+	assertMonitored(100, 101, 200)
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+
+	// worker-1退出，worker-3启动
+	collector.mu.Lock()
+	delete(collector.stats, 100)
+	collector.stats[104] = types.ProcessStats{Name: "worker-3"}
+	collector.mu.Unlock()
+
+	time.Sleep(1500 * time.Millisecond)
+	assertMonitored(101, 104, 200)
+
+	// 取消模式后自动发现的进程被移除，手动添加的保留
+	if err := m.UnwatchPattern("^worker-"); err != nil {
+		t.Fatalf("Failed to unwatch pattern: %v", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	assertMonitored(200)
+}
+
+func TestProcessMonitorErrorClasses(t *testing.T) {
+	// 平台实现对不存在的进程返回ErrProcessGone
+	if _, err := monitor.NewProcessMonitorManager().GetProcessStats(99999999); !errors.Is(err, monitor.ErrProcessGone) {
+		t.Errorf("Expected ErrProcessGone for missing PID, got %v", err)
+	}
+
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{},
+		errs: map[int]error{
+			100: fmt.Errorf("%w: cannot read /proc/100/stat", monitor.ErrPermission),
+			101: fmt.Errorf("%w: invalid stat format", monitor.ErrParse),
+			102: fmt.Errorf("%w: process 102 does not exist", monitor.ErrProcessGone),
+		},
+	}
+
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.AddProcess(100, "permission")
+	m.AddProcess(101, "parse")
+	m.AddProcess(102, "gone")
+
+	for pid, class := range map[int]error{
+		100: monitor.ErrPermission,
+		101: monitor.ErrParse,
+		102: monitor.ErrProcessGone,
+	} {
+		if _, err := m.GetProcessStats(pid); !errors.Is(err, class) {
+			t.Errorf("Expected %v for PID %d, got %v", class, pid, err)
+		}
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+
+	time.Sleep(m.GetConfig().Interval + 500*time.Millisecond)
+
+	monitored := m.GetMonitoredProcesses()
+	if _, exists := monitored[100]; !exists {
+		t.Error("Expected process with permission error to stay monitored")
+	}
+	if _, exists := monitored[101]; !exists {
+		t.Error("Expected process with parse error to stay monitored")
+	}
+	if _, exists := monitored[102]; exists {
+		t.Error("Expected gone process to be removed from monitoring")
+	}
+}
+
+func TestProcessMonitorTransientError(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{
+			100: {CPUPercent: 5, MemoryBytes: 1024},
+			101: {CPUPercent: 5, MemoryBytes: 2048},
+		},
+		errs: map[int]error{},
+	}
+
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.UpdateConfig(types.MonitorConfig{Enabled: true, Interval: time.Second, HistorySize: 10})
+	m.AddProcess(100, "flaky")
+	m.AddProcess(101, "broken")
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+
+	// 第一次采集成功后注入错误
+	time.Sleep(1500 * time.Millisecond)
+	collector.mu.Lock()
+	collector.errs[100] = errors.New("read /proc/100/stat: input/output error")
+	collector.errs[101] = errors.New("read /proc/101/stat: input/output error")
+	collector.mu.Unlock()
+
+	// 单次失败后恢复，监控和历史都应保留
+	time.Sleep(time.Second)
+	collector.mu.Lock()
+	delete(collector.errs, 100)
+	collector.mu.Unlock()
+
+	if _, exists := m.GetMonitoredProcesses()[100]; !exists {
+		t.Fatal("Expected process to stay monitored after a transient error")
+	}
+
+	time.Sleep(time.Second)
+	history, err := m.GetProcessHistory(100, 10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	// 基准样本、第一次采集和恢复后的采集
+	if len(history) != 3 {
+		t.Errorf("Expected history to keep the earlier samples and add a new one, got %d samples", len(history))
+	}
+
+	// 持续失败的进程在连续多次错误后被移除
+	time.Sleep(1500 * time.Millisecond)
+	if _, exists := m.GetMonitoredProcesses()[101]; exists {
+		t.Error("Expected process with repeated errors to be removed from monitoring")
+	}
+	if _, exists := m.GetMonitoredProcesses()[100]; !exists {
+		t.Error("Expected recovered process to remain monitored")
+	}
+}
+
+func TestProcessMonitorStatsHistoryGaps(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{
+			100: {CPUPercent: 5, MemoryBytes: 1024},
+		},
+		errs: map[int]error{},
+	}
+
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.UpdateConfig(types.MonitorConfig{Enabled: true, Interval: time.Second, HistorySize: 10})
+	m.AddProcess(100, "gappy")
+
+	if _, err := m.GetProcessStatsHistory(100, 0); err == nil {
+		t.Error("Expected error for non-positive count")
+	}
+	if _, err := m.GetProcessStatsHistory(999, 5); err == nil {
+		t.Error("Expected error for unmonitored process")
+	}
+
+	// 在秒中间启动，使采样落在各时间段的中部
+	now := time.Now()
+	time.Sleep(time.Until(now.Truncate(time.Second).Add(1500 * time.Millisecond)))
+	base := time.Now().Truncate(time.Second)
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Stop()
+
+	// 第三次采集失败，造成一个缺口
+	time.Sleep(time.Until(base.Add(3 * time.Second)))
+	collector.mu.Lock()
+	collector.errs[100] = errors.New("read /proc/100/stat: input/output error")
+	collector.mu.Unlock()
+
+	time.Sleep(time.Until(base.Add(4 * time.Second)))
+	collector.mu.Lock()
+	delete(collector.errs, 100)
+	collector.mu.Unlock()
+
+	time.Sleep(time.Until(base.Add(4900 * time.Millisecond)))
+	points, err := m.GetProcessStatsHistory(100, 4)
+	if err != nil {
+		t.Fatalf("Failed to get aligned history: %v", err)
+	}
+	if len(points) != 4 {
+		t.Fatalf("Expected 4 points, got %d", len(points))
+	}
+
+	expected := []bool{true, true, false, true}
+	for i, point := range points {
+		if !point.Time.Equal(base.Add(time.Duration(i+1) * time.Second)) {
+			t.Errorf("Point %d not aligned to grid: %v", i, point.Time)
+		}
+		if (point.Stats != nil) != expected[i] {
+			t.Errorf("Point %d: expected sample present=%v, got %+v", i, expected[i], point.Stats)
+		}
+	}
+}
+
+func TestResourceBudgetStopsLowestPriority(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("budget test relies on /proc based memory sampling")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	if _, err := pm.EnforceBudget(); err == nil {
+		t.Error("Expected error when no budget is set")
+	}
+	if err := pm.SetResourceBudget(types.ResourceBudget{Policy: types.BudgetPolicyStop}); err == nil {
+		t.Error("Expected error for budget without limits")
+	}
+	if err := pm.SetResourceBudget(types.ResourceBudget{MemoryBytes: 1, Policy: "shrink"}); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+
+	priorities := []int{5, 0, 10}
+	uuids := make([]string, len(priorities))
+	for i, priority := range priorities {
+		uuid, err := pm.StartProcess("sleep", []string{"30"}, false)
+		if err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		pm.SetPriority(uuid, priority)
+		uuids[i] = uuid
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	stats, err := pm.GetAllMonitoredStats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	var total uint64
+	for _, s := range stats {
+		total += s.MemoryBytes
+	}
+
+	// 预算略低于当前总量，停止一个进程即可满足
+	err = pm.SetResourceBudget(types.ResourceBudget{
+		MemoryBytes: total - 1,
+		Policy:      types.BudgetPolicyStop,
+		Interval:    time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set budget: %v", err)
+	}
+
+	victims, err := pm.EnforceBudget()
+	if err != nil {
+		t.Fatalf("Failed to enforce budget: %v", err)
+	}
+	if len(victims) != 1 || victims[0] != uuids[1] {
+		t.Fatalf("Expected only the lowest priority process to be stopped, got %v", victims)
+	}
+	if _, exists := pm.GetProcess(uuids[1]); exists {
+		t.Error("Expected lowest priority process to be removed")
+	}
+	for _, uuid := range []string{uuids[0], uuids[2]} {
+		if process, exists := pm.GetProcess(uuid); !exists || !process.Running {
+			t.Errorf("Expected process %s to keep running", uuid)
+		}
+	}
+
+	// 回到预算以内后不再处理
+	if victims, _ := pm.EnforceBudget(); len(victims) != 0 {
+		t.Errorf("Expected no action under budget, got %v", victims)
+	}
+
+	pm.ClearResourceBudget()
+	if _, exists := pm.GetResourceBudget(); exists {
+		t.Error("Expected budget to be cleared")
+	}
+}
+
+func TestGetProcessDetail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	if _, err := pm.GetProcessDetail("missing"); !errors.Is(err, manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound, got %v", err)
+	}
+
+	uuid, err := pm.StartProcess("sleep", []string{"10"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	detail, err := pm.GetProcessDetail(uuid)
+	if err != nil {
+		t.Fatalf("Failed to get process detail: %v", err)
+	}
+	if detail.Process.UUID != uuid || !detail.Process.Running || detail.Process.Status != "running" {
+		t.Errorf("Unexpected process in detail: %+v", detail.Process)
+	}
+	if detail.Uptime <= 0 {
+		t.Errorf("Expected positive uptime, got %v", detail.Uptime)
+	}
+	if detail.Stats == nil || detail.Stats.PID != detail.Process.PID {
+		t.Fatalf("Expected the latest sample for PID %d, got %+v", detail.Process.PID, detail.Stats)
+	}
+	if len(detail.History) == 0 || !detail.History[len(detail.History)-1].Timestamp.Equal(detail.Stats.Timestamp) {
+		t.Errorf("Expected history ending with the latest sample, got %d samples", len(detail.History))
+	}
+
+	data, err := json.Marshal(detail)
+	if err != nil {
+		t.Fatalf("Failed to encode detail: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	json.Unmarshal(data, &fields)
+	for _, key := range []string{"process", "uptime", "stats", "history"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("Expected %q in encoded detail, got %s", key, data)
+		}
+	}
+}
+
+func TestManagedMonitoringOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	// By default any PID may be monitored
+	permissive := manager.NewProcessManagerWithMonitor()
+	defer permissive.Shutdown()
+	if err := permissive.AddProcessToMonitor(os.Getpid(), "host"); err != nil {
+		t.Errorf("Expected the permissive manager to monitor any PID, got %v", err)
+	}
+
+	strict := manager.NewProcessManagerWithMonitor(manager.WithManagedMonitoringOnly())
+	defer strict.Shutdown()
+	if err := strict.AddProcessToMonitor(os.Getpid(), "host"); !errors.Is(err, manager.ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged for a foreign PID, got %v", err)
+	}
+
+	uuid, err := strict.StartProcess("sleep", []string{"10"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	snapshot, _ := strict.GetSnapshot(uuid)
+	strict.RemoveProcessFromMonitor(snapshot.PID)
+	if err := strict.AddProcessToMonitor(snapshot.PID, "sleep"); err != nil {
+		t.Errorf("Expected a managed PID to be accepted, got %v", err)
+	}
+}
+
+func TestGetProcessStatsByNameContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	m := monitor.NewProcessMonitorManager()
+	stats, err := m.GetProcessStatsByNameContext(context.Background(), "sleep")
+	if err != nil {
+		t.Fatalf("Failed to get stats by name: %v", err)
+	}
+	found := false
+	for _, s := range stats {
+		found = found || s.PID == cmd.Process.Pid
+	}
+	if !found {
+		t.Errorf("Expected PID %d among %d sleep processes", cmd.Process.Pid, len(stats))
+	}
+
+	// A cancelled context stops the /proc walk
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.GetProcessStatsByNameContext(ctx, "sleep"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	if _, err := m.GetProcessStatsByNameContext(ctx, "sleep"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// startNamedSleep starts sleep under a unique process name through a symlink
+func startNamedSleep(t testing.TB, name string) *exec.Cmd {
+	t.Helper()
+
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not available")
+	}
+	link := filepath.Join(t.TempDir(), name)
+	if err := os.Symlink(sleep, link); err != nil {
+		t.Skipf("Cannot create symlink: %v", err)
+	}
+
+	cmd := exec.Command(link, "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	return cmd
+}
+
+func TestNameLookupCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	m := monitor.NewProcessMonitorManager()
+	if err := m.SetNameCacheTTL(-time.Second); err == nil {
+		t.Error("Expected a negative TTL to be rejected")
+	}
+	m.SetNameCacheTTL(time.Minute)
+
+	// A name missing from the snapshot always rescans, so new processes are found
+	if stats, _ := m.GetProcessStatsByName("pmcachetest"); len(stats) != 0 {
+		t.Fatalf("Expected no pmcachetest process yet, got %d", len(stats))
+	}
+	cmd := startNamedSleep(t, "pmcachetest")
+	time.Sleep(50 * time.Millisecond)
+
+	stats, _ := m.GetProcessStatsByName("pmcachetest")
+	if len(stats) != 1 || stats[0].PID != cmd.Process.Pid {
+		t.Fatalf("Expected the new process to be found, got %+v", stats)
+	}
+	scans := m.MonitorHealth().NameScans
+	if scans != 2 {
+		t.Errorf("Expected 2 scans so far, got %d", scans)
+	}
+
+	// Further lookups within the TTL share the snapshot
+	for i := 0; i < 5; i++ {
+		m.GetProcessStatsByName("pmcachetest")
+	}
+	if got := m.MonitorHealth().NameScans; got != scans {
+		t.Errorf("Expected cached lookups not to rescan, got %d scans", got)
+	}
+
+	// A process that exits within the TTL is not reported
+	cmd.Process.Kill()
+	cmd.Wait()
+	if stats, _ := m.GetProcessStatsByName("pmcachetest"); len(stats) != 0 {
+		t.Errorf("Expected the exited process to be skipped, got %+v", stats)
+	}
+}
+
+func BenchmarkGetProcessStatsByName(b *testing.B) {
+	if runtime.GOOS == "windows" {
+		b.Skip("Skipping benchmark on Windows")
+	}
+
+	cmd := startNamedSleep(b, "pmbench")
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	for _, ttl := range []time.Duration{0, monitor.DefaultNameCacheTTL} {
+		b.Run(fmt.Sprintf("ttl=%v", ttl), func(b *testing.B) {
+			m := monitor.NewProcessMonitorManager()
+			m.SetNameCacheTTL(ttl)
+			for i := 0; i < b.N; i++ {
+				m.GetProcessStatsByName("pmbench")
+			}
+			b.ReportMetric(float64(m.MonitorHealth().NameScans)/float64(b.N), "scans/op")
+		})
+	}
+}
+
+func TestProcessManagerWithMonitorClose(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses sleep")
+	}
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	pm := manager.NewProcessManagerWithMonitor()
+	uuid, err := pm.StartProcess("sleep", []string{"10"}, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.WatchProcess(uuid, types.WatchConfig{Paths: []string{t.TempDir()}}); err != nil {
+		t.Fatalf("Failed to watch process: %v", err)
+	}
+	if err := pm.SetResourceBudget(types.ResourceBudget{MemoryBytes: 1 << 40, Policy: types.BudgetPolicyLog, Interval: time.Second}); err != nil {
+		t.Fatalf("Failed to set budget: %v", err)
+	}
+
+	if err := pm.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := pm.Close(); err != nil {
+		t.Errorf("Expected a second Close to succeed, got %v", err)
+	}
+	if snapshots := pm.ListProcesses(); len(snapshots) != 0 {
+		t.Errorf("Expected all processes to be stopped, got %d", len(snapshots))
+	}
+}
+
+func TestManagerResourcesReturnToBaseline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses true and cat")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Close()
+
+	// Collect as often as allowed so the monitoring loop samples while
+	// AddProcess takes baselines; run with -race to catch races between them
+	config := pm.GetMonitorConfig()
+	config.Interval = time.Second
+	if err := pm.UpdateMonitorConfig(config); err != nil {
+		t.Fatalf("Failed to update monitor config: %v", err)
+	}
+
+	baseline := pm.MonitorHealth()
+	if baseline.OpenPipes != 0 {
+		t.Fatalf("Expected no open pipes before starting processes, got %d", baseline.OpenPipes)
+	}
+
+	iterations := 1000
+	if testing.Short() {
+		iterations = 100
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < iterations; i++ {
+		switch i % 4 {
+		case 0: // exits on its own
+			if _, err := pm.StartProcess("true", nil, false); err != nil {
+				t.Fatalf("Failed to start process: %v", err)
+			}
+		case 1: // stopped while running
+			uuid, err := pm.StartProcess("sleep", []string{"10"}, false)
+			if err != nil {
+				t.Fatalf("Failed to start process: %v", err)
+			}
+			pm.StopProcess(uuid)
+		case 2: // stdio with a subscriber reading to EOF
+			uuid, err := pm.StartProcessWithStdio("cat", nil, false)
+			if err != nil {
+				t.Fatalf("Failed to start process: %v", err)
+			}
+			stdout, err := pm.ProcessStdout(uuid)
+			if err != nil {
+				t.Fatalf("Failed to subscribe to stdout: %v", err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				io.Copy(io.Discard, stdout)
+				stdout.Close()
+			}()
+			if stdin, err := pm.ProcessStdin(uuid); err == nil {
+				stdin.Write([]byte("line\n"))
+				stdin.Close()
+			}
+		case 3: // stdio stopped with a subscriber attached
+			uuid, err := pm.StartProcessWithStdio("cat", nil, false)
+			if err != nil {
+				t.Fatalf("Failed to start process: %v", err)
+			}
+			stdout, err := pm.ProcessStdout(uuid)
+			if err != nil {
+				t.Fatalf("Failed to subscribe to stdout: %v", err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				io.Copy(io.Discard, stdout)
+			}()
+			pm.WaitForProcess(uuid, time.Millisecond)
+			pm.StopProcess(uuid)
+		}
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	var health types.MonitorHealth
+	for time.Now().Before(deadline) {
+		health = pm.MonitorHealth()
+		if health.Goroutines == baseline.Goroutines && health.OpenPipes == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if health.Goroutines != baseline.Goroutines || health.OpenPipes != 0 {
+		t.Errorf("Expected counts to return to %d goroutines and 0 pipes, got %d and %d",
+			baseline.Goroutines, health.Goroutines, health.OpenPipes)
+	}
+	if health.Collections == 0 {
+		t.Error("Expected the monitoring loop to collect while processes were started")
+	}
+	wg.Wait()
+}
+
+func TestGetRawProcessStat(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Raw stat fields come from /proc")
+	}
+
+	m := monitor.NewProcessMonitorManager()
+	fields, err := m.GetRawProcessStat(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to get raw stat: %v", err)
+	}
+
+	if fields["pid"] != strconv.Itoa(os.Getpid()) || fields["Pid"] != fields["pid"] {
+		t.Errorf("Expected pid %d from stat and status, got %q and %q", os.Getpid(), fields["pid"], fields["Pid"])
+	}
+	if fields["comm"] == "" || fields["state"] == "" {
+		t.Errorf("Expected comm and state, got %q and %q", fields["comm"], fields["state"])
+	}
+	for _, key := range []string{"minflt", "majflt", "priority", "nice", "num_threads", "voluntary_ctxt_switches", "nonvoluntary_ctxt_switches"} {
+		if _, err := strconv.ParseInt(fields[key], 10, 64); err != nil {
+			t.Errorf("Expected %s to be an integer, got %q", key, fields[key])
+		}
+	}
+	if !strings.HasSuffix(fields["VmRSS"], "kB") {
+		t.Errorf("Expected VmRSS in kB, got %q", fields["VmRSS"])
+	}
+
+	if _, err := m.GetRawProcessStat(999999999); !errors.Is(err, monitor.ErrProcessGone) {
+		t.Errorf("Expected ErrProcessGone for a missing process, got %v", err)
+	}
+}
+
+func TestGetProcessStatsByUUIDs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	first, err := pm.StartProcess("sleep", []string{"10"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	second, err := pm.StartProcess("sleep", []string{"10"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	stats, errs := pm.GetProcessStatsByUUIDs([]string{first, "missing", second})
+	if len(stats) != 2 {
+		t.Fatalf("Expected stats for 2 processes, got %d: %v", len(stats), errs)
+	}
+	for _, uuid := range []string{first, second} {
+		snapshot, _ := pm.GetSnapshot(uuid)
+		if stats[uuid].PID != snapshot.PID {
+			t.Errorf("Expected stats for PID %d, got %+v", snapshot.PID, stats[uuid])
+		}
+	}
+	if len(errs) != 1 || !errors.Is(errs["missing"], manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound for the missing UUID only, got %v", errs)
+	}
+
+	// 刚采集的样本应被直接使用，而不是重新采集
+	sample, ok := pm.GetLastSampleByUUID(first)
+	if !ok {
+		t.Fatal("Expected a cached sample for the first process")
+	}
+	if !stats[first].Timestamp.Equal(sample.Timestamp) {
+		t.Errorf("Expected the cached sample at %v, got one at %v", sample.Timestamp, stats[first].Timestamp)
+	}
+}
+
+func TestProcessMonitorTimingMetrics(t *testing.T) {
+	clock := managertest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	collector := &clockedCollector{
+		fakeCollector: &fakeCollector{stats: map[int]types.ProcessStats{100: {CPUPercent: 1}}},
+		clock:         clock,
+		step:          1500 * time.Millisecond, // every collection overruns the interval by 500ms
+	}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.SetClock(clock)
+
+	config := m.GetConfig()
+	config.Interval = time.Second
+	if err := m.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	m.AddProcess(100, "fake")
+	if health := m.MonitorHealth(); health.AddToFirstSample != collector.step {
+		t.Errorf("Expected time to first sample after AddProcess of %v, got %v", collector.step, health.AddToFirstSample)
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.MonitorHealth().Collections < 3 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	health := m.MonitorHealth()
+	if health.Collections < 3 {
+		t.Fatalf("Expected at least 3 collections, got %d", health.Collections)
+	}
+	if health.TimeToFirstSample != collector.step {
+		t.Errorf("Expected time to first sample after Start of %v, got %v", collector.step, health.TimeToFirstSample)
+	}
+	if health.LastJitter != 500*time.Millisecond {
+		t.Errorf("Expected a jitter of 500ms, got %v", health.LastJitter)
+	}
+	if health.MaxJitter < health.LastJitter || health.AverageJitter <= 0 || health.AverageJitter > health.MaxJitter {
+		t.Errorf("Unexpected jitter metrics: %+v", health)
+	}
+}
+
+// slowCollector blocks reads of one PID until release is closed, like a hung /proc
+type slowCollector struct {
+	*fakeCollector
+	slowPID int
+	release chan struct{}
+}
+
+func (c *slowCollector) ProcessStats(pid int) (*types.ProcessStats, error) {
+	if pid == c.slowPID {
+		<-c.release
+	}
+	return c.fakeCollector.ProcessStats(pid)
+}
+
+func TestProcessMonitorCollectTimeout(t *testing.T) {
+	collector := &slowCollector{
+		fakeCollector: &fakeCollector{stats: map[int]types.ProcessStats{
+			100: {CPUPercent: 1},
+			300: {CPUPercent: 2},
+		}},
+		slowPID: 300,
+		release: make(chan struct{}),
+	}
+	defer close(collector.release)
+
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	if err := m.SetCollectTimeout(0); err == nil {
+		t.Error("Expected a zero collect timeout to be rejected")
+	}
+	if err := m.SetCollectTimeout(50 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to set collect timeout: %v", err)
+	}
+
+	start := time.Now()
+	_, err := m.GetProcessStats(300)
+	if !errors.Is(err, monitor.ErrTimeout) {
+		t.Errorf("Expected ErrTimeout for a hung read, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the read to give up after the timeout, took %v", elapsed)
+	}
+
+	// 其他进程不受影响
+	stats, err := m.GetProcessStats(100)
+	if err != nil || stats.CPUPercent != 1 {
+		t.Errorf("Expected stats of a responsive process, got %+v, %v", stats, err)
+	}
+
+	// 基准采集使用更短的超时，挂起的读取不会长时间阻塞AddProcess
+	if err := m.SetCollectTimeout(time.Minute); err != nil {
+		t.Fatalf("Failed to set collect timeout: %v", err)
+	}
+	start = time.Now()
+	if err := m.AddProcess(300, "hung"); err != nil {
+		t.Errorf("Expected a hung baseline read not to fail AddProcess, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > monitor.BaselineTimeout+time.Second {
+		t.Errorf("Expected AddProcess to give up after the baseline timeout, took %v", elapsed)
+	}
+	if _, exists := m.GetMonitoredProcesses()[300]; !exists {
+		t.Error("Expected the process to stay monitored after a baseline timeout")
+	}
+}
+
+func TestMonitoredProcessFirstAndLastSeen(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := managertest.NewFakeClock(start)
+	collector := &fakeCollector{stats: map[int]types.ProcessStats{
+		100: {Name: "worker"},
+		200: {Name: "manual"},
+	}}
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	m.SetClock(clock)
+
+	config := m.GetConfig()
+	config.Interval = time.Second
+	if err := m.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	m.AddProcess(200, "manual")
+	if err := m.WatchByPattern("^worker$"); err != nil {
+		t.Fatalf("Failed to watch pattern: %v", err)
+	}
+
+	monitored := m.GetMonitoredProcesses()
+	if worker := monitored[100]; !worker.Discovered || !worker.FirstSeen.Equal(start) || !worker.LastSeen.Equal(start) {
+		t.Errorf("Unexpected discovered process: %+v", worker)
+	}
+	if manual := monitored[200]; manual.Discovered || manual.Name != "manual" || !manual.FirstSeen.Equal(start) {
+		t.Errorf("Unexpected manual process: %+v", manual)
+	}
+
+	clock.Advance(time.Minute)
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer m.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.MonitorHealth().Collections < 1 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for pid, process := range m.GetMonitoredProcesses() {
+		if !process.FirstSeen.Equal(start) {
+			t.Errorf("Expected first seen of PID %d to stay at %v, got %v", pid, start, process.FirstSeen)
+		}
+		if !process.LastSeen.Equal(start.Add(time.Minute)) {
+			t.Errorf("Expected last seen of PID %d to advance to %v, got %v", pid, start.Add(time.Minute), process.LastSeen)
+		}
+	}
+}
+
+// countingCollector counts the stats collections made through it
+type countingCollector struct {
+	*fakeCollector
+	calls atomic.Int64
+}
+
+func (c *countingCollector) ProcessStats(pid int) (*types.ProcessStats, error) {
+	c.calls.Add(1)
+	return c.fakeCollector.ProcessStats(pid)
+}
+
+func TestGetProcessStatsByNameLimited(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	// A copy of sleep under a unique name, so only our processes match
+	sleepPath, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skipf("sleep is not available: %v", err)
+	}
+	data, err := os.ReadFile(sleepPath)
+	if err != nil {
+		t.Fatalf("Failed to read sleep: %v", err)
+	}
+	binary := filepath.Join(t.TempDir(), "pm-limit-sleep")
+	if err := os.WriteFile(binary, data, 0755); err != nil {
+		t.Fatalf("Failed to copy sleep: %v", err)
+	}
+
+	collector := &countingCollector{fakeCollector: &fakeCollector{stats: make(map[int]types.ProcessStats)}}
+	const count = 8
+	for i := 0; i < count; i++ {
+		cmd := exec.Command(binary, "10")
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		collector.stats[cmd.Process.Pid] = types.ProcessStats{
+			CPUPercent:  float64(i),
+			MemoryBytes: uint64((i*5)%count) * 1024,
+		}
+	}
+
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+
+	stats, total, err := m.GetProcessStatsByNameLimited(context.Background(), "pm-limit-sleep", types.NameQueryOptions{Limit: 3})
+	if err != nil {
+		t.Fatalf("Failed to get stats by name: %v", err)
+	}
+	if total != count || len(stats) != 3 {
+		t.Fatalf("Expected 3 of %d matches, got %d of %d", count, len(stats), total)
+	}
+	if calls := collector.calls.Load(); calls != 3 {
+		t.Errorf("Expected collection to stop after 3 processes, made %d collections", calls)
+	}
+	for i := 1; i < len(stats); i++ {
+		if stats[i].PID <= stats[i-1].PID {
+			t.Errorf("Expected results in PID order, got %+v", stats)
+		}
+	}
+
+	stats, total, err = m.GetProcessStatsByNameLimited(context.Background(), "pm-limit-sleep", types.NameQueryOptions{Limit: 2, SortBy: types.SortByMemory})
+	if err != nil {
+		t.Fatalf("Failed to get stats by name: %v", err)
+	}
+	if total != count || len(stats) != 2 {
+		t.Fatalf("Expected 2 of %d matches, got %d of %d", count, len(stats), total)
+	}
+	if stats[0].MemoryBytes != (count-1)*1024 || stats[1].MemoryBytes != (count-2)*1024 {
+		t.Errorf("Expected the two processes using the most memory, got %+v", stats)
+	}
+
+	if _, _, err := m.GetProcessStatsByNameLimited(context.Background(), "pm-limit-sleep", types.NameQueryOptions{SortBy: "name"}); err == nil {
+		t.Error("Expected an unknown sort key to be rejected")
+	}
+}
+
+func TestGetProcessCreateTime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("create time test uses sleep")
+	}
+
+	before := time.Now()
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	created, err := monitor.GetProcessCreateTime(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("Failed to get create time: %v", err)
+	}
+	// Linux derives it from the boot time, which has a resolution of one second
+	if created.Before(before.Add(-2*time.Second)) || created.After(time.Now().Add(2*time.Second)) {
+		t.Errorf("Expected a create time close to %v, got %v", before, created)
+	}
+
+	if runtime.GOOS == "linux" {
+		stats, err := monitor.NewProcessMonitorManager().GetProcessStats(cmd.Process.Pid)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if diff := stats.CreateTime.Sub(created); diff < -time.Second || diff > time.Second {
+			t.Errorf("Expected stats to report create time %v, got %v", created, stats.CreateTime)
+		}
+	}
+
+	if _, err := monitor.GetProcessCreateTime(99999999); !errors.Is(err, monitor.ErrProcessGone) {
+		t.Errorf("Expected ErrProcessGone for a missing process, got %v", err)
+	}
+}
+
+func TestGetProcessStatsAnnotatesManaged(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("sleep", []string{"10"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.SetLabels(uuid, map[string]string{"team": "core"}); err != nil {
+		t.Fatalf("Failed to set labels: %v", err)
+	}
+	snapshot, _ := pm.GetSnapshot(uuid)
+
+	stats, err := pm.GetProcessStats(snapshot.PID)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.UUID != uuid || stats.Labels["team"] != "core" || stats.RestartCount != snapshot.RestartCount {
+		t.Errorf("Expected the stats to carry the manager metadata, got %+v", stats)
+	}
+
+	// 所有返回统计信息的方法都附带托管进程的元数据
+	annotated := func(method string, stats types.ProcessStats, uuid string) {
+		t.Helper()
+		if stats.UUID != uuid || stats.Labels["team"] != "core" {
+			t.Errorf("Expected %s to carry the manager metadata, got %+v", method, stats)
+		}
+	}
+	all, err := pm.GetAllMonitoredStats()
+	if err != nil {
+		t.Fatalf("Failed to get all stats: %v", err)
+	}
+	for _, stats := range all {
+		if stats.PID == snapshot.PID {
+			annotated("GetAllMonitoredStats", stats, uuid)
+		}
+	}
+	byName, err := pm.GetProcessStatsByName("sleep")
+	if err != nil {
+		t.Fatalf("Failed to get stats by name: %v", err)
+	}
+	for _, stats := range byName {
+		if stats.PID == snapshot.PID {
+			annotated("GetProcessStatsByName", stats, uuid)
+		}
+	}
+	batch, errs := pm.GetProcessStatsByUUIDs([]string{uuid})
+	if len(errs) != 0 {
+		t.Fatalf("Failed to get stats by UUIDs: %v", errs)
+	}
+	annotated("GetProcessStatsByUUIDs", batch[uuid], uuid)
+	sample, ok := pm.GetLastSampleByUUID(uuid)
+	if !ok {
+		t.Fatal("Expected a sample for the process")
+	}
+	annotated("GetLastSampleByUUID", sample, uuid)
+
+	// 重启后新的PID对应新的UUID和重启次数
+	restarted, err := pm.RestartProcess(uuid)
+	if err != nil {
+		t.Fatalf("Failed to restart process: %v", err)
+	}
+	snapshot, _ = pm.GetSnapshot(restarted)
+	stats, err = pm.GetProcessStats(snapshot.PID)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.UUID != restarted || stats.RestartCount != 1 {
+		t.Errorf("Expected the stats of the restarted process to carry its new metadata, got %+v", stats)
+	}
+
+	// 非托管进程只有原始统计信息
+	stats, err = pm.GetProcessStats(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.UUID != "" || stats.Labels != nil || stats.RestartCount != 0 {
+		t.Errorf("Expected no manager metadata for an unmanaged PID, got %+v", stats)
+	}
+}
+
+func TestMonitorFollowsEveryStartPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	monitored := func(uuid string) bool {
+		snapshot, _ := pm.GetSnapshot(uuid)
+		_, exists := pm.GetMonitoredProcesses()[snapshot.PID]
+		_, sampled := pm.GetLastSampleByUUID(uuid)
+		return exists && sampled
+	}
+
+	uuid, err := pm.StartProcessWithOptions(types.StartOptions{Name: "sleep", Args: []string{"10"}})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if !monitored(uuid) {
+		t.Error("Expected a process started with StartProcessWithOptions to be monitored")
+	}
+	if _, err := pm.GetProcessStatsByUUID(uuid); err != nil {
+		t.Errorf("Expected stats for a process started with StartProcessWithOptions: %v", err)
+	}
+
+	shell, err := pm.StartShellCommand("sleep 10", false)
+	if err != nil {
+		t.Fatalf("Failed to start shell command: %v", err)
+	}
+	if !monitored(shell) {
+		t.Error("Expected a shell command to be monitored")
+	}
+
+	// 重启后的新进程同样加入监控
+	restarted, err := pm.RestartProcess(uuid)
+	if err != nil {
+		t.Fatalf("Failed to restart process: %v", err)
+	}
+	if !monitored(restarted) {
+		t.Error("Expected the restarted process to be monitored")
+	}
+}
+
+func TestProcessMonitorRetentionCountAndAge(t *testing.T) {
+	collector := &fakeCollector{
+		stats: map[int]types.ProcessStats{100: {CPUPercent: 5}},
+	}
+
+	// Interval 1s: the baseline plus three collections within 3.5s
+	for name, config := range map[string]types.MonitorConfig{
+		"count": {Enabled: true, Interval: time.Second, HistorySize: 2, MaxAge: time.Hour},
+		"age":   {Enabled: true, Interval: time.Second, HistorySize: 100, MaxAge: 1500 * time.Millisecond},
+	} {
+		m := monitor.NewProcessMonitorManagerWithCollector(collector)
+		if err := m.UpdateConfig(config); err != nil {
+			t.Fatalf("%s: failed to update config: %v", name, err)
+		}
+		m.AddProcess(100, "fake")
+		if err := m.Start(); err != nil {
+			t.Fatalf("%s: failed to start monitor: %v", name, err)
+		}
+		time.Sleep(3500 * time.Millisecond)
+		m.Stop()
+
+		history, _ := m.GetProcessHistory(100, 100)
+		if len(history) == 0 || len(history) > 2 {
+			t.Errorf("%s: expected 1 or 2 samples to be kept, got %d", name, len(history))
+			continue
+		}
+		if age := history[len(history)-1].Timestamp.Sub(history[0].Timestamp); age > config.MaxAge {
+			t.Errorf("%s: expected samples within %v, got a spread of %v", name, config.MaxAge, age)
+		}
+	}
+
+	m := monitor.NewProcessMonitorManagerWithCollector(collector)
+	if err := m.UpdateConfig(types.MonitorConfig{Interval: time.Second, HistorySize: 10, MaxAge: -time.Second}); err == nil {
+		t.Error("Expected a negative max age to be rejected")
+	}
+}
+
+func TestClearHistoryKeepsOtherMonitorsBaselines(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("CPU baselines are computed from /proc on Linux")
+	}
+
+	cmd := exec.Command("sh", "-c", "while :; do :; done")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	pid := cmd.Process.Pid
+
+	first := monitor.NewProcessMonitorManager()
+	second := monitor.NewProcessMonitorManager()
+	first.AddProcess(pid, "busy")
+	second.AddProcess(pid, "busy")
+	time.Sleep(300 * time.Millisecond)
+
+	// 清除一个监控器的基准值后，其下一次采集重新建立基准
+	first.ClearHistory()
+	if stats, err := first.GetProcessStats(pid); err != nil || stats.CPUPercent != 0 {
+		t.Errorf("Expected the cleared monitor to start a new baseline, got %+v (%v)", stats, err)
+	}
+
+	// 另一个监控器仍使用自己的基准值
+	if stats, err := second.GetProcessStats(pid); err != nil || stats.CPUPercent <= 0 {
+		t.Errorf("Expected the other monitor to keep its baseline, got %+v (%v)", stats, err)
+	}
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+)
+
+// readPIDFile returns the PID stored in path, or 0 if it does not exist
+func readPIDFile(t *testing.T, path string) int {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatalf("Failed to read PID file: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("Invalid PID file contents %q", data)
+	}
+	return pid
+}
+
+func TestPIDFileTracksLivePID(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	path := filepath.Join(t.TempDir(), "worker.pid")
+	uuid, err := pm.StartProcess("worker", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.SetPIDFile(uuid, path); err != nil {
+		t.Fatalf("Failed to set PID file: %v", err)
+	}
+
+	snapshot, _ := findSnapshot(pm, uuid)
+	if pid := readPIDFile(t, path); pid != snapshot.PID {
+		t.Errorf("Expected PID file to hold %d, got %d", snapshot.PID, pid)
+	}
+
+	// The restarted process rewrites the file with its new PID
+	restarted := crashAndWaitRestart(t, pm, runner, uuid)
+	if pid := readPIDFile(t, path); pid != restarted.PID || pid == snapshot.PID {
+		t.Errorf("Expected PID file to hold the new PID %d, got %d", restarted.PID, pid)
+	}
+
+	if err := pm.StopProcess(restarted.UUID); err != nil {
+		t.Fatalf("Failed to stop process: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected PID file to be removed on stop")
+	}
+}
+
+func TestPIDFileRemovedOnShutdown(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+
+	path := filepath.Join(t.TempDir(), "worker.pid")
+	uuid, err := pm.StartProcess("worker", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.SetPIDFile(uuid, path); err != nil {
+		t.Fatalf("Failed to set PID file: %v", err)
+	}
+
+	pm.Shutdown()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected PID file to be removed on shutdown")
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/dreamsxin/process-manager/manager"
+)
+
+func TestPrometheusLabels(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("metrics test uses sleep")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("sleep", []string{"30"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	err = pm.SetLabels(uuid, map[string]string{
+		"service":  "api",
+		"team-id":  "core",
+		"1st":      "yes",
+		"__secret": "x",
+		"name":     "shadow",
+		"quote":    "say \"hi\"\n",
+	})
+	if err != nil {
+		t.Fatalf("Failed to set labels: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := pm.WritePrometheus(&buf, manager.MetricsOptions{}); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	output := buf.String()
+
+	labels := `{_1st="yes",label_name="shadow",label_secret="x",name="sleep",quote="say \"hi\"\n",service="api",team_id="core",uuid="` + uuid + `"}`
+	for _, line := range []string{
+		"# TYPE pm_process_memory_bytes gauge",
+		"pm_process_up" + labels + " 1",
+		"pm_process_memory_bytes" + labels + " ",
+		"pm_process_restarts_total" + labels + " 0",
+		"# TYPE pm_monitor_collections_total counter",
+		`pm_monitor_processes{monitor="process"} `,
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
+
+func TestPrometheusNameOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("metrics test uses sleep")
+	}
+
+	pm := manager.NewProcessManagerWithMonitor()
+	defer pm.Shutdown()
+
+	for i := 0; i < 2; i++ {
+		uuid, err := pm.StartProcess("sleep", []string{"30"}, false)
+		if err != nil {
+			t.Fatalf("Failed to start process: %v", err)
+		}
+		pm.SetLabels(uuid, map[string]string{"service": "worker"})
+	}
+
+	server := httptest.NewServer(pm.MetricsHandler(manager.MetricsOptions{NameOnly: true}))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	output := string(body)
+
+	if strings.Contains(output, "uuid=") {
+		t.Errorf("Expected no uuid label in name-only mode, got:\n%s", output)
+	}
+	if !strings.Contains(output, `pm_process_up{name="sleep",service="worker"} 2`) {
+		t.Errorf("Expected processes to be aggregated by name, got:\n%s", output)
+	}
+}
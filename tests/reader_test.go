@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+)
+
+var (
+	_ manager.ProcessReader          = (*manager.ProcessManager)(nil)
+	_ manager.ProcessReader          = (*manager.ProcessManagerWithMonitor)(nil)
+	_ manager.MonitoredProcessReader = (*manager.ProcessManagerWithMonitor)(nil)
+)
+
+func TestProcessReaderReturnsCopies(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("worker", []string{"-v"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.SetLabels(uuid, map[string]string{"team": "core"}); err != nil {
+		t.Fatalf("Failed to set labels: %v", err)
+	}
+
+	var reader manager.ProcessReader = pm
+	snapshot, exists := reader.GetSnapshot(uuid)
+	if !exists || snapshot.Name != "worker" || !snapshot.Running {
+		t.Fatalf("Unexpected snapshot: %+v", snapshot)
+	}
+	if _, exists := reader.GetSnapshot("missing"); exists {
+		t.Error("Expected no snapshot for an unknown UUID")
+	}
+	if process, exists := reader.GetProcess(uuid); !exists || process.UUID != uuid {
+		t.Errorf("Expected GetProcess to find the process, got %+v", process)
+	}
+	listed := reader.ListSnapshots()
+	if len(listed) != 1 || listed[0].UUID != uuid {
+		t.Fatalf("Expected ListSnapshots to list the process, got %+v", listed)
+	}
+
+	// Mutating the returned values leaves the manager untouched
+	snapshot.Args[0] = "changed"
+	snapshot.Labels["team"] = "changed"
+	reader.Snapshot()[0].Labels["team"] = "changed"
+	listed[0].Labels["team"] = "changed"
+
+	again, _ := reader.GetSnapshot(uuid)
+	if again.Args[0] != "-v" || again.Labels["team"] != "core" {
+		t.Errorf("Expected records to be unaffected, got args %v labels %v", again.Args, again.Labels)
+	}
+}
+
+func TestListSnapshotsSkipsTerminated(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	if err := pm.SetRetention(time.Minute, 0); err != nil {
+		t.Fatalf("Failed to set retention: %v", err)
+	}
+	done, _ := pm.StartProcess("done", nil, false)
+	live, _ := pm.StartProcess("live", nil, false)
+	runner.Processes()[0].Crash(0)
+	deadline := time.Now().Add(time.Second)
+	for snapshot, _ := pm.GetSnapshot(done); !snapshot.Terminated; snapshot, _ = pm.GetSnapshot(done) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the exited process to be terminated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	listed := pm.ListSnapshots()
+	if len(listed) != 1 || listed[0].UUID != live {
+		t.Errorf("Expected only the live process to be listed, got %+v", listed)
+	}
+	if len(pm.Snapshot()) != 2 {
+		t.Errorf("Expected Snapshot to keep the terminated record, got %d records", len(pm.Snapshot()))
+	}
+}
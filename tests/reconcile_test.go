@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+func TestReconcileMixedChanges(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	runner.SetBehavior("broken", managertest.Behavior{StartErr: errors.New("no such file")})
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	// Processes started outside Reconcile are never touched
+	manual, err := pm.StartProcess("manual", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	result, err := pm.Reconcile([]types.ProcessSpec{
+		{ID: "keep", Name: "keep"},
+		{ID: "tag", Name: "tag"},
+		{ID: "change", Name: "change", Args: []string{"-v1"}},
+		{ID: "remove", Name: "remove"},
+	})
+	if err != nil {
+		t.Fatalf("Initial reconcile failed: %v", err)
+	}
+	if want := []string{"keep", "tag", "change", "remove"}; !slices.Equal(result.Started, want) {
+		t.Fatalf("Expected %v to start, got %+v", want, result)
+	}
+
+	result, err = pm.Reconcile([]types.ProcessSpec{
+		{ID: "keep", Name: "keep"},
+		{ID: "tag", Name: "tag", Labels: map[string]string{"tier": "web"}, Restart: true},
+		{ID: "change", Name: "change", Args: []string{"-v2"}},
+		{ID: "new", Name: "new"},
+		{ID: "broken", Name: "broken"},
+	})
+	if err == nil {
+		t.Error("Expected the failed start to be reported")
+	}
+
+	check := func(bucket string, got, want []string) {
+		t.Helper()
+		if !slices.Equal(got, want) {
+			t.Errorf("Expected %s %v, got %v", bucket, want, got)
+		}
+	}
+	check("started", result.Started, []string{"new"})
+	check("stopped", result.Stopped, []string{"remove"})
+	check("restarted", result.Restarted, []string{"change"})
+	check("unchanged", result.Unchanged, []string{"keep", "tag"})
+	check("failed", result.Failed, []string{"broken"})
+
+	for id, want := range map[string]string{
+		"new":    "new spec",
+		"remove": "removed from specs",
+		"change": "command changed",
+		"keep":   "up to date",
+		"tag":    "labels and restart policy updated",
+		"broken": "failed to start process: no such file",
+	} {
+		if got := result.Reasons[id]; got != want {
+			t.Errorf("Expected reason %q for %s, got %q", want, id, got)
+		}
+	}
+
+	if _, ok := pm.GetSnapshot(manual); !ok {
+		t.Error("Expected the manually started process to be left alone")
+	}
+
+	names := map[string]types.ProcessSnapshot{}
+	for _, snapshot := range pm.Snapshot() {
+		names[snapshot.Name] = snapshot
+	}
+	if _, ok := names["remove"]; ok {
+		t.Error("Expected the removed spec to be stopped")
+	}
+	if got := names["change"].Args; !slices.Equal(got, []string{"-v2"}) {
+		t.Errorf("Expected the changed spec to run with the new args, got %v", got)
+	}
+	if tag := names["tag"]; tag.Labels["tier"] != "web" || !tag.Restart {
+		t.Errorf("Expected labels and restart to be updated in place, got %+v", tag)
+	}
+}
+
+func TestReconcileInvalidSpecs(t *testing.T) {
+	pm := manager.NewProcessManagerWithRunner(managertest.NewFakeRunner())
+	defer pm.Shutdown()
+
+	for _, specs := range [][]types.ProcessSpec{
+		{{Name: "worker"}},
+		{{ID: "a", Name: "worker"}, {ID: "a", Name: "other"}},
+	} {
+		if _, err := pm.Reconcile(specs); err == nil {
+			t.Errorf("Expected an error for %+v", specs)
+		}
+	}
+	if snapshots := pm.Snapshot(); len(snapshots) != 0 {
+		t.Errorf("Expected nothing to start for invalid specs, got %d processes", len(snapshots))
+	}
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+)
+
+func TestRunProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("run test uses sh")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+	ctx := context.Background()
+
+	code, stdout, stderr, err := pm.RunProcess(ctx, "sh", []string{"-c", "echo out; echo err >&2"})
+	if err != nil || code != 0 {
+		t.Fatalf("Expected success, got code %d (%v)", code, err)
+	}
+	if string(stdout) != "out\n" || string(stderr) != "err\n" {
+		t.Errorf("Unexpected output: stdout %q, stderr %q", stdout, stderr)
+	}
+
+	// A non-zero exit is a result, not an error
+	code, _, _, err = pm.RunProcess(ctx, "sh", []string{"-c", "exit 3"})
+	if err != nil || code != 3 {
+		t.Errorf("Expected exit code 3, got %d (%v)", code, err)
+	}
+
+	// Captured output is bounded
+	_, stdout, _, err = pm.RunProcess(ctx, "sh", []string{"-c", "head -c 2000000 /dev/zero"})
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if len(stdout) != manager.RunOutputLimit {
+		t.Errorf("Expected %d bytes of output, got %d", manager.RunOutputLimit, len(stdout))
+	}
+
+	if len(pm.ListAllProcesses()) != 0 {
+		t.Error("Expected RunProcess not to register processes")
+	}
+}
+
+func TestRunProcessTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("run test uses sh")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	code, stdout, _, err := pm.RunProcess(ctx, "sh", []string{"-c", "echo started; sleep 30"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if code != -1 {
+		t.Errorf("Expected exit code -1 for a cancelled run, got %d", code)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the process to be killed promptly, took %v", elapsed)
+	}
+	if string(stdout) != "started\n" {
+		t.Errorf("Expected output captured before cancellation, got %q", stdout)
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/system"
+	"github.com/dreamsxin/process-manager/util"
+)
+
+// writeFakeTool writes an executable shell script named name into dir
+func writeFakeTool(t *testing.T, dir, name, script string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake %s: %v", name, err)
+	}
+}
+
+func TestCheckTools(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses true and false")
+	}
+
+	errs := util.CheckTools([]util.Tool{
+		{Name: "true", Args: []string{}, Purpose: "testing"},
+		{Name: "false", Args: []string{}, Purpose: "a broken tool"},
+		{Name: "pm-no-such-tool", Purpose: "a missing tool"},
+		{Name: "false", Purpose: "a tool that is only looked up"},
+	})
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "false, needed for a broken tool, does not work") {
+		t.Errorf("Unexpected error for the broken tool: %v", errs[0])
+	}
+	if !strings.Contains(errs[1].Error(), "pm-no-such-tool, needed for a missing tool, was not found") {
+		t.Errorf("Unexpected error for the missing tool: %v", errs[1])
+	}
+}
+
+func TestSystemMonitorSelfCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test fakes df with a shell script")
+	}
+
+	sm := system.NewSystemMonitor(t.TempDir())
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+
+	errs := sm.SelfCheck()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "df, needed for disk usage, was not found") {
+		t.Fatalf("Expected a missing df to be reported, got %v", errs)
+	}
+
+	writeFakeTool(t, bin, "df", "exit 1")
+	if errs := sm.SelfCheck(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "does not work") {
+		t.Errorf("Expected a failing df to be reported, got %v", errs)
+	}
+
+	writeFakeTool(t, bin, "df", "exit 0")
+	if errs := sm.SelfCheck(); len(errs) != 0 {
+		t.Errorf("Expected a working df to pass, got %v", errs)
+	}
+}
+
+func TestProcessManagerSelfCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix backends need no external tools")
+	}
+
+	// The Unix manager and process monitor use system calls and /proc only
+	t.Setenv("PATH", t.TempDir())
+	pm := manager.NewProcessManagerWithMonitor(manager.WithSelfCheck())
+	defer pm.Shutdown()
+
+	if errs := pm.SelfCheck(); len(errs) != 0 {
+		t.Errorf("Expected no missing tools, got %v", errs)
+	}
+}
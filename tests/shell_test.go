@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+)
+
+func TestStartShellCommand(t *testing.T) {
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	// The pipeline and && must be interpreted by the shell
+	command := "echo hello | grep -q hello && exit 7"
+	if runtime.GOOS == "windows" {
+		command = "echo hello | findstr hello >nul && exit 7"
+	}
+
+	uuid, err := pm.StartShellCommand(command, false)
+	if err != nil {
+		t.Fatalf("Failed to start shell command: %v", err)
+	}
+
+	code, err := pm.WaitForExit(uuid)
+	if err != nil {
+		t.Fatalf("Failed to wait for shell command: %v", err)
+	}
+	if code != 7 {
+		t.Errorf("Expected exit code 7, got %d", code)
+	}
+
+	snapshot, exists := findSnapshot(pm, uuid)
+	if !exists {
+		t.Fatal("Expected the shell command record to be retained")
+	}
+	if snapshot.Command != command {
+		t.Errorf("Expected recorded command %q, got %q", command, snapshot.Command)
+	}
+
+	if _, err := pm.StartShellCommand("  ", false); err == nil {
+		t.Error("Expected an error for an empty command")
+	}
+}
+
+func TestShellCommandAllowlist(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner, manager.WithAllowedCommands("worker"))
+	defer pm.Shutdown()
+
+	if _, err := pm.StartProcess("worker", nil, false); err != nil {
+		t.Fatalf("Failed to start allowed command: %v", err)
+	}
+	if _, err := pm.StartProcess("other", nil, false); !errors.Is(err, manager.ErrCommandNotAllowed) {
+		t.Errorf("Expected ErrCommandNotAllowed for other, got %v", err)
+	}
+	if _, err := pm.StartShellCommand("worker", false); !errors.Is(err, manager.ErrCommandNotAllowed) {
+		t.Errorf("Expected ErrCommandNotAllowed for a shell command, got %v", err)
+	}
+
+	shell := "sh"
+	if runtime.GOOS == "windows" {
+		shell = "cmd"
+	}
+	allowShell := manager.NewProcessManagerWithRunner(runner, manager.WithAllowedCommands(shell))
+	defer allowShell.Shutdown()
+	if _, err := allowShell.StartShellCommand("worker", false); err != nil {
+		t.Errorf("Expected shell command to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,494 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+func TestProcessStdioCopy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcessWithStdio("cat", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	stdout, err := pm.ProcessStdout(uuid)
+	if err != nil {
+		t.Fatalf("Failed to get stdout: %v", err)
+	}
+	defer stdout.Close()
+	stdin, err := pm.ProcessStdin(uuid)
+	if err != nil {
+		t.Fatalf("Failed to get stdin: %v", err)
+	}
+
+	input := "hello\nworld\n"
+	go func() {
+		io.Copy(stdin, strings.NewReader(input))
+		stdin.Close()
+	}()
+
+	// cat exits after stdin is closed, so ReadAll ends with EOF
+	output, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatalf("Failed to read stdout: %v", err)
+	}
+	if string(output) != input {
+		t.Errorf("Expected %q, got %q", input, output)
+	}
+
+	// The writer must not be usable after the process exits
+	if _, err := stdin.Write([]byte("late")); !errors.Is(err, manager.ErrProcessExited) {
+		t.Errorf("Expected ErrProcessExited, got %v", err)
+	}
+}
+
+func TestProcessStdioPipeline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	first, err := pm.StartProcessWithStdio("cat", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start first process: %v", err)
+	}
+	second, err := pm.StartProcessWithStdio("cat", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start second process: %v", err)
+	}
+
+	firstOut, _ := pm.ProcessStdout(first)
+	defer firstOut.Close()
+	secondIn, _ := pm.ProcessStdin(second)
+	secondOut, _ := pm.ProcessStdout(second)
+	defer secondOut.Close()
+
+	// Bridge the first process's stdout into the second one's stdin
+	go func() {
+		io.Copy(secondIn, firstOut)
+		secondIn.Close()
+	}()
+
+	firstIn, _ := pm.ProcessStdin(first)
+	io.WriteString(firstIn, "piped\n")
+	firstIn.Close()
+
+	done := make(chan []byte)
+	go func() {
+		output, _ := io.ReadAll(secondOut)
+		done <- output
+	}()
+
+	select {
+	case output := <-done:
+		if string(output) != "piped\n" {
+			t.Errorf("Expected %q, got %q", "piped\n", output)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for pipeline output")
+	}
+}
+
+func TestProcessStdioNotEnabled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses sleep")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcess("sleep", []string{"5"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	if _, err := pm.ProcessStdout(uuid); err == nil {
+		t.Error("Expected error for process started without stdio")
+	}
+	if _, err := pm.ProcessStdin("missing"); !errors.Is(err, manager.ErrProcessNotFound) {
+		t.Errorf("Expected ErrProcessNotFound, got %v", err)
+	}
+}
+
+func TestProcessStdoutSubscribers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	if err := pm.SetOutputBacklog(0); err == nil {
+		t.Error("Expected error for empty backlog")
+	}
+	if err := pm.SetOutputBacklog(100); err != nil {
+		t.Fatalf("Failed to set backlog: %v", err)
+	}
+
+	uuid, err := pm.StartProcessWithStdio("cat", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	stdin, _ := pm.ProcessStdin(uuid)
+	fast, _ := pm.ProcessStdout(uuid)
+	defer fast.Close()
+	slow, _ := pm.ProcessStdout(uuid)
+	defer slow.Close()
+
+	// The fast subscriber keeps up with every batch
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(fast)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	for batch := 0; batch < 20; batch++ {
+		for i := 0; i < 50; i++ {
+			fmt.Fprintf(stdin, "line %d\n", batch*50+i+1)
+		}
+		for i := 0; i < 50; i++ {
+			expected := fmt.Sprintf("line %d", batch*50+i+1)
+			select {
+			case line := <-lines:
+				if line != expected {
+					t.Fatalf("Fast subscriber: expected %q, got %q", expected, line)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Fast subscriber timed out waiting for %q", expected)
+			}
+		}
+	}
+
+	// A late subscriber gets the backlog
+	late, _ := pm.ProcessStdout(uuid)
+	defer late.Close()
+	stdin.Close()
+
+	lateOutput, _ := io.ReadAll(late)
+	lateLines := strings.Split(strings.TrimSpace(string(lateOutput)), "\n")
+	if len(lateLines) != 100 || lateLines[0] != "line 901" || lateLines[99] != "line 1000" {
+		t.Errorf("Unexpected backlog: %d lines starting with %q", len(lateLines), lateLines[0])
+	}
+
+	// The slow subscriber never read, so most of its lines were dropped
+	slowOutput, _ := io.ReadAll(slow)
+	slowLines := strings.Split(strings.TrimSpace(string(slowOutput)), "\n")
+	if len(slowLines) != 101 || slowLines[0] != "[900 lines dropped]" || slowLines[1] != "line 901" {
+		t.Errorf("Unexpected slow output: %d lines starting with %q", len(slowLines), slowLines[0])
+	}
+}
+
+// waitForOutput waits until the process has produced n lines of output
+func waitForOutput(t *testing.T, pm *manager.ProcessManager, uuid string, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if raw, _ := pm.ProcessOutputRaw(uuid, 0); len(raw) >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d lines of output", n)
+}
+
+func TestProcessOutputInvalidUTF8(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	uuid, err := pm.StartProcessWithStdio("cat", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	stdin, err := pm.ProcessStdin(uuid)
+	if err != nil {
+		t.Fatalf("Failed to get stdin: %v", err)
+	}
+	defer stdin.Close()
+
+	binary := []byte("ok \xff\xfe\n")
+	stdin.Write(binary)
+	stdin.Write([]byte("plain\r\n"))
+	waitForOutput(t, pm, uuid, 2)
+
+	raw, err := pm.ProcessOutputRaw(uuid, 0)
+	if err != nil || len(raw) != 2 || string(raw[0]) != string(binary) {
+		t.Fatalf("Expected the raw bytes back, got %q, %v", raw, err)
+	}
+
+	lines, err := pm.ProcessOutput(uuid, 0)
+	if err != nil {
+		t.Fatalf("Failed to get output: %v", err)
+	}
+	want := []string{"ok �", "plain"}
+	if len(lines) != 2 || lines[0] != want[0] || lines[1] != want[1] {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+
+	// The sanitized lines survive a JSON round trip unchanged
+	data, err := json.Marshal(map[string][]string{"lines": lines})
+	if err != nil {
+		t.Fatalf("Failed to encode output: %v", err)
+	}
+	var decoded map[string][]string
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode output: %v", err)
+	}
+	if decoded["lines"][0] != lines[0] {
+		t.Errorf("Expected %q after a JSON round trip, got %q", lines[0], decoded["lines"][0])
+	}
+
+	if last, _ := pm.ProcessOutput(uuid, 1); len(last) != 1 || last[0] != "plain" {
+		t.Errorf("Expected only the last line, got %q", last)
+	}
+}
+
+func TestProcessOutputEncoding(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	if err := pm.SetOutputEncoding("no-such-code-page"); err == nil {
+		t.Error("Expected an unknown encoding to be rejected")
+	}
+	if err := pm.SetOutputEncoding("gbk"); err != nil {
+		t.Fatalf("Failed to set output encoding: %v", err)
+	}
+
+	uuid, err := pm.StartProcessWithStdio("cat", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	stdin, err := pm.ProcessStdin(uuid)
+	if err != nil {
+		t.Fatalf("Failed to get stdin: %v", err)
+	}
+	defer stdin.Close()
+
+	// "你好" in GBK, as written by a program using code page 936
+	stdin.Write([]byte("\xc4\xe3\xba\xc3\n"))
+	waitForOutput(t, pm, uuid, 1)
+
+	if lines, err := pm.ProcessOutput(uuid, 0); err != nil || len(lines) != 1 || lines[0] != "你好" {
+		t.Errorf("Expected GBK output to be transcoded, got %q, %v", lines, err)
+	}
+}
+
+func TestStatusPatternFromOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	plain, err := pm.StartProcess("sleep", []string{"30"}, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.SetStatusPattern(plain, `status: (.+)`); err == nil {
+		t.Error("Expected an error for a process without stdio")
+	}
+
+	uuid, err := pm.StartProcessWithStdio("cat", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := pm.SetStatusPattern(uuid, `status: (`); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	if err := pm.SetStatusPattern(uuid, `^status: (.+)$`); err != nil {
+		t.Fatalf("Failed to set status pattern: %v", err)
+	}
+	stdin, err := pm.ProcessStdin(uuid)
+	if err != nil {
+		t.Fatalf("Failed to get stdin: %v", err)
+	}
+	defer stdin.Close()
+
+	appStatus := func() string {
+		snapshot, _ := pm.GetSnapshot(uuid)
+		return snapshot.AppStatus
+	}
+
+	lines := 0
+	feed := func(line string) {
+		t.Helper()
+		stdin.Write([]byte(line + "\n"))
+		lines++
+		waitForOutput(t, pm, uuid, lines)
+	}
+
+	feed("booting")
+	if status := appStatus(); status != "" {
+		t.Errorf("Expected no status before a match, got %q", status)
+	}
+	feed("status: waiting for DB")
+	if status := appStatus(); status != "waiting for DB" {
+		t.Errorf("Expected status %q, got %q", "waiting for DB", status)
+	}
+	feed("status: ready")
+	if status := appStatus(); status != "ready" {
+		t.Errorf("Expected status %q, got %q", "ready", status)
+	}
+
+	// Only the first 1 KiB of a long line is matched
+	feed("status: " + strings.Repeat("x", 2048))
+	if status := appStatus(); len(status) != 1024-len("status: ") {
+		t.Errorf("Expected the match to be bounded to 1 KiB of the line, got %d bytes", len(status))
+	}
+
+	if err := pm.SetStatusPattern(uuid, ""); err != nil {
+		t.Fatalf("Failed to remove status pattern: %v", err)
+	}
+	if status := appStatus(); status != "" {
+		t.Errorf("Expected removing the pattern to clear the status, got %q", status)
+	}
+}
+
+// startLimitedCat starts cat with stdio bounded by limit, writes input to it
+// and waits until the last buffered line satisfies done
+func startLimitedCat(t *testing.T, pm *manager.ProcessManager, limit types.OutputLimit, input string, done func(last string) bool) string {
+	t.Helper()
+	uuid, err := pm.StartProcessWithOptions(types.StartOptions{Name: "cat", Stdio: true, Output: limit})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	stdin, err := pm.ProcessStdin(uuid)
+	if err != nil {
+		t.Fatalf("Failed to get stdin: %v", err)
+	}
+	t.Cleanup(func() { stdin.Close() })
+
+	io.WriteString(stdin, input)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if last, _ := pm.ProcessOutput(uuid, 1); len(last) == 1 && done(last[0]) {
+			return uuid
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for output")
+	return ""
+}
+
+func TestOutputLimitLines(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	for name, limit := range map[string]types.OutputLimit{
+		"negative lines":   {Lines: -1},
+		"negative bytes":   {Bytes: -1},
+		"tiny byte budget": {Bytes: manager.MinOutputBytes - 1},
+	} {
+		if _, err := pm.StartProcessWithOptions(types.StartOptions{Name: "cat", Stdio: true, Output: limit}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := pm.StartProcessWithOptions(types.StartOptions{Name: "cat", Output: types.OutputLimit{Lines: 5}}); err == nil {
+		t.Error("Expected an output limit without stdio to be rejected")
+	}
+
+	// Short lines hit the line limit long before the byte limit
+	var input strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&input, "line %d\n", i)
+	}
+	uuid := startLimitedCat(t, pm, types.OutputLimit{Lines: 5, Bytes: 4096}, input.String(),
+		func(last string) bool { return last == "line 19" })
+
+	lines, err := pm.ProcessOutput(uuid, 0)
+	if err != nil {
+		t.Fatalf("Failed to get output: %v", err)
+	}
+	want := []string{"line 15", "line 16", "line 17", "line 18", "line 19"}
+	if strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+}
+
+func TestOutputLimitBytes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	// 100-byte lines hit a 512 byte limit before the line limit
+	line := strings.Repeat("x", 99) + "\n"
+	uuid := startLimitedCat(t, pm, types.OutputLimit{Lines: 100, Bytes: 512}, strings.Repeat(line, 20)+"done\n",
+		func(last string) bool { return last == "done" })
+
+	raw, err := pm.ProcessOutputRaw(uuid, 0)
+	if err != nil {
+		t.Fatalf("Failed to get output: %v", err)
+	}
+	size := 0
+	for _, l := range raw {
+		size += len(l)
+	}
+	if size > 512 {
+		t.Errorf("Expected at most 512 bytes of output, got %d", size)
+	}
+	if len(raw) != 6 || string(raw[0]) != line || strings.TrimSpace(string(raw[5])) != "done" {
+		t.Errorf("Expected the last 5 full lines and the sentinel, got %q", raw)
+	}
+}
+
+func TestOutputLimitOverlongLine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdio test uses cat")
+	}
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	// The cut line fills the whole budget, so it is the only line left
+	uuid := startLimitedCat(t, pm, types.OutputLimit{Bytes: 512}, "short\n"+strings.Repeat("y", 2000)+"\n",
+		func(last string) bool { return strings.HasSuffix(last, "[truncated]") })
+
+	raw, err := pm.ProcessOutputRaw(uuid, 0)
+	if err != nil {
+		t.Fatalf("Failed to get output: %v", err)
+	}
+	if len(raw) != 1 {
+		t.Fatalf("Expected only the truncated line, got %q", raw)
+	}
+	if len(raw[0]) > 512 || !strings.HasPrefix(string(raw[0]), "yyyy") || !strings.HasSuffix(string(raw[0]), "[truncated]\n") {
+		t.Errorf("Expected the long line cut to 512 bytes with a marker, got %d bytes ending in %q", len(raw[0]), raw[0][max(len(raw[0])-20, 0):])
+	}
+}
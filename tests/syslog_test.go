@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+// readSyslog collects datagrams from conn until want messages arrive or the
+// timeout expires
+func readSyslog(conn net.PacketConn, want int, timeout time.Duration) []string {
+	var messages []string
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for len(messages) < want {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		messages = append(messages, string(buf[:n]))
+	}
+	return messages
+}
+
+func TestProcessLogToSyslog(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("syslog is not available on Windows")
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	_, err = pm.StartProcessWithLog("sh", []string{"-c", "echo hello; echo oops >&2"}, false, types.LogConfig{
+		LogTo:    types.LogToSyslog,
+		Tag:      "worker",
+		Facility: "local0",
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	messages := readSyslog(conn, 2, 3*time.Second)
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 syslog messages, got %q", messages)
+	}
+
+	// local0 is facility 16: info is <134>, err is <131>
+	var stdout, stderr bool
+	for _, m := range messages {
+		if !strings.Contains(m, "worker[") {
+			t.Errorf("Expected tag in message %q", m)
+		}
+		stdout = stdout || strings.HasPrefix(m, "<134>") && strings.HasSuffix(m, "hello\n")
+		stderr = stderr || strings.HasPrefix(m, "<131>") && strings.HasSuffix(m, "oops\n")
+	}
+	if !stdout || !stderr {
+		t.Errorf("Expected stdout at info and stderr at err, got %q", messages)
+	}
+}
+
+func TestProcessLogReconnects(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("syslog is not available on Windows")
+	}
+
+	// Nothing listens on the socket yet, so the first line is dropped
+	path := filepath.Join(t.TempDir(), "syslog.sock")
+
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	_, err := pm.StartProcessWithLog("sh", []string{"-c", "echo first; sleep 1.5; echo second"}, false, types.LogConfig{
+		LogTo:   types.LogToSyslog,
+		Network: "unixgram",
+		Address: path,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start process even though syslog is down: %v", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	messages := readSyslog(conn, 1, 3*time.Second)
+	if len(messages) != 1 || !strings.HasSuffix(messages[0], "second\n") {
+		t.Errorf("Expected only the line logged after syslog came up, got %q", messages)
+	}
+}
+
+func TestProcessLogConfigValidation(t *testing.T) {
+	pm := manager.NewProcessManager()
+	defer pm.Shutdown()
+
+	for _, config := range []types.LogConfig{
+		{LogTo: "file"},
+		{LogTo: types.LogToSyslog, Facility: "nope"},
+		{LogTo: types.LogToSyslog, StderrSeverity: "loud"},
+		{LogTo: types.LogToSyslog, Network: "udp"},
+	} {
+		if _, err := pm.StartProcessWithLog("true", nil, false, config); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,788 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/system"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+func writeHistoryFile(t *testing.T, dir string, content interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		t.Fatalf("Failed to marshal history: %v", err)
+	}
+
+	path := filepath.Join(dir, "system_stats.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+	return path
+}
+
+func TestLoadUnversionedHistory(t *testing.T) {
+	dir := t.TempDir()
+
+	// Files written before versioning have no version field
+	writeHistoryFile(t, dir, map[string]interface{}{
+		"stats": []types.SystemStats{
+			{Timestamp: time.Now().Add(-time.Minute), CPUPercent: 10},
+			{Timestamp: time.Now(), CPUPercent: 20},
+		},
+	})
+
+	sm := system.NewSystemMonitor(dir)
+	history := sm.GetHistory(0)
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 history entries, got %d", len(history))
+	}
+	if history[1].CPUPercent != 20 {
+		t.Errorf("Expected CPU 20, got %.2f", history[1].CPUPercent)
+	}
+}
+
+func TestLoadUnsupportedHistoryVersion(t *testing.T) {
+	dir := t.TempDir()
+
+	path := writeHistoryFile(t, dir, types.SystemStatsHistory{
+		Version: types.SchemaVersion + 1,
+		Stats:   []types.SystemStats{{Timestamp: time.Now(), CPUPercent: 10}},
+	})
+
+	sm := system.NewSystemMonitor(dir)
+	if history := sm.GetHistory(0); len(history) != 0 {
+		t.Errorf("Expected unsupported history to be rejected, got %d entries", len(history))
+	}
+
+	// The unknown file is kept aside instead of being overwritten
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected unsupported history file to be moved")
+	}
+	matches, _ := filepath.Glob(path + ".v*.bak")
+	if len(matches) != 1 {
+		t.Errorf("Expected 1 backup file, got %d", len(matches))
+	}
+}
+
+func TestCompactDropsExpiredHistory(t *testing.T) {
+	dir := t.TempDir()
+
+	path := writeHistoryFile(t, dir, types.SystemStatsHistory{
+		Version: types.SchemaVersion,
+		Stats: []types.SystemStats{
+			{Timestamp: time.Now().AddDate(0, 0, -3), CPUPercent: 10},
+			{Timestamp: time.Now(), CPUPercent: 20},
+		},
+	})
+
+	sm := system.NewSystemMonitor(dir)
+	if history := sm.GetHistory(0); len(history) != 2 {
+		t.Fatalf("Expected 2 history entries, got %d", len(history))
+	}
+
+	// Shorten retention so the older entry expires at runtime
+	config := sm.GetConfig()
+	config.RetentionDays = 1
+	if err := sm.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	sm.Compact()
+
+	history := sm.GetHistory(0)
+	if len(history) != 1 {
+		t.Fatalf("Expected 1 history entry after compaction, got %d", len(history))
+	}
+	if history[0].CPUPercent != 20 {
+		t.Errorf("Expected remaining entry CPU 20, got %.2f", history[0].CPUPercent)
+	}
+
+	// The compacted history is persisted
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read history file: %v", err)
+	}
+	var saved types.SystemStatsHistory
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed to parse history file: %v", err)
+	}
+	if len(saved.Stats) != 1 {
+		t.Errorf("Expected 1 persisted entry, got %d", len(saved.Stats))
+	}
+}
+
+func TestSystemMonitorConfigValidation(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+
+	config := sm.GetConfig()
+	config.RetentionDays = 30
+	if err := sm.UpdateConfig(config); err != nil {
+		t.Errorf("Expected RetentionDays to be accepted, got %v", err)
+	}
+
+	config = sm.GetConfig()
+	config.HistorySize = 5
+	if err := sm.UpdateConfig(config); err == nil {
+		t.Error("Expected history size below 10 to be rejected")
+	}
+
+	config = sm.GetConfig()
+	config.RetentionDays = -1
+	if err := sm.UpdateConfig(config); err == nil {
+		t.Error("Expected negative retention days to be rejected")
+	}
+
+	config = sm.GetConfig()
+	config.AlertThresholds.CPU = 150
+	if err := sm.UpdateConfig(config); err == nil {
+		t.Error("Expected CPU threshold above 100 to be rejected")
+	}
+
+	config = sm.GetConfig()
+	config.CPUAverageSamples = -1
+	if err := sm.UpdateConfig(config); err == nil {
+		t.Error("Expected negative CPU average samples to be rejected")
+	}
+
+	config = sm.GetConfig()
+	config.CPUEMAAlpha = 1.5
+	if err := sm.UpdateConfig(config); err == nil {
+		t.Error("Expected a CPU EMA alpha above 1 to be rejected")
+	}
+}
+
+func TestSystemMonitorSetAlertThreshold(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+	before := sm.GetConfig()
+
+	if err := sm.SetAlertThreshold("cpu", 50); err != nil {
+		t.Fatalf("Failed to set CPU threshold: %v", err)
+	}
+
+	after := sm.GetConfig()
+	if after.AlertThresholds.CPU != 50 {
+		t.Errorf("Expected CPU threshold 50, got %v", after.AlertThresholds.CPU)
+	}
+	after.AlertThresholds.CPU = before.AlertThresholds.CPU
+	if after != before {
+		t.Errorf("Expected other fields unchanged, got %+v (was %+v)", after, before)
+	}
+
+	if err := sm.SetAlertThreshold("disk", 101); err == nil {
+		t.Error("Expected disk threshold above 100 to be rejected")
+	}
+	if err := sm.SetAlertThreshold("swap", 50); err == nil {
+		t.Error("Expected unknown metric to be rejected")
+	}
+	if sm.GetConfig().AlertThresholds.Disk != before.AlertThresholds.Disk {
+		t.Error("Expected rejected update to leave the disk threshold unchanged")
+	}
+}
+
+func TestSystemMonitorCollectsOnStart(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+	if err := sm.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer sm.Stop()
+
+	// The first sample must not wait for a full interval
+	deadline := time.Now().Add(sm.GetConfig().Interval / 2)
+	for len(sm.GetHistory(0)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a sample promptly after Start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSystemMonitorTimingMetrics(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+	config := sm.GetConfig()
+	config.Interval = time.Second
+	if err := sm.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	if err := sm.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer sm.Stop()
+
+	// The collection on start plus one scheduled by the ticker
+	deadline := time.Now().Add(5 * time.Second)
+	for sm.MonitorHealth().Collections < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	health := sm.MonitorHealth()
+	if health.Collections < 2 {
+		t.Fatalf("Expected at least 2 collections, got %d", health.Collections)
+	}
+	if health.TimeToFirstSample <= 0 || health.TimeToFirstSample >= config.Interval {
+		t.Errorf("Expected the first sample well within an interval of Start, got %v", health.TimeToFirstSample)
+	}
+	if health.TotalJitter <= 0 || health.MaxJitter < health.LastJitter || health.MaxJitter >= config.Interval {
+		t.Errorf("Expected jitter of the scheduled collection to be recorded, got %+v", health)
+	}
+	if health.AverageJitter != health.TotalJitter/time.Duration(health.Collections) {
+		t.Errorf("Expected average jitter over all collections, got %v", health.AverageJitter)
+	}
+}
+
+func TestSystemMonitorStartContext(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := sm.StartContext(ctx); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	if !sm.NextCollection().IsZero() {
+		t.Error("Expected monitor to stop after context cancel")
+	}
+	if err := sm.Stop(); err == nil {
+		t.Error("Expected Stop after cancel to report not running")
+	}
+}
+
+func TestSystemMonitorStaleContextKeepsRestartedMonitor(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := sm.StartContext(ctx); err != nil {
+			t.Fatalf("Failed to start monitor: %v", err)
+		}
+		if err := sm.Stop(); err != nil {
+			t.Fatalf("Failed to stop monitor: %v", err)
+		}
+
+		// The context of the stopped run is cancelled after the restart
+		if err := sm.Start(); err != nil {
+			t.Fatalf("Failed to restart monitor: %v", err)
+		}
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+
+		if sm.NextCollection().IsZero() {
+			t.Fatalf("Iteration %d: expected the restarted monitor to keep running", i)
+		}
+		if err := sm.Stop(); err != nil {
+			t.Fatalf("Failed to stop monitor: %v", err)
+		}
+	}
+}
+
+func TestSystemMonitorClearHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := writeHistoryFile(t, dir, types.SystemStatsHistory{
+		Version: types.SchemaVersion,
+		Stats: []types.SystemStats{
+			{Timestamp: time.Now().Add(-time.Minute), CPUPercent: 10},
+			{Timestamp: time.Now(), CPUPercent: 20},
+		},
+	})
+
+	sm := system.NewSystemMonitor(dir)
+	if history := sm.GetHistory(0); len(history) != 2 {
+		t.Fatalf("Expected 2 history entries, got %d", len(history))
+	}
+
+	if err := sm.ClearHistory(true); err != nil {
+		t.Fatalf("Failed to clear history: %v", err)
+	}
+	if history := sm.GetHistory(0); len(history) != 0 {
+		t.Errorf("Expected empty history after clear, got %d entries", len(history))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected history file to be removed")
+	}
+
+	// Sampling starts over after the clear
+	if err := sm.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer sm.Stop()
+	deadline := time.Now().Add(time.Second)
+	for len(sm.GetHistory(0)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected sampling to work after clearing history")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSystemStatsChangedFrom(t *testing.T) {
+	prev := types.SystemStats{CPUPercent: 20, MemoryPercent: 50, DiskPercent: 70}
+
+	flat := types.SystemStats{CPUPercent: 21, MemoryPercent: 49.5, DiskPercent: 70}
+	if flat.ChangedFrom(prev, 2) {
+		t.Error("Expected changes within the dead band to be ignored")
+	}
+
+	spike := types.SystemStats{CPUPercent: 35, MemoryPercent: 50, DiskPercent: 70}
+	if !spike.ChangedFrom(prev, 2) {
+		t.Error("Expected a CPU change beyond the dead band to be detected")
+	}
+}
+
+func TestSystemMonitorDeadBand(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+	config := sm.GetConfig()
+	config.Interval = time.Second
+	config.DeadBand = -1
+	if err := sm.UpdateConfig(config); err == nil {
+		t.Error("Expected a negative dead band to be rejected")
+	}
+
+	// No metric moves by more than 100 points, so only the first sample is kept
+	config.DeadBand = 100
+	config.MaxGap = time.Hour
+	if err := sm.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	// The same dead band with a short max gap still records regularly
+	gapped := system.NewSystemMonitor(t.TempDir())
+	config.MaxGap = 500 * time.Millisecond
+	if err := gapped.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	for _, m := range []*system.SystemMonitor{sm, gapped} {
+		if err := m.Start(); err != nil {
+			t.Fatalf("Failed to start monitor: %v", err)
+		}
+		defer m.Stop()
+	}
+	time.Sleep(3500 * time.Millisecond)
+
+	if history := sm.GetHistory(0); len(history) != 1 {
+		t.Errorf("Expected a flat system to produce 1 sample, got %d", len(history))
+	}
+	if history := gapped.GetHistory(0); len(history) < 3 {
+		t.Errorf("Expected the max gap to force at least 3 samples, got %d", len(history))
+	}
+	if health := sm.MonitorHealth(); health.Collections < 3 {
+		t.Errorf("Expected collections to continue inside the dead band, got %d", health.Collections)
+	}
+}
+
+func TestSystemStatsNormalizeLoad(t *testing.T) {
+	stats := types.SystemStats{Load1: 4.8, NumCPU: 4}
+	stats.NormalizeLoad()
+	if math.Abs(stats.LoadPerCPU-1.2) > 1e-9 {
+		t.Errorf("Expected load per CPU 1.2, got %v", stats.LoadPerCPU)
+	}
+
+	unknown := types.SystemStats{Load1: 2}
+	unknown.NormalizeLoad()
+	if unknown.LoadPerCPU != 0 {
+		t.Errorf("Expected 0 load per CPU without a CPU count, got %v", unknown.LoadPerCPU)
+	}
+
+	sm := system.NewSystemMonitor(t.TempDir())
+	current, err := sm.GetCurrentStats()
+	if err != nil {
+		t.Fatalf("Failed to get current stats: %v", err)
+	}
+	if current.NumCPU != runtime.NumCPU() {
+		t.Errorf("Expected NumCPU %d, got %d", runtime.NumCPU(), current.NumCPU)
+	}
+}
+
+func TestSystemStatsCPUEMAStep(t *testing.T) {
+	// A step from 0% to 100% CPU: raw jumps at once, the EMA closes the gap by alpha each sample
+	const alpha = 0.5
+	var prev *types.SystemStats
+	var ema []float64
+	for i := 0; i < 6; i++ {
+		stats := types.SystemStats{}
+		if i >= 2 {
+			stats.CPUPercent = 100
+		}
+		stats.ApplyCPUEMA(prev, alpha)
+		ema = append(ema, stats.CPUPercentEMA)
+		prev = &stats
+	}
+
+	want := []float64{0, 0, 50, 75, 87.5, 93.75}
+	for i := range want {
+		if math.Abs(ema[i]-want[i]) > 1e-9 {
+			t.Errorf("Sample %d: expected EMA %v, got %v", i, want[i], ema[i])
+		}
+	}
+
+	// Without an alpha the EMA follows the raw value
+	raw := types.SystemStats{CPUPercent: 100}
+	raw.ApplyCPUEMA(&types.SystemStats{CPUPercentEMA: 0}, 0)
+	if raw.CPUPercentEMA != 100 {
+		t.Errorf("Expected an unsmoothed EMA of 100, got %v", raw.CPUPercentEMA)
+	}
+
+	dir := t.TempDir()
+	now := time.Now()
+	writeHistoryFile(t, dir, types.SystemStatsHistory{
+		Version: types.SchemaVersion,
+		Stats: []types.SystemStats{
+			{Timestamp: now.Add(-time.Minute), CPUPercent: 0, CPUPercentEMA: 0},
+			{Timestamp: now, CPUPercent: 100, CPUPercentEMA: 50},
+		},
+	})
+
+	chart, err := system.NewSystemMonitor(dir).GetChartData(10, "cpu_ema")
+	if err != nil {
+		t.Fatalf("Failed to get chart data: %v", err)
+	}
+	if len(chart.Datasets) != 1 || len(chart.Datasets[0].Data) != 2 || chart.Datasets[0].Data[1] != 50 {
+		t.Errorf("Expected the EMA series in the cpu_ema chart, got %+v", chart.Datasets)
+	}
+}
+
+func TestSystemMonitorStopStart(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+
+	config := sm.GetConfig()
+	config.Interval = time.Second
+	if err := sm.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	if err := sm.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if err := sm.Stop(); err != nil {
+		t.Fatalf("Failed to stop monitor: %v", err)
+	}
+
+	before := len(sm.GetHistory(0))
+	if before == 0 {
+		t.Fatal("Expected samples before stopping")
+	}
+
+	// Sampling resumes after a restart
+	if err := sm.Start(); err != nil {
+		t.Fatalf("Failed to restart monitor: %v", err)
+	}
+	defer sm.Stop()
+	time.Sleep(1500 * time.Millisecond)
+
+	if after := len(sm.GetHistory(0)); after <= before {
+		t.Errorf("Expected sampling to resume after restart, history %d -> %d", before, after)
+	}
+
+	// Health counters accumulate across restarts
+	if health := sm.MonitorHealth(); health.Collections < 2 || health.LastCollection.IsZero() {
+		t.Errorf("Expected collections from both runs, got %+v", health)
+	}
+}
+
+func TestSeriesMatchesChartData(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+	writeHistoryFile(t, dir, types.SystemStatsHistory{
+		Version: types.SchemaVersion,
+		Stats: []types.SystemStats{
+			{Timestamp: now.Add(-2 * time.Minute), CPUPercent: 10, Load1: 0.5, Load5: 0.4, Load15: 0.3},
+			{Timestamp: now.Add(-time.Minute), CPUPercent: 20, Load1: 1.5, Load5: 1.4, Load15: 1.3},
+			{Timestamp: now, CPUPercent: 30, Load1: 2.5, Load5: 2.4, Load15: 2.3},
+		},
+	})
+
+	sm := system.NewSystemMonitor(dir)
+
+	if _, err := sm.GetSeries(10, []string{"bogus"}); err == nil {
+		t.Error("Expected error for unknown metric")
+	}
+
+	series, err := sm.GetSeries(10, []string{"cpu", "load1", "load5", "load15"})
+	if err != nil {
+		t.Fatalf("Failed to get series: %v", err)
+	}
+	if len(series) != 4 || series[0].Name != "cpu" {
+		t.Fatalf("Unexpected series: %+v", series)
+	}
+	if len(series[0].Points) != 3 || !series[0].Points[2].T.Equal(now) || series[0].Points[2].V != 30 {
+		t.Errorf("Unexpected CPU points: %+v", series[0].Points)
+	}
+
+	chart, err := sm.GetChartData(10, "load")
+	if err != nil {
+		t.Fatalf("Failed to get chart data: %v", err)
+	}
+	if len(chart.Datasets) != 3 {
+		t.Fatalf("Expected 3 load datasets, got %d", len(chart.Datasets))
+	}
+	for i, dataset := range chart.Datasets {
+		points := series[i+1].Points
+		if len(dataset.Data) != len(points) {
+			t.Fatalf("Dataset %s has %d values, series has %d", dataset.Label, len(dataset.Data), len(points))
+		}
+		for j, point := range points {
+			if dataset.Data[j] != point.V {
+				t.Errorf("Dataset %s value %d: chart %v, series %v", dataset.Label, j, dataset.Data[j], point.V)
+			}
+			if chart.Labels[j] != point.T.Format("15:04:05") {
+				t.Errorf("Label %d: chart %s, series %v", j, chart.Labels[j], point.T)
+			}
+		}
+	}
+
+	if _, err := sm.GetChartData(10, "bogus"); err == nil {
+		t.Error("Expected error for unknown chart metric")
+	}
+}
+
+func TestSystemDiskUsageMatchesDF(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	output, err := exec.Command("df", "-k", "-P", "/").Output()
+	if err != nil {
+		t.Skipf("df is not available: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 5 {
+		t.Fatalf("Unexpected df output: %q", output)
+	}
+	totalKB, _ := strconv.ParseUint(fields[1], 10, 64)
+	usedKB, _ := strconv.ParseUint(fields[2], 10, 64)
+
+	sm := system.NewSystemMonitor(t.TempDir())
+	stats, err := sm.GetCurrentStats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	// 两次读取之间已用空间可能略有变化
+	within := func(got, want uint64, tolerance float64) bool {
+		return math.Abs(float64(got)-float64(want)) <= float64(want)*tolerance
+	}
+	if !within(stats.DiskTotal, totalKB*1024, 0.01) {
+		t.Errorf("Expected disk total near %d bytes, got %d", totalKB*1024, stats.DiskTotal)
+	}
+	if !within(stats.DiskUsed, usedKB*1024, 0.05) {
+		t.Errorf("Expected disk used near %d bytes, got %d", usedKB*1024, stats.DiskUsed)
+	}
+}
+
+func TestSystemDiskUsages(t *testing.T) {
+	sm := system.NewSystemMonitor(t.TempDir())
+
+	usages, err := sm.GetDiskUsages()
+	if err != nil {
+		t.Fatalf("Failed to get disk usages: %v", err)
+	}
+	excluded := make(map[string]bool)
+	for _, fstype := range sm.DiskExcludedFSTypes() {
+		excluded[fstype] = true
+	}
+	for _, usage := range usages {
+		if excluded[usage.FSType] {
+			t.Errorf("Expected %s filesystems to be excluded, got %+v", usage.FSType, usage)
+		}
+		if usage.Total == 0 || usage.Used > usage.Total || usage.Percent < 0 || usage.Percent > 100 {
+			t.Errorf("Unexpected disk usage: %+v", usage)
+		}
+	}
+}
+
+func TestGetSystemStatsRate(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	first := types.SystemStats{
+		Timestamp:   start,
+		NetRxBytes:  1000,
+		NetTxBytes:  500,
+		DiskReads:   10,
+		DiskWrites:  20,
+		CtxSwitches: 5000,
+	}
+	second := types.SystemStats{
+		Timestamp:   start.Add(10 * time.Second),
+		NetRxBytes:  21000,
+		NetTxBytes:  1500,
+		DiskReads:   60,
+		DiskWrites:  20,
+		CtxSwitches: 15000,
+	}
+
+	dir := t.TempDir()
+	writeHistoryFile(t, dir, types.SystemStatsHistory{
+		Version: types.SchemaVersion,
+		Stats:   []types.SystemStats{first, second},
+	})
+	rates, err := system.NewSystemMonitor(dir).GetSystemStatsRate()
+	if err != nil {
+		t.Fatalf("Failed to get rates: %v", err)
+	}
+	if rates.Interval != 10*time.Second {
+		t.Errorf("Expected a 10s interval, got %v", rates.Interval)
+	}
+	for name, got := range map[string][2]float64{
+		"net rx":       {rates.NetRxBytesPerSec, 2000},
+		"net tx":       {rates.NetTxBytesPerSec, 100},
+		"disk reads":   {rates.DiskReadsPerSec, 5},
+		"disk writes":  {rates.DiskWritesPerSec, 0},
+		"ctx switches": {rates.CtxSwitchesPerSec, 1000},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("Expected %s rate %.1f/s, got %.1f/s", name, got[1], got[0])
+		}
+	}
+
+	// Counters that went backwards after a reboot give a zero rate
+	rebooted := second
+	rebooted.Timestamp = second.Timestamp.Add(10 * time.Second)
+	rebooted.NetRxBytes = 100
+	rebooted.CtxSwitches = 25000
+	rates = rebooted.RatesSince(second)
+	if rates.NetRxBytesPerSec != 0 {
+		t.Errorf("Expected a reset counter to give rate 0, got %.1f", rates.NetRxBytesPerSec)
+	}
+	if rates.CtxSwitchesPerSec != 1000 {
+		t.Errorf("Expected other counters to be unaffected, got %.1f", rates.CtxSwitchesPerSec)
+	}
+
+	if _, err := system.NewSystemMonitor(t.TempDir()).GetSystemStatsRate(); err == nil {
+		t.Error("Expected an error without two samples")
+	}
+}
+
+func TestSystemMonitorRetentionCountAndAge(t *testing.T) {
+	now := time.Now()
+
+	// Twelve recent samples: HistorySize is the binding limit
+	dir := t.TempDir()
+	var recent []types.SystemStats
+	for i := 12; i > 0; i-- {
+		recent = append(recent, types.SystemStats{Timestamp: now.Add(-time.Duration(i) * time.Minute), CPUPercent: float64(i)})
+	}
+	writeHistoryFile(t, dir, types.SystemStatsHistory{Version: types.SchemaVersion, Stats: recent})
+
+	sm := system.NewSystemMonitor(dir)
+	config := sm.GetConfig()
+	config.HistorySize = 10
+	config.MaxAge = time.Hour
+	if err := sm.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if history := sm.GetHistory(0); len(history) != 10 || history[0].CPUPercent != 10 {
+		t.Fatalf("Expected the newest 10 samples, got %d", len(history))
+	}
+
+	// A sample about to expire: MaxAge is the binding limit once it has
+	// passed, without a reload or Compact
+	dir = t.TempDir()
+	writeHistoryFile(t, dir, types.SystemStatsHistory{
+		Version: types.SchemaVersion,
+		Stats: []types.SystemStats{
+			{Timestamp: now.Add(-2 * time.Hour), CPUPercent: 1},
+			{Timestamp: now.Add(-time.Hour + 1500*time.Millisecond), CPUPercent: 2},
+			{Timestamp: now.Add(-time.Minute), CPUPercent: 3},
+		},
+	})
+
+	sm = system.NewSystemMonitor(dir)
+	config = sm.GetConfig()
+	config.HistorySize = 100
+	config.MaxAge = time.Hour
+	if err := sm.UpdateConfig(config); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if history := sm.GetHistory(0); len(history) != 2 || history[0].CPUPercent != 2 {
+		t.Fatalf("Expected the 2 samples within the hour, got %d", len(history))
+	}
+
+	time.Sleep(2 * time.Second)
+	if err := sm.Start(); err != nil {
+		t.Fatalf("Failed to start monitor: %v", err)
+	}
+	defer sm.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	history := sm.GetHistory(0)
+	if len(history) != 2 || history[0].CPUPercent != 3 {
+		t.Errorf("Expected the expired sample to be dropped when the next one is recorded, got %d samples", len(history))
+	}
+
+	config.MaxAge = -time.Second
+	if err := sm.UpdateConfig(config); err == nil {
+		t.Error("Expected a negative max age to be rejected")
+	}
+}
+
+func TestSystemMonitorGetHistoryPage(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	var stats []types.SystemStats
+	for i := range 25 {
+		stats = append(stats, types.SystemStats{Timestamp: now.Add(time.Duration(i-25) * time.Minute), CPUPercent: float64(i)})
+	}
+	writeHistoryFile(t, dir, types.SystemStatsHistory{Version: types.SchemaVersion, Stats: stats})
+	sm := system.NewSystemMonitor(dir)
+
+	// cpu returns the CPU values of a page, which equal the sample indexes
+	cpu := func(page []types.SystemStats) []int {
+		var values []int
+		for _, s := range page {
+			values = append(values, int(s.CPUPercent))
+		}
+		return values
+	}
+
+	for _, tc := range []struct {
+		offset, limit int
+		want          string
+	}{
+		{0, 10, "[15 16 17 18 19 20 21 22 23 24]"}, // newest page
+		{10, 10, "[5 6 7 8 9 10 11 12 13 14]"},
+		{20, 10, "[0 1 2 3 4]"}, // partial oldest page
+		{24, 1, "[0]"},
+		{0, 100, fmt.Sprint(cpu(stats))}, // limit beyond the total
+		{-5, 3, "[22 23 24]"},            // negative offset counts as 0
+		{25, 10, "[]"},                   // offset at the total
+		{100, 10, "[]"},
+		{0, 0, "[]"},
+		{0, -1, "[]"},
+	} {
+		page, total := sm.GetHistoryPage(tc.offset, tc.limit)
+		if total != 25 {
+			t.Errorf("offset %d, limit %d: expected total 25, got %d", tc.offset, tc.limit, total)
+		}
+		if got := fmt.Sprint(cpu(page)); got != tc.want {
+			t.Errorf("offset %d, limit %d: expected %s, got %s", tc.offset, tc.limit, tc.want, got)
+		}
+		if page == nil {
+			t.Errorf("offset %d, limit %d: expected an empty page rather than nil", tc.offset, tc.limit)
+		}
+	}
+
+	// Pages are copies of the history
+	page, _ := sm.GetHistoryPage(0, 1)
+	page[0].CPUPercent = -1
+	if latest := sm.GetHistory(1); latest[0].CPUPercent != 24 {
+		t.Error("Expected the page not to alias the history")
+	}
+}
@@ -0,0 +1,34 @@
+// trapsignal is a helper process for the kill timeout tests. It writes the
+// ready file once its signal handler is installed, and on SIGTERM (Unix) or
+// CTRL_BREAK (Windows) it spends -cleanup before writing the done file.
+// With -ignore it ignores the termination request entirely.
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	ready := flag.String("ready", "", "file created once signals are trapped")
+	done := flag.String("done", "", "file created after cleanup")
+	cleanup := flag.Duration("cleanup", 300*time.Millisecond, "time spent cleaning up")
+	ignore := flag.Bool("ignore", false, "ignore termination requests")
+	flag.Parse()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	os.WriteFile(*ready, nil, 0644)
+
+	for range signals {
+		if *ignore {
+			continue
+		}
+		time.Sleep(*cleanup)
+		os.WriteFile(*done, nil, 0644)
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/process-manager/manager"
+	"github.com/dreamsxin/process-manager/manager/managertest"
+	"github.com/dreamsxin/process-manager/types"
+)
+
+func TestWatchProcessReload(t *testing.T) {
+	runner := managertest.NewFakeRunner()
+	pm := manager.NewProcessManagerWithRunner(runner)
+	defer pm.Shutdown()
+
+	config := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(config, []byte("v1"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	uuid, err := pm.StartProcess("app", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	err = pm.WatchProcess(uuid, types.WatchConfig{
+		Paths:    []string{config},
+		Interval: 20 * time.Millisecond,
+		Debounce: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to watch process: %v", err)
+	}
+
+	// Simulate an atomic write: remove, then recreate a moment later
+	os.Remove(config)
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(config, []byte("version 2"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite config: %v", err)
+	}
+	time.Sleep(400 * time.Millisecond)
+
+	process, exists := pm.GetProcess(uuid)
+	if !exists {
+		t.Fatal("Expected process to keep its UUID after reload")
+	}
+	if process.RestartCount != 1 {
+		t.Errorf("Expected exactly one reload, got %d", process.RestartCount)
+	}
+	if len(runner.Processes()) != 2 || !runner.Last().Running() {
+		t.Error("Expected the reloaded fake process to be running")
+	}
+
+	// Disabling the watch stops further reloads
+	if err := pm.UnwatchProcess(uuid); err != nil {
+		t.Fatalf("Failed to unwatch process: %v", err)
+	}
+	if err := os.WriteFile(config, []byte("version three"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite config: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	if len(runner.Processes()) != 2 {
+		t.Errorf("Expected no reload after unwatch, got %d runs", len(runner.Processes()))
+	}
+}
@@ -9,25 +9,180 @@ type ProcessStats struct {
 	PID           int       `json:"pid"`
 	Name          string    `json:"name"`
 	CPUPercent    float64   `json:"cpu_percent"`
+	CPUPercentAvg float64   `json:"cpu_percent_avg"` // 最近CPUAverageSamples个采样的CPU平均值
 	MemoryPercent float64   `json:"memory_percent"`
 	MemoryBytes   uint64    `json:"memory_bytes"`
+	MemoryPSS     uint64    `json:"memory_pss,omitempty"` // 按比例分摊共享内存，需开启DetailedMemory
+	MemoryUSS     uint64    `json:"memory_uss,omitempty"` // 进程独占内存，需开启DetailedMemory
 	CreateTime    time.Time `json:"create_time"`
 	Timestamp     time.Time `json:"timestamp"`
+
+	// 托管进程的管理器元数据，由ProcessManagerWithMonitor.GetProcessStats填充，非托管进程为空
+	UUID         string            `json:"uuid,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	RestartCount int               `json:"restart_count,omitempty"`
+}
+
+// ProcessDetail 进程详情，一次返回进程记录、最近一次采样和最近的历史数据
+type ProcessDetail struct {
+	Process ProcessSnapshot `json:"process"`
+	Uptime  time.Duration   `json:"uptime"`  // 运行时长，已退出的进程为最后一次运行的时长
+	Stats   *ProcessStats   `json:"stats"`   // 最近一次采样，尚无采样或进程未运行时为nil
+	History []ProcessStats  `json:"history"` // 最近的历史采样，按时间顺序排列
+}
+
+// HistoryPoint 对齐到固定时间网格的历史采样点，Stats为nil表示该时间段内没有采样
+type HistoryPoint struct {
+	Time  time.Time     `json:"time"`
+	Stats *ProcessStats `json:"stats"` // 缺失时序列化为null
 }
 
 // MonitorConfig 监控配置
+//
+// 系统监控器(system.SystemMonitor)支持除DetailedMemory外的全部字段；进程监控器
+// (monitor.ProcessMonitorManager)只支持Enabled、Interval、HistorySize、MaxAge、
+// DetailedMemory和CPUAverageSamples，设置不支持的字段会被UpdateConfig拒绝。
+//
+// 两种监控器都在每次记录样本和更新配置时同时按HistorySize和MaxAge裁剪历史：
+// 最多保留HistorySize个样本，并丢弃早于MaxAge的样本，以更严格者为准。
 type MonitorConfig struct {
-	Enabled         bool          `json:"enabled"`
-	Interval        time.Duration `json:"interval"`
-	HistorySize     int           `json:"history_size"`
-	RetentionDays   int           `json:"retention_days"`
-	AlertThresholds struct {
+	Enabled           bool          `json:"enabled"`
+	Interval          time.Duration `json:"interval"`
+	HistorySize       int           `json:"history_size"`                  // 系统监控器至少10，进程监控器至少1
+	MaxAge            time.Duration `json:"max_age,omitempty"`             // 样本最长保留时间，0表示不按时间裁剪
+	RetentionDays     int           `json:"retention_days"`                // 仅系统监控器，与MaxAge同时设置时取较短者
+	DetailedMemory    bool          `json:"detailed_memory,omitempty"`     // 仅进程监控器，额外读取smaps获取PSS/USS，开销较大
+	CPUAverageSamples int           `json:"cpu_average_samples,omitempty"` // 计算CPUPercentAvg的采样数，0或1表示不平滑
+	DeadBand          float64       `json:"dead_band,omitempty"`           // 仅系统监控器，CPU/内存/磁盘使用率变化超过该值(百分点)才记录新样本，0表示每次都记录
+	MaxGap            time.Duration `json:"max_gap,omitempty"`             // 仅系统监控器，启用DeadBand时两个样本的最大间隔，0表示默认10分钟
+	CPUEMAAlpha       float64       `json:"cpu_ema_alpha,omitempty"`       // 仅系统监控器，CPUPercentEMA的平滑系数，取值(0,1]，越大越跟随新样本，0或1表示不平滑
+	AlertThresholds   struct {      // 仅系统监控器
 		CPU    float64 `json:"cpu"`
 		Memory float64 `json:"memory"`
 		Disk   float64 `json:"disk"`
 	} `json:"alert_thresholds"`
 }
 
+// MonitorHealth 监控器自身的运行指标
+type MonitorHealth struct {
+	Collections        int64         `json:"collections"`         // 已完成的采集轮数
+	Failures           int64         `json:"failures"`            // 采集失败的轮数
+	Skipped            int64         `json:"skipped"`             // 因采集耗时超过间隔而错过的轮数
+	TotalDuration      time.Duration `json:"total_duration"`      // 累计采集耗时
+	AverageDuration    time.Duration `json:"average_duration"`    // 平均每轮采集耗时
+	LastDuration       time.Duration `json:"last_duration"`       // 最近一轮采集耗时
+	LastCollection     time.Time     `json:"last_collection"`     // 最近一轮采集完成的时间
+	MonitoredProcesses int           `json:"monitored_processes"` // 当前监控的进程数，系统监控器为0
+	NameScans          int64         `json:"name_scans"`          // 按名称查找时扫描进程列表的次数，系统监控器为0
+	Goroutines         int64         `json:"goroutines"`          // 进程管理器当前持有的后台协程数，仅ProcessManagerWithMonitor填写
+	OpenPipes          int64         `json:"open_pipes"`          // 进程管理器当前持有的stdio管道和日志输出数，仅ProcessManagerWithMonitor填写
+
+	// 抖动持续偏高说明主机过载或采集间隔过短
+	LastJitter        time.Duration `json:"last_jitter"`          // 最近一轮实际采集时间偏离计划时间的绝对值
+	MaxJitter         time.Duration `json:"max_jitter"`           // 最大采集抖动
+	TotalJitter       time.Duration `json:"total_jitter"`         // 累计采集抖动
+	AverageJitter     time.Duration `json:"average_jitter"`       // 平均每轮采集抖动
+	TimeToFirstSample time.Duration `json:"time_to_first_sample"` // 最近一次启动到第一轮采集完成的时间
+	AddToFirstSample  time.Duration `json:"add_to_first_sample"`  // 最近一次添加进程到取得其基准样本的时间，系统监控器为0
+}
+
+// Record 记录一轮耗时为d的采集，耗时超过interval时按错过的tick数累加Skipped
+func (h *MonitorHealth) Record(d, interval time.Duration, failed bool) {
+	h.Collections++
+	if failed {
+		h.Failures++
+	}
+	if interval > 0 && d > interval {
+		h.Skipped += int64(d / interval)
+	}
+	h.TotalDuration += d
+	h.AverageDuration = h.TotalDuration / time.Duration(h.Collections)
+	h.LastDuration = d
+	h.LastCollection = time.Now()
+}
+
+// RecordJitter 记录一轮采集的抖动，即实际采集时间与计划时间之差，需在Record之后调用
+func (h *MonitorHealth) RecordJitter(jitter time.Duration) {
+	if jitter < 0 {
+		jitter = -jitter
+	}
+	h.LastJitter = jitter
+	if jitter > h.MaxJitter {
+		h.MaxJitter = jitter
+	}
+	h.TotalJitter += jitter
+	if h.Collections > 0 {
+		h.AverageJitter = h.TotalJitter / time.Duration(h.Collections)
+	}
+}
+
+// StatsSortKey 按名称查询统计信息时结果的排序方式
+type StatsSortKey string
+
+const (
+	SortByPID    StatsSortKey = ""       // 按PID升序
+	SortByCPU    StatsSortKey = "cpu"    // 按CPU使用率降序
+	SortByMemory StatsSortKey = "memory" // 按内存使用量降序
+)
+
+// NameQueryOptions 按名称查询统计信息的选项
+type NameQueryOptions struct {
+	Limit  int          `json:"limit"`   // 最多返回的进程数，<=0时不限制
+	SortBy StatsSortKey `json:"sort_by"` // 排序方式，默认按PID
+}
+
+// MonitoredProcess 被监控进程的元数据
+type MonitoredProcess struct {
+	PID        int       `json:"pid"`
+	Name       string    `json:"name"`
+	Discovered bool      `json:"discovered"` // 通过名称模式自动发现，而非AddProcess添加
+	FirstSeen  time.Time `json:"first_seen"` // 加入监控的时间
+	LastSeen   time.Time `json:"last_seen"`  // 最近一次确认进程存活(采集成功或出现在进程列表中)的时间
+}
+
+// IdleConfig 进程空闲自动停止配置
+type IdleConfig struct {
+	CPUThreshold   float64       `json:"cpu_threshold"`   // CPU使用率低于该值视为空闲
+	Duration       time.Duration `json:"duration"`        // 持续空闲多久后停止
+	KeepDefinition bool          `json:"keep_definition"` // 停止后保留进程定义以便按需重启
+}
+
+// UsageBaseline 进程的预期资源使用，字段为0表示不检查该项
+type UsageBaseline struct {
+	CPUPercent  float64 `json:"cpu_percent"`  // 预期CPU使用率
+	MemoryBytes uint64  `json:"memory_bytes"` // 预期内存占用
+	Deviation   float64 `json:"deviation"`    // 允许偏离预期值的百分比，如200表示实际值超过预期3倍时告警
+}
+
+// DeviationAlert 进程资源使用偏离预期时产生的告警
+type DeviationAlert struct {
+	PID       int       `json:"pid"`
+	Name      string    `json:"name"`
+	Metric    string    `json:"metric"` // "cpu"或"memory"
+	Expected  float64   `json:"expected"`
+	Actual    float64   `json:"actual"`
+	Deviation float64   `json:"deviation"` // 实际偏离的百分比
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
+
+// BudgetPolicy 超出资源预算时的处理策略
+type BudgetPolicy string
+
+const (
+	BudgetPolicyLog  BudgetPolicy = "log"  // 只记录日志
+	BudgetPolicyStop BudgetPolicy = "stop" // 停止优先级最低的进程
+	BudgetPolicyNice BudgetPolicy = "nice" // 降低优先级最低的进程的调度优先级
+)
+
+// ResourceBudget 所有托管进程的资源总预算，字段为0表示不限制该项
+type ResourceBudget struct {
+	CPUPercent  float64       `json:"cpu_percent"`
+	MemoryBytes uint64        `json:"memory_bytes"`
+	Policy      BudgetPolicy  `json:"policy"`
+	Interval    time.Duration `json:"interval"` // 检查间隔，0表示使用监控采集间隔
+}
+
 // ProcessMonitor 进程监控器
 type ProcessMonitor struct {
 	StatsHistory map[int][]ProcessStats `json:"stats_history"`
@@ -35,3 +190,13 @@ type ProcessMonitor struct {
 	Running      bool                   `json:"running"`
 	stopChan     chan struct{}
 }
+
+// GroupStats 进程组的资源使用汇总
+type GroupStats struct {
+	Name        string         `json:"name"`
+	Members     int            `json:"members"`      // 组内进程数
+	Running     int            `json:"running"`      // 正在运行的进程数
+	CPUPercent  float64        `json:"cpu_percent"`  // 运行中进程的CPU使用率之和
+	MemoryBytes uint64         `json:"memory_bytes"` // 运行中进程的内存占用之和
+	Processes   []ProcessStats `json:"processes"`    // 各运行中进程的统计
+}
@@ -1,13 +1,18 @@
 package types
 
 import (
+	"math"
 	"time"
 )
 
 // SystemStats 系统资源使用统计
 type SystemStats struct {
 	Timestamp     time.Time `json:"timestamp"`
+	Host          string    `json:"host,omitempty"` // 采样主机的标识，见SystemMonitor.SetHost
 	CPUPercent    float64   `json:"cpu_percent"`
+	CPUPercentAvg float64   `json:"cpu_percent_avg"`     // 最近CPUAverageSamples个采样的CPU平均值
+	CPUPercentEMA float64   `json:"cpu_percent_ema"`     // 按CPUEMAAlpha计算的CPU指数移动平均值
+	CPULimit      float64   `json:"cpu_limit,omitempty"` // 容器CPU限制(核数)，未限制时为0
 	MemoryPercent float64   `json:"memory_percent"`
 	MemoryUsed    uint64    `json:"memory_used"`
 	MemoryTotal   uint64    `json:"memory_total"`
@@ -17,14 +22,116 @@ type SystemStats struct {
 	Load1         float64   `json:"load_1,omitempty"`
 	Load5         float64   `json:"load_5,omitempty"`
 	Load15        float64   `json:"load_15,omitempty"`
+	NumCPU        int       `json:"num_cpu"`                // 可用的CPU核数
+	LoadPerCPU    float64   `json:"load_per_cpu,omitempty"` // Load1/NumCPU，1表示满负荷
+	Temperature   float64   `json:"temperature,omitempty"`  // CPU温度(摄氏度)，不可用时为0
+
+	// 开机以来的累计计数器，不可用时为0，速率见RatesSince
+	NetRxBytes  uint64 `json:"net_rx_bytes,omitempty"` // 除回环接口外接收的字节数
+	NetTxBytes  uint64 `json:"net_tx_bytes,omitempty"` // 除回环接口外发送的字节数
+	DiskReads   uint64 `json:"disk_reads,omitempty"`   // 完成的磁盘读次数，不含分区重复计数
+	DiskWrites  uint64 `json:"disk_writes,omitempty"`  // 完成的磁盘写次数
+	CtxSwitches uint64 `json:"ctx_switches,omitempty"` // 上下文切换次数
+}
+
+// SystemRates 两个样本之间累计计数器的每秒速率，见SystemMonitor.GetSystemStatsRate
+type SystemRates struct {
+	From              time.Time     `json:"from"`
+	To                time.Time     `json:"to"`
+	Interval          time.Duration `json:"interval"`
+	NetRxBytesPerSec  float64       `json:"net_rx_bytes_per_sec"`
+	NetTxBytesPerSec  float64       `json:"net_tx_bytes_per_sec"`
+	DiskReadsPerSec   float64       `json:"disk_reads_per_sec"`
+	DiskWritesPerSec  float64       `json:"disk_writes_per_sec"`
+	CtxSwitchesPerSec float64       `json:"ctx_switches_per_sec"`
+}
+
+// RatesSince 计算从prev到当前样本的每秒速率。计数器回退(如主机重启)时
+// 对应速率取0；两个样本时间相同或顺序颠倒时所有速率为0
+func (s SystemStats) RatesSince(prev SystemStats) SystemRates {
+	rates := SystemRates{
+		From:     prev.Timestamp,
+		To:       s.Timestamp,
+		Interval: s.Timestamp.Sub(prev.Timestamp),
+	}
+	if rates.Interval <= 0 {
+		return rates
+	}
+
+	seconds := rates.Interval.Seconds()
+	rate := func(current, previous uint64) float64 {
+		if current < previous {
+			return 0
+		}
+		return float64(current-previous) / seconds
+	}
+	rates.NetRxBytesPerSec = rate(s.NetRxBytes, prev.NetRxBytes)
+	rates.NetTxBytesPerSec = rate(s.NetTxBytes, prev.NetTxBytes)
+	rates.DiskReadsPerSec = rate(s.DiskReads, prev.DiskReads)
+	rates.DiskWritesPerSec = rate(s.DiskWrites, prev.DiskWrites)
+	rates.CtxSwitchesPerSec = rate(s.CtxSwitches, prev.CtxSwitches)
+	return rates
+}
+
+// DiskUsage 一个挂载点的磁盘使用情况，见SystemMonitor.GetDiskUsages
+type DiskUsage struct {
+	MountPoint string  `json:"mount_point"`
+	Device     string  `json:"device,omitempty"`
+	FSType     string  `json:"fs_type,omitempty"`
+	Used       uint64  `json:"used"`
+	Total      uint64  `json:"total"`
+	Percent    float64 `json:"percent"`
+}
+
+// NormalizeLoad 按CPU核数计算LoadPerCPU，NumCPU未知时为0
+func (s *SystemStats) NormalizeLoad() {
+	if s.NumCPU <= 0 {
+		s.LoadPerCPU = 0
+		return
+	}
+	s.LoadPerCPU = s.Load1 / float64(s.NumCPU)
 }
 
+// ApplyCPUEMA 由上一个样本prev的指数移动平均值递推CPUPercentEMA：
+// EMA = alpha*CPUPercent + (1-alpha)*prev.CPUPercentEMA。
+// prev为nil(第一个样本)或alpha不在(0,1)内时取当前CPUPercent
+func (s *SystemStats) ApplyCPUEMA(prev *SystemStats, alpha float64) {
+	if prev == nil || alpha <= 0 || alpha >= 1 {
+		s.CPUPercentEMA = s.CPUPercent
+		return
+	}
+	s.CPUPercentEMA = alpha*s.CPUPercent + (1-alpha)*prev.CPUPercentEMA
+}
+
+// ChangedFrom 判断CPU、内存或磁盘使用率相对prev的变化是否超过delta(百分点)
+func (s SystemStats) ChangedFrom(prev SystemStats, delta float64) bool {
+	return math.Abs(s.CPUPercent-prev.CPUPercent) > delta ||
+		math.Abs(s.MemoryPercent-prev.MemoryPercent) > delta ||
+		math.Abs(s.DiskPercent-prev.DiskPercent) > delta
+}
+
+// SchemaVersion 当前持久化历史文件的格式版本，缺少版本号的旧文件视为版本0
+const SchemaVersion = 1
+
 // SystemStatsHistory 系统统计历史记录
 type SystemStatsHistory struct {
-	Stats []SystemStats `json:"stats"`
+	Version int           `json:"version"`
+	Stats   []SystemStats `json:"stats"`
+}
+
+// Point 时间序列中的一个数据点
+type Point struct {
+	T time.Time `json:"t"`
+	V float64   `json:"v"`
+}
+
+// Series 与前端库无关的时间序列
+type Series struct {
+	Name   string  `json:"name"`
+	Points []Point `json:"points"`
 }
 
-// ChartData 图表数据
+// ChartData 图表数据(Chart.js格式)
 type ChartData struct {
 	Labels   []string  `json:"labels"`
 	Datasets []Dataset `json:"datasets"`
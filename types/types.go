@@ -1,22 +1,265 @@
 package types
 
 import (
+	"fmt"
+	"os"
 	"os/exec"
+	"regexp"
 	"time"
 )
 
+// Process is a handle to a single run of a managed process
+type Process interface {
+	// Start starts the process
+	Start() error
+	// Wait blocks until the process exits; it may be called more than once
+	Wait() error
+	// Terminate asks the process and its children to exit gracefully
+	Terminate() error
+	// Kill terminates the process and its children
+	Kill() error
+	// Pid returns the process ID
+	Pid() int
+	// ExitCode returns the exit code once the process has exited, or -1
+	ExitCode() int
+}
+
+// ExitCodeRange is an inclusive range of exit codes
+type ExitCodeRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Contains reports whether code lies in the range
+func (r ExitCodeRange) Contains(code int) bool {
+	return code >= r.Min && code <= r.Max
+}
+
+// ExitCodePolicy narrows which exit codes auto-restart a process that has
+// Restart enabled. NoRestart takes precedence over Restart; an empty Restart
+// list allows every code not in NoRestart.
+type ExitCodePolicy struct {
+	Restart   []ExitCodeRange `json:"restart,omitempty"`    // codes that trigger a restart
+	NoRestart []ExitCodeRange `json:"no_restart,omitempty"` // codes that never trigger a restart
+}
+
+// ShouldRestart reports whether a process that exited with code should be
+// restarted under the policy
+func (p ExitCodePolicy) ShouldRestart(code int) bool {
+	for _, r := range p.NoRestart {
+		if r.Contains(code) {
+			return false
+		}
+	}
+	if len(p.Restart) == 0 {
+		return true
+	}
+	for _, r := range p.Restart {
+		if r.Contains(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// RestartBudget limits how often a process is auto-restarted: at most Max
+// restarts within any rolling Window. The zero value sets no limit.
+type RestartBudget struct {
+	Max    int           `json:"max"`
+	Window time.Duration `json:"window"`
+}
+
+// RestartPolicy decides whether a process is restarted when it exits
+type RestartPolicy struct {
+	Restart   bool           `json:"restart"`              // restart the process when it exits
+	ExitCodes ExitCodePolicy `json:"exit_codes,omitempty"` // narrows the exit codes that restart it
+	Budget    RestartBudget  `json:"budget,omitempty"`     // holds off restarts beyond a rate
+}
+
+// StartOptions configures a process started with
+// ProcessManager.StartProcessWithOptions. Everything except Labels, Priority
+// and DependsOn is kept for restarts and reloads; those three are kept too but
+// can be changed later through their setters.
+type StartOptions struct {
+	Name      string            // command to run, required
+	Args      []string          // command arguments
+	Env       []string          // KEY=value entries added to the manager's environment
+	Dir       string            // working directory, defaults to the manager's
+	Umask     *os.FileMode      // file mode creation mask on Unix, nil inherits the manager's
+	Policy    RestartPolicy     // whether the process is restarted when it exits
+	Labels    map[string]string // user-defined tags, see ProcessManager.SetLabels
+	Priority  int               // see ProcessManager.SetPriority
+	DependsOn []string          // UUIDs of managed processes this process depends on
+	Stdio     bool              // wire stdin/stdout to the manager, see ProcessManager.StartProcessWithStdio
+	Output    OutputLimit       // bounds the stdout kept with Stdio
+	Log       *LogConfig        // forward stdout/stderr to the host log, see ProcessManager.StartProcessWithLog
+	Listeners []*os.File        // inherited listening sockets, see ProcessManager.StartProcessWithListeners
+}
+
+// StartResult describes a process as it was started, see
+// ProcessManager.StartProcessWithResult
+type StartResult struct {
+	UUID      string    `json:"uuid"`
+	PID       int       `json:"pid"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// OutputLimit bounds the stdout kept for a process started with stdio.
+// Whichever limit is hit first drops the oldest lines; a single line longer
+// than Bytes is cut short with a "[truncated]" marker.
+type OutputLimit struct {
+	Lines int // lines kept, 0 uses ProcessManager.OutputBacklog
+	Bytes int // bytes kept, 0 for no byte limit
+}
+
 // ProcessInfo contains information about a managed process
 type ProcessInfo struct {
 	UUID         string
-	Cmd          *exec.Cmd
+	Process      Process
+	Cmd          *exec.Cmd // set when the process is backed by exec.Cmd
 	Name         string
 	Args         []string
+	Command      string       // original command string for processes started through the shell
+	Env          []string     // environment the process was started with, nil if unknown
+	ExtraEnv     []string     // StartOptions.Env, added to the environment on every restart
+	Dir          string       // working directory, empty for the manager's
+	Umask        *os.FileMode // StartOptions.Umask, applied on every restart
+	PIDFile      string       // file kept up to date with the PID, see ProcessManager.SetPIDFile
+	Listeners    []*os.File
+	Stdio        bool        // stdin/stdout are wired to the manager
+	Output       OutputLimit // bounds the stdout kept with Stdio
+	Log          *LogConfig  // stdout/stderr are forwarded to the host log
 	PID          int
 	Running      bool
 	Restart      bool
+	ExitCodes    ExitCodePolicy // exit codes that allow or forbid an auto-restart
+	Budget       RestartBudget  // rate limit of auto-restarts
+	RestartTimes []time.Time    // auto-restarts within the budget window, oldest first
+	Held         bool           // auto-restart held back until the budget allows it
+	IdleStopped  bool
+	Stopped      bool              // stopped with its group, kept for StartGroup
+	Replaced     bool              // killed by RestartProcess, a new record takes over
+	Terminated   bool              // exited without restart, kept by the retention policy
+	DependsOn    []string          // UUIDs of processes this process depends on
+	Priority     int               // lower priorities are stopped first when over a resource budget
+	Labels       map[string]string // user-defined tags, exported as metric labels
+	Readiness    ReadinessCheck    // reports when a started process is ready, see ProcessManager.SetReadinessCheck
+	Health       *HealthCheck      // periodic health check, see ProcessManager.SetHealthCheck
+	StatusRegexp *regexp.Regexp    // extracts AppStatus from output, see ProcessManager.SetStatusPattern
+	AppStatus    string            // status last reported by the process in its output
 	StartTime    time.Time
 	EndTime      time.Time
-	RestartCount int
+	RestartCount int // reset after a stable run, see ProcessManager.SetStableDuration
+
+	// Restart diagnostics, carried over across restarts
+	LastRestartTime time.Time
+	LastExitCode    int
+	LastError       string
+	TotalRestarts   int // lifetime restart count, never reset
+}
+
+// RestartPlan describes what ProcessManager.RestartProcess would do to a
+// process at the time it was planned
+type RestartPlan struct {
+	UUID             string        `json:"uuid"`
+	Name             string        `json:"name"`
+	Running          bool          `json:"running"`           // the current run is stopped first
+	Overlap          bool          `json:"overlap"`           // the new run starts before the old one has stopped
+	NewUUID          bool          `json:"new_uuid"`          // the restarted process gets a new UUID
+	Signals          []string      `json:"signals,omitempty"` // stop sequence, empty for custom runners
+	KillTimeout      time.Duration `json:"kill_timeout"`      // grace period before the forced kill
+	ExpectedDowntime time.Duration `json:"expected_downtime"` // upper bound of the gap between the runs
+
+	// Auto-restart state; RestartProcess itself is never delayed or held
+	AutoRestart      bool          `json:"auto_restart"`            // the process is restarted when it exits
+	AutoRestartDelay time.Duration `json:"auto_restart_delay"`      // shortest wait before an auto-restart
+	RestartBudget    int           `json:"restart_budget"`          // auto-restarts left, -1 without a budget
+	Backoff          bool          `json:"backoff"`                 // the next auto-restart would be held
+	BackoffUntil     time.Time     `json:"backoff_until,omitempty"` // when the budget allows a restart again
+}
+
+// ReadinessCheck reports whether a running process is ready to do work. It
+// returns nil once the process is ready and an error describing why not
+// otherwise.
+type ReadinessCheck func(snapshot ProcessSnapshot) error
+
+// HealthCheck periodically checks a running process, see
+// ProcessManager.SetHealthCheck
+type HealthCheck struct {
+	Check            ReadinessCheck // returns nil while the process is healthy
+	Interval         time.Duration  // time between checks, defaults to 10s
+	FailureThreshold int            // consecutive failures before the process is unhealthy, defaults to 3
+
+	// RestartOnUnhealthy restarts an unhealthy process in place, keeping its
+	// UUID. It is independent of Restart, which only applies when the
+	// process exits.
+	RestartOnUnhealthy bool
+}
+
+// ProcessSnapshot is an immutable copy of the display fields of a ProcessInfo
+type ProcessSnapshot struct {
+	UUID            string            `json:"uuid"`
+	Name            string            `json:"name"`
+	Args            []string          `json:"args"`
+	Command         string            `json:"command,omitempty"`
+	PID             int               `json:"pid"`
+	Status          string            `json:"status"`
+	AppStatus       string            `json:"app_status,omitempty"` // status extracted from output, see ProcessManager.SetStatusPattern
+	Running         bool              `json:"running"`
+	Restart         bool              `json:"restart"`
+	IdleStopped     bool              `json:"idle_stopped"`
+	Terminated      bool              `json:"terminated"`
+	Stdio           bool              `json:"stdio"`
+	DependsOn       []string          `json:"depends_on,omitempty"`
+	Priority        int               `json:"priority"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	StartTime       time.Time         `json:"start_time"`
+	EndTime         time.Time         `json:"end_time"`
+	Uptime          time.Duration     `json:"uptime"`
+	RestartCount    int               `json:"restart_count"`
+	TotalRestarts   int               `json:"total_restarts"`
+	RestartBudget   int               `json:"restart_budget"` // auto-restarts left in the budget window, -1 without a budget
+	LastRestartTime time.Time         `json:"last_restart_time"`
+	LastExitCode    int               `json:"last_exit_code"`
+	LastError       string            `json:"last_error,omitempty"`
+}
+
+// Snapshot copies the display fields of the process. The caller must hold
+// the lock guarding the record.
+func (p *ProcessInfo) Snapshot() ProcessSnapshot {
+	snapshot := ProcessSnapshot{
+		UUID:            p.UUID,
+		Name:            p.Name,
+		Args:            append([]string(nil), p.Args...),
+		Command:         p.Command,
+		PID:             p.PID,
+		Status:          p.Status(),
+		AppStatus:       p.AppStatus,
+		Running:         p.Running,
+		Restart:         p.Restart,
+		IdleStopped:     p.IdleStopped,
+		Terminated:      p.Terminated,
+		Stdio:           p.Stdio,
+		DependsOn:       append([]string(nil), p.DependsOn...),
+		Priority:        p.Priority,
+		StartTime:       p.StartTime,
+		EndTime:         p.EndTime,
+		Uptime:          p.Uptime(),
+		RestartCount:    p.RestartCount,
+		TotalRestarts:   p.TotalRestarts,
+		RestartBudget:   p.RestartBudgetRemaining(time.Now()),
+		LastRestartTime: p.LastRestartTime,
+		LastExitCode:    p.LastExitCode,
+		LastError:       p.LastError,
+	}
+
+	if p.Labels != nil {
+		snapshot.Labels = make(map[string]string, len(p.Labels))
+		for k, v := range p.Labels {
+			snapshot.Labels[k] = v
+		}
+	}
+	return snapshot
 }
 
 // Status returns the current status of the process as a string
@@ -24,9 +267,36 @@ func (p *ProcessInfo) Status() string {
 	if p.Running {
 		return "running"
 	}
+	if p.Held {
+		return "held"
+	}
+	if p.IdleStopped {
+		return "idle"
+	}
+	if p.Terminated {
+		if p.LastExitCode == 0 && p.LastError == "" {
+			return "exited"
+		}
+		return "failed"
+	}
 	return "stopped"
 }
 
+// RestartBudgetRemaining returns how many auto-restarts the budget still
+// allows at now, or -1 when the process has no budget
+func (p *ProcessInfo) RestartBudgetRemaining(now time.Time) int {
+	if p.Budget.Max <= 0 {
+		return -1
+	}
+	used := 0
+	for _, t := range p.RestartTimes {
+		if now.Sub(t) < p.Budget.Window {
+			used++
+		}
+	}
+	return max(p.Budget.Max-used, 0)
+}
+
 // Uptime returns the duration the process has been running
 func (p *ProcessInfo) Uptime() time.Duration {
 	if p.Running {
@@ -42,3 +312,108 @@ func (p *ProcessInfo) Uptime() time.Duration {
 func (p *ProcessInfo) IsActive() bool {
 	return p.Running
 }
+
+// LogToSyslog forwards output to syslog on Unix and the Event Log on Windows
+const LogToSyslog = "syslog"
+
+// LogConfig forwards the stdout and stderr of a process to the host log,
+// one entry per line
+type LogConfig struct {
+	LogTo          string // destination, currently only LogToSyslog
+	Tag            string // syslog tag or event source, defaults to the base name of the command
+	Facility       string // syslog facility such as "daemon" or "local0", defaults to "user"; unused on Windows
+	StdoutSeverity string // severity of stdout lines such as "info" or "notice", defaults to "info"
+	StderrSeverity string // severity of stderr lines, defaults to "err"
+	Network        string // "udp", "tcp" or "unixgram" for a remote or non-default syslog; empty uses the local daemon
+	Address        string // address for Network
+}
+
+// AuditAction identifies an operator-initiated action on a process
+type AuditAction string
+
+const (
+	AuditStart   AuditAction = "start"
+	AuditStop    AuditAction = "stop"
+	AuditRestart AuditAction = "restart"
+	AuditKill    AuditAction = "kill"   // forced stop by StopAll or an expired graceful stop
+	AuditForget  AuditAction = "forget" // record dropped by ForgetProcess
+)
+
+// AuditRecord describes one operator-initiated action for an audit trail
+type AuditRecord struct {
+	Time    time.Time         `json:"time"`
+	Action  AuditAction       `json:"action"`
+	UUID    string            `json:"uuid,omitempty"`     // empty when a start failed before an id was assigned
+	NewUUID string            `json:"new_uuid,omitempty"` // set by a successful restart
+	Name    string            `json:"name,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Command string            `json:"command,omitempty"` // shell command string, if any
+	Labels  map[string]string `json:"labels,omitempty"`
+	Error   string            `json:"error,omitempty"` // empty when the action succeeded
+	Actor   string            `json:"actor,omitempty"` // who performed the action, see manager.WithActor
+}
+
+// EventType identifies a lifecycle event in the manager's event log
+type EventType string
+
+const (
+	EventStart     EventType = "start"
+	EventExit      EventType = "exit"
+	EventRestart   EventType = "restart" // RestartProcess or an auto-restart
+	EventReload    EventType = "reload"  // in-place restart after a file change
+	EventStop      EventType = "stop"
+	EventHeld      EventType = "held"      // auto-restart or health restart held back by the restart budget
+	EventUnhealthy EventType = "unhealthy" // failed its health check too often
+	EventKill      EventType = "kill"
+	EventForget    EventType = "forget" // record dropped by ForgetProcess, the process may still run
+	EventError     EventType = "error"
+)
+
+// Event is an entry of the manager's in-memory event log
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"type"`
+	UUID    string    `json:"uuid,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Message string    `json:"message"`
+
+	// Set on restart and reload events: why the process is restarted, e.g.
+	// "exit code 1", "file change" or "health check failed: ...", and for
+	// auto-restarts how long until the next attempt
+	Reason string        `json:"reason,omitempty"`
+	Delay  time.Duration `json:"delay,omitempty"`
+}
+
+// WatchConfig configures restarting a process when watched files change
+type WatchConfig struct {
+	Paths    []string      // files or directories to watch
+	Interval time.Duration // polling interval, defaults to 500ms
+	Debounce time.Duration // quiet period before reloading, defaults to 300ms
+}
+
+// ProcessSpec describes a process that should be running, see
+// ProcessManager.Reconcile
+type ProcessSpec struct {
+	ID      string            `json:"id"` // stable identifier matching the spec to its process
+	Name    string            `json:"name"`
+	Args    []string          `json:"args,omitempty"`
+	Restart bool              `json:"restart"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// ReconcileResult reports what a reconcile did, by spec ID. Reasons explains
+// each entry, including why a failed action failed.
+type ReconcileResult struct {
+	Started   []string          `json:"started"`
+	Stopped   []string          `json:"stopped"`
+	Restarted []string          `json:"restarted"`
+	Unchanged []string          `json:"unchanged"`
+	Failed    []string          `json:"failed"`
+	Reasons   map[string]string `json:"reasons"`
+}
+
+// String returns a one-line summary suitable for an audit log
+func (r ReconcileResult) String() string {
+	return fmt.Sprintf("reconcile: started=%v stopped=%v restarted=%v unchanged=%v failed=%v",
+		r.Started, r.Stopped, r.Restarted, r.Unchanged, r.Failed)
+}
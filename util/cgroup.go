@@ -0,0 +1,97 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultCgroupRoot is where the cgroup filesystem is normally mounted
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// cgroupUnlimited is the threshold above which a cgroup v1 memory limit is
+// treated as unlimited (the kernel reports a page-aligned 2^63-1)
+const cgroupUnlimited = 1 << 62
+
+// CgroupLimits describes the resource limits of the current cgroup
+type CgroupLimits struct {
+	MemoryLimit uint64  // bytes, 0 when unlimited
+	MemoryUsage uint64  // bytes currently charged to the cgroup
+	CPULimit    float64 // number of CPUs, 0 when unlimited
+}
+
+// ReadCgroupLimits reads cgroup v2 or v1 limits from the cgroup filesystem
+// mounted at root
+func ReadCgroupLimits(root string) (CgroupLimits, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return readCgroupV2Limits(root)
+	}
+	if _, err := os.Stat(filepath.Join(root, "memory")); err == nil {
+		return readCgroupV1Limits(root)
+	}
+	return CgroupLimits{}, fmt.Errorf("no cgroup filesystem found at %s", root)
+}
+
+// readCgroupV2Limits reads memory.max, memory.current and cpu.max
+func readCgroupV2Limits(root string) (CgroupLimits, error) {
+	var limits CgroupLimits
+
+	if value, err := readCgroupFile(root, "memory.max"); err == nil && value != "max" {
+		limits.MemoryLimit, _ = strconv.ParseUint(value, 10, 64)
+	}
+	if value, err := readCgroupFile(root, "memory.current"); err == nil {
+		limits.MemoryUsage, _ = strconv.ParseUint(value, 10, 64)
+	}
+
+	// cpu.max的格式为"$MAX $PERIOD"，MAX为max表示不限制
+	if value, err := readCgroupFile(root, "cpu.max"); err == nil {
+		fields := strings.Fields(value)
+		if len(fields) == 2 && fields[0] != "max" {
+			quota, err1 := strconv.ParseFloat(fields[0], 64)
+			period, err2 := strconv.ParseFloat(fields[1], 64)
+			if err1 == nil && err2 == nil && period > 0 {
+				limits.CPULimit = quota / period
+			}
+		}
+	}
+
+	return limits, nil
+}
+
+// readCgroupV1Limits reads the memory and cpu controller limits
+func readCgroupV1Limits(root string) (CgroupLimits, error) {
+	var limits CgroupLimits
+
+	if value, err := readCgroupFile(root, "memory/memory.limit_in_bytes"); err == nil {
+		if limit, err := strconv.ParseUint(value, 10, 64); err == nil && limit < cgroupUnlimited {
+			limits.MemoryLimit = limit
+		}
+	}
+	if value, err := readCgroupFile(root, "memory/memory.usage_in_bytes"); err == nil {
+		limits.MemoryUsage, _ = strconv.ParseUint(value, 10, 64)
+	}
+
+	// cfs_quota_us为-1表示不限制
+	quotaValue, err1 := readCgroupFile(root, "cpu/cpu.cfs_quota_us")
+	periodValue, err2 := readCgroupFile(root, "cpu/cpu.cfs_period_us")
+	if err1 == nil && err2 == nil {
+		quota, err1 := strconv.ParseFloat(quotaValue, 64)
+		period, err2 := strconv.ParseFloat(periodValue, 64)
+		if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+			limits.CPULimit = quota / period
+		}
+	}
+
+	return limits, nil
+}
+
+// readCgroupFile reads a single-value cgroup file
+func readCgroupFile(root, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,134 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Default paths of the kernel's cumulative counters on Linux
+const (
+	DefaultNetDevPath    = "/proc/net/dev"
+	DefaultDiskstatsPath = "/proc/diskstats"
+	DefaultProcStatPath  = "/proc/stat"
+)
+
+// NetCounters are the bytes received and sent since boot over all interfaces
+// except loopback
+type NetCounters struct {
+	RxBytes uint64
+	TxBytes uint64
+}
+
+// ReadNetDev sums the byte counters of a file in the /proc/net/dev format
+func ReadNetDev(path string) (NetCounters, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return NetCounters{}, err
+	}
+	defer file.Close()
+
+	var counters NetCounters
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		// receive: bytes packets errs drop fifo frame compressed multicast, then transmit
+		fields := strings.Fields(rest)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, err1 := strconv.ParseUint(fields[0], 10, 64)
+		tx, err2 := strconv.ParseUint(fields[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		counters.RxBytes += rx
+		counters.TxBytes += tx
+	}
+	if err := scanner.Err(); err != nil {
+		return NetCounters{}, err
+	}
+	return counters, nil
+}
+
+// DiskCounters are the reads and writes completed since boot
+type DiskCounters struct {
+	Reads  uint64
+	Writes uint64
+}
+
+// ReadDiskstats sums the completed reads and writes of a file in the
+// /proc/diskstats format. Partitions are skipped so that their I/O is not
+// counted twice, as are loop and RAM devices.
+func ReadDiskstats(path string) (DiskCounters, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return DiskCounters{}, err
+	}
+	defer file.Close()
+
+	var counters DiskCounters
+	var disks []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// major minor name reads merged sectors ms writes ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		name := fields[2]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || isPartition(name, disks) {
+			continue
+		}
+		disks = append(disks, name)
+
+		reads, err1 := strconv.ParseUint(fields[3], 10, 64)
+		writes, err2 := strconv.ParseUint(fields[7], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		counters.Reads += reads
+		counters.Writes += writes
+	}
+	if err := scanner.Err(); err != nil {
+		return DiskCounters{}, err
+	}
+	return counters, nil
+}
+
+// isPartition reports whether name is a partition of one of the disks listed
+// before it, such as sda1 of sda or nvme0n1p1 of nvme0n1
+func isPartition(name string, disks []string) bool {
+	for _, disk := range disks {
+		if suffix, ok := strings.CutPrefix(name, disk); ok && suffix != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadContextSwitches reads the number of context switches since boot from
+// a file in the /proc/stat format
+func ReadContextSwitches(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "ctxt "); ok {
+			return strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no ctxt line in %s", path)
+}
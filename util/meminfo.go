@@ -0,0 +1,75 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultMeminfoPath is the kernel's memory statistics file
+const DefaultMeminfoPath = "/proc/meminfo"
+
+// MemInfo is the system memory reported by /proc/meminfo, in bytes
+type MemInfo struct {
+	Total     uint64
+	Available uint64
+}
+
+// ReadMeminfo reads total and available memory from a meminfo file. Kernels
+// before 3.14 do not report MemAvailable; available memory is then
+// approximated as MemFree + Buffers + Cached.
+func ReadMeminfo(path string) (MemInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return MemInfo{}, err
+	}
+	defer file.Close()
+
+	var info MemInfo
+	var free, buffers, cached uint64
+	hasAvailable := false
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		value *= 1024 // values are in kB
+
+		switch fields[0] {
+		case "MemTotal:":
+			info.Total = value
+		case "MemAvailable:":
+			info.Available = value
+			hasAvailable = true
+		case "MemFree:":
+			free = value
+		case "Buffers:":
+			buffers = value
+		case "Cached:":
+			cached = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return MemInfo{}, err
+	}
+
+	if info.Total == 0 {
+		return MemInfo{}, fmt.Errorf("no MemTotal in %s", path)
+	}
+	if !hasAvailable {
+		info.Available = free + buffers + cached
+	}
+	if info.Available > info.Total {
+		info.Available = info.Total
+	}
+	return info, nil
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultMountsPath lists the mounted filesystems on Linux
+const DefaultMountsPath = "/proc/mounts"
+
+// DefaultExcludedFSTypes are pseudo, in-memory and overlay filesystem types
+// that do not represent real storage
+var DefaultExcludedFSTypes = []string{
+	"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs", "debugfs",
+	"devpts", "devtmpfs", "efivarfs", "fusectl", "hugetlbfs", "mqueue", "nsfs",
+	"overlay", "proc", "pstore", "ramfs", "rpc_pipefs", "securityfs", "squashfs",
+	"sysfs", "tmpfs", "tracefs",
+}
+
+// Mount is one entry of a mounts file
+type Mount struct {
+	Device     string
+	MountPoint string
+	FSType     string
+}
+
+// ReadMounts reads a mounts file in the /proc/mounts format, skipping
+// filesystems whose type is in exclude
+func ReadMounts(path string, exclude []string) ([]Mount, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	excluded := make(map[string]bool, len(exclude))
+	for _, fstype := range exclude {
+		excluded[fstype] = true
+	}
+
+	var mounts []Mount
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || excluded[fields[2]] {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			Device:     unescapeMountField(fields[0]),
+			MountPoint: unescapeMountField(fields[1]),
+			FSType:     fields[2],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// unescapeMountField decodes the octal escapes (e.g. \040 for a space) the
+// kernel uses for whitespace and backslashes in mount fields
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
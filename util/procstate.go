@@ -0,0 +1,27 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// IsZombie reports whether a process has exited but not been reaped by its
+// parent yet, which kill(pid, 0) and the existence of /proc/<pid> do not
+// tell apart from a live process. It reads the state from /proc/<pid>/stat
+// and returns false where that file is unavailable.
+func IsZombie(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+
+	// The command name may contain spaces and parentheses, the state follows
+	// the last closing parenthesis
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 || i+2 >= len(data) {
+		return false
+	}
+	state := data[i+2]
+	return state == 'Z' || state == 'X'
+}
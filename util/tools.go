@@ -0,0 +1,57 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// toolCheckTimeout bounds each trial run of a tool
+const toolCheckTimeout = 10 * time.Second
+
+// Tool is an external program a backend shells out to
+type Tool struct {
+	Name    string   // program looked up in PATH
+	Args    []string // arguments of a harmless invocation that must succeed, nil to only look the program up
+	Purpose string   // what the program is needed for, used in diagnostics
+}
+
+// CheckTools verifies that every tool is in PATH and, when it has Args, that
+// running it succeeds. It returns one error per missing or broken tool.
+func CheckTools(tools []Tool) []error {
+	var errs []error
+	for _, tool := range tools {
+		if err := checkTool(tool); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// checkTool checks a single tool
+func checkTool(tool Tool) error {
+	path, err := exec.LookPath(tool.Name)
+	if err != nil {
+		return fmt.Errorf("%s, needed for %s, was not found: %v", tool.Name, tool.Purpose, err)
+	}
+	if tool.Args == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolCheckTimeout)
+	defer cancel()
+
+	if output, err := exec.CommandContext(ctx, path, tool.Args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s, needed for %s, does not work: %v: %s", tool.Name, tool.Purpose, err, truncate(output, 200))
+	}
+	return nil
+}
+
+// truncate shortens output for an error message
+func truncate(output []byte, n int) string {
+	if len(output) > n {
+		return string(output[:n]) + "..."
+	}
+	return string(output)
+}